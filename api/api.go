@@ -4,6 +4,10 @@ import (
     "context"
     "encoding/json"
     "errors"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
+    "github.com/aleph-zero/flutterdb/engine/parser"
     "github.com/aleph-zero/flutterdb/service/cluster"
     "github.com/aleph-zero/flutterdb/service/identity"
     "github.com/aleph-zero/flutterdb/service/index"
@@ -12,7 +16,9 @@ import (
     "github.com/aleph-zero/flutterdb/service/query"
     "github.com/go-chi/chi/v5"
     "github.com/go-chi/render"
+    "io"
     "net/http"
+    "strconv"
 )
 
 /* *** Identity API *** */
@@ -39,6 +45,15 @@ func NewIdentityHandler(svc identity.Service) IdentityHandler {
 
 /* *** Query API *** */
 
+// SessionHeader identifies the client session that statements prepared with PREPARE belong to.
+// The server generates the id when a PREPARE opens a session and returns it in this header of the
+// response; requests send it back to reach the statements of the session.
+const SessionHeader = "X-Session-Id"
+
+// ParallelismHeader sets the number of goroutines the scans of a statement read the search index
+// on, overriding the parallelism the server was started with. The query service caps the value.
+const ParallelismHeader = "X-Parallelism"
+
 type QueryHandler struct {
     service query.Service
 }
@@ -48,18 +63,178 @@ func NewQueryHandler(svc query.Service) QueryHandler {
 }
 
 func (h *QueryHandler) Query(w http.ResponseWriter, r *http.Request) {
+    ctx, err := queryContext(r)
+    if err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+
     q := r.URL.Query().Get("q")
-    result, err := h.service.Execute(r.Context(), q)
+    result, err := h.service.Execute(ctx, q)
     if err != nil {
-        w.WriteHeader(http.StatusInternalServerError)
+        if Diagnostics(err) != nil {
+            render.Render(w, r, ErrInvalidRequest(err))
+            return
+        }
+        render.Render(w, r, ErrQueryFailed(err, ErrInternalServerError))
         return
     }
 
     response := &QueryResponse{result}
+    setSession(w, result.Session)
+    render.Status(r, http.StatusOK)
+    render.Render(w, r, response)
+}
+
+// QueryWithParameters executes a statement whose placeholders are bound to the typed parameters
+// in the request body, e.g. {"statement": "SELECT a FROM t WHERE b = $1",
+// "parameters": [{"kind": "int64", "value": 5}]}.
+func (h *QueryHandler) QueryWithParameters(w http.ResponseWriter, r *http.Request) {
+    ctx, err := queryContext(r)
+    if err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+
+    data := &QueryRequest{}
+    if err := render.Bind(r, data); err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+
+    result, err := h.service.Execute(ctx, data.Statement, data.Parameters...)
+    if err != nil {
+        render.Render(w, r, ErrQueryFailed(err, ErrInvalidRequest))
+        return
+    }
+
+    setSession(w, result.Session)
+    render.Status(r, http.StatusOK)
+    render.Render(w, r, &QueryResponse{result})
+}
+
+// Script executes the semicolon-separated statements in the request body in order. The on_error
+// query parameter chooses whether execution stops at the first failing statement ("stop", the
+// default) or carries on with the rest ("continue").
+func (h *QueryHandler) Script(w http.ResponseWriter, r *http.Request) {
+    var continueOnError bool
+    switch onError := r.URL.Query().Get("on_error"); onError {
+    case "", "stop":
+    case "continue":
+        continueOnError = true
+    default:
+        render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid on_error value '%s', expected 'stop' or 'continue'", onError)))
+        return
+    }
+
+    ctx, err := queryContext(r)
+    if err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+
+    script, err := io.ReadAll(r.Body)
+    if err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+
+    results, err := h.service.ExecuteScript(ctx, string(script), continueOnError)
+    if err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+
+    response := &ScriptResponse{Results: make([]*StatementResponse, len(results))}
+    for i, result := range results {
+        response.Results[i] = &StatementResponse{Statement: result.Statement, QueryResult: result.Result}
+        if result.Result != nil {
+            setSession(w, result.Result.Session)
+        }
+        if result.Err != nil {
+            response.Results[i].Error = result.Err.Error()
+            response.Results[i].Diagnostics = Diagnostics(result.Err)
+        }
+    }
     render.Status(r, http.StatusOK)
     render.Render(w, r, response)
 }
 
+// Format prints the statements of the script in the request body back as canonical SQL, with
+// each clause on its own line when pretty=true.
+func (h *QueryHandler) Format(w http.ResponseWriter, r *http.Request) {
+    pretty := false
+    if value := r.URL.Query().Get("pretty"); value != "" {
+        var err error
+        if pretty, err = strconv.ParseBool(value); err != nil {
+            render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid pretty value '%s'", value)))
+            return
+        }
+    }
+
+    script, err := io.ReadAll(r.Body)
+    if err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+
+    formatted, err := parser.Format(string(script), pretty)
+    if err != nil {
+        render.Render(w, r, ErrInvalidRequest(err))
+        return
+    }
+    render.Status(r, http.StatusOK)
+    render.Render(w, r, &FormatResponse{SQL: formatted})
+}
+
+// Statistics returns the execution statistics of the statements run so far, aggregated by
+// fingerprint, the most expensive first.
+func (h *QueryHandler) Statistics(w http.ResponseWriter, r *http.Request) {
+    render.Status(r, http.StatusOK)
+    render.Render(w, r, &StatisticsResponse{Statements: h.service.Statistics()})
+}
+
+func (h *QueryHandler) ResetStatistics(w http.ResponseWriter, r *http.Request) {
+    h.service.ResetStatistics()
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// queryContext returns the context of a request, carrying the session and the parallelism the
+// request asks for in its headers.
+func queryContext(r *http.Request) (context.Context, error) {
+    ctx := r.Context()
+    if id := r.Header.Get(SessionHeader); id != "" {
+        ctx = query.WithSession(ctx, id)
+    }
+    if value := r.Header.Get(ParallelismHeader); value != "" {
+        workers, err := strconv.Atoi(value)
+        if err != nil || workers < 1 {
+            return nil, fmt.Errorf("invalid %s value '%s', expected a positive integer", ParallelismHeader, value)
+        }
+        ctx = query.WithParallelism(ctx, workers)
+    }
+    return ctx, nil
+}
+
+// setSession returns the id of the session a statement opened to the client.
+func setSession(w http.ResponseWriter, id string) {
+    if id != "" {
+        w.Header().Set(SessionHeader, id)
+    }
+}
+
+type QueryRequest struct {
+    Statement  string         `json:"statement"`
+    Parameters []engine.Value `json:"parameters,omitempty"`
+}
+
+func (q *QueryRequest) Bind(r *http.Request) error {
+    if q.Statement == "" {
+        return errors.New("missing required statement")
+    }
+    return nil
+}
+
 type QueryResponse struct {
     *query.QueryResult
 }
@@ -68,6 +243,37 @@ func (q *QueryResponse) Render(w http.ResponseWriter, r *http.Request) error {
     return nil
 }
 
+type ScriptResponse struct {
+    Results []*StatementResponse `json:"results"`
+}
+
+type StatementResponse struct {
+    Statement string `json:"statement"`
+    *query.QueryResult
+    Error       string                   `json:"error,omitempty"`
+    Diagnostics []*diagnostic.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+func (s *ScriptResponse) Render(w http.ResponseWriter, r *http.Request) error {
+    return nil
+}
+
+type FormatResponse struct {
+    SQL string `json:"sql"`
+}
+
+func (f *FormatResponse) Render(w http.ResponseWriter, r *http.Request) error {
+    return nil
+}
+
+type StatisticsResponse struct {
+    Statements []*query.StatementStatistics `json:"statements"`
+}
+
+func (s *StatisticsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+    return nil
+}
+
 /* *** Indexer API *** */
 
 type IndexerHandler struct {
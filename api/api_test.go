@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/aleph-zero/flutterdb/engine/diagnostic"
 	"github.com/aleph-zero/flutterdb/engine/types"
+	"github.com/aleph-zero/flutterdb/service/index"
 	"github.com/aleph-zero/flutterdb/service/metastore"
+	"github.com/aleph-zero/flutterdb/service/query"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/stretchr/testify/require"
@@ -54,6 +57,251 @@ func TestMetastoreHandler_Create(t *testing.T) {
 	require.Equal(t, http.StatusCreated, res.StatusCode)
 }
 
+func TestQueryHandler_QueryWithParameters(t *testing.T) {
+	server := httptest.NewServer(initializeTestRouter())
+	defer server.Close()
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"parameters": [{"kind": "int64", "value": 5}]}`, http.StatusBadRequest},
+		{`{"statement": "SELECT a FROM t WHERE a = $1", "parameters": [{"kind": "int128", "value": 5}]}`, http.StatusBadRequest},
+		{`{"statement": "SELECT a FROM t WHERE a = $1", "parameters": [{"kind": "int64", "value": "five"}]}`, http.StatusBadRequest},
+		{`{"statement": "EXECUTE q", "parameters": [{"kind": "int64", "value": 5}]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/sql", server.URL), bytes.NewReader([]byte(tt.body)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(SessionHeader, "session-1")
+
+			res, err := server.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+}
+
+func TestQueryHandler_Session(t *testing.T) {
+	server := httptest.NewServer(initializeTestRouter())
+	defer server.Close()
+
+	script := `CREATE TABLE a (c1 KEYWORD); PREPARE q AS SELECT c1 FROM a WHERE c1 = $1`
+	res, err := server.Client().Post(fmt.Sprintf("%s/sql/script", server.URL), "text/plain", bytes.NewReader([]byte(script)))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	session := res.Header.Get(SessionHeader)
+	require.NotEmpty(t, session)
+
+	deallocate := func(session string) int {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/sql", server.URL), bytes.NewReader([]byte(`{"statement": "DEALLOCATE q"}`)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SessionHeader, session)
+		res, err := server.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// only the session the server handed out reaches the statement
+	require.Equal(t, http.StatusBadRequest, deallocate("session-1"))
+	require.Equal(t, http.StatusOK, deallocate(session))
+}
+
+func TestQueryHandler_Script(t *testing.T) {
+	script := `CREATE TABLE a (c1 KEYWORD); CREATE TABLE a (c1 KEYWORD); CREATE TABLE b (c1 TEXT);`
+
+	tests := []struct {
+		onError  string
+		script   string
+		status   int
+		expected []string
+	}{
+		{"stop", script, http.StatusOK, []string{"", "already exists"}},
+		{"continue", script, http.StatusOK, []string{"", "already exists", ""}},
+		{"ignore", script, http.StatusBadRequest, nil},
+		{"", `CREATE TABLE c (c1 KEYWORD); CREATE`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.onError, func(t *testing.T) {
+			server := httptest.NewServer(initializeTestRouter())
+			defer server.Close()
+
+			url := fmt.Sprintf("%s/sql/script", server.URL)
+			if tt.onError != "" {
+				url += "?on_error=" + tt.onError
+			}
+			res, err := server.Client().Post(url, "text/plain", bytes.NewReader([]byte(tt.script)))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tt.status, res.StatusCode)
+			if tt.expected == nil {
+				return
+			}
+
+			var response ScriptResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+			require.Len(t, response.Results, len(tt.expected))
+			for i, result := range response.Results {
+				if tt.expected[i] == "" {
+					require.Empty(t, result.Error)
+				} else {
+					require.Contains(t, result.Error, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Diagnostics(t *testing.T) {
+	server := httptest.NewServer(initializeTestRouter())
+	defer server.Close()
+
+	tests := []struct {
+		path  string
+		body  string
+		codes []diagnostic.Code
+	}{
+		{"/sql", `{"statement": "SELEC a FROM t"}`, []diagnostic.Code{diagnostic.SyntaxError}},
+		{"/sql", `{"statement": "SELECT a FROM t"}`, []diagnostic.Code{diagnostic.UnknownTable}},
+		{"/sql/script", "SELEC a FROM t;\nSELECT a FRM t;", []diagnostic.Code{diagnostic.SyntaxError, diagnostic.SyntaxError}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			res, err := server.Client().Post(server.URL+tt.path, "application/json", bytes.NewReader([]byte(tt.body)))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+			var response ErrResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+			require.Len(t, response.Diagnostics, len(tt.codes))
+			for i, d := range response.Diagnostics {
+				require.Equal(t, tt.codes[i], d.Code)
+				require.NotEmpty(t, d.Excerpt)
+			}
+		})
+	}
+}
+
+func TestQueryHandler_ExecutionError(t *testing.T) {
+	server := httptest.NewServer(initializeTestRouter())
+	defer server.Close()
+
+	res, err := server.Client().Post(server.URL+"/sql", "application/json", bytes.NewReader([]byte(`{"statement": "SHOW TABLES"}`)))
+	require.NoError(t, err)
+	res.Body.Close()
+
+	// every row of stat_statements divides by zero once the plan executes
+	body := `{"statement": "SELECT 10 / (calls - calls) FROM stat_statements"}`
+	res, err = server.Client().Post(server.URL+"/sql", "application/json", bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var response ErrResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+	require.Equal(t, "evaluation", response.ErrorCode)
+	require.Contains(t, response.ErrorText, "division by zero")
+}
+
+func TestQueryHandler_Parallelism(t *testing.T) {
+	server := httptest.NewServer(initializeTestRouter())
+	defer server.Close()
+
+	tests := []struct {
+		parallelism string
+		status      int
+	}{
+		{"4", http.StatusOK},
+		{"1", http.StatusOK},
+		{"0", http.StatusBadRequest},
+		{"many", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parallelism, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/sql", bytes.NewReader([]byte(`{"statement": "SHOW TABLES"}`)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(ParallelismHeader, tt.parallelism)
+			res, err := server.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+}
+
+func TestQueryHandler_Format(t *testing.T) {
+	server := httptest.NewServer(initializeTestRouter())
+	defer server.Close()
+
+	tests := []struct {
+		query    string
+		script   string
+		status   int
+		expected string
+	}{
+		{"", "select a from t where a<>1; show tables", http.StatusOK, "SELECT a FROM t WHERE a != 1;\nSHOW TABLES;\n"},
+		{"?pretty=true", "select a from t where a<>1", http.StatusOK, "SELECT a\nFROM t\nWHERE a != 1;\n"},
+		{"?pretty=yes", "select a from t", http.StatusBadRequest, ""},
+		{"", "selec a from t", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query+tt.script, func(t *testing.T) {
+			res, err := server.Client().Post(server.URL+"/sql/format"+tt.query, "text/plain", bytes.NewReader([]byte(tt.script)))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tt.status, res.StatusCode)
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response FormatResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+			require.Equal(t, tt.expected, response.SQL)
+		})
+	}
+}
+
+func TestQueryHandler_Statistics(t *testing.T) {
+	server := httptest.NewServer(initializeTestRouter())
+	defer server.Close()
+
+	for _, body := range []string{`{"statement": "SHOW TABLES"}`, `{"statement": "show tables;"}`} {
+		res, err := server.Client().Post(server.URL+"/sql", "application/json", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	res, err := server.Client().Get(server.URL + "/sql/stats")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var response StatisticsResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+	require.Len(t, response.Statements, 1)
+	require.Equal(t, "SHOW TABLES", response.Statements[0].Query)
+	require.Equal(t, uint64(2), response.Statements[0].Calls)
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/sql/stats", nil)
+	require.NoError(t, err)
+	res, err = server.Client().Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+}
+
 func initializeTestRouter() chi.Router {
 	router := chi.NewRouter()
 	router.Use(render.SetContentType(render.ContentTypeJSON))
@@ -67,5 +315,12 @@ func initializeTestRouter() chi.Router {
 	handler := NewMetastoreHandler(meta)
 	router.Put("/metastore/table", handler.Create)
 
+	queryHandler := NewQueryHandler(query.NewService(meta, index.NewService(meta)))
+	router.Post("/sql", queryHandler.QueryWithParameters)
+	router.Post("/sql/script", queryHandler.Script)
+	router.Post("/sql/format", queryHandler.Format)
+	router.Get("/sql/stats", queryHandler.Statistics)
+	router.Delete("/sql/stats", queryHandler.ResetStatistics)
+
 	return router
 }
@@ -1,6 +1,10 @@
 package api
 
 import (
+    "context"
+    "errors"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
+    "github.com/aleph-zero/flutterdb/engine/physical"
     "github.com/go-chi/render"
     "net/http"
 )
@@ -11,6 +15,7 @@ func ErrInvalidRequest(err error) render.Renderer {
         HTTPStatusCode: http.StatusBadRequest,
         StatusText:     "Invalid request",
         ErrorText:      err.Error(),
+        Diagnostics:    Diagnostics(err),
     }
 }
 
@@ -23,11 +28,61 @@ func ErrInternalServerError(err error) render.Renderer {
     }
 }
 
+// ErrQueryFailed renders an error returned by executing a statement. An error raised by an
+// operator of the query plan is rendered according to its code: a record the statement cannot
+// be evaluated against is an invalid request, while failing to read the index is a server
+// error. Any other error is rendered by fallback.
+func ErrQueryFailed(err error, fallback func(error) render.Renderer) render.Renderer {
+    var operatorErr physical.Error
+    switch {
+    case errors.As(err, &operatorErr) && operatorErr.ErrorCode == physical.EvaluationError:
+        return &ErrResponse{
+            Err:            err,
+            HTTPStatusCode: http.StatusBadRequest,
+            StatusText:     "Query failed",
+            ErrorText:      err.Error(),
+            ErrorCode:      operatorErr.ErrorCode.String(),
+        }
+    case errors.As(err, &operatorErr):
+        return &ErrResponse{
+            Err:            err,
+            HTTPStatusCode: http.StatusInternalServerError,
+            StatusText:     "Query failed",
+            ErrorText:      err.Error(),
+            ErrorCode:      operatorErr.ErrorCode.String(),
+        }
+    case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+        return &ErrResponse{
+            Err:            err,
+            HTTPStatusCode: http.StatusServiceUnavailable,
+            StatusText:     "Query cancelled",
+            ErrorText:      err.Error(),
+        }
+    }
+    return fallback(err)
+}
+
 type ErrResponse struct {
-    Err            error  `json:"-"`               // low-level runtime error
-    HTTPStatusCode int    `json:"code"`            // http response status code
-    StatusText     string `json:"status"`          // user-level status message
-    ErrorText      string `json:"error,omitempty"` // application-level error message, for debugging
+    Err            error  `json:"-"`                    // low-level runtime error
+    HTTPStatusCode int    `json:"code"`                 // http response status code
+    StatusText     string `json:"status"`               // user-level status message
+    ErrorText      string `json:"error,omitempty"`      // application-level error message, for debugging
+    ErrorCode      string `json:"error_code,omitempty"` // kind of failure raised while executing a query plan
+
+    Diagnostics []*diagnostic.Diagnostic `json:"diagnostics,omitempty"` // located errors in the submitted SQL
+}
+
+// Diagnostics returns the diagnostics carried by an error, if any.
+func Diagnostics(err error) []*diagnostic.Diagnostic {
+    var list diagnostic.List
+    if errors.As(err, &list) {
+        return list
+    }
+    var d *diagnostic.Diagnostic
+    if errors.As(err, &d) {
+        return []*diagnostic.Diagnostic{d}
+    }
+    return nil
 }
 
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
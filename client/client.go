@@ -5,6 +5,7 @@ import (
     "encoding/json"
     "errors"
     "fmt"
+    "github.com/aleph-zero/flutterdb/api"
     "github.com/aleph-zero/flutterdb/engine"
     "github.com/aleph-zero/flutterdb/service/query"
     "github.com/aleph-zero/flutterdb/telemetry"
@@ -62,6 +63,7 @@ func Bootstrap(config *Config) {
     defer shutdown()
 
     endpoint := fmt.Sprintf("http://%s:%d/sql", config.RemoteAddr, config.RemotePort)
+    var session string // handed out by the server on the first PREPARE of this shell
 
     client := http.Client{
         Transport: otelhttp.NewTransport(http.DefaultTransport),
@@ -84,13 +86,15 @@ func Bootstrap(config *Config) {
         if stmt == "" {
             continue
         }
-        if err := submit(ctx, client, endpoint, stmt); err != nil {
+        if err := submit(ctx, client, endpoint, &session, stmt); err != nil {
             fmt.Printf("Error submitting statement: %s\n", err)
         }
     }
 }
 
-func submit(ctx context.Context, client http.Client, endpoint, statement string) error {
+// submit sends a statement in the given session, and adopts the session the server returns when
+// the statement opened one.
+func submit(ctx context.Context, client http.Client, endpoint string, session *string, statement string) error {
     tr := otel.Tracer(serviceName)
     traceCtx, span := tr.Start(ctx, "client.sql", trace.WithSpanKind(trace.SpanKindClient))
     defer span.End()
@@ -100,6 +104,9 @@ func submit(ctx context.Context, client http.Client, endpoint, statement string)
         return err
     }
 
+    if *session != "" {
+        req.Header.Set(api.SessionHeader, *session)
+    }
     q := req.URL.Query()
     q.Add("q", statement)
     req.URL.RawQuery = q.Encode()
@@ -110,6 +117,13 @@ func submit(ctx context.Context, client http.Client, endpoint, statement string)
     }
     defer res.Body.Close()
 
+    if res.StatusCode != http.StatusOK {
+        return renderError(res)
+    }
+    if id := res.Header.Get(api.SessionHeader); id != "" {
+        *session = id
+    }
+
     var results query.QueryResult
     err = json.NewDecoder(res.Body).Decode(&results)
     if err != nil {
@@ -117,12 +131,30 @@ func submit(ctx context.Context, client http.Client, endpoint, statement string)
     }
 
     fmt.Printf(engine.RenderASCIITable(results.Records, &engine.RenderOptions{
+        Columns:  results.Columns,
         MaxWidth: 80,
         Overflow: engine.Wrap,
     }))
     return nil
 }
 
+// renderError prints the diagnostics of a failed statement, pointing at the offending part of
+// the statement, and returns the error of the statement, so that the statement fails whether or
+// not the server had diagnostics for it.
+func renderError(res *http.Response) error {
+    var response api.ErrResponse
+    if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+        return fmt.Errorf("server responded %s", res.Status)
+    }
+    if len(response.Diagnostics) == 0 {
+        return fmt.Errorf("%s", response.ErrorText)
+    }
+    for _, d := range response.Diagnostics {
+        fmt.Print(d.Render())
+    }
+    return fmt.Errorf("%s", response.ErrorText)
+}
+
 func setupReadline() (rl *readline.Instance, err error) {
     home, err := os.UserHomeDir()
     if err != nil {
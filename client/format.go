@@ -0,0 +1,82 @@
+package client
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/api"
+    "github.com/aleph-zero/flutterdb/engine/parser"
+    "io"
+    "os"
+)
+
+type FormatConfig struct {
+    Filename string
+    Pretty   bool
+    Write    bool
+}
+
+type FormatOption func(*FormatConfig)
+
+func NewFormatConfig(options ...FormatOption) *FormatConfig {
+    cfg := &FormatConfig{}
+    for _, option := range options {
+        option(cfg)
+    }
+    return cfg
+}
+
+func WithFormatFilename(filename string) FormatOption {
+    return func(cfg *FormatConfig) {
+        cfg.Filename = filename
+    }
+}
+
+func WithPretty(pretty bool) FormatOption {
+    return func(cfg *FormatConfig) {
+        cfg.Pretty = pretty
+    }
+}
+
+func WithWrite(write bool) FormatOption {
+    return func(cfg *FormatConfig) {
+        cfg.Write = write
+    }
+}
+
+// Format prints a SQL script, read from a file or from standard input, as canonical SQL. With
+// Write set the file is rewritten in place instead. Formatting happens locally; no server is
+// needed. A script that does not parse is left untouched and its diagnostics are printed.
+func Format(config *FormatConfig) error {
+    var src []byte
+    var err error
+    name := config.Filename
+    if config.Filename == "" || config.Filename == "-" {
+        if config.Write {
+            return fmt.Errorf("cannot write formatted SQL back to standard input")
+        }
+        name = "standard input"
+        src, err = io.ReadAll(os.Stdin)
+    } else {
+        src, err = os.ReadFile(config.Filename)
+    }
+    if err != nil {
+        return err
+    }
+
+    formatted, err := parser.Format(string(src), config.Pretty)
+    if err != nil {
+        diagnostics := api.Diagnostics(err)
+        if len(diagnostics) == 0 {
+            return err
+        }
+        for _, d := range diagnostics {
+            fmt.Fprint(os.Stderr, d.Render())
+        }
+        return fmt.Errorf("%d error(s) in %s", len(diagnostics), name)
+    }
+
+    if config.Write {
+        return os.WriteFile(config.Filename, []byte(formatted), 0644)
+    }
+    _, err = fmt.Print(formatted)
+    return err
+}
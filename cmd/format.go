@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/aleph-zero/flutterdb/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+)
+
+var formatCmd = &cobra.Command{
+	Use:   "fmt [file]",
+	Short: "Format SQL",
+	Long:  "Print a SQL script, read from a file or from standard input, as canonical SQL",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var filename string
+		if len(args) > 0 {
+			filename = args[0]
+		}
+		config := client.NewFormatConfig(
+			client.WithFormatFilename(filename),
+			client.WithPretty(viper.GetBool("client.fmt.pretty")),
+			client.WithWrite(viper.GetBool("client.fmt.write")))
+		if err := client.Format(config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	clientCmd.AddCommand(formatCmd)
+	formatCmd.Flags().Bool("client.fmt.pretty", false, "Put each clause on its own line")
+	formatCmd.Flags().BoolP("client.fmt.write", "w", false, "Write the result back to the file")
+
+	viper.BindPFlag("client.fmt.pretty", formatCmd.Flags().Lookup("client.fmt.pretty"))
+	viper.BindPFlag("client.fmt.write", formatCmd.Flags().Lookup("client.fmt.write"))
+}
@@ -23,7 +23,8 @@ var serverCmd = &cobra.Command{
                 server.WithMembershipListenPort(viper.GetUint16("cluster.membership-listen-port")),
                 server.WithMembershipJoinAddrs(viper.GetStringSlice("cluster.membership-join-addrs")))),
             server.WithMetastoreConfig(metastore.NewConfig(
-                metastore.WithDirectory(viper.GetString("metastore.data-dir")))))
+                metastore.WithDirectory(viper.GetString("metastore.data-dir")))),
+            server.WithParallelism(viper.GetInt("query.parallelism")))
         server.Bootstrap(config)
     },
 }
@@ -34,6 +35,7 @@ const (
     membershipListenAddr = "127.0.0.1"
     membershipListenPort = 5678
     metastoreDataDir     = ".metastore"
+    queryParallelism     = 1
 )
 
 func init() {
@@ -53,6 +55,7 @@ func init() {
     serverCmd.PersistentFlags().Uint16("cluster.membership-listen-port", membershipListenPort, "Cluster membership port")
     serverCmd.PersistentFlags().StringSlice("cluster.membership-join-addrs", nil, "Join existing cluster at these addresses")
     serverCmd.PersistentFlags().String("metastore.data-dir", metastoreDataDir, "Data directory for metastore")
+    serverCmd.PersistentFlags().Int("query.parallelism", queryParallelism, "Goroutines a scan reads the search index on")
 
     viper.BindPFlag("server.addr", serverCmd.PersistentFlags().Lookup("server.addr"))
     viper.BindPFlag("server.port", serverCmd.PersistentFlags().Lookup("server.port"))
@@ -61,6 +64,7 @@ func init() {
     viper.BindPFlag("cluster.membership-listen-port", serverCmd.PersistentFlags().Lookup("cluster.membership-listen-port"))
     viper.BindPFlag("cluster.membership-join-addrs", serverCmd.PersistentFlags().Lookup("cluster.membership-join-addrs"))
     viper.BindPFlag("metastore.data-dir", serverCmd.PersistentFlags().Lookup("metastore.data-dir"))
+    viper.BindPFlag("query.parallelism", serverCmd.PersistentFlags().Lookup("query.parallelism"))
 
     // Cobra supports local flags which will only run when this command is called directly, e.g.:
     // serverCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -1,11 +1,13 @@
 package ast
 
 import (
-    "fmt"
     "github.com/aleph-zero/flutterdb/engine/token"
     "github.com/aleph-zero/flutterdb/engine/types"
     "github.com/aleph-zero/flutterdb/service/metastore"
     "strconv"
+    "strings"
+    "text/scanner"
+    "time"
 )
 
 type VisitableNode interface {
@@ -20,13 +22,54 @@ type ExpressionNode interface {
 
 func IsLiteralNode(n ExpressionNode) bool {
     switch n.(type) {
-    case *IntegerLiteralNode, *FloatLiteralNode, *StringLiteralNode:
+    case *IntegerLiteralNode, *FloatLiteralNode, *StringLiteralNode, *BooleanLiteralNode, *TimestampLiteralNode,
+        *IntervalLiteralNode:
         return true
     default:
         return false
     }
 }
 
+// TypeOf returns the result type of an expression. Literals and resolved columns carry their
+// type; operators and function calls carry the type inferred by the type checker. It returns
+// false if the type is not known, e.g. for an unbound parameter.
+func TypeOf(n ExpressionNode) (types.Type, bool) {
+    var resolved *types.Type
+    switch v := n.(type) {
+    case *IntegerLiteralNode:
+        return types.INTEGER, true
+    case *FloatLiteralNode:
+        return types.FLOAT, true
+    case *StringLiteralNode:
+        return types.KEYWORD, true
+    case *BooleanLiteralNode:
+        return types.BOOLEAN, true
+    case *TimestampLiteralNode:
+        return types.DATETIME, true
+    case *IntervalLiteralNode:
+        return types.INTERVAL, true
+    case *ColumnIdentifierNode:
+        if v.ResolvedColumnSymbol == nil {
+            return 0, false
+        }
+        return v.ResolvedColumnSymbol.ColumnType, true
+    case *ParenthesizedExpressionNode:
+        resolved = v.ResolvedType
+    case *LogicalNegationNode:
+        resolved = v.ResolvedType
+    case *UnaryExpressionNode:
+        resolved = v.ResolvedType
+    case *BinaryExpressionNode:
+        resolved = v.ResolvedType
+    case *FunctionCallNode:
+        resolved = v.ResolvedType
+    }
+    if resolved == nil {
+        return 0, false
+    }
+    return *resolved, true
+}
+
 type NumericNode interface {
     ExpressionNode
     CanInt() bool
@@ -39,6 +82,7 @@ type SelectStatementNode struct {
     Expressions []ExpressionNode
     Table       *TableIdentifierNode
     Predicate   *PredicateNode
+    OrderBy     *OrderByNode
     Limit       *LimitNode
 }
 
@@ -53,6 +97,7 @@ func (n *SelectStatementNode) Accept(visitor Visitor) error {
 type TableIdentifierNode struct {
     Value               string
     ResolvedTableSymbol *metastore.TableScopeSymbolTableEntry
+    Position            scanner.Position // where the identifier appears in the statement, if parsed
 }
 
 func NewTableIdentifierNode(value string) *TableIdentifierNode {
@@ -69,13 +114,17 @@ func (n *TableIdentifierNode) Accept(visitor Visitor) error {
 type ColumnIdentifierNode struct {
     Value                string
     ResolvedColumnSymbol *metastore.ColumnScopeSymbolTableEntry
+    Position             scanner.Position // where the identifier appears in the statement, if parsed
 }
 
 func NewColumnIdentifierNode(value string) *ColumnIdentifierNode {
     return &ColumnIdentifierNode{Value: value}
 }
 
-func (n *ColumnIdentifierNode) Expression()    {}
+func (n *ColumnIdentifierNode) Expression() {}
+
+// String returns the column name, which is how the column is known in records. Print renders it
+// as SQL, quoted where necessary.
 func (n *ColumnIdentifierNode) String() string { return n.Value }
 
 func (n *ColumnIdentifierNode) Accept(visitor Visitor) error {
@@ -110,6 +159,75 @@ func (n *ShowTablesStatementNode) Accept(visitor Visitor) error {
     return visitor.VisitShowTablesStatementNode(n)
 }
 
+type ExplainFormat int
+
+const (
+    ExplainFormatText ExplainFormat = iota
+    ExplainFormatJSON
+)
+
+type ExplainStatementNode struct {
+    Statement VisitableNode
+    Analyze   bool
+    Format    ExplainFormat
+}
+
+func NewExplainStatementNode(statement VisitableNode, analyze bool, format ExplainFormat) *ExplainStatementNode {
+    return &ExplainStatementNode{
+        Statement: statement,
+        Analyze:   analyze,
+        Format:    format,
+    }
+}
+
+func (n *ExplainStatementNode) Accept(visitor Visitor) error {
+    return visitor.VisitExplainStatementNode(n)
+}
+
+type PrepareStatementNode struct {
+    Name      string
+    Statement VisitableNode
+}
+
+func NewPrepareStatementNode(name string, statement VisitableNode) *PrepareStatementNode {
+    return &PrepareStatementNode{
+        Name:      strings.ToLower(name),
+        Statement: statement,
+    }
+}
+
+func (n *PrepareStatementNode) Accept(visitor Visitor) error {
+    return visitor.VisitPrepareStatementNode(n)
+}
+
+type ExecuteStatementNode struct {
+    Name      string
+    Arguments []ExpressionNode
+}
+
+func NewExecuteStatementNode(name string, arguments []ExpressionNode) *ExecuteStatementNode {
+    return &ExecuteStatementNode{
+        Name:      strings.ToLower(name),
+        Arguments: arguments,
+    }
+}
+
+func (n *ExecuteStatementNode) Accept(visitor Visitor) error {
+    return visitor.VisitExecuteStatementNode(n)
+}
+
+type DeallocateStatementNode struct {
+    Name string
+}
+
+func NewDeallocateStatementNode(name string) *DeallocateStatementNode {
+    return &DeallocateStatementNode{Name: strings.ToLower(name)}
+}
+
+func (n *DeallocateStatementNode) Accept(visitor Visitor) error {
+    return visitor.VisitDeallocateStatementNode(n)
+}
+
 type CreateTableStatementNode struct {
     Table             string
     ColumnDefinitions []VisitableNode
@@ -145,7 +263,8 @@ func (n *ColumnDefinitionNode) Accept(visitor Visitor) error {
 }
 
 type ParenthesizedExpressionNode struct {
-    Node ExpressionNode
+    Node         ExpressionNode
+    ResolvedType *types.Type
 }
 
 func NewParenthesizedExpressionNode(node ExpressionNode) *ParenthesizedExpressionNode {
@@ -153,15 +272,16 @@ func NewParenthesizedExpressionNode(node ExpressionNode) *ParenthesizedExpressio
 }
 
 func (n *ParenthesizedExpressionNode) Expression()    {}
-func (n *ParenthesizedExpressionNode) String() string { return fmt.Sprintf("(%s)", n.Node.String()) }
+func (n *ParenthesizedExpressionNode) String() string { return Print(n) }
 
 func (n *ParenthesizedExpressionNode) Accept(visitor Visitor) error {
     return visitor.VisitParenthesizedExpression(n)
 }
 
 type LogicalNegationNode struct {
-    Op   token.Token
-    Node ExpressionNode
+    Op           token.Token
+    Node         ExpressionNode
+    ResolvedType *types.Type
 }
 
 func NewLogicalNegationNode(op token.Token, node ExpressionNode) *LogicalNegationNode {
@@ -171,18 +291,17 @@ func NewLogicalNegationNode(op token.Token, node ExpressionNode) *LogicalNegatio
     }
 }
 
-func (n *LogicalNegationNode) Expression() {}
-func (n *LogicalNegationNode) String() string {
-    return fmt.Sprintf("%s %s", n.Op.TokenType.String(), n.Node.String())
-}
+func (n *LogicalNegationNode) Expression()    {}
+func (n *LogicalNegationNode) String() string { return Print(n) }
 
 func (n *LogicalNegationNode) Accept(visitor Visitor) error {
     return visitor.VisitLogicalNegationNode(n)
 }
 
 type UnaryExpressionNode struct {
-    Op   token.Token
-    Node ExpressionNode
+    Op           token.Token
+    Node         ExpressionNode
+    ResolvedType *types.Type
 }
 
 func NewUnaryExpressionNode(op token.Token, node ExpressionNode) *UnaryExpressionNode {
@@ -192,19 +311,18 @@ func NewUnaryExpressionNode(op token.Token, node ExpressionNode) *UnaryExpressio
     }
 }
 
-func (n *UnaryExpressionNode) Expression() {}
-func (n *UnaryExpressionNode) String() string {
-    return fmt.Sprintf("%s %s", n.Op.TokenType.String(), n.Node.String())
-}
+func (n *UnaryExpressionNode) Expression()    {}
+func (n *UnaryExpressionNode) String() string { return Print(n) }
 
 func (n *UnaryExpressionNode) Accept(visitor Visitor) error {
     return visitor.VisitUnaryExpressionNode(n)
 }
 
 type BinaryExpressionNode struct {
-    Op    token.Token
-    Left  ExpressionNode
-    Right ExpressionNode
+    Op           token.Token
+    Left         ExpressionNode
+    Right        ExpressionNode
+    ResolvedType *types.Type
 }
 
 func NewBinaryExpressionNode(op token.Token, left, right ExpressionNode) *BinaryExpressionNode {
@@ -215,10 +333,8 @@ func NewBinaryExpressionNode(op token.Token, left, right ExpressionNode) *Binary
     }
 }
 
-func (n *BinaryExpressionNode) Expression() {}
-func (n *BinaryExpressionNode) String() string {
-    return fmt.Sprintf("%s %s %s", n.Left, n.Op.TokenType.String(), n.Right)
-}
+func (n *BinaryExpressionNode) Expression()    {}
+func (n *BinaryExpressionNode) String() string { return Print(n) }
 
 func (n *BinaryExpressionNode) Accept(visitor Visitor) error {
     return visitor.VisitBinaryExpressionNode(n)
@@ -237,7 +353,7 @@ func (n *StringLiteralNode) Accept(visitor Visitor) error {
 }
 
 func (n *StringLiteralNode) Expression()    {}
-func (n *StringLiteralNode) String() string { return n.Value }
+func (n *StringLiteralNode) String() string { return Print(n) }
 func (n *StringLiteralNode) CanInt() bool {
     if n.CanFloat() {
         return false
@@ -297,12 +413,79 @@ func (n *FloatLiteralNode) Accept(visitor Visitor) error {
 }
 
 func (n *FloatLiteralNode) Expression()        {}
-func (n *FloatLiteralNode) String() string     { return strconv.FormatFloat(n.Value, 'g', -1, 64) }
+func (n *FloatLiteralNode) String() string     { return Print(n) }
 func (n *FloatLiteralNode) CanInt() bool       { return false } // avoid lossy truncation
 func (n *FloatLiteralNode) CanFloat() bool     { return true }
 func (n *FloatLiteralNode) ToInt64() int64     { panic("attempt to convert float to int") }
 func (n *FloatLiteralNode) ToFloat64() float64 { return n.Value }
 
+type BooleanLiteralNode struct {
+    Value bool
+}
+
+func NewBooleanLiteralNode(value bool) *BooleanLiteralNode {
+    return &BooleanLiteralNode{Value: value}
+}
+
+func (n *BooleanLiteralNode) Accept(visitor Visitor) error {
+    return visitor.VisitBooleanLiteralNode(n)
+}
+
+func (n *BooleanLiteralNode) Expression()    {}
+func (n *BooleanLiteralNode) String() string { return Print(n) }
+
+type TimestampLiteralNode struct {
+    Value time.Time
+    Date  bool // written as a DATE literal
+}
+
+func NewTimestampLiteralNode(value time.Time) *TimestampLiteralNode {
+    return &TimestampLiteralNode{Value: value}
+}
+
+func NewDateLiteralNode(value time.Time) *TimestampLiteralNode {
+    return &TimestampLiteralNode{Value: value, Date: true}
+}
+
+func (n *TimestampLiteralNode) Accept(visitor Visitor) error {
+    return visitor.VisitTimestampLiteralNode(n)
+}
+
+func (n *TimestampLiteralNode) Expression()    {}
+func (n *TimestampLiteralNode) String() string { return Print(n) }
+
+type IntervalLiteralNode struct {
+    Value types.Interval
+}
+
+func NewIntervalLiteralNode(value types.Interval) *IntervalLiteralNode {
+    return &IntervalLiteralNode{Value: value}
+}
+
+func (n *IntervalLiteralNode) Accept(visitor Visitor) error {
+    return visitor.VisitIntervalLiteralNode(n)
+}
+
+func (n *IntervalLiteralNode) Expression()    {}
+func (n *IntervalLiteralNode) String() string { return Print(n) }
+
+// PlaceholderNode stands for the Index-th (1-based) parameter of a prepared statement until the
+// parameters are bound.
+type PlaceholderNode struct {
+    Index int
+}
+
+func NewPlaceholderNode(index int) *PlaceholderNode {
+    return &PlaceholderNode{Index: index}
+}
+
+func (n *PlaceholderNode) Accept(visitor Visitor) error {
+    return visitor.VisitPlaceholderNode(n)
+}
+
+func (n *PlaceholderNode) Expression()    {}
+func (n *PlaceholderNode) String() string { return "$" + strconv.Itoa(n.Index) }
+
 type AsteriskLiteralNode struct{}
 
 func NewAsteriskLiteralNode() *AsteriskLiteralNode {
@@ -316,6 +499,47 @@ func (n *AsteriskLiteralNode) Accept(visitor Visitor) error {
     return visitor.VisitAsteriskLiteralNode(n)
 }
 
+type FunctionCallNode struct {
+    Name         string
+    Arguments    []ExpressionNode
+    Position     scanner.Position // where the function name appears in the statement, if parsed
+    ResolvedType *types.Type
+}
+
+func NewFunctionCallNode(name string, arguments []ExpressionNode) *FunctionCallNode {
+    return &FunctionCallNode{
+        Name:      strings.ToUpper(name),
+        Arguments: arguments,
+    }
+}
+
+func (n *FunctionCallNode) Expression()    {}
+func (n *FunctionCallNode) String() string { return Print(n) }
+
+func (n *FunctionCallNode) Accept(visitor Visitor) error {
+    return visitor.VisitFunctionCallNode(n)
+}
+
+type OrderingTerm struct {
+    Node       ExpressionNode
+    Descending bool
+}
+
+type OrderByNode struct {
+    Terms []OrderingTerm
+}
+
+func NewOrderByNode(terms []OrderingTerm) *OrderByNode {
+    return &OrderByNode{Terms: terms}
+}
+
+func (n *OrderByNode) Accept(visitor Visitor) error {
+    if n != nil {
+        return visitor.VisitOrderByNode(n)
+    }
+    return nil
+}
+
 type LimitNode struct {
     Limit IntegerLiteralNode
 }
@@ -0,0 +1,342 @@
+package ast
+
+import (
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
+)
+
+const (
+    FunctionMatch        = "MATCH"
+    FunctionMatchPhrase  = "MATCH_PHRASE"
+    FunctionMatchQuery   = "MATCH_QUERY"
+    FunctionHighlight    = "HIGHLIGHT"
+    FunctionGeoDistance  = "GEO_DISTANCE"
+    FunctionGeoWithinBox = "GEO_WITHIN_BOX"
+    FunctionNow          = "NOW"
+    FunctionDateTrunc    = "DATE_TRUNC"
+    FunctionExtract      = "EXTRACT"
+    FunctionCount        = "COUNT"
+    FunctionMin          = "MIN"
+    FunctionMax          = "MAX"
+)
+
+// ScoreColumn is the pseudo-column holding the relevance score of a search hit.
+const ScoreColumn = "_score"
+
+type FunctionSignature struct {
+    Name      string
+    MinArgs   int
+    MaxArgs   int
+    Search    bool // search predicates are answered by the search index, never row by row
+    Aggregate bool // aggregate functions are computed over every record of the relation
+}
+
+var functions = map[string]FunctionSignature{
+    FunctionMatch:        {Name: FunctionMatch, MinArgs: 2, MaxArgs: 2, Search: true},
+    FunctionMatchPhrase:  {Name: FunctionMatchPhrase, MinArgs: 2, MaxArgs: 2, Search: true},
+    FunctionMatchQuery:   {Name: FunctionMatchQuery, MinArgs: 2, MaxArgs: 2, Search: true},
+    FunctionHighlight:    {Name: FunctionHighlight, MinArgs: 1, MaxArgs: 1},
+    FunctionGeoDistance:  {Name: FunctionGeoDistance, MinArgs: 3, MaxArgs: 3},
+    FunctionGeoWithinBox: {Name: FunctionGeoWithinBox, MinArgs: 5, MaxArgs: 5, Search: true},
+    FunctionNow:          {Name: FunctionNow, MinArgs: 0, MaxArgs: 0},
+    FunctionDateTrunc:    {Name: FunctionDateTrunc, MinArgs: 2, MaxArgs: 2},
+    FunctionExtract:      {Name: FunctionExtract, MinArgs: 2, MaxArgs: 2},
+    FunctionCount:        {Name: FunctionCount, MinArgs: 1, MaxArgs: 1, Aggregate: true},
+    FunctionMin:          {Name: FunctionMin, MinArgs: 1, MaxArgs: 1, Aggregate: true},
+    FunctionMax:          {Name: FunctionMax, MinArgs: 1, MaxArgs: 1, Aggregate: true},
+}
+
+func LookupFunction(name string) (FunctionSignature, bool) {
+    signature, ok := functions[name]
+    return signature, ok
+}
+
+// FunctionNames returns the names of the supported functions.
+func FunctionNames() []string {
+    names := make([]string, 0, len(functions))
+    for name := range functions {
+        names = append(names, name)
+    }
+    return names
+}
+
+// HighlightColumn returns the name of the column holding the highlighted fragments of a field.
+func HighlightColumn(field string) string {
+    return NewFunctionCallNode(FunctionHighlight, []ExpressionNode{NewColumnIdentifierNode(field)}).String()
+}
+
+// Highlights returns the fields named by the HIGHLIGHT calls in a select list.
+func Highlights(expressions []ExpressionNode) []string {
+    var fields []string
+    for _, expression := range expressions {
+        fn, ok := expression.(*FunctionCallNode)
+        if !ok || fn.Name != FunctionHighlight || len(fn.Arguments) != 1 {
+            continue
+        }
+        if column, ok := fn.Arguments[0].(*ColumnIdentifierNode); ok {
+            fields = append(fields, column.Value)
+        }
+    }
+    return fields
+}
+
+// IsAggregate reports whether the expression is a call of an aggregate function.
+func IsAggregate(n ExpressionNode) bool {
+    fn, ok := n.(*FunctionCallNode)
+    if !ok {
+        return false
+    }
+    signature, ok := LookupFunction(fn.Name)
+    return ok && signature.Aggregate
+}
+
+// Aggregates returns the calls of aggregate functions in a select list, or nil if it has none.
+func Aggregates(expressions []ExpressionNode) []*FunctionCallNode {
+    var aggregates []*FunctionCallNode
+    for _, expression := range expressions {
+        if IsAggregate(expression) {
+            aggregates = append(aggregates, expression.(*FunctionCallNode))
+        }
+    }
+    return aggregates
+}
+
+// Columns returns the names of the columns an expression reads, in the order they appear.
+func Columns(n ExpressionNode) []string {
+    switch v := n.(type) {
+    case *ColumnIdentifierNode:
+        return []string{v.Value}
+    case *ParenthesizedExpressionNode:
+        return Columns(v.Node)
+    case *LogicalNegationNode:
+        return Columns(v.Node)
+    case *UnaryExpressionNode:
+        return Columns(v.Node)
+    case *BinaryExpressionNode:
+        return append(Columns(v.Left), Columns(v.Right)...)
+    case *FunctionCallNode:
+        var columns []string
+        for _, argument := range v.Arguments {
+            columns = append(columns, Columns(argument)...)
+        }
+        return columns
+    default:
+        return nil
+    }
+}
+
+// IsGeoDistancePredicate reports whether the expression compares GEO_DISTANCE against a
+// literal distance, e.g. GEO_DISTANCE(c, 40.7, -74.0) < '10km'.
+func IsGeoDistancePredicate(n ExpressionNode) bool {
+    b, ok := n.(*BinaryExpressionNode)
+    if !ok {
+        return false
+    }
+    switch b.Op.TokenType {
+    case token.LT, token.LTE, token.GT, token.GTE:
+    default:
+        return false
+    }
+    fn, ok := b.Left.(*FunctionCallNode)
+    return ok && fn.Name == FunctionGeoDistance && IsLiteralNode(b.Right)
+}
+
+// IsDateRangePredicate reports whether the expression compares a DATETIME column against a
+// timestamp, e.g. c > TIMESTAMP '2024-01-01 00:00:00'. The timestamp may also be written as a
+// string in one of the layouts accepted by TIMESTAMP literals.
+func IsDateRangePredicate(n ExpressionNode) bool {
+    _, _, _, ok := DateRange(n)
+    return ok
+}
+
+// DateRange decomposes a date range predicate into its column, operator and timestamp, with the
+// operator flipped if necessary so that it reads as 'column op timestamp'.
+func DateRange(n ExpressionNode) (*ColumnIdentifierNode, token.TokenType, *TimestampLiteralNode, bool) {
+    c, op, value, ok := columnComparison(n)
+    if !ok || c.ResolvedColumnSymbol.ColumnType != types.DATETIME {
+        return nil, 0, nil, false
+    }
+    switch v := value.(type) {
+    case *TimestampLiteralNode:
+        return c, op, v, true
+    case *StringLiteralNode:
+        t, err := types.ParseTimestamp(v.Value)
+        if err != nil {
+            return nil, 0, nil, false
+        }
+        return c, op, NewTimestampLiteralNode(t), true
+    default:
+        return nil, 0, nil, false
+    }
+}
+
+// IsTermRangePredicate reports whether the expression compares a KEYWORD column against a
+// non-empty string, or an INTEGER or FLOAT column against a number, e.g. author = 'Leo Tolstoy' or
+// population >= 1000000. The search index answers these with term and numeric range queries.
+// Either may also be compared against a placeholder, which is bound before the index is searched.
+func IsTermRangePredicate(n ExpressionNode) bool {
+    _, _, _, ok := TermRange(n)
+    return ok
+}
+
+// TermRange decomposes a term range predicate into its column, operator and literal, with the
+// operator flipped if necessary so that it reads as 'column op literal'.
+func TermRange(n ExpressionNode) (*ColumnIdentifierNode, token.TokenType, ExpressionNode, bool) {
+    c, op, value, ok := columnComparison(n)
+    if !ok {
+        return nil, 0, nil, false
+    }
+    switch v := value.(type) {
+    case *StringLiteralNode:
+        // the search index takes an empty string for an open end of a range
+        ok = c.ResolvedColumnSymbol.ColumnType == types.KEYWORD && v.Value != ""
+    case *IntegerLiteralNode, *FloatLiteralNode:
+        ok = c.ResolvedColumnSymbol.ColumnType.IsNumeric()
+    case *PlaceholderNode:
+        ok = c.ResolvedColumnSymbol.ColumnType == types.KEYWORD || c.ResolvedColumnSymbol.ColumnType.IsNumeric()
+    default:
+        ok = false
+    }
+    if !ok {
+        return nil, 0, nil, false
+    }
+    return c, op, value, true
+}
+
+// columnComparison decomposes an equality or ordering comparison of a resolved column against
+// another expression, flipping the operator if the column is on the right.
+func columnComparison(n ExpressionNode) (*ColumnIdentifierNode, token.TokenType, ExpressionNode, bool) {
+    b, ok := n.(*BinaryExpressionNode)
+    if !ok {
+        return nil, 0, nil, false
+    }
+
+    op := b.Op.TokenType
+    switch op {
+    case token.EQUAL, token.LT, token.LTE, token.GT, token.GTE:
+    default:
+        return nil, 0, nil, false
+    }
+
+    column, value := b.Left, b.Right
+    if _, ok := column.(*ColumnIdentifierNode); !ok {
+        column, value = value, column
+        switch op {
+        case token.LT:
+            op = token.GT
+        case token.LTE:
+            op = token.GTE
+        case token.GT:
+            op = token.LT
+        case token.GTE:
+            op = token.LTE
+        }
+    }
+
+    c, ok := column.(*ColumnIdentifierNode)
+    if !ok || c.ResolvedColumnSymbol == nil {
+        return nil, 0, nil, false
+    }
+    return c, op, value, true
+}
+
+// IsSearchPredicate reports whether the expression consists solely of search predicates
+// combined with AND, OR and NOT, and can therefore be answered entirely by the search index.
+func IsSearchPredicate(n ExpressionNode) bool {
+    switch v := n.(type) {
+    case *FunctionCallNode:
+        signature, ok := LookupFunction(v.Name)
+        return ok && signature.Search
+    case *ParenthesizedExpressionNode:
+        return IsSearchPredicate(v.Node)
+    case *LogicalNegationNode:
+        return IsSearchPredicate(v.Node)
+    case *BinaryExpressionNode:
+        if IsGeoDistancePredicate(v) || IsDateRangePredicate(v) {
+            return true
+        }
+        if v.Op.TokenType != token.AND && v.Op.TokenType != token.OR {
+            return false
+        }
+        return IsSearchPredicate(v.Left) && IsSearchPredicate(v.Right)
+    default:
+        return false
+    }
+}
+
+// IsSargable reports whether the expression consists solely of search predicates and term range
+// predicates combined with AND, OR and NOT, and can therefore be answered by the search index
+// instead of being evaluated row by row.
+func IsSargable(n ExpressionNode) bool {
+    switch v := n.(type) {
+    case *ParenthesizedExpressionNode:
+        return IsSargable(v.Node)
+    case *LogicalNegationNode:
+        return IsSargable(v.Node)
+    case *BinaryExpressionNode:
+        if IsTermRangePredicate(v) || IsSearchPredicate(v) {
+            return true
+        }
+        if v.Op.TokenType != token.AND && v.Op.TokenType != token.OR {
+            return false
+        }
+        return IsSargable(v.Left) && IsSargable(v.Right)
+    default:
+        return IsSearchPredicate(n)
+    }
+}
+
+// ContainsSearchPredicate reports whether a search predicate that cannot be evaluated row by row
+// appears anywhere in the expression. Date range predicates can be evaluated either way.
+func ContainsSearchPredicate(n ExpressionNode) bool {
+    switch v := n.(type) {
+    case *FunctionCallNode:
+        if signature, ok := LookupFunction(v.Name); ok && signature.Search {
+            return true
+        }
+        for _, argument := range v.Arguments {
+            if ContainsSearchPredicate(argument) {
+                return true
+            }
+        }
+        return false
+    case *ParenthesizedExpressionNode:
+        return ContainsSearchPredicate(v.Node)
+    case *LogicalNegationNode:
+        return ContainsSearchPredicate(v.Node)
+    case *UnaryExpressionNode:
+        return ContainsSearchPredicate(v.Node)
+    case *BinaryExpressionNode:
+        return IsGeoDistancePredicate(v) || ContainsSearchPredicate(v.Left) || ContainsSearchPredicate(v.Right)
+    default:
+        return false
+    }
+}
+
+// Conjuncts splits an expression on its top-level AND operators.
+func Conjuncts(n ExpressionNode) []ExpressionNode {
+    switch v := n.(type) {
+    case *BinaryExpressionNode:
+        if v.Op.TokenType == token.AND {
+            return append(Conjuncts(v.Left), Conjuncts(v.Right)...)
+        }
+    case *ParenthesizedExpressionNode:
+        if b, ok := v.Node.(*BinaryExpressionNode); ok && b.Op.TokenType == token.AND {
+            return Conjuncts(b)
+        }
+    }
+    return []ExpressionNode{n}
+}
+
+// Conjunction joins expressions with AND. It returns nil for an empty list.
+func Conjunction(nodes []ExpressionNode) ExpressionNode {
+    var expr ExpressionNode
+    for _, node := range nodes {
+        if expr == nil {
+            expr = node
+            continue
+        }
+        expr = NewBinaryExpressionNode(token.Token{TokenType: token.AND, Lexeme: "AND"}, expr, node)
+    }
+    return expr
+}
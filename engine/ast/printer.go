@@ -0,0 +1,418 @@
+package ast
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "math"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+)
+
+// Print renders a node as canonical SQL on a single line: keywords in upper case, identifiers
+// quoted only where they have to be, and parentheses only where the source had them or the
+// precedence of the operators requires them. Parsing the printed SQL yields the same tree.
+func Print(node VisitableNode) string {
+    p := &printer{}
+    _ = node.Accept(p)
+    return p.sb.String()
+}
+
+// PrettyPrint renders a node as canonical SQL in the same way as Print, but starts each clause
+// of a statement on a new line and each column definition of CREATE TABLE on its own line.
+func PrettyPrint(node VisitableNode) string {
+    p := &printer{pretty: true}
+    _ = node.Accept(p)
+    return p.sb.String()
+}
+
+// PrintNormalized renders a node as Print does, but with every literal and placeholder replaced
+// by a placeholder numbered in order of appearance, so that statements differing only in their
+// literals print the same. A negated number counts as one literal. The field of EXTRACT and the
+// count of LIMIT are part of the shape of a statement and are kept.
+func PrintNormalized(node VisitableNode) string {
+    p := &printer{normalize: true}
+    _ = node.Accept(p)
+    return p.sb.String()
+}
+
+// Operator precedence, from the loosest to the tightest binding, following the grammar.
+const (
+    precedenceOr = iota + 1
+    precedenceAnd
+    precedenceNot
+    precedenceEquality
+    precedenceComparison
+    precedenceTerm
+    precedenceFactor
+    precedenceUnary
+    precedencePrimary
+)
+
+var operators = map[token.TokenType]struct {
+    symbol     string
+    precedence int
+}{
+    token.OR:        {"OR", precedenceOr},
+    token.AND:       {"AND", precedenceAnd},
+    token.EQUAL:     {"=", precedenceEquality},
+    token.NOT_EQUAL: {"!=", precedenceEquality},
+    token.LIKE:      {"LIKE", precedenceEquality},
+    token.GT:        {">", precedenceComparison},
+    token.GTE:       {">=", precedenceComparison},
+    token.LT:        {"<", precedenceComparison},
+    token.LTE:       {"<=", precedenceComparison},
+    token.PLUS:      {"+", precedenceTerm},
+    token.MINUS:     {"-", precedenceTerm},
+    token.ASTERISK:  {"*", precedenceFactor},
+    token.DIVIDE:    {"/", precedenceFactor},
+    token.MODULO:    {"%", precedenceFactor},
+}
+
+func precedence(node ExpressionNode) int {
+    switch n := node.(type) {
+    case *BinaryExpressionNode:
+        return operators[n.Op.TokenType].precedence
+    case *LogicalNegationNode:
+        return precedenceNot
+    case *UnaryExpressionNode:
+        return precedenceUnary
+    case *IntegerLiteralNode:
+        if n.Value < 0 {
+            return precedenceUnary
+        }
+    case *FloatLiteralNode:
+        if math.Signbit(n.Value) {
+            return precedenceUnary
+        }
+    }
+    return precedencePrimary
+}
+
+type printer struct {
+    sb        strings.Builder
+    pretty    bool
+    normalize bool // print literals as placeholders
+    literals  int  // number of literals replaced so far
+}
+
+// literal prints a literal, or the next placeholder in its stead when normalizing.
+func (p *printer) literal(format string, args ...any) {
+    if p.normalize {
+        p.literals++
+        p.write("$%d", p.literals)
+        return
+    }
+    p.write(format, args...)
+}
+
+func (p *printer) write(format string, args ...any) {
+    fmt.Fprintf(&p.sb, format, args...)
+}
+
+// clause starts a clause of a statement: on a new line when pretty printing.
+func (p *printer) clause(keyword string) {
+    if p.pretty {
+        p.sb.WriteString("\n")
+    } else {
+        p.sb.WriteString(" ")
+    }
+    p.sb.WriteString(keyword)
+}
+
+// operand prints an expression that is an operand of an operator of the given precedence,
+// parenthesized when it binds more loosely than the operator.
+func (p *printer) operand(node ExpressionNode, minimum int) error {
+    if precedence(node) < minimum {
+        p.sb.WriteString("(")
+        defer p.sb.WriteString(")")
+    }
+    return node.Accept(p)
+}
+
+func (p *printer) list(nodes []ExpressionNode) error {
+    for i, node := range nodes {
+        if i > 0 {
+            p.sb.WriteString(", ")
+        }
+        if err := node.Accept(p); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (p *printer) VisitSelectStatementNode(node *SelectStatementNode) error {
+    p.sb.WriteString("SELECT ")
+    if err := p.list(node.Expressions); err != nil {
+        return err
+    }
+    if node.Table != nil {
+        p.clause("FROM ")
+        if err := node.Table.Accept(p); err != nil {
+            return err
+        }
+    }
+    if err := node.Predicate.Accept(p); err != nil {
+        return err
+    }
+    if err := node.OrderBy.Accept(p); err != nil {
+        return err
+    }
+    if node.Limit != nil {
+        return node.Limit.Accept(p)
+    }
+    return nil
+}
+
+func (p *printer) VisitPredicateNode(node *PredicateNode) error {
+    p.clause("WHERE ")
+    return node.Node.Accept(p)
+}
+
+func (p *printer) VisitCreateTableStatementNode(node *CreateTableStatementNode) error {
+    p.write("CREATE TABLE %s (", QuoteIdentifier(node.Table))
+    for i, cd := range node.ColumnDefinitions {
+        switch {
+        case p.pretty:
+            p.sb.WriteString("\n    ")
+        case i > 0:
+            p.sb.WriteString(" ")
+        }
+        if err := cd.Accept(p); err != nil {
+            return err
+        }
+        if i < len(node.ColumnDefinitions)-1 {
+            p.sb.WriteString(",")
+        }
+    }
+    if p.pretty {
+        p.sb.WriteString("\n")
+    }
+    p.sb.WriteString(")")
+    if node.Partition != "" {
+        p.write(" PARTITION BY %s", QuoteIdentifier(node.Partition))
+    }
+    return nil
+}
+
+func (p *printer) VisitColumnDefinitionNode(node *ColumnDefinitionNode) error {
+    p.write("%s %s", QuoteIdentifier(node.Value), node.Type)
+    return nil
+}
+
+func (p *printer) VisitShowTablesStatementNode(*ShowTablesStatementNode) error {
+    p.sb.WriteString("SHOW TABLES")
+    return nil
+}
+
+func (p *printer) VisitExplainStatementNode(node *ExplainStatementNode) error {
+    p.sb.WriteString("EXPLAIN ")
+    if node.Analyze {
+        p.sb.WriteString("ANALYZE ")
+    }
+    if node.Format == ExplainFormatJSON {
+        p.sb.WriteString("FORMAT JSON ")
+    }
+    return node.Statement.Accept(p)
+}
+
+func (p *printer) VisitPrepareStatementNode(node *PrepareStatementNode) error {
+    p.write("PREPARE %s AS ", QuoteIdentifier(node.Name))
+    return node.Statement.Accept(p)
+}
+
+func (p *printer) VisitExecuteStatementNode(node *ExecuteStatementNode) error {
+    p.write("EXECUTE %s", QuoteIdentifier(node.Name))
+    if len(node.Arguments) == 0 {
+        return nil
+    }
+    p.sb.WriteString("(")
+    if err := p.list(node.Arguments); err != nil {
+        return err
+    }
+    p.sb.WriteString(")")
+    return nil
+}
+
+func (p *printer) VisitDeallocateStatementNode(node *DeallocateStatementNode) error {
+    p.write("DEALLOCATE %s", QuoteIdentifier(node.Name))
+    return nil
+}
+
+func (p *printer) VisitTableIdentifierNode(node *TableIdentifierNode) error {
+    p.sb.WriteString(QuoteIdentifier(node.Value))
+    return nil
+}
+
+func (p *printer) VisitColumnIdentifierNode(node *ColumnIdentifierNode) error {
+    p.sb.WriteString(QuoteIdentifier(node.Value))
+    return nil
+}
+
+func (p *printer) VisitParenthesizedExpression(node *ParenthesizedExpressionNode) error {
+    p.sb.WriteString("(")
+    if err := node.Node.Accept(p); err != nil {
+        return err
+    }
+    p.sb.WriteString(")")
+    return nil
+}
+
+func (p *printer) VisitLogicalNegationNode(node *LogicalNegationNode) error {
+    p.sb.WriteString("NOT ")
+    return p.operand(node.Node, precedenceNot)
+}
+
+func (p *printer) VisitUnaryExpressionNode(node *UnaryExpressionNode) error {
+    switch node.Node.(type) {
+    case *IntegerLiteralNode, *FloatLiteralNode:
+        if p.normalize {
+            p.literal("")
+            return nil
+        }
+    }
+
+    p.sb.WriteString("-")
+    // '--' would start a comment
+    if precedence(node.Node) == precedenceUnary {
+        p.sb.WriteString(" ")
+    }
+    return p.operand(node.Node, precedenceUnary)
+}
+
+// VisitBinaryExpressionNode prints the operands of a binary operator. Operators associate to the
+// left, so a right operand of the same precedence is parenthesized.
+func (p *printer) VisitBinaryExpressionNode(node *BinaryExpressionNode) error {
+    op, ok := operators[node.Op.TokenType]
+    if !ok {
+        op.symbol, op.precedence = node.Op.Lexeme, precedencePrimary
+    }
+    if err := p.operand(node.Left, op.precedence); err != nil {
+        return err
+    }
+    p.write(" %s ", op.symbol)
+    return p.operand(node.Right, op.precedence+1)
+}
+
+func (p *printer) VisitFunctionCallNode(node *FunctionCallNode) error {
+    if node.Name == FunctionExtract && len(node.Arguments) == 2 {
+        if field, ok := node.Arguments[0].(*StringLiteralNode); ok {
+            p.write("EXTRACT(%s FROM ", field.Value)
+            if err := node.Arguments[1].Accept(p); err != nil {
+                return err
+            }
+            p.sb.WriteString(")")
+            return nil
+        }
+    }
+
+    p.write("%s(", node.Name)
+    if err := p.list(node.Arguments); err != nil {
+        return err
+    }
+    p.sb.WriteString(")")
+    return nil
+}
+
+func (p *printer) VisitStringLiteralNode(node *StringLiteralNode) error {
+    p.literal("%s", QuoteString(node.Value))
+    return nil
+}
+
+func (p *printer) VisitIntegerLiteralNode(node *IntegerLiteralNode) error {
+    p.literal("%d", node.Value)
+    return nil
+}
+
+// VisitFloatLiteralNode prints a float so that it scans as a float again, e.g. 3 as 3.0.
+func (p *printer) VisitFloatLiteralNode(node *FloatLiteralNode) error {
+    s := strconv.FormatFloat(node.Value, 'g', -1, 64)
+    if !strings.ContainsAny(s, ".eIN") {
+        s += ".0"
+    }
+    p.literal("%s", s)
+    return nil
+}
+
+func (p *printer) VisitBooleanLiteralNode(node *BooleanLiteralNode) error {
+    if node.Value {
+        p.literal("TRUE")
+    } else {
+        p.literal("FALSE")
+    }
+    return nil
+}
+
+func (p *printer) VisitTimestampLiteralNode(node *TimestampLiteralNode) error {
+    if node.Date {
+        p.literal("DATE '%s'", node.Value.Format(time.DateOnly))
+    } else {
+        p.literal("TIMESTAMP '%s'", node.Value.Format(time.RFC3339Nano))
+    }
+    return nil
+}
+
+func (p *printer) VisitIntervalLiteralNode(node *IntervalLiteralNode) error {
+    p.literal("INTERVAL '%s'", node.Value)
+    return nil
+}
+
+func (p *printer) VisitAsteriskLiteralNode(*AsteriskLiteralNode) error {
+    p.sb.WriteString("*")
+    return nil
+}
+
+func (p *printer) VisitPlaceholderNode(node *PlaceholderNode) error {
+    p.literal("$%d", node.Index)
+    return nil
+}
+
+func (p *printer) VisitOrderByNode(node *OrderByNode) error {
+    p.clause("ORDER BY ")
+    for i, term := range node.Terms {
+        if i > 0 {
+            p.sb.WriteString(", ")
+        }
+        if err := term.Node.Accept(p); err != nil {
+            return err
+        }
+        if term.Descending {
+            p.sb.WriteString(" DESC")
+        }
+    }
+    return nil
+}
+
+func (p *printer) VisitLimitNode(node *LimitNode) error {
+    p.clause("LIMIT ")
+    p.sb.WriteString(strconv.FormatInt(node.Limit.Value, 10))
+    return nil
+}
+
+// QuoteIdentifier returns an identifier as it must be written in SQL: verbatim when it scans as
+// an identifier, and otherwise, as for keywords, enclosed in double quotes.
+func QuoteIdentifier(ident string) string {
+    if _, ok := token.LookupKeyword(ident); !ok && isPlainIdentifier(ident) {
+        return ident
+    }
+    return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+// QuoteString returns a string literal enclosed in single quotes, with quotes doubled.
+func QuoteString(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func isPlainIdentifier(ident string) bool {
+    if ident == "" {
+        return false
+    }
+    for i, r := range ident {
+        if !(r == '_' || unicode.IsLetter(r) || i > 0 && '0' <= r && r <= '9') {
+            return false
+        }
+    }
+    return true
+}
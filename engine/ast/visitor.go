@@ -5,6 +5,10 @@ type Visitor interface {
     VisitPredicateNode(*PredicateNode) error
     VisitCreateTableStatementNode(*CreateTableStatementNode) error
     VisitShowTablesStatementNode(*ShowTablesStatementNode) error
+    VisitExplainStatementNode(*ExplainStatementNode) error
+    VisitPrepareStatementNode(*PrepareStatementNode) error
+    VisitExecuteStatementNode(*ExecuteStatementNode) error
+    VisitDeallocateStatementNode(*DeallocateStatementNode) error
     VisitColumnDefinitionNode(*ColumnDefinitionNode) error
 
     VisitTableIdentifierNode(*TableIdentifierNode) error
@@ -14,11 +18,17 @@ type Visitor interface {
     VisitLogicalNegationNode(*LogicalNegationNode) error
     VisitUnaryExpressionNode(*UnaryExpressionNode) error
     VisitBinaryExpressionNode(*BinaryExpressionNode) error
+    VisitFunctionCallNode(*FunctionCallNode) error
 
     VisitStringLiteralNode(*StringLiteralNode) error
     VisitIntegerLiteralNode(*IntegerLiteralNode) error
     VisitFloatLiteralNode(*FloatLiteralNode) error
+    VisitBooleanLiteralNode(*BooleanLiteralNode) error
+    VisitTimestampLiteralNode(*TimestampLiteralNode) error
+    VisitIntervalLiteralNode(*IntervalLiteralNode) error
     VisitAsteriskLiteralNode(*AsteriskLiteralNode) error
+    VisitPlaceholderNode(*PlaceholderNode) error
 
+    VisitOrderByNode(*OrderByNode) error
     VisitLimitNode(*LimitNode) error
 }
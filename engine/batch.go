@@ -0,0 +1,155 @@
+package engine
+
+import "sort"
+
+// Schema names the columns of the records in a batch, in order. Operators carry a schema once
+// per batch rather than a column name with every value of every record.
+type Schema struct {
+    Columns []string
+    index   map[string]int
+}
+
+func NewSchema(columns []string) *Schema {
+    index := make(map[string]int, len(columns))
+    for i, column := range columns {
+        index[column] = i
+    }
+    return &Schema{Columns: columns, index: index}
+}
+
+// Index returns the position of a column in the schema.
+func (s *Schema) Index(column string) (int, bool) {
+    i, ok := s.index[column]
+    return i, ok
+}
+
+func (s *Schema) Len() int {
+    return len(s.Columns)
+}
+
+// Batch holds a run of records in column-oriented layout: Vectors[i][j] is the value of column
+// Schema.Columns[i] in the j-th record. A record without a value for a column holds an invalid
+// Value in that position. Sizes holds the bytes each record occupied in the search index, or zero
+// for records that were not read from one, and has one entry per record even when the schema has
+// no columns at all.
+type Batch struct {
+    Schema  *Schema
+    Vectors [][]Value
+    Sizes   []int
+    Error   error
+}
+
+func NewBatch(schema *Schema, capacity int) *Batch {
+    vectors := make([][]Value, schema.Len())
+    for i := range vectors {
+        vectors[i] = make([]Value, 0, capacity)
+    }
+    return &Batch{
+        Schema:  schema,
+        Vectors: vectors,
+        Sizes:   make([]int, 0, capacity),
+    }
+}
+
+// Len returns the number of records in the batch.
+func (b *Batch) Len() int {
+    return len(b.Sizes)
+}
+
+// Bytes returns the bytes the records of the batch occupied in the search index.
+func (b *Batch) Bytes() int {
+    total := 0
+    for _, size := range b.Sizes {
+        total += size
+    }
+    return total
+}
+
+// Append adds a record given as one value for every column of the schema.
+func (b *Batch) Append(values []Value, size int) {
+    for i, value := range values {
+        b.Vectors[i] = append(b.Vectors[i], value)
+    }
+    b.Sizes = append(b.Sizes, size)
+}
+
+// AppendFrom adds a record of another batch with the same schema.
+func (b *Batch) AppendFrom(from *Batch, row int) {
+    for i, vector := range from.Vectors {
+        b.Vectors[i] = append(b.Vectors[i], vector[row])
+    }
+    b.Sizes = append(b.Sizes, from.Sizes[row])
+}
+
+// Value returns the value of a column in a record of the batch, reporting false if the schema
+// has no such column or the record has no value for it.
+func (b *Batch) Value(column string, row int) (Value, bool) {
+    i, ok := b.Schema.Index(column)
+    if !ok {
+        return Value{}, false
+    }
+    value := b.Vectors[i][row]
+    return value, value.IsValid()
+}
+
+// Slice returns the records from i up to but not including j. The vectors of the slice share
+// their storage with the batch.
+func (b *Batch) Slice(i, j int) *Batch {
+    vectors := make([][]Value, len(b.Vectors))
+    for c, vector := range b.Vectors {
+        vectors[c] = vector[i:j]
+    }
+    return &Batch{Schema: b.Schema, Vectors: vectors, Sizes: b.Sizes[i:j]}
+}
+
+// Select returns a batch holding only the given records, in the given order.
+func (b *Batch) Select(rows []int) *Batch {
+    selected := NewBatch(b.Schema, len(rows))
+    for _, row := range rows {
+        selected.AppendFrom(b, row)
+    }
+    return selected
+}
+
+// Record materializes a record of the batch, leaving out the columns it has no value for.
+func (b *Batch) Record(row int) *Record {
+    record := &Record{Values: make(map[string]Value, len(b.Vectors))}
+    for i, vector := range b.Vectors {
+        if vector[row].IsValid() {
+            record.Values[b.Schema.Columns[i]] = vector[row]
+        }
+    }
+    return record
+}
+
+// NewBatches lays out records in batches of at most size records. The schema holds every column
+// that any of the records has a value for, in alphabetical order.
+func NewBatches(records []*Record, size int) []*Batch {
+    seen := make(map[string]bool)
+    columns := make([]string, 0)
+    for _, record := range records {
+        for column := range record.Values {
+            if !seen[column] {
+                seen[column] = true
+                columns = append(columns, column)
+            }
+        }
+    }
+    sort.Strings(columns)
+    schema := NewSchema(columns)
+
+    batches := make([]*Batch, 0, len(records)/size+1)
+    for start := 0; start < len(records); start += size {
+        end := min(start+size, len(records))
+        batch := NewBatch(schema, end-start)
+        for _, record := range records[start:end] {
+            values := make([]Value, len(columns))
+            for i, column := range columns {
+                values[i] = record.Values[column]
+            }
+            batch.Append(values, 0)
+        }
+        batches = append(batches, batch)
+    }
+    return batches
+}
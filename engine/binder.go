@@ -0,0 +1,320 @@
+package engine
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+)
+
+// BindParameters returns a copy of a statement in which every placeholder is replaced by the
+// corresponding parameter. Parameters must be literals, so binding can never change the shape of
+// the statement. The statement itself is left untouched, so a prepared statement may be bound any
+// number of times.
+func BindParameters(root ast.VisitableNode, parameters []ast.ExpressionNode) (ast.VisitableNode, error) {
+    count, err := ParameterCount(root)
+    if err != nil {
+        return nil, fmt.Errorf("binding parameters: %w", err)
+    }
+    if err := CheckParameters(count, parameters); err != nil {
+        return nil, err
+    }
+
+    b := newParameterBinder(parameters, true)
+    if err := root.Accept(b); err != nil {
+        return nil, fmt.Errorf("binding parameters: %w", err)
+    }
+    return b.statement, nil
+}
+
+// CheckParameters checks that parameters are literals, and exactly as many as a statement with
+// count parameters expects.
+func CheckParameters(count int, parameters []ast.ExpressionNode) error {
+    for i, parameter := range parameters {
+        if !isParameterLiteral(parameter) {
+            return fmt.Errorf("parameter $%d must be a literal, received '%s'", i+1, parameter.String())
+        }
+    }
+    if count != len(parameters) {
+        return fmt.Errorf("statement expects %d parameter(s), received %d", count, len(parameters))
+    }
+    return nil
+}
+
+// CloneStatement returns a deep copy of a statement, leaving any placeholders in place.
+func CloneStatement(root ast.VisitableNode) (ast.VisitableNode, error) {
+    b := newParameterBinder(nil, false)
+    if err := root.Accept(b); err != nil {
+        return nil, err
+    }
+    return b.statement, nil
+}
+
+// ParameterCount returns the number of parameters a statement expects, which is the highest
+// placeholder index it contains.
+func ParameterCount(root ast.VisitableNode) (int, error) {
+    b := newParameterBinder(nil, false)
+    if err := root.Accept(b); err != nil {
+        return 0, err
+    }
+    return b.count, nil
+}
+
+// ParameterLiteral converts a typed parameter value into the literal it is bound as.
+func ParameterLiteral(value Value) (ast.ExpressionNode, error) {
+    switch value.Kind() {
+    case String:
+        return ast.NewStringLiteralNode(value.MustString()), nil
+    case Int:
+        return ast.NewIntegerLiteralNode(value.MustInt()), nil
+    case Float:
+        return ast.NewFloatLiteralNode(value.MustFloat()), nil
+    case Boolean:
+        return ast.NewBooleanLiteralNode(value.MustBoolean()), nil
+    case DateTime:
+        return ast.NewTimestampLiteralNode(value.MustTime()), nil
+    case Interval:
+        interval, _ := value.IntervalVal()
+        return ast.NewIntervalLiteralNode(interval), nil
+    default:
+        return nil, fmt.Errorf("unsupported parameter kind '%s'", value.Kind())
+    }
+}
+
+func isParameterLiteral(node ast.ExpressionNode) bool {
+    if unary, ok := node.(*ast.UnaryExpressionNode); ok && unary.Op.TokenType == token.MINUS {
+        node = unary.Node
+        switch node.(type) {
+        case *ast.IntegerLiteralNode, *ast.FloatLiteralNode:
+            return true
+        default:
+            return false
+        }
+    }
+    return ast.IsLiteralNode(node)
+}
+
+/* *** Parameter Binder *** */
+
+type ParameterBinder struct {
+    parameters []ast.ExpressionNode
+    strict     bool // whether every placeholder must be bound
+    count      int  // highest placeholder index seen
+    stack      *Stack[ast.ExpressionNode]
+    statement  ast.VisitableNode
+}
+
+func newParameterBinder(parameters []ast.ExpressionNode, strict bool) *ParameterBinder {
+    return &ParameterBinder{
+        parameters: parameters,
+        strict:     strict,
+        stack:      NewStack[ast.ExpressionNode](),
+    }
+}
+
+func (b *ParameterBinder) expression(node ast.ExpressionNode) (ast.ExpressionNode, error) {
+    if err := node.Accept(b); err != nil {
+        return nil, err
+    }
+    return b.stack.MustPop(), nil
+}
+
+func (b *ParameterBinder) VisitSelectStatementNode(node *ast.SelectStatementNode) error {
+    expressions := make([]ast.ExpressionNode, len(node.Expressions))
+    for i, expression := range node.Expressions {
+        bound, err := b.expression(expression)
+        if err != nil {
+            return err
+        }
+        expressions[i] = bound
+    }
+
+    stmt := ast.NewSelectStatementNode(expressions)
+    if node.Table != nil {
+        stmt.Table = ast.NewTableIdentifierNode(node.Table.Value)
+        stmt.Table.Position = node.Table.Position
+    }
+    if node.Predicate != nil {
+        predicate, err := b.expression(node.Predicate.Node)
+        if err != nil {
+            return err
+        }
+        stmt.Predicate = ast.NewPredicateNode(predicate)
+    }
+    if node.OrderBy != nil {
+        terms := make([]ast.OrderingTerm, len(node.OrderBy.Terms))
+        for i, term := range node.OrderBy.Terms {
+            bound, err := b.expression(term.Node)
+            if err != nil {
+                return err
+            }
+            terms[i] = ast.OrderingTerm{Node: bound, Descending: term.Descending}
+        }
+        stmt.OrderBy = ast.NewOrderByNode(terms)
+    }
+    if node.Limit != nil {
+        stmt.Limit = ast.NewLimitNode(node.Limit.Limit)
+    }
+
+    b.statement = stmt
+    return nil
+}
+
+func (b *ParameterBinder) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    if err := node.Statement.Accept(b); err != nil {
+        return err
+    }
+    b.statement = ast.NewExplainStatementNode(b.statement, node.Analyze, node.Format)
+    return nil
+}
+
+func (b *ParameterBinder) VisitCreateTableStatementNode(node *ast.CreateTableStatementNode) error {
+    b.statement = node
+    return nil
+}
+
+func (b *ParameterBinder) VisitShowTablesStatementNode(node *ast.ShowTablesStatementNode) error {
+    b.statement = node
+    return nil
+}
+
+func (b *ParameterBinder) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
+
+func (b *ParameterBinder) VisitExecuteStatementNode(node *ast.ExecuteStatementNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
+
+func (b *ParameterBinder) VisitDeallocateStatementNode(node *ast.DeallocateStatementNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
+
+func (b *ParameterBinder) VisitPlaceholderNode(node *ast.PlaceholderNode) error {
+    b.count = max(b.count, node.Index)
+    if !b.strict {
+        b.stack.Push(ast.NewPlaceholderNode(node.Index))
+        return nil
+    }
+    if node.Index > len(b.parameters) {
+        return fmt.Errorf("no value for parameter '%s'", node.String())
+    }
+    b.stack.Push(b.parameters[node.Index-1])
+    return nil
+}
+
+func (b *ParameterBinder) VisitColumnIdentifierNode(node *ast.ColumnIdentifierNode) error {
+    id := ast.NewColumnIdentifierNode(node.Value)
+    id.Position = node.Position
+    b.stack.Push(id)
+    return nil
+}
+
+func (b *ParameterBinder) VisitParenthesizedExpression(node *ast.ParenthesizedExpressionNode) error {
+    inner, err := b.expression(node.Node)
+    if err != nil {
+        return err
+    }
+    b.stack.Push(ast.NewParenthesizedExpressionNode(inner))
+    return nil
+}
+
+func (b *ParameterBinder) VisitLogicalNegationNode(node *ast.LogicalNegationNode) error {
+    inner, err := b.expression(node.Node)
+    if err != nil {
+        return err
+    }
+    b.stack.Push(ast.NewLogicalNegationNode(node.Op, inner))
+    return nil
+}
+
+func (b *ParameterBinder) VisitUnaryExpressionNode(node *ast.UnaryExpressionNode) error {
+    inner, err := b.expression(node.Node)
+    if err != nil {
+        return err
+    }
+    b.stack.Push(ast.NewUnaryExpressionNode(node.Op, inner))
+    return nil
+}
+
+func (b *ParameterBinder) VisitBinaryExpressionNode(node *ast.BinaryExpressionNode) error {
+    left, err := b.expression(node.Left)
+    if err != nil {
+        return err
+    }
+    right, err := b.expression(node.Right)
+    if err != nil {
+        return err
+    }
+    b.stack.Push(ast.NewBinaryExpressionNode(node.Op, left, right))
+    return nil
+}
+
+func (b *ParameterBinder) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    arguments := make([]ast.ExpressionNode, len(node.Arguments))
+    for i, argument := range node.Arguments {
+        bound, err := b.expression(argument)
+        if err != nil {
+            return err
+        }
+        arguments[i] = bound
+    }
+    call := ast.NewFunctionCallNode(node.Name, arguments)
+    call.Position = node.Position
+    b.stack.Push(call)
+    return nil
+}
+
+func (b *ParameterBinder) VisitStringLiteralNode(node *ast.StringLiteralNode) error {
+    b.stack.Push(node)
+    return nil
+}
+
+func (b *ParameterBinder) VisitIntegerLiteralNode(node *ast.IntegerLiteralNode) error {
+    b.stack.Push(node)
+    return nil
+}
+
+func (b *ParameterBinder) VisitFloatLiteralNode(node *ast.FloatLiteralNode) error {
+    b.stack.Push(node)
+    return nil
+}
+
+func (b *ParameterBinder) VisitBooleanLiteralNode(node *ast.BooleanLiteralNode) error {
+    b.stack.Push(node)
+    return nil
+}
+
+func (b *ParameterBinder) VisitTimestampLiteralNode(node *ast.TimestampLiteralNode) error {
+    b.stack.Push(node)
+    return nil
+}
+
+func (b *ParameterBinder) VisitIntervalLiteralNode(node *ast.IntervalLiteralNode) error {
+    b.stack.Push(node)
+    return nil
+}
+
+func (b *ParameterBinder) VisitAsteriskLiteralNode(node *ast.AsteriskLiteralNode) error {
+    b.stack.Push(node)
+    return nil
+}
+
+func (b *ParameterBinder) VisitPredicateNode(node *ast.PredicateNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
+
+func (b *ParameterBinder) VisitColumnDefinitionNode(node *ast.ColumnDefinitionNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
+
+func (b *ParameterBinder) VisitTableIdentifierNode(node *ast.TableIdentifierNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
+
+func (b *ParameterBinder) VisitOrderByNode(node *ast.OrderByNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
+
+func (b *ParameterBinder) VisitLimitNode(node *ast.LimitNode) error {
+    return fmt.Errorf("cannot bind parameters of node type %T", node)
+}
@@ -0,0 +1,199 @@
+// Package diagnostic describes errors in SQL statements in terms of the source text they were
+// found in, so that clients can point at the offending token and suggest a fix.
+package diagnostic
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "text/scanner"
+    "unicode/utf8"
+)
+
+type Code string
+
+const (
+    LexicalError    Code = "LEXICAL_ERROR"
+    SyntaxError     Code = "SYNTAX_ERROR"
+    UnknownTable    Code = "UNKNOWN_TABLE"
+    UnknownColumn   Code = "UNKNOWN_COLUMN"
+    UnknownFunction Code = "UNKNOWN_FUNCTION"
+    TypeError       Code = "TYPE_ERROR"
+)
+
+// Diagnostic is an error located at a line and column of a statement. Line and column are
+// 1-based; a zero line means the position is unknown.
+type Diagnostic struct {
+    Code        Code     `json:"code"`
+    Message     string   `json:"message"`
+    Line        int      `json:"line,omitempty"`
+    Column      int      `json:"column,omitempty"`
+    Excerpt     string   `json:"excerpt,omitempty"`
+    Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func New(code Code, position scanner.Position, format string, args ...any) *Diagnostic {
+    return &Diagnostic{
+        Code:    code,
+        Message: fmt.Sprintf(format, args...),
+        Line:    position.Line,
+        Column:  position.Column,
+    }
+}
+
+// WithSuggestions adds the candidates closest to word, if any are close enough.
+func (d *Diagnostic) WithSuggestions(word string, candidates []string) *Diagnostic {
+    d.Suggestions = Suggest(word, candidates)
+    return d
+}
+
+func (d *Diagnostic) Error() string {
+    var sb strings.Builder
+    sb.WriteString(d.Message)
+    if d.Line > 0 {
+        fmt.Fprintf(&sb, " at line %d, column %d", d.Line, d.Column)
+    }
+    if len(d.Suggestions) > 0 {
+        fmt.Fprintf(&sb, "; did you mean %s?", quote(d.Suggestions))
+    }
+    return sb.String()
+}
+
+// Render formats the diagnostic for a terminal: the error, the excerpt of the source with a caret
+// under the offending position, and the suggestions.
+func (d *Diagnostic) Render() string {
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "%s: %s", d.Code, d.Message)
+    if d.Line > 0 {
+        fmt.Fprintf(&sb, " (line %d, column %d)", d.Line, d.Column)
+    }
+    sb.WriteString("\n")
+    for _, line := range strings.Split(d.Excerpt, "\n") {
+        if line != "" {
+            sb.WriteString("    " + line + "\n")
+        }
+    }
+    if len(d.Suggestions) > 0 {
+        fmt.Fprintf(&sb, "Did you mean %s?\n", quote(d.Suggestions))
+    }
+    return sb.String()
+}
+
+// List holds the diagnostics of several statements, such as those of a script.
+type List []*Diagnostic
+
+func (l List) Error() string {
+    messages := make([]string, len(l))
+    for i, d := range l {
+        messages[i] = d.Error()
+    }
+    return strings.Join(messages, "\n")
+}
+
+// WithSource fills in the excerpt of every diagnostic in err from the source text the positions
+// refer to. Other errors are returned unchanged.
+func WithSource(err error, src string) error {
+    var list List
+    if errors.As(err, &list) {
+        for _, d := range list {
+            d.Excerpt = excerpt(src, d.Line, d.Column)
+        }
+        return err
+    }
+
+    var d *Diagnostic
+    if errors.As(err, &d) {
+        d.Excerpt = excerpt(src, d.Line, d.Column)
+    }
+    return err
+}
+
+// excerpt returns the source line at the given position followed by a line with a caret under
+// the column. Tabs are kept so that the caret lines up with the source.
+func excerpt(src string, line, column int) string {
+    lines := strings.Split(src, "\n")
+    if line < 1 || line > len(lines) || column < 1 {
+        return ""
+    }
+
+    text := strings.TrimRight(lines[line-1], "\r")
+    var caret strings.Builder
+    for i, r := range text {
+        if utf8.RuneCountInString(text[:i]) >= column-1 {
+            break
+        }
+        if r == '\t' {
+            caret.WriteRune('\t')
+        } else {
+            caret.WriteRune(' ')
+        }
+    }
+    for caret.Len() < column-1 {
+        caret.WriteRune(' ')
+    }
+    return text + "\n" + caret.String() + "^"
+}
+
+// Suggest returns up to three candidates closest to word by case-insensitive edit distance. A
+// candidate is only suggested if it is within a third of the word's length, and at least one
+// edit, of it.
+func Suggest(word string, candidates []string) []string {
+    limit := max(1, min(3, utf8.RuneCountInString(word)/3))
+    best := limit + 1
+    var suggestions []string
+    seen := make(map[string]bool)
+    for _, candidate := range candidates {
+        if candidate == word || seen[candidate] {
+            continue
+        }
+        seen[candidate] = true
+
+        distance := levenshtein(strings.ToLower(word), strings.ToLower(candidate))
+        switch {
+        case distance < best:
+            best = distance
+            suggestions = []string{candidate}
+        case distance == best:
+            suggestions = append(suggestions, candidate)
+        }
+    }
+
+    sort.Strings(suggestions)
+    if len(suggestions) > 3 {
+        suggestions = suggestions[:3]
+    }
+    return suggestions
+}
+
+func levenshtein(a, b string) int {
+    s, t := []rune(a), []rune(b)
+    previous := make([]int, len(t)+1)
+    current := make([]int, len(t)+1)
+    for j := range previous {
+        previous[j] = j
+    }
+    for i := 1; i <= len(s); i++ {
+        current[0] = i
+        for j := 1; j <= len(t); j++ {
+            cost := 1
+            if s[i-1] == t[j-1] {
+                cost = 0
+            }
+            current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+        }
+        previous, current = current, previous
+    }
+    return previous[len(t)]
+}
+
+func quote(words []string) string {
+    quoted := make([]string, len(words))
+    for i, word := range words {
+        quoted[i] = "'" + word + "'"
+    }
+    if len(quoted) == 1 {
+        return quoted[0]
+    }
+    return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
@@ -0,0 +1,57 @@
+package diagnostic
+
+import (
+    "errors"
+    "fmt"
+    "github.com/stretchr/testify/require"
+    "testing"
+    "text/scanner"
+)
+
+func TestSuggest(t *testing.T) {
+    candidates := []string{"SELECT", "FROM", "FORMAT", "OR", "ORDER", "population", "city", "country"}
+
+    tests := []struct {
+        word     string
+        expected []string
+    }{
+        {"SELEC", []string{"SELECT"}},
+        {"frm", []string{"FROM"}},
+        {"populaton", []string{"population"}},
+        {"City", []string{"city"}},
+        {"city", nil},
+        {"xyz", nil},
+        {"ordr", []string{"ORDER"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.word, func(t *testing.T) {
+            require.Equal(t, tt.expected, Suggest(tt.word, candidates))
+        })
+    }
+}
+
+func TestDiagnostic_WithSource(t *testing.T) {
+    d := New(UnknownColumn, scanner.Position{Line: 2, Column: 8}, "column '%s' does not exist", "ctiy").
+        WithSuggestions("ctiy", []string{"city", "country"})
+    err := fmt.Errorf("resolving column names: %w", d)
+
+    require.Same(t, err, WithSource(err, "SELECT population\n  FROM ctiy"))
+    require.Equal(t, "  FROM ctiy\n       ^", d.Excerpt)
+    require.Equal(t, "column 'ctiy' does not exist at line 2, column 8; did you mean 'city'?", d.Error())
+    require.Equal(t, "UNKNOWN_COLUMN: column 'ctiy' does not exist (line 2, column 8)\n"+
+        "      FROM ctiy\n"+
+        "           ^\n"+
+        "Did you mean 'city'?\n", d.Render())
+
+    tabbed := New(SyntaxError, scanner.Position{Line: 1, Column: 3}, "unexpected")
+    WithSource(List{tabbed}, "\t\tx")
+    require.Equal(t, "\t\tx\n\t\t^", tabbed.Excerpt)
+
+    outside := New(SyntaxError, scanner.Position{Line: 3, Column: 1}, "unexpected")
+    WithSource(outside, "SELECT")
+    require.Empty(t, outside.Excerpt)
+
+    plain := errors.New("plain")
+    require.Same(t, plain, WithSource(plain, "SELECT"))
+}
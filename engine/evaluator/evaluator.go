@@ -23,10 +23,19 @@ func (e *Evaluator) VisitSelectStatementNode(node *ast.SelectStatementNode) erro
 func (e *Evaluator) VisitPredicateNode(*ast.PredicateNode) error                       { return nil }
 func (e *Evaluator) VisitCreateTableStatementNode(*ast.CreateTableStatementNode) error { return nil }
 func (e *Evaluator) VisitShowTablesStatementNode(*ast.ShowTablesStatementNode) error   { return nil }
+func (e *Evaluator) VisitExplainStatementNode(*ast.ExplainStatementNode) error         { return nil }
+func (e *Evaluator) VisitPrepareStatementNode(*ast.PrepareStatementNode) error         { return nil }
+func (e *Evaluator) VisitExecuteStatementNode(*ast.ExecuteStatementNode) error         { return nil }
+func (e *Evaluator) VisitDeallocateStatementNode(*ast.DeallocateStatementNode) error   { return nil }
 func (e *Evaluator) VisitColumnDefinitionNode(*ast.ColumnDefinitionNode) error         { return nil }
 func (e *Evaluator) VisitTableIdentifierNode(*ast.TableIdentifierNode) error           { return nil }
 func (e *Evaluator) VisitColumnIdentifierNode(*ast.ColumnIdentifierNode) error         { return nil }
 func (e *Evaluator) VisitLimitNode(*ast.LimitNode) error                               { return nil }
+func (e *Evaluator) VisitOrderByNode(*ast.OrderByNode) error                           { return nil }
+
+func (e *Evaluator) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    return fmt.Errorf("cannot evaluate function '%s'", node.Name)
+}
 
 func (e *Evaluator) VisitParenthesizedExpression(node *ast.ParenthesizedExpressionNode) error {
     return node.Node.Accept(e)
@@ -124,6 +133,15 @@ func (e *Evaluator) VisitFloatLiteralNode(node *ast.FloatLiteralNode) error {
     return nil
 }
 
+func (e *Evaluator) VisitBooleanLiteralNode(node *ast.BooleanLiteralNode) error {
+    if node.Value {
+        e.Result = 1
+    } else {
+        e.Result = 0
+    }
+    return nil
+}
+
 func (e *Evaluator) VisitAsteriskLiteralNode(node *ast.AsteriskLiteralNode) error { return nil }
 
 func equal(left, right float64) float64 {
@@ -167,3 +185,15 @@ func truth(b bool) float64 {
     }
     return 0.0
 }
+
+func (e *Evaluator) VisitTimestampLiteralNode(node *ast.TimestampLiteralNode) error {
+    return fmt.Errorf("cannot evaluate timestamp '%s'", node.String())
+}
+
+func (e *Evaluator) VisitIntervalLiteralNode(node *ast.IntervalLiteralNode) error {
+    return fmt.Errorf("cannot evaluate interval '%s'", node.String())
+}
+
+func (e *Evaluator) VisitPlaceholderNode(node *ast.PlaceholderNode) error {
+    return fmt.Errorf("cannot evaluate unbound parameter '%s'", node.String())
+}
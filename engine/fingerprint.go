@@ -0,0 +1,29 @@
+package engine
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "hash/fnv"
+    "strings"
+)
+
+// Fingerprint identifies the shape of a statement: statements that differ only in their literals
+// or parameters share a fingerprint. It returns the fingerprint along with the normalized text
+// it is computed from, in which every literal is replaced by a placeholder.
+func Fingerprint(root ast.VisitableNode) (string, string) {
+    normalized := ast.PrintNormalized(root)
+    return hash(normalized), normalized
+}
+
+// FingerprintText identifies a statement that could not be parsed, and so has no shape to
+// normalize, by its text with runs of whitespace collapsed into single spaces.
+func FingerprintText(text string) (string, string) {
+    normalized := strings.Join(strings.Fields(text), " ")
+    return hash(normalized), normalized
+}
+
+func hash(normalized string) string {
+    h := fnv.New64a()
+    h.Write([]byte(normalized))
+    return fmt.Sprintf("%016x", h.Sum64())
+}
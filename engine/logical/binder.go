@@ -0,0 +1,331 @@
+package logical
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "slices"
+)
+
+// BindParameters returns a copy of an optimized plan in which every placeholder is replaced by the
+// corresponding parameter, so that a prepared statement is resolved and optimized once and bound
+// on every execution. The plan itself is left untouched and may be bound concurrently.
+//
+// The bound expressions are type checked again, as the types of the parameters were unknown when
+// the plan was optimized. A comparison with a placeholder is pushed into the relation by the
+// optimizer; if the search index cannot answer it once bound, it is evaluated row by row instead.
+func BindParameters(plan *QueryPlan, parameters []ast.ExpressionNode) (*QueryPlan, error) {
+    b := &planBinder{parameters: parameters}
+    project, err := b.node(&plan.ProjectNode)
+    if err != nil {
+        return nil, err
+    }
+    return &QueryPlan{ProjectNode: *project.(*ProjectNode)}, nil
+}
+
+type planBinder struct {
+    parameters []ast.ExpressionNode
+}
+
+func (b *planBinder) node(node PlanNode) (PlanNode, error) {
+    if node == nil {
+        return nil, nil
+    }
+    child, err := b.node(node.Child())
+    if err != nil {
+        return nil, err
+    }
+
+    switch v := node.(type) {
+    case *ProjectNode:
+        projections, err := b.expressions(v.projections)
+        if err != nil {
+            return nil, err
+        }
+        return &ProjectNode{projections: projections, names: b.names(v.names, v.projections, projections), child: child}, nil
+    case *SelectNode:
+        predicate, err := b.predicate(v.Predicate)
+        if err != nil {
+            return nil, err
+        }
+        if rn, ok := child.(*RelationNode); ok {
+            predicate = unpush(rn, predicate)
+        }
+        return &SelectNode{Predicate: predicate, child: child}, nil
+    case *AggregateNode:
+        aggregates := make([]*ast.FunctionCallNode, len(v.Aggregates))
+        for i, aggregate := range v.Aggregates {
+            bound, err := b.expression(aggregate)
+            if err != nil {
+                return nil, err
+            }
+            aggregates[i] = bound.(*ast.FunctionCallNode)
+        }
+        names := make([]string, len(aggregates))
+        for i, aggregate := range aggregates {
+            names[i] = aggregate.String()
+        }
+        return &AggregateNode{Aggregates: aggregates, Names: names, child: child}, nil
+    case *LimitNode:
+        return &LimitNode{Limit: v.Limit, child: child}, nil
+    case *SortNode:
+        terms, err := b.terms(v.Terms)
+        if err != nil {
+            return nil, err
+        }
+        return &SortNode{Terms: terms, child: child}, nil
+    case *TopNNode:
+        terms, err := b.terms(v.Terms)
+        if err != nil {
+            return nil, err
+        }
+        return &TopNNode{Terms: terms, Limit: v.Limit, child: child}, nil
+    case *RelationNode:
+        predicate, err := b.predicate(v.PushedPredicate)
+        if err != nil {
+            return nil, err
+        }
+        return &RelationNode{
+            PushedPredicate: predicate,
+            Highlights:      v.Highlights,
+            Columns:         v.Columns,
+            Relation:        v.Relation,
+        }, nil
+    case *ExplainNode:
+        plan, err := BindParameters(v.Plan, b.parameters)
+        if err != nil {
+            return nil, err
+        }
+        explain := NewExplainNode(plan, v.Analyze, v.Format)
+        explain.Rules = v.Rules
+        return explain, nil
+    case *ValuesNode, *TableNode, *TablesNode:
+        return node, nil
+    default:
+        return nil, fmt.Errorf("cannot bind parameters of a %s node", node.Type())
+    }
+}
+
+// names returns the column names of bound projections. A projection that read a placeholder is
+// named after its bound expression, as if the parameter had been written in the statement.
+func (b *planBinder) names(names []string, projections, bound []ast.ExpressionNode) []string {
+    renamed := slices.Clone(names)
+    for i := range projections {
+        if projections[i] != bound[i] {
+            renamed[i] = bound[i].String()
+        }
+    }
+    return renamed
+}
+
+func (b *planBinder) predicate(predicate ast.ExpressionNode) (ast.ExpressionNode, error) {
+    if predicate == nil {
+        return nil, nil
+    }
+    bound, err := b.bind(predicate)
+    if err != nil {
+        return nil, err
+    }
+    if bound == predicate {
+        return predicate, nil
+    }
+    bound = detach(bound)
+    if err := ast.NewPredicateNode(bound).Accept(&engine.TypeChecker{}); err != nil {
+        return nil, err
+    }
+    return bound, nil
+}
+
+func (b *planBinder) terms(terms []ast.OrderingTerm) ([]ast.OrderingTerm, error) {
+    bound := make([]ast.OrderingTerm, len(terms))
+    for i, term := range terms {
+        node, err := b.expression(term.Node)
+        if err != nil {
+            return nil, err
+        }
+        bound[i] = ast.OrderingTerm{Node: node, Descending: term.Descending}
+    }
+    return bound, nil
+}
+
+func (b *planBinder) expressions(expressions []ast.ExpressionNode) ([]ast.ExpressionNode, error) {
+    bound := make([]ast.ExpressionNode, len(expressions))
+    for i, expression := range expressions {
+        var err error
+        if bound[i], err = b.expression(expression); err != nil {
+            return nil, err
+        }
+    }
+    return bound, nil
+}
+
+// expression binds the placeholders of an expression and type checks it if it had any.
+func (b *planBinder) expression(expression ast.ExpressionNode) (ast.ExpressionNode, error) {
+    bound, err := b.bind(expression)
+    if err != nil {
+        return nil, err
+    }
+    if bound != expression {
+        bound = detach(bound)
+        if err := bound.Accept(&engine.TypeChecker{}); err != nil {
+            return nil, err
+        }
+    }
+    return bound, nil
+}
+
+// detach copies the operators and function calls of a bound expression that are still shared with
+// the prepared plan, which the type checker records the inferred types in, so that executions
+// binding the same plan concurrently each annotate their own nodes. Columns and literals are not
+// annotated and stay shared.
+func detach(expression ast.ExpressionNode) ast.ExpressionNode {
+    switch v := expression.(type) {
+    case *ast.ParenthesizedExpressionNode:
+        c := *v
+        c.Node = detach(v.Node)
+        return &c
+    case *ast.LogicalNegationNode:
+        c := *v
+        c.Node = detach(v.Node)
+        return &c
+    case *ast.UnaryExpressionNode:
+        c := *v
+        c.Node = detach(v.Node)
+        return &c
+    case *ast.BinaryExpressionNode:
+        c := *v
+        c.Left, c.Right = detach(v.Left), detach(v.Right)
+        return &c
+    case *ast.FunctionCallNode:
+        c := *v
+        c.Arguments = make([]ast.ExpressionNode, len(v.Arguments))
+        for i, argument := range v.Arguments {
+            c.Arguments[i] = detach(argument)
+        }
+        return &c
+    default:
+        return expression
+    }
+}
+
+// bind returns the expression with its placeholders replaced by their parameters. The operators
+// and function calls above a placeholder are copied, keeping their resolved types for the type
+// checker to replace, and an expression without placeholders is returned as it is.
+func (b *planBinder) bind(expression ast.ExpressionNode) (ast.ExpressionNode, error) {
+    switch v := expression.(type) {
+    case *ast.PlaceholderNode:
+        if v.Index > len(b.parameters) {
+            return nil, fmt.Errorf("no value for parameter '%s'", v.String())
+        }
+        return negated(b.parameters[v.Index-1]), nil
+    case *ast.ParenthesizedExpressionNode:
+        node, err := b.bind(v.Node)
+        if err != nil || node == v.Node {
+            return v, err
+        }
+        c := *v
+        c.Node = node
+        return &c, nil
+    case *ast.LogicalNegationNode:
+        node, err := b.bind(v.Node)
+        if err != nil || node == v.Node {
+            return v, err
+        }
+        c := *v
+        c.Node = node
+        return &c, nil
+    case *ast.UnaryExpressionNode:
+        node, err := b.bind(v.Node)
+        if err != nil || node == v.Node {
+            return v, err
+        }
+        c := *v
+        c.Node = node
+        return &c, nil
+    case *ast.BinaryExpressionNode:
+        left, err := b.bind(v.Left)
+        if err != nil {
+            return nil, err
+        }
+        right, err := b.bind(v.Right)
+        if err != nil {
+            return nil, err
+        }
+        if left == v.Left && right == v.Right {
+            return v, nil
+        }
+        c := *v
+        c.Left, c.Right = left, right
+        return &c, nil
+    case *ast.FunctionCallNode:
+        arguments := make([]ast.ExpressionNode, len(v.Arguments))
+        changed := false
+        for i, argument := range v.Arguments {
+            var err error
+            if arguments[i], err = b.bind(argument); err != nil {
+                return nil, err
+            }
+            changed = changed || arguments[i] != argument
+        }
+        if !changed {
+            return v, nil
+        }
+        c := *v
+        c.Arguments = arguments
+        return &c, nil
+    default:
+        return expression, nil
+    }
+}
+
+// negated folds a negative numeric parameter, written as a minus applied to a literal, into a
+// negative literal, which the search index can compare a column with.
+func negated(parameter ast.ExpressionNode) ast.ExpressionNode {
+    unary, ok := parameter.(*ast.UnaryExpressionNode)
+    if !ok || unary.Op.TokenType != token.MINUS {
+        return parameter
+    }
+    switch v := unary.Node.(type) {
+    case *ast.IntegerLiteralNode:
+        return ast.NewIntegerLiteralNode(-v.Value)
+    case *ast.FloatLiteralNode:
+        return ast.NewFloatLiteralNode(-v.Value)
+    default:
+        return parameter
+    }
+}
+
+// unpush moves the conjuncts of the predicate pushed into a relation that the search index cannot
+// answer once bound, such as a keyword compared with an empty string, into the predicate of the
+// select node above it, and adds the columns they read to those the relation decodes.
+func unpush(rn *RelationNode, predicate ast.ExpressionNode) ast.ExpressionNode {
+    if rn.PushedPredicate == nil {
+        return predicate
+    }
+    var pushed, remaining []ast.ExpressionNode
+    for _, conjunct := range ast.Conjuncts(rn.PushedPredicate) {
+        if ast.IsSargable(conjunct) {
+            pushed = append(pushed, conjunct)
+        } else {
+            remaining = append(remaining, conjunct)
+        }
+    }
+    if len(remaining) == 0 {
+        return predicate
+    }
+
+    rn.PushedPredicate = ast.Conjunction(pushed)
+    if rn.Columns != nil {
+        columns := slices.Clone(rn.Columns)
+        for _, conjunct := range remaining {
+            columns = append(columns, ast.Columns(conjunct)...)
+        }
+        slices.Sort(columns)
+        rn.Columns = slices.Compact(columns)
+    }
+    if predicate != nil {
+        remaining = append(remaining, predicate)
+    }
+    return ast.Conjunction(remaining)
+}
@@ -0,0 +1,78 @@
+package logical
+
+import (
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/stretchr/testify/require"
+    "testing"
+)
+
+func Test_BindParameters(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    minus := token.Token{TokenType: token.MINUS, Lexeme: "-"}
+    tests := []struct {
+        stmt       string
+        parameters []ast.ExpressionNode
+        generic    []string
+        bound      []string
+    }{
+        {`SELECT c1 FROM t1 WHERE c3 > $1 AND c1 = $2`,
+            []ast.ExpressionNode{ast.NewIntegerLiteralNode(5), ast.NewStringLiteralNode("a")},
+            []string{"Project [c1]", "  Select", "    Relation t1 pushed: c3 > $1 AND c1 = $2 columns: [c1]"},
+            []string{"Project [c1]", "  Select", "    Relation t1 pushed: c3 > 5 AND c1 = 'a' columns: [c1]"}},
+        {`SELECT c1 FROM t1 WHERE c3 > $1`,
+            []ast.ExpressionNode{ast.NewUnaryExpressionNode(minus, ast.NewIntegerLiteralNode(5))},
+            []string{"Project [c1]", "  Select", "    Relation t1 pushed: c3 > $1 columns: [c1]"},
+            []string{"Project [c1]", "  Select", "    Relation t1 pushed: c3 > -5 columns: [c1]"}},
+        // the search index cannot compare a keyword with an empty string
+        {`SELECT c3 FROM t1 WHERE c1 = $1 AND c3 > 1`,
+            []ast.ExpressionNode{ast.NewStringLiteralNode("")},
+            []string{"Project [c3]", "  Select", "    Relation t1 pushed: c1 = $1 AND c3 > 1 columns: [c3]"},
+            []string{"Project [c3]", "  Select predicate: c1 = ''", "    Relation t1 pushed: c3 > 1 columns: [c1, c3]"}},
+        {`SELECT c3 * $1 FROM t1 ORDER BY c3 + $1 LIMIT 2`,
+            []ast.ExpressionNode{ast.NewIntegerLiteralNode(2)},
+            []string{"Project [c3 * $1]", "  TopN 2 [c3 + $1 ASC]", "    Select", "      Relation t1 columns: [c3]"},
+            []string{"Project [c3 * 2]", "  TopN 2 [c3 + 2 ASC]", "    Select", "      Relation t1 columns: [c3]"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            plan, err = OptimizeQueryPlan(plan)
+            require.NoError(t, err)
+
+            bound, err := BindParameters(plan, tt.parameters)
+            require.NoError(t, err)
+            lines, err := ExplainQueryPlan(bound)
+            require.NoError(t, err)
+            require.Equal(t, tt.bound, lines)
+
+            // the generic plan is left as it was, to be bound again
+            lines, err = ExplainQueryPlan(plan)
+            require.NoError(t, err)
+            require.Equal(t, tt.generic, lines)
+        })
+    }
+}
+
+func Test_BindParametersTypeErrors(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    root, err := parse(`SELECT c1 FROM t1 WHERE c3 > $1`, meta)
+    require.NoError(t, err)
+    plan, err := NewQueryPlan(root)
+    require.NoError(t, err)
+    plan, err = OptimizeQueryPlan(plan)
+    require.NoError(t, err)
+
+    _, err = BindParameters(plan, []ast.ExpressionNode{ast.NewStringLiteralNode("a")})
+    require.ErrorContains(t, err, "cannot be applied to INTEGER and KEYWORD")
+    _, err = BindParameters(plan, nil)
+    require.ErrorContains(t, err, "no value for parameter '$1'")
+}
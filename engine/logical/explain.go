@@ -0,0 +1,134 @@
+package logical
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "strings"
+)
+
+// ExplainQueryPlan renders the logical plan as an indented tree, one line per plan node,
+// starting at the root projection.
+func ExplainQueryPlan(plan *QueryPlan) ([]string, error) {
+    printer := &PlanNodePrinter{}
+    if err := plan.ProjectNode.Accept(printer); err != nil {
+        return nil, err
+    }
+    return printer.lines, nil
+}
+
+/* *** Plan Node Printer *** */
+
+type PlanNodePrinter struct {
+    depth int
+    lines []string
+}
+
+func (p *PlanNodePrinter) print(format string, args ...any) {
+    p.lines = append(p.lines, strings.Repeat("  ", p.depth)+fmt.Sprintf(format, args...))
+}
+
+func (p *PlanNodePrinter) child(node PlanNode) error {
+    if node == nil {
+        return nil
+    }
+    p.depth++
+    defer func() { p.depth-- }()
+    return node.Accept(p)
+}
+
+func (p *PlanNodePrinter) VisitProjectNode(node *ProjectNode) error {
+    projections := make([]string, len(node.Projections()))
+    for i, projection := range node.Projections() {
+        projections[i] = projection.String()
+    }
+    p.print("Project [%s]", strings.Join(projections, ", "))
+    return p.child(node.Child())
+}
+
+func (p *PlanNodePrinter) VisitSelectNode(node *SelectNode) error {
+    if node.Predicate != nil {
+        p.print("Select predicate: %s", node.Predicate.String())
+    } else {
+        p.print("Select")
+    }
+    return p.child(node.Child())
+}
+
+func (p *PlanNodePrinter) VisitAggregateNode(node *AggregateNode) error {
+    p.print("Aggregate [%s]", strings.Join(node.Names, ", "))
+    return p.child(node.Child())
+}
+
+func (p *PlanNodePrinter) VisitLimitNode(node *LimitNode) error {
+    p.print("Limit %d", node.Limit.Value)
+    return p.child(node.Child())
+}
+
+func (p *PlanNodePrinter) VisitSortNode(node *SortNode) error {
+    p.print("Sort [%s]", describeTerms(node.Terms))
+    return p.child(node.Child())
+}
+
+func (p *PlanNodePrinter) VisitTopNNode(node *TopNNode) error {
+    p.print("TopN %d [%s]", node.Limit.Value, describeTerms(node.Terms))
+    return p.child(node.Child())
+}
+
+func describeTerms(terms []ast.OrderingTerm) string {
+    descriptions := make([]string, len(terms))
+    for i, term := range terms {
+        if term.Descending {
+            descriptions[i] = term.Node.String() + " DESC"
+        } else {
+            descriptions[i] = term.Node.String() + " ASC"
+        }
+    }
+    return strings.Join(descriptions, ", ")
+}
+
+func (p *PlanNodePrinter) VisitRelationNode(node *RelationNode) error {
+    if node.Relation == nil {
+        p.print("Relation")
+        return nil
+    }
+    line := "Relation " + node.Relation.Value
+    if node.PushedPredicate != nil {
+        line += " pushed: " + node.PushedPredicate.String()
+    }
+    if len(node.Highlights) > 0 {
+        line += " highlight: " + strings.Join(node.Highlights, ", ")
+    }
+    if node.Columns != nil {
+        line += " columns: [" + strings.Join(node.Columns, ", ") + "]"
+    }
+    p.print("%s", line)
+    return nil
+}
+
+func (p *PlanNodePrinter) VisitValuesNode(node *ValuesNode) error {
+    if node.Empty {
+        p.print("Values empty")
+    } else {
+        p.print("Values")
+    }
+    return nil
+}
+
+func (p *PlanNodePrinter) VisitTableNode(node *TableNode) error {
+    p.print("Table %s", node.Name)
+    return nil
+}
+
+func (p *PlanNodePrinter) VisitTablesNode(*TablesNode) error {
+    p.print("Tables")
+    return nil
+}
+
+func (p *PlanNodePrinter) VisitExplainNode(node *ExplainNode) error {
+    if node.Analyze {
+        p.print("Explain analyze")
+    } else {
+        p.print("Explain")
+    }
+    return p.child(&node.Plan.ProjectNode)
+}
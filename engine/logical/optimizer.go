@@ -6,61 +6,482 @@ import (
     "github.com/aleph-zero/flutterdb/engine"
     "github.com/aleph-zero/flutterdb/engine/ast"
     "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
     "golang.org/x/exp/constraints"
     "math"
+    "reflect"
+    "slices"
+    "time"
 )
 
+// maxOptimizerPasses bounds the passes over a plan, in case rules keep undoing each other's
+// rewrites and never reach a fixpoint.
+const maxOptimizerPasses = 32
+
+// OptimizeQueryPlan rewrites a plan with the default rules.
 func OptimizeQueryPlan(plan *QueryPlan) (*QueryPlan, error) {
-    switch plan.ProjectNode.Child().(type) {
-    case *TableNode, *TablesNode:
-        return plan, nil
+    optimized, _, err := NewOptimizer(DefaultRules(time.Now())...).Optimize(plan)
+    return optimized, err
+}
+
+// DefaultRules returns the rules OptimizeQueryPlan applies, in the order it applies them to a node.
+// NOW() folds to the timestamp of the statement, now.
+func DefaultRules(now time.Time) []OptimizationRule {
+    return []OptimizationRule{
+        NewConstantExpressionEvaluator(now),
+        NewSearchPredicatePushdown(),
+        NewPredicatePushdown(),
+        NewProjectionPushdown(),
+        NewTopNFusion(),
+    }
+}
+
+// OptimizationRule rewrites nodes of the logical plan. The optimizer offers a rule each node of
+// a type the rule matches. Apply returns the node that takes the place of the one it was given,
+// which may be the same node rewritten in place, and whether it rewrote anything; a rule that
+// has nothing left to rewrite must say so, or the optimizer never reaches a fixpoint.
+type OptimizationRule interface {
+    Name() string
+    Matches() []NodeType
+    Apply(node PlanNode) (PlanNode, bool, error)
+}
+
+// RuleApplication records a rule rewriting a node in one of the optimizer's passes over a plan.
+type RuleApplication struct {
+    Pass int
+    Rule string
+    Node NodeType
+}
+
+func (a RuleApplication) String() string {
+    return fmt.Sprintf("pass %d: %s rewrote %s", a.Pass, a.Rule, a.Node)
+}
+
+/* *** Optimizer *** */
+
+// Optimizer applies its rules to every node of a plan, top down, and repeats the passes over
+// the plan until a pass rewrites nothing.
+type Optimizer struct {
+    rules []OptimizationRule
+}
+
+func NewOptimizer(rules ...OptimizationRule) *Optimizer {
+    return &Optimizer{rules: rules}
+}
+
+// Optimize returns the optimized plan along with the rules that rewrote it, in the order they
+// did. The plan of an explained statement is optimized in its place, and the rules are recorded
+// on the explain node for EXPLAIN to show.
+func (o *Optimizer) Optimize(plan *QueryPlan) (*QueryPlan, []RuleApplication, error) {
+    if explain, ok := plan.ProjectNode.Child().(*ExplainNode); ok {
+        optimized, trace, err := o.Optimize(explain.Plan)
+        if err != nil {
+            return nil, nil, err
+        }
+        explain.Plan = optimized
+        explain.Rules = trace
+        return plan, trace, nil
+    }
+
+    var trace []RuleApplication
+    for pass := 1; pass <= maxOptimizerPasses; pass++ {
+        applied := len(trace)
+        root, err := o.rewrite(&plan.ProjectNode, pass, &trace)
+        if err != nil {
+            return nil, nil, err
+        }
+        project, ok := root.(*ProjectNode)
+        if !ok {
+            return nil, nil, fmt.Errorf("optimizer rule replaced the root of the plan with a %s node", root.Type())
+        }
+        plan.ProjectNode = *project
+        if len(trace) == applied {
+            return plan, trace, nil
+        }
+    }
+    return nil, nil, fmt.Errorf("optimizer did not reach a fixpoint after %d passes", maxOptimizerPasses)
+}
+
+// rewrite applies the rules to a node and then to its descendants, and returns the node that
+// takes its place.
+func (o *Optimizer) rewrite(node PlanNode, pass int, trace *[]RuleApplication) (PlanNode, error) {
+    for _, rule := range o.rules {
+        if !slices.Contains(rule.Matches(), node.Type()) {
+            continue
+        }
+        rewritten, changed, err := rule.Apply(node)
+        if err != nil {
+            return nil, err
+        }
+        if changed {
+            *trace = append(*trace, RuleApplication{Pass: pass, Rule: rule.Name(), Node: node.Type()})
+            node = rewritten
+        }
+    }
+
+    child := node.Child()
+    if child == nil {
+        return node, nil
+    }
+    rewritten, err := o.rewrite(child, pass, trace)
+    if err != nil {
+        return nil, err
+    }
+    if rewritten != child {
+        if err := replaceChild(node, rewritten); err != nil {
+            return nil, err
+        }
+    }
+    return node, nil
+}
+
+func replaceChild(node PlanNode, child PlanNode) error {
+    switch v := node.(type) {
+    case *ProjectNode:
+        v.child = child
+    case *SelectNode:
+        v.child = child
+    case *AggregateNode:
+        v.child = child
+    case *LimitNode:
+        v.child = child
+    case *SortNode:
+        v.child = child
+    case *TopNNode:
+        v.child = child
     default:
-        rules := []OptimizationRule{NewConstantExpressionEvaluator()}
-        for _, rule := range rules {
+        return fmt.Errorf("cannot replace the child of a %s node", node.Type())
+    }
+    return nil
+}
+
+/* *** Search Predicate Pushdown *** */
+
+// SearchPredicatePushdown moves the search conjuncts of a select predicate, such as full-text,
+// geo and date range predicates, into the relation, where they are answered by the search index. Search
+// predicates cannot be evaluated row by row, so a search predicate combined under OR or NOT with
+// a predicate the search index cannot answer is rejected, as is a HIGHLIGHT with nothing to highlight.
+type SearchPredicatePushdown struct{}
+
+func NewSearchPredicatePushdown() *SearchPredicatePushdown {
+    return &SearchPredicatePushdown{}
+}
+
+func (f *SearchPredicatePushdown) Name() string {
+    return "SearchPredicatePushdown"
+}
+
+func (f *SearchPredicatePushdown) Matches() []NodeType {
+    return []NodeType{ProjectNodeType, SelectNodeType}
+}
+
+func (f *SearchPredicatePushdown) Apply(node PlanNode) (PlanNode, bool, error) {
+    switch v := node.(type) {
+    case *ProjectNode:
+        for _, projection := range v.projections {
+            if ast.ContainsSearchPredicate(projection) {
+                return nil, false, fmt.Errorf("search predicate not allowed in projection '%s'", projection.String())
+            }
+        }
+    case *SelectNode:
+        rn, ok := v.child.(*RelationNode)
+        if !ok {
+            return node, false, nil
+        }
+        var pushed bool
+        if v.Predicate != nil {
             var err error
-            plan, err = rule.optimize(plan)
-            if err != nil {
-                return nil, err
+            if pushed, err = f.pushdown(v, rn); err != nil {
+                return nil, false, err
             }
         }
-        return plan, nil
+        if len(rn.Highlights) > 0 && rn.PushedPredicate == nil {
+            return nil, false, fmt.Errorf("function '%s' requires a full-text predicate", ast.FunctionHighlight)
+        }
+        return node, pushed, nil
     }
+    return node, false, nil
 }
 
-type OptimizationRule interface {
-    optimize(*QueryPlan) (*QueryPlan, error)
+// pushdown moves the search conjuncts of the select predicate into the relation and reports
+// whether there were any.
+func (f *SearchPredicatePushdown) pushdown(sn *SelectNode, rn *RelationNode) (bool, error) {
+    var pushed, remaining []ast.ExpressionNode
+    for _, conjunct := range ast.Conjuncts(sn.Predicate) {
+        switch {
+        case ast.IsSearchPredicate(conjunct):
+            pushed = append(pushed, conjunct)
+        case ast.ContainsSearchPredicate(conjunct):
+            if !ast.IsSargable(conjunct) {
+                return false, fmt.Errorf("search predicate cannot be combined with other predicates in '%s'", conjunct.String())
+            }
+            pushed = append(pushed, conjunct)
+        default:
+            remaining = append(remaining, conjunct)
+        }
+    }
+    return push(sn, rn, pushed, remaining), nil
+}
+
+// push adds conjuncts to the predicate pushed into the relation and leaves the remaining ones in
+// the select node. It reports whether there was anything to push.
+func push(sn *SelectNode, rn *RelationNode, pushed, remaining []ast.ExpressionNode) bool {
+    if len(pushed) == 0 {
+        return false
+    }
+    if rn.PushedPredicate != nil {
+        pushed = append([]ast.ExpressionNode{rn.PushedPredicate}, pushed...)
+    }
+    rn.PushedPredicate = ast.Conjunction(pushed)
+    sn.Predicate = ast.Conjunction(remaining)
+    return true
+}
+
+/* *** Predicate Pushdown *** */
+
+// PredicatePushdown moves the conjuncts of a select predicate that the search index can answer,
+// such as author = 'Leo Tolstoy' or population >= 1000000, into the relation, so that the scan
+// reads only the documents that match them and the filter evaluates only what is left.
+type PredicatePushdown struct{}
+
+func NewPredicatePushdown() *PredicatePushdown {
+    return &PredicatePushdown{}
+}
+
+func (p *PredicatePushdown) Name() string {
+    return "PredicatePushdown"
+}
+
+func (p *PredicatePushdown) Matches() []NodeType {
+    return []NodeType{SelectNodeType}
+}
+
+func (p *PredicatePushdown) Apply(node PlanNode) (PlanNode, bool, error) {
+    sn := node.(*SelectNode)
+    rn, ok := sn.child.(*RelationNode)
+    if !ok || sn.Predicate == nil {
+        return node, false, nil
+    }
+
+    var pushed, remaining []ast.ExpressionNode
+    for _, conjunct := range ast.Conjuncts(sn.Predicate) {
+        if ast.IsSargable(conjunct) {
+            pushed = append(pushed, conjunct)
+        } else {
+            remaining = append(remaining, conjunct)
+        }
+    }
+    return node, push(sn, rn, pushed, remaining), nil
+}
+
+/* *** Projection Pushdown *** */
+
+// ProjectionPushdown records in the relation the columns that the projections, the remaining
+// select predicate and the sort keys read, so that the scan decodes only those stored fields.
+// Predicates pushed into the relation are answered by the search index and need no stored fields.
+type ProjectionPushdown struct{}
+
+func NewProjectionPushdown() *ProjectionPushdown {
+    return &ProjectionPushdown{}
+}
+
+func (p *ProjectionPushdown) Name() string {
+    return "ProjectionPushdown"
+}
+
+func (p *ProjectionPushdown) Matches() []NodeType {
+    return []NodeType{ProjectNodeType}
+}
+
+func (p *ProjectionPushdown) Apply(node PlanNode) (PlanNode, bool, error) {
+    pn := node.(*ProjectNode)
+    var rn *RelationNode
+    referenced := make([]string, 0)
+    for _, projection := range pn.projections {
+        referenced = append(referenced, ast.Columns(projection)...)
+    }
+    for child := pn.Child(); child != nil; child = child.Child() {
+        switch v := child.(type) {
+        case *SelectNode:
+            if v.Predicate != nil {
+                referenced = append(referenced, ast.Columns(v.Predicate)...)
+            }
+        case *SortNode:
+            for _, term := range v.Terms {
+                referenced = append(referenced, ast.Columns(term.Node)...)
+            }
+        case *TopNNode:
+            for _, term := range v.Terms {
+                referenced = append(referenced, ast.Columns(term.Node)...)
+            }
+        case *RelationNode:
+            rn = v
+        }
+    }
+    if rn == nil {
+        return node, false, nil
+    }
+
+    slices.Sort(referenced)
+    referenced = slices.Compact(referenced)
+    if rn.Columns != nil && slices.Equal(rn.Columns, referenced) {
+        return node, false, nil
+    }
+    rn.Columns = referenced
+    return node, true, nil
+}
+
+/* *** Top-N Fusion *** */
+
+// TopNFusion replaces a limit over a sort with a top-N node, which holds no more records than the
+// limit while it reads its child, rather than ordering every record before the limit keeps the
+// first of them. A top-N directly over a scan whose ordering terms are sortable columns is
+// answered by the search index.
+type TopNFusion struct{}
+
+func NewTopNFusion() *TopNFusion {
+    return &TopNFusion{}
+}
+
+func (f *TopNFusion) Name() string {
+    return "TopNFusion"
+}
+
+func (f *TopNFusion) Matches() []NodeType {
+    return []NodeType{LimitNodeType}
+}
+
+func (f *TopNFusion) Apply(node PlanNode) (PlanNode, bool, error) {
+    ln := node.(*LimitNode)
+    sn, ok := ln.child.(*SortNode)
+    if !ok {
+        return node, false, nil
+    }
+    return NewTopNNode(sn.child, sn.Terms, ln.Limit), true, nil
 }
 
 /* *** Constant Expression Optimizer *** */
 
+// ConstantExpressionEvaluator folds the constant parts of projections and of the select
+// predicate into literals, and simplifies logical operators with a constant operand. Negations
+// are pushed down through AND and OR by De Morgan's laws, so that they end up on the operands
+// they negate. A predicate that folds to a constant is removed if it is true, and replaces the
+// relation with an empty one if it is false or contradicts itself, so that no scan is opened.
 type ConstantExpressionEvaluator struct {
-    stack *engine.Stack[ast.ExpressionNode]
+    stack     *engine.Stack[ast.ExpressionNode]
+    now       time.Time // every NOW() in a statement folds to the same timestamp
+    predicate bool      // only the truth value of the expression matters, not its value
 }
 
-func NewConstantExpressionEvaluator() *ConstantExpressionEvaluator {
-    return &ConstantExpressionEvaluator{stack: engine.NewStack[ast.ExpressionNode]()}
+// NewConstantExpressionEvaluator creates a folder in which NOW() folds to the timestamp of the
+// statement. A zero timestamp leaves NOW() to be evaluated when the plan is executed, which a
+// plan prepared once and executed many times requires.
+func NewConstantExpressionEvaluator(now time.Time) *ConstantExpressionEvaluator {
+    if !now.IsZero() {
+        now = now.UTC()
+    }
+    return &ConstantExpressionEvaluator{
+        stack: engine.NewStack[ast.ExpressionNode](),
+        now:   now,
+    }
 }
 
-func (c *ConstantExpressionEvaluator) optimize(plan *QueryPlan) (*QueryPlan, error) {
-    for i, projection := range plan.ProjectNode.projections {
+func (c *ConstantExpressionEvaluator) Name() string {
+    return "ConstantExpressionEvaluator"
+}
+
+func (c *ConstantExpressionEvaluator) Matches() []NodeType {
+    return []NodeType{ProjectNodeType, SelectNodeType}
+}
+
+// Apply folds the projections of a project node or the predicate of a select node. The folded
+// expressions are new trees, so they are compared with the originals to tell whether anything
+// was folded.
+func (c *ConstantExpressionEvaluator) Apply(node PlanNode) (PlanNode, bool, error) {
+    switch v := node.(type) {
+    case *ProjectNode:
+        changed, err := c.projections(v)
+        return node, changed, err
+    case *SelectNode:
+        changed, err := c.selection(v)
+        return node, changed, err
+    }
+    return node, false, nil
+}
+
+func (c *ConstantExpressionEvaluator) projections(pn *ProjectNode) (bool, error) {
+    defer c.stack.Clear()
+    changed := false
+    for i, projection := range pn.projections {
         if err := projection.Accept(c); err != nil {
-            return nil, fmt.Errorf("optimizing projection expression: %w", err)
+            return false, fmt.Errorf("optimizing projection expression: %w", err)
+        }
+        optimized := c.stack.MustPop()
+        if !reflect.DeepEqual(projection, optimized) {
+            pn.projections[i] = optimized // replace original expression with optimized version
+            changed = true
         }
-        plan.ProjectNode.projections[i] = c.stack.MustPop() // replace original expression with optimized version
     }
-    c.stack.Clear()
+    return changed, nil
+}
 
-    sn := getSelectNode(plan)
-    if sn == nil || sn.Predicate == nil {
-        return plan, nil
+func (c *ConstantExpressionEvaluator) selection(sn *SelectNode) (bool, error) {
+    if sn.Predicate == nil {
+        return false, nil
     }
 
+    c.predicate = true
+    defer func() { c.predicate = false }()
     if err := sn.Predicate.Accept(c); err != nil {
-        return nil, fmt.Errorf("optimizing select predicate: %w", err)
+        return false, fmt.Errorf("optimizing select predicate: %w", err)
     }
 
-    sn.Predicate = c.stack.MustPop() // replace Predicate with optimized version
-    return plan, nil
+    optimized := c.stack.MustPop()
+    if value, ok := truth(optimized); ok {
+        sn.Predicate = nil
+        if !value {
+            sn.child = NewEmptyValuesNode()
+        }
+        return true, nil
+    }
+    if contradictory(ast.Conjuncts(optimized)) {
+        sn.Predicate = nil
+        sn.child = NewEmptyValuesNode()
+        return true, nil
+    }
+    if reflect.DeepEqual(sn.Predicate, optimized) {
+        return false, nil
+    }
+    sn.Predicate = optimized // replace Predicate with optimized version
+    return true, nil
+}
+
+// contradictory reports whether conjuncts compare the same column for equality with different
+// literals, e.g. c = 1 AND c = 2, which no row satisfies.
+func contradictory(conjuncts []ast.ExpressionNode) bool {
+    values := make(map[string]ast.ExpressionNode)
+    for _, conjunct := range conjuncts {
+        b, ok := conjunct.(*ast.BinaryExpressionNode)
+        if !ok || b.Op.TokenType != token.EQUAL {
+            continue
+        }
+        column, value := b.Left, b.Right
+        if _, ok := column.(*ast.ColumnIdentifierNode); !ok {
+            column, value = value, column
+        }
+        c, ok := column.(*ast.ColumnIdentifierNode)
+        if !ok || !ast.IsLiteralNode(value) {
+            continue
+        }
+        if previous, ok := values[c.Value]; ok {
+            if equal, ok := comparison(previous, value, token.EQUAL); ok && !equal {
+                return true
+            }
+            continue
+        }
+        values[c.Value] = value
+    }
+    return false
 }
 
 func (c *ConstantExpressionEvaluator) VisitBinaryExpressionNode(node *ast.BinaryExpressionNode) error {
@@ -74,31 +495,169 @@ func (c *ConstantExpressionEvaluator) VisitBinaryExpressionNode(node *ast.Binary
     }
     right := c.stack.MustPop()
 
+    if node.Op.TokenType == token.AND || node.Op.TokenType == token.OR {
+        c.stack.Push(c.logical(node, left, right))
+        return nil
+    }
+
+    rebuilt := ast.NewBinaryExpressionNode(node.Op, left, right)
+    rebuilt.ResolvedType = node.ResolvedType
     if !ast.IsLiteralNode(left) || !ast.IsLiteralNode(right) {
-        c.stack.Push(ast.NewBinaryExpressionNode(node.Op, left, right))
+        c.stack.Push(rebuilt)
+        return nil
+    }
+
+    switch node.Op.TokenType {
+    case token.EQUAL, token.NOT_EQUAL, token.GT, token.GTE, token.LT, token.LTE:
+        if value, ok := comparison(left, right, node.Op.TokenType); ok {
+            c.stack.Push(ast.NewBooleanLiteralNode(value))
+            return nil
+        }
+        c.stack.Push(rebuilt)
+        return nil
+    }
+
+    if expression, ok := temporalArithmetic(left, right, node.Op.TokenType); ok {
+        c.stack.Push(expression)
+        return nil
+    }
+    l, lok := left.(ast.NumericNode)
+    r, rok := right.(ast.NumericNode)
+    if !lok || !rok {
+        c.stack.Push(rebuilt)
         return nil
     }
 
     switch node.Op.TokenType {
     case token.PLUS, token.MINUS, token.ASTERISK, token.DIVIDE, token.MODULO:
-        expression, err := arithmetic(left.(ast.NumericNode), right.(ast.NumericNode), node.Op.TokenType)
+        expression, err := arithmetic(l, r, node.Op.TokenType)
         if err != nil {
             return err
         }
         c.stack.Push(expression)
-    case token.AND, token.OR, token.NOT:
-        panic("and, or, not unimplemented") // TODO XXX DOES NOT WORK WITH 'AND', 'OR', 'NOT'
     default:
-        c.stack.Push(node)
+        c.stack.Push(rebuilt)
     }
 
     return nil
 }
 
+// logical simplifies AND and OR: two constants fold to a constant, a constant that decides the
+// outcome replaces the whole expression, and one that does not is dropped.
+func (c *ConstantExpressionEvaluator) logical(node *ast.BinaryExpressionNode, left, right ast.ExpressionNode) ast.ExpressionNode {
+    and := node.Op.TokenType == token.AND
+    l, lok := truth(left)
+    r, rok := truth(right)
+
+    switch {
+    case lok && rok && and:
+        return ast.NewBooleanLiteralNode(l && r)
+    case lok && rok:
+        return ast.NewBooleanLiteralNode(l || r)
+    case lok && l != and, rok && r != and: // x AND FALSE, x OR TRUE
+        return ast.NewBooleanLiteralNode(!and)
+    case lok && c.truthValued(right): // TRUE AND x, FALSE OR x
+        return right
+    case rok && c.truthValued(left):
+        return left
+    }
+
+    rebuilt := ast.NewBinaryExpressionNode(node.Op, left, right)
+    rebuilt.ResolvedType = node.ResolvedType
+    return rebuilt
+}
+
+// truthValued reports whether an expression may stand in for a logical operator applied to it:
+// either it is a boolean, or only its truth value is of interest.
+func (c *ConstantExpressionEvaluator) truthValued(node ast.ExpressionNode) bool {
+    t, ok := ast.TypeOf(node)
+    return c.predicate || (ok && t == types.BOOLEAN)
+}
+
+// truth returns the truth value of a literal, which is how the literal is taken when filtering.
+func truth(node ast.ExpressionNode) (bool, bool) {
+    switch v := node.(type) {
+    case *ast.BooleanLiteralNode:
+        return v.Value, true
+    case *ast.IntegerLiteralNode:
+        return engine.NewIntValue(v.Value).ToBoolean(), true
+    case *ast.FloatLiteralNode:
+        return engine.NewFloatValue(v.Value).ToBoolean(), true
+    case *ast.StringLiteralNode:
+        return engine.NewStringValue(v.Value).ToBoolean(), true
+    default:
+        return false, false
+    }
+}
+
+// comparison compares two literals, or returns false if they cannot be compared at plan time.
+// Timestamps may be compared with strings that parse as timestamps.
+func comparison(left, right ast.ExpressionNode, op token.TokenType) (bool, bool) {
+    switch l := left.(type) {
+    case *ast.IntegerLiteralNode:
+        switch r := right.(type) {
+        case *ast.IntegerLiteralNode:
+            return compare(l.Value, r.Value, op), true
+        case *ast.FloatLiteralNode:
+            return compare(float64(l.Value), r.Value, op), true
+        }
+    case *ast.FloatLiteralNode:
+        switch r := right.(type) {
+        case *ast.IntegerLiteralNode:
+            return compare(l.Value, float64(r.Value), op), true
+        case *ast.FloatLiteralNode:
+            return compare(l.Value, r.Value, op), true
+        }
+    case *ast.StringLiteralNode:
+        switch r := right.(type) {
+        case *ast.StringLiteralNode:
+            return compare(l.Value, r.Value, op), true
+        case *ast.TimestampLiteralNode:
+            if t, err := types.ParseTimestamp(l.Value); err == nil {
+                return compare(t.UnixNano(), r.Value.UnixNano(), op), true
+            }
+        }
+    case *ast.TimestampLiteralNode:
+        switch r := right.(type) {
+        case *ast.TimestampLiteralNode:
+            return compare(l.Value.UnixNano(), r.Value.UnixNano(), op), true
+        case *ast.StringLiteralNode:
+            if t, err := types.ParseTimestamp(r.Value); err == nil {
+                return compare(l.Value.UnixNano(), t.UnixNano(), op), true
+            }
+        }
+    case *ast.BooleanLiteralNode:
+        if r, ok := right.(*ast.BooleanLiteralNode); ok && (op == token.EQUAL || op == token.NOT_EQUAL) {
+            return (l.Value == r.Value) == (op == token.EQUAL), true
+        }
+    }
+    return false, false
+}
+
+func compare[T constraints.Ordered](left, right T, op token.TokenType) bool {
+    switch op {
+    case token.EQUAL:
+        return left == right
+    case token.NOT_EQUAL:
+        return left != right
+    case token.GT:
+        return left > right
+    case token.GTE:
+        return left >= right
+    case token.LT:
+        return left < right
+    default:
+        return left <= right
+    }
+}
+
 func arithmetic(left, right ast.NumericNode, op token.TokenType) (ast.ExpressionNode, error) {
     if left.CanInt() && right.CanInt() {
         l := left.ToInt64()
         r := right.ToInt64()
+        if (op == token.DIVIDE || op == token.MODULO) && r == 0 {
+            return nil, errors.New("division by zero")
+        }
         if op == token.MODULO {
             return ast.NewIntegerLiteralNode(l % r), nil
         }
@@ -116,6 +675,43 @@ func arithmetic(left, right ast.NumericNode, op token.TokenType) (ast.Expression
     return ast.NewFloatLiteralNode(apply(l, r, op)), nil
 }
 
+// temporalArithmetic folds the sum or difference of a timestamp and an interval, of two
+// intervals, or the difference of two timestamps.
+func temporalArithmetic(left, right ast.ExpressionNode, op token.TokenType) (ast.ExpressionNode, bool) {
+    if op != token.PLUS && op != token.MINUS {
+        return nil, false
+    }
+
+    switch l := left.(type) {
+    case *ast.TimestampLiteralNode:
+        switch r := right.(type) {
+        case *ast.IntervalLiteralNode:
+            interval := r.Value
+            if op == token.MINUS {
+                interval = interval.Negate()
+            }
+            return ast.NewTimestampLiteralNode(interval.AddTo(l.Value)), true
+        case *ast.TimestampLiteralNode:
+            if op == token.MINUS {
+                return ast.NewIntervalLiteralNode(types.Interval{Duration: l.Value.Sub(r.Value)}), true
+            }
+        }
+    case *ast.IntervalLiteralNode:
+        switch r := right.(type) {
+        case *ast.TimestampLiteralNode:
+            if op == token.PLUS {
+                return ast.NewTimestampLiteralNode(l.Value.AddTo(r.Value)), true
+            }
+        case *ast.IntervalLiteralNode:
+            if op == token.MINUS {
+                return ast.NewIntervalLiteralNode(l.Value.Add(r.Value.Negate())), true
+            }
+            return ast.NewIntervalLiteralNode(l.Value.Add(r.Value)), true
+        }
+    }
+    return nil, false
+}
+
 type operable interface {
     constraints.Integer | constraints.Float
 }
@@ -133,7 +729,6 @@ func apply[T operable](left, right T, op token.TokenType) T {
     default:
         panic(fmt.Sprintf("cannot apply arithmetic operator '%s'", op.String()))
     }
-    return 0
 }
 
 func (c *ConstantExpressionEvaluator) VisitParenthesizedExpression(node *ast.ParenthesizedExpressionNode) error {
@@ -141,7 +736,23 @@ func (c *ConstantExpressionEvaluator) VisitParenthesizedExpression(node *ast.Par
 }
 
 func (c *ConstantExpressionEvaluator) VisitUnaryExpressionNode(node *ast.UnaryExpressionNode) error {
-    c.stack.Push(node)
+    if err := node.Node.Accept(c); err != nil {
+        return err
+    }
+    operand := c.stack.MustPop()
+
+    switch v := operand.(type) {
+    case *ast.IntegerLiteralNode:
+        c.stack.Push(ast.NewIntegerLiteralNode(-v.Value))
+    case *ast.FloatLiteralNode:
+        c.stack.Push(ast.NewFloatLiteralNode(-v.Value))
+    case *ast.UnaryExpressionNode: // - -x
+        c.stack.Push(v.Node)
+    default:
+        rebuilt := ast.NewUnaryExpressionNode(node.Op, operand)
+        rebuilt.ResolvedType = node.ResolvedType
+        c.stack.Push(rebuilt)
+    }
     return nil
 }
 
@@ -160,16 +771,122 @@ func (c *ConstantExpressionEvaluator) VisitFloatLiteralNode(node *ast.FloatLiter
     return nil
 }
 
+func (c *ConstantExpressionEvaluator) VisitBooleanLiteralNode(node *ast.BooleanLiteralNode) error {
+    c.stack.Push(node)
+    return nil
+}
+
+func (c *ConstantExpressionEvaluator) VisitTimestampLiteralNode(node *ast.TimestampLiteralNode) error {
+    c.stack.Push(node)
+    return nil
+}
+
+func (c *ConstantExpressionEvaluator) VisitIntervalLiteralNode(node *ast.IntervalLiteralNode) error {
+    c.stack.Push(node)
+    return nil
+}
+
 func (c *ConstantExpressionEvaluator) VisitColumnIdentifierNode(node *ast.ColumnIdentifierNode) error {
     c.stack.Push(node)
     return nil
 }
 
 func (c *ConstantExpressionEvaluator) VisitLogicalNegationNode(node *ast.LogicalNegationNode) error {
-    c.stack.Push(node)
+    if err := node.Node.Accept(c); err != nil {
+        return err
+    }
+    operand := c.stack.MustPop()
+
+    if value, ok := truth(operand); ok {
+        c.stack.Push(ast.NewBooleanLiteralNode(!value))
+        return nil
+    }
+
+    switch v := operand.(type) {
+    case *ast.LogicalNegationNode: // NOT NOT x
+        if c.truthValued(v.Node) {
+            c.stack.Push(v.Node)
+            return nil
+        }
+    case *ast.BinaryExpressionNode: // NOT (x AND y) is NOT x OR NOT y, and vice versa
+        if v.Op.TokenType == token.AND || v.Op.TokenType == token.OR {
+            op := token.Token{TokenType: token.OR, Lexeme: "OR", Position: v.Op.Position}
+            if v.Op.TokenType == token.OR {
+                op = token.Token{TokenType: token.AND, Lexeme: "AND", Position: v.Op.Position}
+            }
+            left := ast.NewLogicalNegationNode(node.Op, v.Left)
+            left.ResolvedType = node.ResolvedType
+            right := ast.NewLogicalNegationNode(node.Op, v.Right)
+            right.ResolvedType = node.ResolvedType
+            rewritten := ast.NewBinaryExpressionNode(op, left, right)
+            rewritten.ResolvedType = node.ResolvedType
+            return rewritten.Accept(c)
+        }
+    }
+
+    rebuilt := ast.NewLogicalNegationNode(node.Op, operand)
+    rebuilt.ResolvedType = node.ResolvedType
+    c.stack.Push(rebuilt)
     return nil
 }
 
+func (c *ConstantExpressionEvaluator) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    if ast.IsAggregate(node) {
+        // the aggregate node computes the call as written, and the projection reads its result
+        c.stack.Push(node)
+        return nil
+    }
+
+    arguments := make([]ast.ExpressionNode, len(node.Arguments))
+    for i, argument := range node.Arguments {
+        if err := argument.Accept(c); err != nil {
+            return err
+        }
+        arguments[i] = c.stack.MustPop()
+    }
+
+    switch node.Name {
+    case ast.FunctionNow:
+        if c.now.IsZero() {
+            c.stack.Push(node)
+            return nil
+        }
+        c.stack.Push(ast.NewTimestampLiteralNode(c.now))
+        return nil
+    case ast.FunctionDateTrunc:
+        unit, uok := arguments[0].(*ast.StringLiteralNode)
+        ts, tok := arguments[1].(*ast.TimestampLiteralNode)
+        if uok && tok {
+            t, err := types.TruncateTime(unit.Value, ts.Value)
+            if err != nil {
+                return err
+            }
+            c.stack.Push(ast.NewTimestampLiteralNode(t))
+            return nil
+        }
+    case ast.FunctionExtract:
+        field, fok := arguments[0].(*ast.StringLiteralNode)
+        ts, tok := arguments[1].(*ast.TimestampLiteralNode)
+        if fok && tok {
+            v, err := types.ExtractField(field.Value, ts.Value)
+            if err != nil {
+                return err
+            }
+            c.stack.Push(ast.NewIntegerLiteralNode(v))
+            return nil
+        }
+    }
+    rebuilt := ast.NewFunctionCallNode(node.Name, arguments)
+    rebuilt.Position = node.Position
+    rebuilt.ResolvedType = node.ResolvedType
+    c.stack.Push(rebuilt)
+    return nil
+}
+
+func (c *ConstantExpressionEvaluator) VisitOrderByNode(node *ast.OrderByNode) error {
+    return fmt.Errorf("cannot optimize node type %T", node)
+}
+
 func (c *ConstantExpressionEvaluator) VisitLimitNode(node *ast.LimitNode) error {
     return fmt.Errorf("cannot optimize node type %T", node)
 }
@@ -194,6 +911,29 @@ func (c *ConstantExpressionEvaluator) VisitShowTablesStatementNode(node *ast.Sho
     return fmt.Errorf("cannot optimize node type %T", node)
 }
 
+func (c *ConstantExpressionEvaluator) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    return fmt.Errorf("cannot optimize node type %T", node)
+}
+
+func (c *ConstantExpressionEvaluator) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return fmt.Errorf("cannot optimize node type %T", node)
+}
+
+func (c *ConstantExpressionEvaluator) VisitExecuteStatementNode(node *ast.ExecuteStatementNode) error {
+    return fmt.Errorf("cannot optimize node type %T", node)
+}
+
+func (c *ConstantExpressionEvaluator) VisitDeallocateStatementNode(node *ast.DeallocateStatementNode) error {
+    return fmt.Errorf("cannot optimize node type %T", node)
+}
+
+// VisitPlaceholderNode leaves the placeholders of a prepared statement in place, to be bound into
+// its optimized plan on every execution.
+func (c *ConstantExpressionEvaluator) VisitPlaceholderNode(node *ast.PlaceholderNode) error {
+    c.stack.Push(node)
+    return nil
+}
+
 func (c *ConstantExpressionEvaluator) VisitColumnDefinitionNode(node *ast.ColumnDefinitionNode) error {
     return fmt.Errorf("cannot optimize node type %T", node)
 }
@@ -11,6 +11,7 @@ import (
     "github.com/stretchr/testify/require"
     "testing"
     "text/scanner"
+    "time"
 )
 
 const data = "../../testdata/metastore"
@@ -24,18 +25,31 @@ func Test_OptimizeConstantProjectionExpression(t *testing.T) {
         expected ast.ExpressionNode
     }{
         {`SELECT 1`, ast.NewIntegerLiteralNode(1)},
-        {`SELECT -1`,
-            ast.NewUnaryExpressionNode(
-                token.Token{TokenType: token.MINUS, Lexeme: "-", Position: scanner.Position{}},
-                ast.NewIntegerLiteralNode(1)),
+        {`SELECT -1`, ast.NewIntegerLiteralNode(-1)},
+        {`SELECT -(2 + 3.5)`, ast.NewFloatLiteralNode(-5.5)},
+        {`SELECT 1 = 1`, ast.NewBooleanLiteralNode(true)},
+        {`SELECT 'a' > 'b'`, ast.NewBooleanLiteralNode(false)},
+        {`SELECT NOT (1 > 2)`, ast.NewBooleanLiteralNode(true)},
+        {`SELECT TRUE AND 1 < 2`, ast.NewBooleanLiteralNode(true)},
+        {`SELECT DATE '2024-01-01' < '2024-06-01'`, ast.NewBooleanLiteralNode(true)},
+        {`SELECT c3 > 1 AND TRUE FROM t1`,
+            ast.NewBinaryExpressionNode(
+                token.Token{TokenType: token.GT, Lexeme: ">", Position: scanner.Position{}},
+                ast.NewColumnIdentifierNode("c3"),
+                ast.NewIntegerLiteralNode(1),
+            ),
+        },
+        {`SELECT c3 AND TRUE FROM t1`, // the value of c3 is not a boolean, so TRUE must stay
+            ast.NewBinaryExpressionNode(
+                token.Token{TokenType: token.AND, Lexeme: "AND", Position: scanner.Position{}},
+                ast.NewColumnIdentifierNode("c3"),
+                ast.NewBooleanLiteralNode(true),
+            ),
         },
+        {`SELECT - -c3 FROM t1`, ast.NewColumnIdentifierNode("c3")},
         {`SELECT 1 + 2`, ast.NewIntegerLiteralNode(3)},
         {`SELECT 1 + 2.5`, ast.NewFloatLiteralNode(3.5)},
         {`SELECT 1 + (2 * 3)`, ast.NewIntegerLiteralNode(7)},
-        {`SELECT 1 * "a"`, ast.NewIntegerLiteralNode(0)},
-        {`SELECT 1 + "a"`, ast.NewIntegerLiteralNode(1)},
-        {`SELECT 1 + "-5"`, ast.NewFloatLiteralNode(-4)},
-        {`SELECT 2 * "12.2"`, ast.NewFloatLiteralNode(24.4)},
         {`SELECT 1 * c3 FROM t1`,
             ast.NewBinaryExpressionNode(
                 token.Token{TokenType: token.ASTERISK, Lexeme: "*", Position: scanner.Position{}},
@@ -57,13 +71,13 @@ func Test_OptimizeConstantProjectionExpression(t *testing.T) {
                 ast.NewColumnIdentifierNode("c3"),
             ),
         },
-        {`SELECT c3 + (c1 * (4 + 5)) FROM t1`,
+        {`SELECT c3 + (c4 * (4 + 5)) FROM t1`,
             ast.NewBinaryExpressionNode(
                 token.Token{TokenType: token.PLUS, Lexeme: "+", Position: scanner.Position{}},
                 ast.NewColumnIdentifierNode("c3"),
                 ast.NewBinaryExpressionNode(
                     token.Token{TokenType: token.ASTERISK, Lexeme: "*", Position: scanner.Position{}},
-                    ast.NewColumnIdentifierNode("c1"),
+                    ast.NewColumnIdentifierNode("c4"),
                     ast.NewIntegerLiteralNode(9),
                 ),
             ),
@@ -82,15 +96,16 @@ func Test_OptimizeConstantProjectionExpression(t *testing.T) {
                 t.Fatal(err)
             }
 
-            optimizer := NewConstantExpressionEvaluator()
-            plan, err = optimizer.optimize(plan)
+            optimizer := NewOptimizer(NewConstantExpressionEvaluator(time.Now()))
+            plan, _, err = optimizer.Optimize(plan)
             if err != nil {
                 t.Fatal(err)
             }
 
             if diff := cmp.Diff(tt.expected, plan.ProjectNode.projections[0],
                 cmpopts.IgnoreFields(token.Token{}, "Position"),
-                cmpopts.IgnoreFields(ast.ColumnIdentifierNode{}, "ResolvedColumnSymbol"),
+                cmpopts.IgnoreFields(ast.ColumnIdentifierNode{}, "ResolvedColumnSymbol", "Position"),
+                ignoreResolvedTypes,
             ); diff != "" {
                 t.Errorf("failed to optimize plan (-expected, +received):\n%s", diff)
             }
@@ -98,6 +113,61 @@ func Test_OptimizeConstantProjectionExpression(t *testing.T) {
     }
 }
 
+func Test_OptimizeNow(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    now := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)
+    tests := []struct {
+        now      time.Time
+        expected ast.ExpressionNode
+    }{
+        {now, ast.NewTimestampLiteralNode(now)},
+        // a prepared plan leaves NOW() to each execution of the statement
+        {time.Time{}, ast.NewFunctionCallNode(ast.FunctionNow, nil)},
+    }
+
+    for _, tt := range tests {
+        root, err := parse(`SELECT NOW() FROM t1`, meta)
+        require.NoError(t, err)
+        plan, err := NewQueryPlan(root)
+        require.NoError(t, err)
+
+        plan, _, err = NewOptimizer(NewConstantExpressionEvaluator(tt.now)).Optimize(plan)
+        require.NoError(t, err)
+        if diff := cmp.Diff(tt.expected, plan.ProjectNode.projections[0],
+            cmpopts.IgnoreFields(ast.FunctionCallNode{}, "Position", "ResolvedType"),
+            cmpopts.EquateEmpty(),
+            ignoreResolvedTypes,
+        ); diff != "" {
+            t.Errorf("failed to optimize plan (-expected, +received):\n%s", diff)
+        }
+    }
+}
+
+func Test_OptimizeDivisionByZero(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []string{
+        `SELECT 1 / 0`,
+        `SELECT 1 % 0`,
+        `SELECT 1.5 / 0`,
+        `SELECT c1 FROM t1 WHERE c3 > 10 % 0`,
+    }
+
+    for _, stmt := range tests {
+        t.Run(stmt, func(t *testing.T) {
+            root, err := parse(stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            _, err = OptimizeQueryPlan(plan)
+            require.ErrorContains(t, err, "division by zero")
+        })
+    }
+}
+
 func Test_OptimizeConstantSelectionPredicate(t *testing.T) {
     teardown, meta := setupSuite(t, data)
     defer teardown(t)
@@ -106,8 +176,8 @@ func Test_OptimizeConstantSelectionPredicate(t *testing.T) {
         stmt     string
         expected ast.ExpressionNode
     }{
-        {`SELECT 1 FROM t1 WHERE 1`, ast.NewIntegerLiteralNode(1)},
-        {`SELECT 1 FROM t1 WHERE 1 + 2`, ast.NewIntegerLiteralNode(3)},
+        {`SELECT 1 FROM t1 WHERE 1`, nil},
+        {`SELECT 1 FROM t1 WHERE 1 + 2`, nil},
         {`SELECT 1 FROM t1 WHERE (1 + 2) / c3`,
             ast.NewBinaryExpressionNode(
                 token.Token{TokenType: token.DIVIDE, Lexeme: "/", Position: scanner.Position{}},
@@ -117,26 +187,29 @@ func Test_OptimizeConstantSelectionPredicate(t *testing.T) {
         },
         {`SELECT 1 FROM t1 WHERE (1 + 2) / c3 OR ((4 + 5) / 3) > 6`,
             ast.NewBinaryExpressionNode(
-                token.Token{TokenType: token.OR, Lexeme: "OR", Position: scanner.Position{}},
-                ast.NewBinaryExpressionNode(
-                    token.Token{TokenType: token.DIVIDE, Lexeme: "/", Position: scanner.Position{}},
-                    ast.NewIntegerLiteralNode(3),
-                    ast.NewColumnIdentifierNode("c3"),
-                ),
-                ast.NewParenthesizedExpressionNode(
-                    ast.NewBinaryExpressionNode(
-                        token.Token{TokenType: token.GT, Lexeme: ">", Position: scanner.Position{}},
-                        ast.NewIntegerLiteralNode(3),
-                        ast.NewIntegerLiteralNode(6),
-                    )),
+                token.Token{TokenType: token.DIVIDE, Lexeme: "/", Position: scanner.Position{}},
+                ast.NewIntegerLiteralNode(3),
+                ast.NewColumnIdentifierNode("c3"),
             ),
         },
-        {`SELECT 1 FROM t1 WHERE NOT 0`,
+        {`SELECT 1 FROM t1 WHERE NOT 0`, nil},
+        {`SELECT 1 FROM t1 WHERE c3 OR 1 = 1`, nil},
+        {`SELECT 1 FROM t1 WHERE c3 AND 1 = 1`, ast.NewColumnIdentifierNode("c3")},
+        {`SELECT 1 FROM t1 WHERE NOT NOT c3`, ast.NewColumnIdentifierNode("c3")},
+        {`SELECT 1 FROM t1 WHERE NOT (c3 OR 2 < 1)`,
             ast.NewLogicalNegationNode(
                 token.Token{TokenType: token.NOT, Lexeme: "NOT", Position: scanner.Position{}},
-                ast.NewIntegerLiteralNode(0)),
+                ast.NewColumnIdentifierNode("c3")),
+        },
+        {`SELECT 1 FROM t1 WHERE NOT (c3 AND NOT c4)`,
+            ast.NewBinaryExpressionNode(
+                token.Token{TokenType: token.OR, Lexeme: "OR", Position: scanner.Position{}},
+                ast.NewLogicalNegationNode(
+                    token.Token{TokenType: token.NOT, Lexeme: "NOT", Position: scanner.Position{}},
+                    ast.NewColumnIdentifierNode("c3")),
+                ast.NewColumnIdentifierNode("c4"),
+            ),
         },
-        // TODO Add tests for 'AND', 'OR', 'NOT'
     }
 
     for _, tt := range tests {
@@ -151,8 +224,8 @@ func Test_OptimizeConstantSelectionPredicate(t *testing.T) {
                 t.Fatal(err)
             }
 
-            optimizer := NewConstantExpressionEvaluator()
-            plan, err = optimizer.optimize(plan)
+            optimizer := NewOptimizer(NewConstantExpressionEvaluator(time.Now()))
+            plan, _, err = optimizer.Optimize(plan)
             if err != nil {
                 t.Fatal(err)
             }
@@ -162,7 +235,8 @@ func Test_OptimizeConstantSelectionPredicate(t *testing.T) {
 
             if diff := cmp.Diff(tt.expected, sn.Predicate,
                 cmpopts.IgnoreFields(token.Token{}, "Position"),
-                cmpopts.IgnoreFields(ast.ColumnIdentifierNode{}, "ResolvedColumnSymbol"),
+                cmpopts.IgnoreFields(ast.ColumnIdentifierNode{}, "ResolvedColumnSymbol", "Position"),
+                ignoreResolvedTypes,
             ); diff != "" {
                 t.Errorf("failed to optimize plan (-expected, +received):\n%s", diff)
             }
@@ -170,6 +244,346 @@ func Test_OptimizeConstantSelectionPredicate(t *testing.T) {
     }
 }
 
+func Test_OptimizeContradiction(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        stmt  string
+        empty bool
+    }{
+        {`SELECT c1 FROM t1 WHERE 1 = 0`, true},
+        {`SELECT c1 FROM t1 WHERE NOT TRUE`, true},
+        {`SELECT c1 FROM t1 WHERE c3 > 1 AND 'a' = 'b'`, true},
+        {`SELECT c1 FROM t1 WHERE MATCH(c2, 'apple') AND FALSE`, true},
+        {`SELECT c1 FROM t1 WHERE c3 = 1 AND c4 > 2 AND 2 = c3`, true},
+        {`SELECT 1 WHERE 1 > 2`, true},
+        {`SELECT c1 FROM t1 WHERE c3 = 1 AND c3 = 1`, false},
+        {`SELECT c1 FROM t1 WHERE c3 = 1 OR c3 = 2`, false},
+        {`SELECT c1 FROM t1 WHERE 1 = 1`, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            plan, err = OptimizeQueryPlan(plan)
+            require.NoError(t, err)
+
+            sn := getSelectNode(plan)
+            values, ok := sn.Child().(*ValuesNode)
+            require.Equal(t, tt.empty, ok && values.Empty)
+            if tt.empty {
+                require.Nil(t, sn.Predicate)
+            }
+        })
+    }
+}
+
+func Test_SearchPredicatePushdown(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        stmt      string
+        pushed    string
+        remaining string
+    }{
+        {`SELECT c1 FROM t1 WHERE MATCH(c2, 'apple')`, "MATCH(c2, 'apple')", ""},
+        {`SELECT c1 FROM t1 WHERE MATCH(c2, 'apple') AND c3 > 5`, "MATCH(c2, 'apple')", "c3 > 5"},
+        {`SELECT c1 FROM t1 WHERE c3 > 5 AND (MATCH(c2, 'a') OR NOT MATCH_PHRASE(c2, 'b c'))`,
+            "MATCH(c2, 'a') OR NOT MATCH_PHRASE(c2, 'b c')", "c3 > 5"},
+        {`SELECT c1 FROM t1 WHERE MATCH(c2, 'a') AND c3 > 5 AND MATCH(c1, 'b')`,
+            "MATCH(c2, 'a') AND MATCH(c1, 'b')", "c3 > 5"},
+        {`SELECT c1 FROM t1 WHERE c3 > 5`, "", "c3 > 5"},
+        {`SELECT title FROM books WHERE published >= DATE '2020-01-01' AND author = 'x'`,
+            "published >= DATE '2020-01-01'", "author = 'x'"},
+        {`SELECT title FROM books WHERE published > TIMESTAMP '2020-01-01 00:00:00' + INTERVAL '1 day'`,
+            "published > TIMESTAMP '2020-01-02T00:00:00Z'", ""},
+        {`SELECT title FROM books WHERE published < '2020-01-01' OR MATCH(summary, 'war')`,
+            "published < '2020-01-01' OR MATCH(summary, 'war')", ""},
+        {`SELECT title FROM books WHERE published < '2020-01-01' OR author = 'x'`,
+            "", "published < '2020-01-01' OR author = 'x'"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            plan, _, err = NewOptimizer(NewConstantExpressionEvaluator(time.Now()), NewSearchPredicatePushdown()).Optimize(plan)
+            require.NoError(t, err)
+
+            pushed, remaining := "", ""
+            if rn := getRelationNode(plan); rn.PushedPredicate != nil {
+                pushed = rn.PushedPredicate.String()
+            }
+            if sn := getSelectNode(plan); sn.Predicate != nil {
+                remaining = sn.Predicate.String()
+            }
+            require.Equal(t, tt.pushed, pushed)
+            require.Equal(t, tt.remaining, remaining)
+        })
+    }
+}
+
+func Test_PredicatePushdown(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        stmt      string
+        pushed    string
+        remaining string
+    }{
+        {`SELECT title FROM books WHERE author = 'Leo Tolstoy'`, "author = 'Leo Tolstoy'", ""},
+        {`SELECT c1 FROM t1 WHERE 5 < c3 AND c4 <= 2.5 AND c1 >= 'b'`, "5 < c3 AND c4 <= 2.5 AND c1 >= 'b'", ""},
+        {`SELECT c1 FROM t1 WHERE c3 > 2 + 3 AND c3 * 2 < 20`, "c3 > 5", "c3 * 2 < 20"},
+        {`SELECT c1 FROM t1 WHERE c3 = 1 OR NOT c1 = 'a'`, "c3 = 1 OR NOT c1 = 'a'", ""},
+        {`SELECT c1 FROM t1 WHERE c3 = 1 OR c1 LIKE 'a%'`, "", "c3 = 1 OR c1 LIKE 'a%'"},
+        {`SELECT c1 FROM t1 WHERE c1 != 'a' AND c1 > '' AND c2 = 'text' AND c3 = c4`, "",
+            "c1 != 'a' AND c1 > '' AND c2 = 'text' AND c3 = c4"},
+        {`SELECT c1 FROM t1 WHERE MATCH(c2, 'apple') AND c3 > 5`, "MATCH(c2, 'apple') AND c3 > 5", ""},
+        {`SELECT c1 FROM t1 WHERE MATCH(c2, 'apple') OR c3 > 5`, "MATCH(c2, 'apple') OR c3 > 5", ""},
+        {`SELECT c1 FROM t1 WHERE c4 > 1 AND NOT (MATCH(c2, 'apple') AND c3 > 5)`,
+            "(NOT MATCH(c2, 'apple') OR NOT c3 > 5) AND c4 > 1", ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            plan, err = OptimizeQueryPlan(plan)
+            require.NoError(t, err)
+
+            pushed, remaining := "", ""
+            if rn := getRelationNode(plan); rn.PushedPredicate != nil {
+                pushed = rn.PushedPredicate.String()
+            }
+            if sn := getSelectNode(plan); sn.Predicate != nil {
+                remaining = sn.Predicate.String()
+            }
+            require.Equal(t, tt.pushed, pushed)
+            require.Equal(t, tt.remaining, remaining)
+        })
+    }
+}
+
+func Test_ProjectionPushdown(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        stmt    string
+        columns []string
+    }{
+        {`SELECT c1 FROM t1`, []string{"c1"}},
+        {`SELECT 1 FROM t1`, []string{}},
+        {`SELECT c1, c3 * c4, c1 FROM t1`, []string{"c1", "c3", "c4"}},
+        {`SELECT c1 FROM t1 WHERE c3 * 2 > 4 ORDER BY c6 DESC`, []string{"c1", "c3", "c6"}},
+        {`SELECT c1 FROM t1 WHERE c3 > 4 AND MATCH(c2, 'apple')`, []string{"c1"}},
+        {`SELECT HIGHLIGHT(c2), GEO_DISTANCE(c5, 1.0, 2.0) FROM t1 WHERE MATCH(c2, 'apple')`, []string{"c2", "c5"}},
+        {`SELECT EXTRACT(YEAR FROM c6) FROM t1`, []string{"c6"}},
+        {`SELECT * FROM t1`, []string{"c1", "c2", "c3", "c4", "c5", "c6"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            plan, err = OptimizeQueryPlan(plan)
+            require.NoError(t, err)
+            require.Equal(t, tt.columns, getRelationNode(plan).Columns)
+        })
+    }
+}
+
+func Test_TopNFusion(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT c1 FROM t1 ORDER BY c3 DESC LIMIT 5`,
+            []string{"Project [c1]", "  TopN 5 [c3 DESC]", "    Select", "      Relation t1 columns: [c1, c3]"}},
+        {`SELECT c1 FROM t1 WHERE c3 * 2 > 4 ORDER BY c6, c1 DESC LIMIT 1`,
+            []string{"Project [c1]", "  TopN 1 [c6 ASC, c1 DESC]", "    Select predicate: c3 * 2 > 4", "      Relation t1 columns: [c1, c3, c6]"}},
+        {`SELECT c1 FROM t1 ORDER BY c3`,
+            []string{"Project [c1]", "  Sort [c3 ASC]", "    Select", "      Relation t1 columns: [c1, c3]"}},
+        {`SELECT c1 FROM t1 LIMIT 5`,
+            []string{"Project [c1]", "  Limit 5", "    Select", "      Relation t1 columns: [c1]"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            plan, err = OptimizeQueryPlan(plan)
+            require.NoError(t, err)
+            lines, err := ExplainQueryPlan(plan)
+            require.NoError(t, err)
+            require.Equal(t, tt.expected, lines)
+        })
+    }
+}
+
+func Test_Aggregate(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT COUNT(*) FROM t1`,
+            []string{"Project [COUNT(*)]", "  Aggregate [COUNT(*)]", "    Select", "      Relation t1 columns: []"}},
+        {`SELECT MIN(c3), MAX(c3 * 2) FROM t1 WHERE c3 > 1 + 1 LIMIT 1`,
+            []string{"Project [MIN(c3), MAX(c3 * 2)]", "  Limit 1", "    Aggregate [MIN(c3), MAX(c3 * 2)]", "      Select",
+                "        Relation t1 pushed: c3 > 2 columns: [c3]"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            plan, err = OptimizeQueryPlan(plan)
+            require.NoError(t, err)
+            lines, err := ExplainQueryPlan(plan)
+            require.NoError(t, err)
+            require.Equal(t, tt.expected, lines)
+        })
+    }
+}
+
+func Test_SearchPredicatePushdownInvalid(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []string{
+        `SELECT c1 FROM t1 WHERE MATCH(c2, 'apple') OR c2 LIKE 'a%'`,
+        `SELECT c1 FROM t1 WHERE NOT (MATCH(c2, 'apple') AND c3 + 1 > 5)`,
+        `SELECT MATCH(c2, 'apple') FROM t1`,
+        `SELECT HIGHLIGHT(c2) FROM t1 WHERE c3 > 5`,
+    }
+
+    for _, stmt := range tests {
+        t.Run(stmt, func(t *testing.T) {
+            root, err := parse(stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            _, err = OptimizeQueryPlan(plan)
+            require.Error(t, err)
+        })
+    }
+}
+
+func Test_OptimizerTrace(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        stmt     string
+        expected []RuleApplication
+    }{
+        {`SELECT 1 + 2`, []RuleApplication{{Pass: 1, Rule: "ConstantExpressionEvaluator", Node: ProjectNodeType}}},
+        {`SELECT c1 FROM t1`, []RuleApplication{{Pass: 1, Rule: "ProjectionPushdown", Node: ProjectNodeType}}},
+        // the columns are pushed down again once the predicate no longer needs c3
+        {`SELECT c1 FROM t1 WHERE MATCH(c2, 'apple') AND c3 > 1 + 1`, []RuleApplication{
+            {Pass: 1, Rule: "ProjectionPushdown", Node: ProjectNodeType},
+            {Pass: 1, Rule: "ConstantExpressionEvaluator", Node: SelectNodeType},
+            {Pass: 1, Rule: "SearchPredicatePushdown", Node: SelectNodeType},
+            {Pass: 1, Rule: "PredicatePushdown", Node: SelectNodeType},
+            {Pass: 2, Rule: "ProjectionPushdown", Node: ProjectNodeType},
+        }},
+        {`EXPLAIN SELECT c1 FROM t1 WHERE MATCH(c2, 'apple')`, []RuleApplication{
+            {Pass: 1, Rule: "ProjectionPushdown", Node: ProjectNodeType},
+            {Pass: 1, Rule: "SearchPredicatePushdown", Node: SelectNodeType},
+            {Pass: 2, Rule: "ProjectionPushdown", Node: ProjectNodeType},
+        }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt, meta)
+            require.NoError(t, err)
+            plan, err := NewQueryPlan(root)
+            require.NoError(t, err)
+            _, trace, err := NewOptimizer(DefaultRules(time.Now())...).Optimize(plan)
+            require.NoError(t, err)
+            require.Equal(t, tt.expected, trace)
+        })
+    }
+}
+
+// selectElimination replaces a select node without a predicate with its child.
+type selectElimination struct{}
+
+func (s selectElimination) Name() string        { return "SelectElimination" }
+func (s selectElimination) Matches() []NodeType { return []NodeType{SelectNodeType} }
+func (s selectElimination) Apply(node PlanNode) (PlanNode, bool, error) {
+    if node.(*SelectNode).Predicate != nil {
+        return node, false, nil
+    }
+    return node.Child(), true, nil
+}
+
+// restless claims to rewrite every node it is given.
+type restless struct{}
+
+func (r restless) Name() string        { return "Restless" }
+func (r restless) Matches() []NodeType { return []NodeType{LimitNodeType} }
+func (r restless) Apply(node PlanNode) (PlanNode, bool, error) {
+    return node, true, nil
+}
+
+func Test_OptimizerFixpoint(t *testing.T) {
+    teardown, meta := setupSuite(t, data)
+    defer teardown(t)
+
+    root, err := parse(`SELECT c1 FROM t1 WHERE 1 = 1 LIMIT 5`, meta)
+    require.NoError(t, err)
+    plan, err := NewQueryPlan(root)
+    require.NoError(t, err)
+
+    // the predicate is folded away after the select node has been offered to SelectElimination,
+    // so the select node is only eliminated in the second pass
+    optimizer := NewOptimizer(selectElimination{}, NewConstantExpressionEvaluator(time.Now()))
+    plan, trace, err := optimizer.Optimize(plan)
+    require.NoError(t, err)
+    require.Equal(t, []RuleApplication{
+        {Pass: 1, Rule: "ConstantExpressionEvaluator", Node: SelectNodeType},
+        {Pass: 2, Rule: "SelectElimination", Node: SelectNodeType},
+    }, trace)
+
+    lines, err := ExplainQueryPlan(plan)
+    require.NoError(t, err)
+    require.Equal(t, []string{"Project [c1]", "  Limit 5", "    Relation t1"}, lines)
+
+    _, _, err = NewOptimizer(restless{}).Optimize(plan)
+    require.ErrorContains(t, err, "fixpoint")
+}
+
+var ignoreResolvedTypes = cmp.Options{
+    cmpopts.IgnoreFields(ast.ParenthesizedExpressionNode{}, "ResolvedType"),
+    cmpopts.IgnoreFields(ast.LogicalNegationNode{}, "ResolvedType"),
+    cmpopts.IgnoreFields(ast.UnaryExpressionNode{}, "ResolvedType"),
+    cmpopts.IgnoreFields(ast.BinaryExpressionNode{}, "ResolvedType"),
+}
+
 func parse(statement string, meta metastore.Service) (ast.VisitableNode, error) {
     tokens, err := parser.LexicalScan(statement)
     if err != nil {
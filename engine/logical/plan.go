@@ -12,6 +12,43 @@ type QueryPlan struct {
 type PlanNode interface {
     Accept(PlanNodeVisitor) error
     Child() PlanNode
+    Type() NodeType
+}
+
+// NodeType identifies the kind of a plan node. Optimization rules declare the node types they
+// rewrite by it.
+type NodeType int
+
+const (
+    ProjectNodeType NodeType = iota
+    SelectNodeType
+    AggregateNodeType
+    LimitNodeType
+    SortNodeType
+    TopNNodeType
+    RelationNodeType
+    ValuesNodeType
+    TableNodeType
+    TablesNodeType
+    ExplainNodeType
+)
+
+var nodeTypes = [...]string{
+    ProjectNodeType:   "Project",
+    SelectNodeType:    "Select",
+    AggregateNodeType: "Aggregate",
+    LimitNodeType:     "Limit",
+    SortNodeType:      "Sort",
+    TopNNodeType:      "TopN",
+    RelationNodeType:  "Relation",
+    ValuesNodeType:    "Values",
+    TableNodeType:     "Table",
+    TablesNodeType:    "Tables",
+    ExplainNodeType:   "Explain",
+}
+
+func (t NodeType) String() string {
+    return nodeTypes[t]
 }
 
 type PlanNodeVisitor interface {
@@ -19,23 +56,123 @@ type PlanNodeVisitor interface {
     VisitTablesNode(*TablesNode) error
     VisitProjectNode(*ProjectNode) error
     VisitSelectNode(*SelectNode) error
+    VisitAggregateNode(*AggregateNode) error
     VisitLimitNode(*LimitNode) error
+    VisitSortNode(*SortNode) error
+    VisitTopNNode(*TopNNode) error
     VisitRelationNode(*RelationNode) error
+    VisitValuesNode(*ValuesNode) error
+    VisitExplainNode(*ExplainNode) error
 }
 
 func NewQueryPlan(node ast.VisitableNode) (*QueryPlan, error) {
-    switch v := node.(type) {
-    case *ast.SelectStatementNode:
-        return newSelectStatementPlan(v), nil
-    case *ast.ShowTablesStatementNode:
-        return newShowTablesPlan(), nil
-    case *ast.CreateTableStatementNode:
-        return newCreateTableStatementPlan(v), nil
-    default:
-        return nil, fmt.Errorf("cannot create query plan for node type: %T", v)
+    builder := &PlanBuilder{}
+    if err := node.Accept(builder); err != nil {
+        return nil, err
+    }
+    return builder.plan, nil
+}
+
+/* *** Plan Builder *** */
+
+// PlanBuilder creates the logical plan of a statement. Only statements that are executed have
+// a plan, so visiting any other node is an error.
+type PlanBuilder struct {
+    plan *QueryPlan
+}
+
+func (b *PlanBuilder) VisitSelectStatementNode(node *ast.SelectStatementNode) error {
+    b.plan = newSelectStatementPlan(node)
+    return nil
+}
+
+func (b *PlanBuilder) VisitShowTablesStatementNode(*ast.ShowTablesStatementNode) error {
+    b.plan = newShowTablesPlan()
+    return nil
+}
+
+func (b *PlanBuilder) VisitCreateTableStatementNode(node *ast.CreateTableStatementNode) error {
+    b.plan = newCreateTableStatementPlan(node)
+    return nil
+}
+
+func (b *PlanBuilder) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    plan, err := newExplainStatementPlan(node)
+    if err != nil {
+        return err
     }
+    b.plan = plan
+    return nil
+}
+
+func (b *PlanBuilder) unsupported(node ast.VisitableNode) error {
+    return fmt.Errorf("cannot create query plan for node type: %T", node)
+}
+
+func (b *PlanBuilder) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return b.unsupported(node)
+}
+
+func (b *PlanBuilder) VisitExecuteStatementNode(node *ast.ExecuteStatementNode) error {
+    return b.unsupported(node)
+}
+
+func (b *PlanBuilder) VisitDeallocateStatementNode(node *ast.DeallocateStatementNode) error {
+    return b.unsupported(node)
 }
 
+func (b *PlanBuilder) VisitPredicateNode(node *ast.PredicateNode) error { return b.unsupported(node) }
+func (b *PlanBuilder) VisitColumnDefinitionNode(node *ast.ColumnDefinitionNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitTableIdentifierNode(node *ast.TableIdentifierNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitColumnIdentifierNode(node *ast.ColumnIdentifierNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitParenthesizedExpression(node *ast.ParenthesizedExpressionNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitLogicalNegationNode(node *ast.LogicalNegationNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitUnaryExpressionNode(node *ast.UnaryExpressionNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitBinaryExpressionNode(node *ast.BinaryExpressionNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitStringLiteralNode(node *ast.StringLiteralNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitIntegerLiteralNode(node *ast.IntegerLiteralNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitFloatLiteralNode(node *ast.FloatLiteralNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitBooleanLiteralNode(node *ast.BooleanLiteralNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitTimestampLiteralNode(node *ast.TimestampLiteralNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitIntervalLiteralNode(node *ast.IntervalLiteralNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitAsteriskLiteralNode(node *ast.AsteriskLiteralNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitPlaceholderNode(node *ast.PlaceholderNode) error {
+    return b.unsupported(node)
+}
+func (b *PlanBuilder) VisitOrderByNode(node *ast.OrderByNode) error { return b.unsupported(node) }
+func (b *PlanBuilder) VisitLimitNode(node *ast.LimitNode) error     { return b.unsupported(node) }
+
 func newShowTablesPlan() *QueryPlan {
     project := NewProjectNode(NewTablesNode(), nil)
     return &QueryPlan{ProjectNode: *project}
@@ -50,36 +187,57 @@ func newCreateTableStatementPlan(node *ast.CreateTableStatementNode) *QueryPlan
     return &QueryPlan{ProjectNode: *project}
 }
 
+func newExplainStatementPlan(node *ast.ExplainStatementNode) (*QueryPlan, error) {
+    plan, err := NewQueryPlan(node.Statement)
+    if err != nil {
+        return nil, err
+    }
+    project := NewProjectNode(NewExplainNode(plan, node.Analyze, node.Format), nil)
+    return &QueryPlan{ProjectNode: *project}, nil
+}
+
 func newSelectStatementPlan(node *ast.SelectStatementNode) *QueryPlan {
-    var project *ProjectNode
-    if node.Limit != nil {
-        project = NewProjectNode(
-            NewLimitNode(
-                NewSelectNode(NewRelationNode(node.Table), node.Predicate),
-                node.Limit.Limit),
-            node.Expressions)
+    var source PlanNode
+    if node.Table == nil {
+        source = NewValuesNode()
     } else {
-        project = NewProjectNode(
-            NewSelectNode(NewRelationNode(node.Table), node.Predicate), node.Expressions)
+        relation := NewRelationNode(node.Table)
+        relation.Highlights = ast.Highlights(node.Expressions)
+        source = relation
+    }
+
+    var child PlanNode = NewSelectNode(source, node.Predicate)
+    if aggregates := ast.Aggregates(node.Expressions); aggregates != nil {
+        child = NewAggregateNode(child, aggregates)
+    }
+    if node.OrderBy != nil {
+        child = NewSortNode(child, node.OrderBy.Terms)
+    }
+    if node.Limit != nil {
+        child = NewLimitNode(child, node.Limit.Limit)
     }
+    project := NewProjectNode(child, node.Expressions)
     return &QueryPlan{ProjectNode: *project}
 }
 
 func getSelectNode(plan *QueryPlan) *SelectNode {
-    sn, ok := plan.ProjectNode.child.(*SelectNode)
-    if ok {
-        return sn
-    }
-    ln, ok := plan.ProjectNode.child.(*LimitNode)
-    if ok {
-        sn, ok = ln.child.(*SelectNode)
-        if ok {
+    for node := plan.ProjectNode.Child(); node != nil; node = node.Child() {
+        if sn, ok := node.(*SelectNode); ok {
             return sn
         }
     }
     return nil
 }
 
+func getRelationNode(plan *QueryPlan) *RelationNode {
+    for node := plan.ProjectNode.Child(); node != nil; node = node.Child() {
+        if rn, ok := node.(*RelationNode); ok {
+            return rn
+        }
+    }
+    return nil
+}
+
 /* *** Tables *** */
 
 type TablesNode struct{}
@@ -92,10 +250,43 @@ func (t *TablesNode) Child() PlanNode {
     return nil
 }
 
+func (t *TablesNode) Type() NodeType {
+    return TablesNodeType
+}
+
 func (t *TablesNode) Accept(visitor PlanNodeVisitor) error {
     return visitor.VisitTablesNode(t)
 }
 
+/* *** Explain Node *** */
+
+type ExplainNode struct {
+    Plan    *QueryPlan
+    Analyze bool
+    Format  ast.ExplainFormat
+    Rules   []RuleApplication // the rules that rewrote the plan when it was optimized
+}
+
+func NewExplainNode(plan *QueryPlan, analyze bool, format ast.ExplainFormat) *ExplainNode {
+    return &ExplainNode{
+        Plan:    plan,
+        Analyze: analyze,
+        Format:  format,
+    }
+}
+
+func (e *ExplainNode) Child() PlanNode {
+    return nil
+}
+
+func (e *ExplainNode) Type() NodeType {
+    return ExplainNodeType
+}
+
+func (e *ExplainNode) Accept(visitor PlanNodeVisitor) error {
+    return visitor.VisitExplainNode(e)
+}
+
 /* *** Table Node *** */
 
 type TableNode struct {
@@ -116,6 +307,10 @@ func (t *TableNode) Child() PlanNode {
     return nil
 }
 
+func (t *TableNode) Type() NodeType {
+    return TableNodeType
+}
+
 func (t *TableNode) Accept(visitor PlanNodeVisitor) error {
     return visitor.VisitTableNode(t)
 }
@@ -124,6 +319,7 @@ func (t *TableNode) Accept(visitor PlanNodeVisitor) error {
 
 type ProjectNode struct {
     projections []ast.ExpressionNode
+    names       []string // the projections as written, before the optimizer rewrites them
     child       PlanNode
 }
 
@@ -131,6 +327,10 @@ func (p *ProjectNode) Child() PlanNode {
     return p.child
 }
 
+func (p *ProjectNode) Type() NodeType {
+    return ProjectNodeType
+}
+
 func (p *ProjectNode) Accept(visitor PlanNodeVisitor) error {
     return visitor.VisitProjectNode(p)
 }
@@ -139,13 +339,22 @@ func (p *ProjectNode) Projections() []ast.ExpressionNode {
     return p.projections
 }
 
+// Names returns the column names of the projections, which are the projections as they were
+// written in the statement.
+func (p *ProjectNode) Names() []string {
+    return p.names
+}
+
 func NewProjectNode(child PlanNode, expressions []ast.ExpressionNode) *ProjectNode {
     projections := make([]ast.ExpressionNode, 0)
+    names := make([]string, 0)
     for _, expression := range expressions {
         projections = append(projections, expression)
+        names = append(names, expression.String())
     }
     return &ProjectNode{
         projections: projections,
+        names:       names,
         child:       child,
     }
 }
@@ -161,6 +370,10 @@ func (s *SelectNode) Child() PlanNode {
     return s.child
 }
 
+func (s *SelectNode) Type() NodeType {
+    return SelectNodeType
+}
+
 func (s *SelectNode) Accept(visitor PlanNodeVisitor) error {
     return visitor.VisitSelectNode(s)
 }
@@ -178,6 +391,41 @@ func NewSelectNode(child PlanNode, predicate *ast.PredicateNode) *SelectNode {
     }
 }
 
+/* *** Aggregate Node *** */
+
+// AggregateNode computes aggregate functions over every record of its child and produces a single
+// record. Its columns are named by the calls as they were written in the statement, which is how
+// the projections above it read them.
+type AggregateNode struct {
+    Aggregates []*ast.FunctionCallNode
+    Names      []string
+    child      PlanNode
+}
+
+func (a *AggregateNode) Child() PlanNode {
+    return a.child
+}
+
+func (a *AggregateNode) Type() NodeType {
+    return AggregateNodeType
+}
+
+func (a *AggregateNode) Accept(visitor PlanNodeVisitor) error {
+    return visitor.VisitAggregateNode(a)
+}
+
+func NewAggregateNode(child PlanNode, aggregates []*ast.FunctionCallNode) *AggregateNode {
+    names := make([]string, len(aggregates))
+    for i, aggregate := range aggregates {
+        names[i] = aggregate.String()
+    }
+    return &AggregateNode{
+        Aggregates: aggregates,
+        Names:      names,
+        child:      child,
+    }
+}
+
 /* *** Limit Node *** */
 
 type LimitNode struct {
@@ -189,6 +437,10 @@ func (l *LimitNode) Child() PlanNode {
     return l.child
 }
 
+func (l *LimitNode) Type() NodeType {
+    return LimitNodeType
+}
+
 func (l *LimitNode) Accept(visitor PlanNodeVisitor) error {
     return visitor.VisitLimitNode(l)
 }
@@ -199,10 +451,68 @@ func NewLimitNode(child PlanNode, node ast.IntegerLiteralNode) *LimitNode {
         child: child}
 }
 
+/* *** Sort Node *** */
+
+type SortNode struct {
+    Terms []ast.OrderingTerm
+    child PlanNode
+}
+
+func (s *SortNode) Child() PlanNode {
+    return s.child
+}
+
+func (s *SortNode) Type() NodeType {
+    return SortNodeType
+}
+
+func (s *SortNode) Accept(visitor PlanNodeVisitor) error {
+    return visitor.VisitSortNode(s)
+}
+
+func NewSortNode(child PlanNode, terms []ast.OrderingTerm) *SortNode {
+    return &SortNode{
+        Terms: terms,
+        child: child,
+    }
+}
+
+/* *** Top-N Node *** */
+
+// TopNNode orders the records of its child and keeps the first Limit of them. It is not built from
+// a statement; TopNFusion replaces a limit over a sort with one.
+type TopNNode struct {
+    Terms []ast.OrderingTerm
+    Limit ast.IntegerLiteralNode
+    child PlanNode
+}
+
+func (t *TopNNode) Child() PlanNode {
+    return t.child
+}
+
+func (t *TopNNode) Type() NodeType {
+    return TopNNodeType
+}
+
+func (t *TopNNode) Accept(visitor PlanNodeVisitor) error {
+    return visitor.VisitTopNNode(t)
+}
+
+func NewTopNNode(child PlanNode, terms []ast.OrderingTerm, limit ast.IntegerLiteralNode) *TopNNode {
+    return &TopNNode{
+        Terms: terms,
+        Limit: limit,
+        child: child,
+    }
+}
+
 /* *** Relation Node *** */
 
 type RelationNode struct {
     PushedPredicate ast.ExpressionNode
+    Highlights      []string // fields whose matching fragments are highlighted by the search index
+    Columns         []string // stored fields the plan reads, or nil to read all of them
     Relation        *ast.TableIdentifierNode
 }
 
@@ -210,6 +520,10 @@ func (r *RelationNode) Child() PlanNode {
     return nil
 }
 
+func (r *RelationNode) Type() NodeType {
+    return RelationNodeType
+}
+
 func (r *RelationNode) Accept(visitor PlanNodeVisitor) error {
     return visitor.VisitRelationNode(r)
 }
@@ -219,3 +533,32 @@ func NewRelationNode(relation *ast.TableIdentifierNode) *RelationNode {
         Relation: relation,
     }
 }
+
+/* *** Values Node *** */
+
+// ValuesNode is the relation of a SELECT without a FROM clause: a single row without columns,
+// against which constant expressions are evaluated once. An empty ValuesNode has no rows at all;
+// it stands in for a relation whose predicate no row can satisfy.
+type ValuesNode struct {
+    Empty bool
+}
+
+func NewValuesNode() *ValuesNode {
+    return &ValuesNode{}
+}
+
+func NewEmptyValuesNode() *ValuesNode {
+    return &ValuesNode{Empty: true}
+}
+
+func (v *ValuesNode) Child() PlanNode {
+    return nil
+}
+
+func (v *ValuesNode) Type() NodeType {
+    return ValuesNodeType
+}
+
+func (v *ValuesNode) Accept(visitor PlanNodeVisitor) error {
+    return visitor.VisitValuesNode(v)
+}
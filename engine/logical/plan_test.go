@@ -55,10 +55,10 @@ func TestPlan_NewLogicalQueryPlan_Select(t *testing.T) {
 		stmt string
 	}{
 		{`SELECT 5`},
-		{`SELECT "a"`},
+		{`SELECT 'a'`},
 		{`SELECT c1 FROM t1`},
 		{`SELECT c1 FROM t1 LIMIT 5`},
-		{`SELECT c1 * 2.5 FROM t1`},
+		{`SELECT c3 * 2.5 FROM t1`},
 		{`SELECT (c1) FROM t1`},
 		{`SELECT c1, c2 FROM t1 WHERE c3 = 1`},
 		{`SELECT c1, c2 FROM t1 WHERE c3 = 1 LIMIT 5`},
@@ -119,3 +119,10 @@ func TestPlan_NewLogicalQueryPlan_InvalidCreateTable(t *testing.T) {
 		})
 	}
 }
+
+func TestPlan_NewQueryPlanUnsupported(t *testing.T) {
+	root, err := parser.ParseStatement(`DEALLOCATE q`)
+	require.NoError(t, err)
+	_, err = NewQueryPlan(root)
+	require.ErrorContains(t, err, "cannot create query plan")
+}
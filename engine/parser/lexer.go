@@ -1,111 +1,271 @@
 package parser
 
 import (
-    "fmt"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
     "github.com/aleph-zero/flutterdb/engine/token"
-    "regexp"
     "strings"
     "text/scanner"
+    "unicode"
+    "unicode/utf8"
 )
 
-type TokenPattern struct {
-    regex *regexp.Regexp
-    token.TokenType
+// LexicalScan splits a SQL statement into tokens, terminated by an EOF token.
+//
+// Strings are enclosed in single quotes, with a doubled quote standing for a literal one
+// ('it''s'). Double quotes enclose identifiers, which are then taken verbatim and never as
+// keywords ("order"). Numbers may carry a fraction and an exponent (1, 1.5, .5, 1e10, 2.5E-3).
+// Comments run from -- to the end of the line, or between /* and */.
+func LexicalScan(src string) ([]token.Token, error) {
+    l := &lexer{src: src, line: 1, column: 1}
+    tokens := make([]token.Token, 0, 10)
+    for {
+        tok, err := l.next()
+        if err != nil {
+            return nil, err
+        }
+        tokens = append(tokens, tok)
+        if tok.TokenType == token.EOF {
+            return tokens, nil
+        }
+    }
 }
 
-var patterns = []TokenPattern{
-    {regex: regexp.MustCompile(`(?i)^SELECT$`), TokenType: token.SELECT},
-    {regex: regexp.MustCompile(`(?i)^FROM$`), TokenType: token.FROM},
-    {regex: regexp.MustCompile(`(?i)^WHERE$`), TokenType: token.WHERE},
-    {regex: regexp.MustCompile(`(?i)^CREATE$`), TokenType: token.CREATE},
-    {regex: regexp.MustCompile(`(?i)^TABLE$`), TokenType: token.TABLE},
-    {regex: regexp.MustCompile(`(?i)^AND$`), TokenType: token.AND},
-    {regex: regexp.MustCompile(`(?i)^OR$`), TokenType: token.OR},
-    {regex: regexp.MustCompile(`(?i)^NOT$`), TokenType: token.NOT},
-    {regex: regexp.MustCompile(`(?i)^LIMIT$`), TokenType: token.LIMIT},
-    {regex: regexp.MustCompile(`(?i)^LIKE$`), TokenType: token.LIKE},
-    {regex: regexp.MustCompile(`(?i)^SHOW$`), TokenType: token.SHOW},
-    {regex: regexp.MustCompile(`(?i)^TABLES$`), TokenType: token.TABLES},
-    {regex: regexp.MustCompile(`(?i)^PARTITION$`), TokenType: token.PARTITION},
-    {regex: regexp.MustCompile(`(?i)^ORDER$`), TokenType: token.ORDER},
-    {regex: regexp.MustCompile(`(?i)^BY$`), TokenType: token.BY},
-    {regex: regexp.MustCompile(`(?i)^TEXT$`), TokenType: token.TEXT},
-    {regex: regexp.MustCompile(`(?i)^KEYWORD$`), TokenType: token.KEYWORD},
-    {regex: regexp.MustCompile(`(?i)^INTEGER$`), TokenType: token.INTEGER},
-    {regex: regexp.MustCompile(`(?i)^FLOAT$`), TokenType: token.FLOAT},
-    {regex: regexp.MustCompile(`(?i)^DATETIME$`), TokenType: token.DATETIME},
-    {regex: regexp.MustCompile(`(?i)^GEOPOINT$`), TokenType: token.GEOPOINT},
-    {regex: regexp.MustCompile(`"([^"\\]*(?:\\.[^"\\]*)*)"|'([^'\\]*(?:\\.[^'\\]*)*)'`), TokenType: token.STRING},
-    {regex: regexp.MustCompile(`[_a-zA-Z][_a-zA-Z0-9]*`), TokenType: token.IDENTIFIER},
-    {regex: regexp.MustCompile(`[0-9]+\.[0-9]+`), TokenType: token.FLOAT},
-    {regex: regexp.MustCompile(`\d+`), TokenType: token.INTEGER},
-    {regex: regexp.MustCompile(`,`), TokenType: token.COMMA},
-    {regex: regexp.MustCompile(`\+`), TokenType: token.PLUS},
-    {regex: regexp.MustCompile(`-`), TokenType: token.MINUS},
-    {regex: regexp.MustCompile(`/`), TokenType: token.DIVIDE},
-    {regex: regexp.MustCompile(`\*`), TokenType: token.ASTERISK},
-    {regex: regexp.MustCompile(`%`), TokenType: token.MODULO},
-    {regex: regexp.MustCompile(`\(`), TokenType: token.L_PAREN},
-    {regex: regexp.MustCompile(`\)`), TokenType: token.R_PAREN},
-    {regex: regexp.MustCompile(`!=`), TokenType: token.NOT_EQUAL},
-    {regex: regexp.MustCompile(`>=`), TokenType: token.GTE},
-    {regex: regexp.MustCompile(`>`), TokenType: token.GT},
-    {regex: regexp.MustCompile(`<=`), TokenType: token.LTE},
-    {regex: regexp.MustCompile(`<`), TokenType: token.LT},
-    {regex: regexp.MustCompile(`<=`), TokenType: token.LTE},
-    {regex: regexp.MustCompile(`=`), TokenType: token.EQUAL},
-    {regex: regexp.MustCompile(`!`), TokenType: token.BANG},
+type lexer struct {
+    src    string
+    offset int // byte offset of the next rune
+    line   int
+    column int // column of the next rune, counted in runes
 }
 
-func LexicalScan(src string) ([]token.Token, error) {
-    tokens := make([]token.Token, 0, 10)
-    var s scanner.Scanner
-    s.Init(strings.NewReader(src))
+func (l *lexer) position() scanner.Position {
+    return scanner.Position{Offset: l.offset, Line: l.line, Column: l.column}
+}
 
-    for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-        matched := false
-        text := s.TokenText()
-        position := s.Position
+// peek returns the rune n runes ahead of the next one, or EOF.
+func (l *lexer) peek(n int) rune {
+    offset := l.offset
+    for ; offset < len(l.src); n-- {
+        r, size := utf8.DecodeRuneInString(l.src[offset:])
+        if n == 0 {
+            return r
+        }
+        offset += size
+    }
+    return scanner.EOF
+}
 
+func (l *lexer) advance() rune {
+    r, size := utf8.DecodeRuneInString(l.src[l.offset:])
+    l.offset += size
+    if r == '\n' {
+        l.line++
+        l.column = 1
+    } else {
+        l.column++
+    }
+    return r
+}
+
+func (l *lexer) next() (token.Token, error) {
+    if err := l.skipWhitespaceAndComments(); err != nil {
+        return token.Token{}, err
+    }
+
+    start := l.position()
+    emit := func(tokenType token.TokenType, lexeme string) (token.Token, error) {
+        return token.Token{TokenType: tokenType, Lexeme: lexeme, Position: start}, nil
+    }
+
+    r := l.peek(0)
+    switch {
+    case r == scanner.EOF:
+        return emit(token.EOF, "")
+    case isIdentifierStart(r):
+        ident := l.identifier()
+        if tokenType, ok := token.LookupKeyword(ident); ok {
+            return emit(tokenType, ident)
+        }
+        return emit(token.IDENTIFIER, ident)
+    case isDigit(r) || r == '.' && isDigit(l.peek(1)):
+        return l.number(start)
+    case r == '\'':
+        s, err := l.quoted('\'', "string")
+        if err != nil {
+            return token.Token{}, err
+        }
+        return emit(token.STRING, s)
+    case r == '"':
+        ident, err := l.quoted('"', "quoted identifier")
+        if err != nil {
+            return token.Token{}, err
+        }
+        if ident == "" {
+            return token.Token{}, lexicalError(start, "zero-length quoted identifier")
+        }
+        return emit(token.IDENTIFIER, ident)
+    case r == '$':
+        l.advance()
+        if !isDigit(l.peek(0)) || l.peek(0) == '0' {
+            return token.Token{}, lexicalError(start, "placeholder must be '$' followed by a positive integer")
+        }
+        for isDigit(l.peek(0)) {
+            l.advance()
+        }
+        return emit(token.PLACEHOLDER, l.src[start.Offset:l.offset])
+    }
+
+    l.advance()
+    switch r {
+    case '?':
+        return emit(token.PLACEHOLDER, "?")
+    case ',':
+        return emit(token.COMMA, ",")
+    case ';':
+        return emit(token.SEMICOLON, ";")
+    case '(':
+        return emit(token.L_PAREN, "(")
+    case ')':
+        return emit(token.R_PAREN, ")")
+    case '+':
+        return emit(token.PLUS, "+")
+    case '-':
+        return emit(token.MINUS, "-")
+    case '*':
+        return emit(token.ASTERISK, "*")
+    case '/':
+        return emit(token.DIVIDE, "/")
+    case '%':
+        return emit(token.MODULO, "%")
+    case '=':
+        return emit(token.EQUAL, "=")
+    case '!':
+        if l.peek(0) == '=' {
+            l.advance()
+            return emit(token.NOT_EQUAL, "!=")
+        }
+        return emit(token.BANG, "!")
+    case '<':
+        switch l.peek(0) {
+        case '=':
+            l.advance()
+            return emit(token.LTE, "<=")
+        case '>':
+            l.advance()
+            return emit(token.NOT_EQUAL, "<>")
+        }
+        return emit(token.LT, "<")
+    case '>':
+        if l.peek(0) == '=' {
+            l.advance()
+            return emit(token.GTE, ">=")
+        }
+        return emit(token.GT, ">")
+    }
+
+    return token.Token{}, lexicalError(start, "unexpected character %q", r)
+}
+
+func (l *lexer) skipWhitespaceAndComments() error {
+    for {
+        r := l.peek(0)
         switch {
-        case text == "!":
-            if s.Peek() == '=' {
-                s.Scan()
-                text += s.TokenText()
+        case unicode.IsSpace(r):
+            l.advance()
+        case r == '-' && l.peek(1) == '-':
+            for r := l.peek(0); r != '\n' && r != scanner.EOF; r = l.peek(0) {
+                l.advance()
             }
-        case text == ">":
-            if s.Peek() == '=' {
-                s.Scan()
-                text += s.TokenText()
-            }
-        case text == "<":
-            if s.Peek() == '=' {
-                s.Scan()
-                text += s.TokenText()
+        case r == '/' && l.peek(1) == '*':
+            start := l.position()
+            l.advance()
+            l.advance()
+            for !(l.peek(0) == '*' && l.peek(1) == '/') {
+                if l.peek(0) == scanner.EOF {
+                    return lexicalError(start, "unterminated comment")
+                }
+                l.advance()
             }
+            l.advance()
+            l.advance()
+        default:
+            return nil
         }
+    }
+}
 
-        for _, pattern := range patterns {
-            str := pattern.regex.FindString(text)
-            if str != "" {
-                matched = true
-                if pattern.TokenType == token.STRING {
-                    text = strings.Trim(text, "\"")
-                }
-                tokens = append(tokens, token.Token{
-                    TokenType: pattern.TokenType,
-                    Lexeme:    text,
-                    Position:  position,
-                })
-                break
-            }
+func (l *lexer) identifier() string {
+    start := l.offset
+    for isIdentifierStart(l.peek(0)) || isDigit(l.peek(0)) {
+        l.advance()
+    }
+    return l.src[start:l.offset]
+}
+
+// number scans an integer or a float: digits, an optional fraction and an optional exponent.
+func (l *lexer) number(start scanner.Position) (token.Token, error) {
+    tokenType := token.INTEGER
+    digits := func() {
+        for isDigit(l.peek(0)) {
+            l.advance()
+        }
+    }
+
+    digits()
+    if l.peek(0) == '.' {
+        tokenType = token.FLOAT
+        l.advance()
+        digits()
+    }
+    if r := l.peek(0); r == 'e' || r == 'E' {
+        tokenType = token.FLOAT
+        l.advance()
+        if r := l.peek(0); r == '+' || r == '-' {
+            l.advance()
+        }
+        if !isDigit(l.peek(0)) {
+            return token.Token{}, lexicalError(start, "missing exponent in numeric literal")
         }
+        digits()
+    }
+
+    lexeme := l.src[start.Offset:l.offset]
+    if r := l.peek(0); isIdentifierStart(r) || r == '.' {
+        return token.Token{}, lexicalError(start, "invalid numeric literal '%s%c'", lexeme, r)
+    }
+    return token.Token{TokenType: tokenType, Lexeme: lexeme, Position: start}, nil
+}
+
+// quoted scans text enclosed in quote characters, in which a doubled quote stands for one.
+func (l *lexer) quoted(quote rune, what string) (string, error) {
+    start := l.position()
+    l.advance()
 
-        if !matched {
-            return nil, fmt.Errorf("unrecognized lexical pattern: %s at position: %s", s.TokenText(), s.Position)
+    var sb strings.Builder
+    for {
+        switch r := l.peek(0); {
+        case r == scanner.EOF:
+            return "", lexicalError(start, "unterminated %s", what)
+        case r == quote && l.peek(1) == quote:
+            l.advance()
+            l.advance()
+            sb.WriteRune(quote)
+        case r == quote:
+            l.advance()
+            return sb.String(), nil
+        default:
+            sb.WriteRune(l.advance())
         }
     }
+}
+
+func isIdentifierStart(r rune) bool {
+    return r == '_' || unicode.IsLetter(r)
+}
+
+func isDigit(r rune) bool {
+    return '0' <= r && r <= '9'
+}
 
-    tokens = append(tokens, token.Token{TokenType: token.EOF})
-    return tokens, nil
+func lexicalError(position scanner.Position, format string, args ...any) error {
+    return diagnostic.New(diagnostic.LexicalError, position, format, args...)
 }
@@ -12,8 +12,24 @@ func TestScan(t *testing.T) {
 		expected []token.TokenType
 	}{
 		{`a`, []token.TokenType{token.IDENTIFIER, token.EOF}},
-		{`"a"`, []token.TokenType{token.STRING, token.EOF}},
+		{`"a"`, []token.TokenType{token.IDENTIFIER, token.EOF}},
 		{`'a'`, []token.TokenType{token.STRING, token.EOF}},
+		{`"select"`, []token.TokenType{token.IDENTIFIER, token.EOF}},
+		{`select`, []token.TokenType{token.SELECT, token.EOF}},
+		{`1`, []token.TokenType{token.INTEGER, token.EOF}},
+		{`1.5 .5 1. 1e10 2.5E-3 7e+2`, []token.TokenType{token.FLOAT, token.FLOAT, token.FLOAT, token.FLOAT, token.FLOAT, token.FLOAT, token.EOF}},
+		{`$1 ?`, []token.TokenType{token.PLACEHOLDER, token.PLACEHOLDER, token.EOF}},
+		{`a; b`, []token.TokenType{token.IDENTIFIER, token.SEMICOLON, token.IDENTIFIER, token.EOF}},
+		{`a!=b<>c<=d>=e<f>g=h`, []token.TokenType{
+			token.IDENTIFIER, token.NOT_EQUAL, token.IDENTIFIER, token.NOT_EQUAL, token.IDENTIFIER, token.LTE,
+			token.IDENTIFIER, token.GTE, token.IDENTIFIER, token.LT, token.IDENTIFIER, token.GT, token.IDENTIFIER,
+			token.EQUAL, token.IDENTIFIER, token.EOF}},
+		{`- -1`, []token.TokenType{token.MINUS, token.MINUS, token.INTEGER, token.EOF}},
+		{`1 -- a comment`, []token.TokenType{token.INTEGER, token.EOF}},
+		{"1 -- a comment\n+ 2", []token.TokenType{token.INTEGER, token.PLUS, token.INTEGER, token.EOF}},
+		{`1 /* a * comment */ / 2`, []token.TokenType{token.INTEGER, token.DIVIDE, token.INTEGER, token.EOF}},
+		{`a/**/b`, []token.TokenType{token.IDENTIFIER, token.IDENTIFIER, token.EOF}},
+		{``, []token.TokenType{token.EOF}},
 	}
 
 	for _, tt := range tests {
@@ -25,7 +41,7 @@ func TestScan(t *testing.T) {
 			}
 
 			if len(tokens) != len(tt.expected) {
-				t.Errorf("expected %d tokens, received %d", len(tt.expected), len(tokens))
+				t.Fatalf("expected %d tokens, received %d", len(tt.expected), len(tokens))
 			}
 
 			for i, tok := range tokens {
@@ -36,3 +52,89 @@ func TestScan(t *testing.T) {
 		})
 	}
 }
+
+func TestScan_Lexemes(t *testing.T) {
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{`'it''s'`, `it's`},
+		{`''`, ``},
+		{`'a -- not a comment'`, `a -- not a comment`},
+		{`"Mixed Case"`, `Mixed Case`},
+		{`"say ""hi"""`, `say "hi"`},
+		{`2.5E-3`, `2.5E-3`},
+		{`$12`, `$12`},
+		{`Select`, `Select`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			tokens, err := LexicalScan(tt.text)
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if tokens[0].Lexeme != tt.expected {
+				t.Errorf("expected lexeme %q, received %q", tt.expected, tokens[0].Lexeme)
+			}
+		})
+	}
+}
+
+func TestScan_Positions(t *testing.T) {
+	tokens, err := LexicalScan("SELECT a,\n  /* comment\n */ 'b' -- trailing\nFROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		lexeme       string
+		line, column int
+	}{
+		{"SELECT", 1, 1}, {"a", 1, 8}, {",", 1, 9}, {"b", 3, 5}, {"FROM", 4, 1}, {"t", 4, 6}, {"", 4, 7},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, received %d", len(expected), len(tokens))
+	}
+	for i, tok := range tokens {
+		if tok.Lexeme != expected[i].lexeme || tok.Line != expected[i].line || tok.Column != expected[i].column {
+			t.Errorf("expected %q at %d:%d, received %q at %d:%d", expected[i].lexeme, expected[i].line,
+				expected[i].column, tok.Lexeme, tok.Line, tok.Column)
+		}
+	}
+
+	_, err = parse("SELECT a\nFROM t\nWHERE")
+	if err == nil || err.Error() != "unexpected end of input, expected INTEGER, FLOAT, string, identifier at line 3, column 6" {
+		t.Errorf("unexpected parse error: %v", err)
+	}
+}
+
+func TestScan_Invalid(t *testing.T) {
+
+	tests := []struct {
+		text string
+	}{
+		{`'abc`},
+		{`"abc`},
+		{`""`},
+		{`/* abc`},
+		{`1e`},
+		{`1e+`},
+		{`12abc`},
+		{`1.2.3`},
+		{`$`},
+		{`$0`},
+		{`$a`},
+		{`a # b`},
+		{`.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if _, err := LexicalScan(tt.text); err == nil {
+				t.Errorf("expected lexical error")
+			}
+		})
+	}
+}
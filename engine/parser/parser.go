@@ -1,20 +1,34 @@
 package parser
 
 import (
+    "errors"
     "fmt"
     "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
     "github.com/aleph-zero/flutterdb/engine/token"
     "github.com/aleph-zero/flutterdb/engine/types"
     "strconv"
+    "strings"
 )
 
 /*
+   script                   -> statement? (';' statement?)*
    statement                -> select_statement
                             | create_table_statement
                             | show_tables_statement
-   select_statement         -> 'SELECT' projections ('FROM' IDENTIFIER)? ('WHERE' disjunction)? ('LIMIT' INTEGER)?
+                            | explain_statement
+                            | prepare_statement
+                            | execute_statement
+                            | deallocate_statement
+   prepare_statement        -> 'PREPARE' IDENTIFIER 'AS' (select_statement | explain_statement)
+   execute_statement        -> 'EXECUTE' IDENTIFIER ('(' unary (',' unary)* ')')?
+   deallocate_statement     -> 'DEALLOCATE' IDENTIFIER
+   explain_statement        -> 'EXPLAIN' ('ANALYZE')? ('FORMAT' ('TEXT' | 'JSON'))? select_statement
+   select_statement         -> 'SELECT' projections ('FROM' IDENTIFIER)? ('WHERE' disjunction)? order_by? ('LIMIT' INTEGER)?
    projections              -> disjunction (',' disjunction)*
                             | '*'
+   order_by                 -> 'ORDER' 'BY' ordering_term (',' ordering_term)*
+   ordering_term            -> disjunction ('ASC' | 'DESC')?
    disjunction              -> conjunction ('OR' conjunction)*
    conjunction              -> equality ('AND' equality)*
    negation                 -> ('NOT')* equality
@@ -24,8 +38,12 @@ import (
    factor                   -> unary (('/' | '*' | '%') unary)*
    unary                    -> ('-')? unary
                             | primary ;
-   primary                  -> INTEGER|FLOAT|STRING|IDENTIFIER
+   primary                  -> INTEGER|FLOAT|STRING|IDENTIFIER|PLACEHOLDER
+                            | ('TIMESTAMP' | 'DATE' | 'INTERVAL') STRING
+                            | function_call
                             | '(' disjunction ')' ;
+   function_call            -> 'EXTRACT' '(' IDENTIFIER 'FROM' disjunction ')'
+                            | IDENTIFIER '(' (disjunction (',' disjunction)*)? ')'
 
    create_table_statement   -> 'CREATE' 'TABLE' IDENTIFIER '(' columns ')' ('PARTITION BY' IDENTIFIER)?
    show_tables_statement    -> 'SHOW' 'TABLES'
@@ -36,6 +54,9 @@ import (
 type Parser struct {
     tokens []token.Token
     index  int
+
+    positional int  // number of '?' placeholders seen so far
+    numbered   bool // whether a '$n' placeholder has been seen
 }
 
 func New(tokens []token.Token) *Parser {
@@ -46,9 +67,125 @@ func New(tokens []token.Token) *Parser {
 }
 
 // Parse returns an abstract syntax tree representing the logical structure of
-// the provided SQL statement.
+// the provided SQL statement, which may be terminated by a semicolon.
 func (p *Parser) Parse() (ast.VisitableNode, error) {
-    return p.statement()
+    stmt, err := p.statement()
+    if err != nil {
+        return nil, diagnose(err)
+    }
+
+    p.match(token.SEMICOLON)
+    if !p.eof() {
+        return nil, diagnose(ParseError{
+            Expected: []token.TokenType{token.EOF},
+            Received: p.peek(),
+        })
+    }
+    return stmt, nil
+}
+
+// ParseStatement scans and parses a single statement. Errors are diagnostics with an excerpt of
+// the statement.
+func ParseStatement(src string) (ast.VisitableNode, error) {
+    tokens, err := LexicalScan(src)
+    if err != nil {
+        return nil, diagnostic.WithSource(err, src)
+    }
+    root, err := New(tokens).Parse()
+    if err != nil {
+        return nil, diagnostic.WithSource(err, src)
+    }
+    return root, nil
+}
+
+// Statement is one statement of a script along with its source text.
+type Statement struct {
+    Node ast.VisitableNode
+    Text string
+}
+
+// ParseScript parses a script of statements separated by semicolons. Empty statements are
+// skipped. The script is rejected as a whole if any of its statements fails to parse: after an
+// error the parser resumes at the next semicolon, so that the returned diagnostic.List reports
+// every statement in error.
+func ParseScript(src string) ([]Statement, error) {
+    tokens, err := LexicalScan(src)
+    if err != nil {
+        var d *diagnostic.Diagnostic
+        if !errors.As(err, &d) {
+            return nil, err
+        }
+        return nil, diagnostic.WithSource(diagnostic.List{d}, src)
+    }
+
+    p := New(tokens)
+    statements := make([]Statement, 0)
+    var diagnostics diagnostic.List
+    for !p.eof() {
+        if p.match(token.SEMICOLON) {
+            continue
+        }
+
+        p.positional, p.numbered = 0, false
+        start := p.peek().Offset
+        stmt, err := p.statement()
+        if err == nil && !p.check(token.SEMICOLON) && !p.eof() {
+            err = ParseError{
+                Expected: []token.TokenType{token.SEMICOLON, token.EOF},
+                Received: p.peek(),
+            }
+        }
+        if err != nil {
+            d, ok := diagnose(err).(*diagnostic.Diagnostic)
+            if !ok {
+                d = diagnostic.New(diagnostic.SyntaxError, p.peek().Position, "%s", err)
+            }
+            diagnostics = append(diagnostics, d)
+            p.synchronize()
+            continue
+        }
+
+        end := p.peek().Offset
+        p.match(token.SEMICOLON)
+        statements = append(statements, Statement{Node: stmt, Text: strings.TrimSpace(src[start:end])})
+    }
+
+    if len(diagnostics) > 0 {
+        return nil, diagnostic.WithSource(diagnostics, src)
+    }
+    return statements, nil
+}
+
+// Format parses a script and prints it back as canonical SQL, each statement terminated by a
+// semicolon and on a line of its own. Pretty printing puts each clause on its own line and a
+// blank line between statements. Comments are not preserved.
+func Format(src string, pretty bool) (string, error) {
+    statements, err := ParseScript(src)
+    if err != nil {
+        return "", err
+    }
+
+    var sb strings.Builder
+    for i, stmt := range statements {
+        if i > 0 && pretty {
+            sb.WriteString("\n")
+        }
+        if pretty {
+            sb.WriteString(ast.PrettyPrint(stmt.Node))
+        } else {
+            sb.WriteString(ast.Print(stmt.Node))
+        }
+        sb.WriteString(";\n")
+    }
+    return sb.String(), nil
+}
+
+// synchronize discards the tokens of a statement in error, up to and including the semicolon
+// that ends it.
+func (p *Parser) synchronize() {
+    for !p.eof() && !p.match(token.SEMICOLON) {
+        p.advance()
+    }
 }
 
 func (p *Parser) statement() (ast.VisitableNode, error) {
@@ -71,14 +208,132 @@ func (p *Parser) statement() (ast.VisitableNode, error) {
             }
         }
         return p.showTablesStatement()
+    case p.match(token.EXPLAIN):
+        return p.explainStatement()
+    case p.match(token.PREPARE):
+        return p.prepareStatement()
+    case p.match(token.EXECUTE):
+        return p.executeStatement()
+    case p.match(token.DEALLOCATE):
+        return p.deallocateStatement()
     default:
         return nil, ParseError{
-            Expected: []token.TokenType{token.SELECT, token.CREATE},
+            Expected: []token.TokenType{token.SELECT, token.CREATE, token.SHOW, token.EXPLAIN,
+                token.PREPARE, token.EXECUTE, token.DEALLOCATE},
             Received: p.peek(),
         }
     }
 }
 
+func (p *Parser) explainStatement() (ast.VisitableNode, error) {
+    analyze := p.match(token.ANALYZE)
+
+    format := ast.ExplainFormatText
+    if p.match(token.FORMAT) {
+        switch {
+        case p.match(token.TEXT):
+            format = ast.ExplainFormatText
+        case p.check(token.IDENTIFIER) && strings.EqualFold(p.peek().Lexeme, "JSON"):
+            p.advance()
+            format = ast.ExplainFormatJSON
+        default:
+            return nil, ParseError{
+                Expected: []token.TokenType{token.TEXT, token.IDENTIFIER},
+                Received: p.peek(),
+            }
+        }
+    }
+
+    if !p.match(token.SELECT) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.SELECT},
+            Received: p.peek(),
+        }
+    }
+
+    stmt, err := p.selectStatement()
+    if err != nil {
+        return nil, err
+    }
+    return ast.NewExplainStatementNode(stmt, analyze, format), nil
+}
+
+func (p *Parser) prepareStatement() (ast.VisitableNode, error) {
+    if !p.match(token.IDENTIFIER) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.IDENTIFIER},
+            Received: p.peek(),
+        }
+    }
+    name := p.previous()
+
+    if !p.match(token.AS) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.AS},
+            Received: p.peek(),
+        }
+    }
+
+    var stmt ast.VisitableNode
+    var err error
+    switch {
+    case p.match(token.SELECT):
+        stmt, err = p.selectStatement()
+    case p.match(token.EXPLAIN):
+        stmt, err = p.explainStatement()
+    default:
+        return nil, ParseError{
+            Expected: []token.TokenType{token.SELECT, token.EXPLAIN},
+            Received: p.peek(),
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+    return ast.NewPrepareStatementNode(name.Lexeme, stmt), nil
+}
+
+func (p *Parser) executeStatement() (ast.VisitableNode, error) {
+    if !p.match(token.IDENTIFIER) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.IDENTIFIER},
+            Received: p.peek(),
+        }
+    }
+    name := p.previous()
+
+    var arguments []ast.ExpressionNode
+    if p.match(token.L_PAREN) {
+        for ok := true; ok; ok = p.match(token.COMMA) {
+            argument, err := p.unary()
+            if err != nil {
+                return nil, err
+            }
+            arguments = append(arguments, argument)
+        }
+        if !p.match(token.R_PAREN) {
+            return nil, ParseError{
+                Expected: []token.TokenType{token.COMMA, token.R_PAREN},
+                Received: p.peek(),
+            }
+        }
+    }
+
+    return ast.NewExecuteStatementNode(name.Lexeme, arguments), nil
+}
+
+func (p *Parser) deallocateStatement() (ast.VisitableNode, error) {
+    if !p.match(token.IDENTIFIER) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.IDENTIFIER},
+            Received: p.peek(),
+        }
+    }
+    name := p.previous()
+
+    return ast.NewDeallocateStatementNode(name.Lexeme), nil
+}
+
 func (p *Parser) showTablesStatement() (ast.VisitableNode, error) {
     return ast.NewShowTablesStatementNode(), nil
 }
@@ -139,13 +394,6 @@ func (p *Parser) createTableStatement() (ast.VisitableNode, error) {
         partition = id.(*ast.ColumnIdentifierNode).Value
     }
 
-    if !p.eof() {
-        return nil, ParseError{
-            Expected: []token.TokenType{token.EOF},
-            Received: p.peek(),
-        }
-    }
-
     return ast.NewCreateTableStatementNode(name.Lexeme, cds, partition), nil
 }
 
@@ -210,6 +458,7 @@ func (p *Parser) selectStatement() (ast.VisitableNode, error) {
         }
         tok := p.previous()
         stmt.Table = ast.NewTableIdentifierNode(tok.Lexeme)
+        stmt.Table.Position = tok.Position
     }
 
     if p.match(token.WHERE) {
@@ -220,6 +469,14 @@ func (p *Parser) selectStatement() (ast.VisitableNode, error) {
         stmt.Predicate = ast.NewPredicateNode(predicate)
     }
 
+    if p.match(token.ORDER) {
+        orderBy, err := p.orderBy()
+        if err != nil {
+            return nil, err
+        }
+        stmt.OrderBy = orderBy
+    }
+
     if p.match(token.LIMIT) {
         if !p.match(token.INTEGER) {
             return nil, ParseError{
@@ -234,14 +491,30 @@ func (p *Parser) selectStatement() (ast.VisitableNode, error) {
         stmt.Limit = ast.NewLimitNode(*(limit.(*ast.IntegerLiteralNode)))
     }
 
-    if !p.eof() {
+    return stmt, nil
+}
+
+func (p *Parser) orderBy() (*ast.OrderByNode, error) {
+    if !p.match(token.BY) {
         return nil, ParseError{
-            Expected: []token.TokenType{token.EOF},
+            Expected: []token.TokenType{token.BY},
             Received: p.peek(),
         }
     }
 
-    return stmt, nil
+    var terms []ast.OrderingTerm
+    for ok := true; ok; ok = p.match(token.COMMA) {
+        expr, err := p.disjunction()
+        if err != nil {
+            return nil, err
+        }
+        descending := false
+        if p.match(token.ASC, token.DESC) {
+            descending = p.previous().TokenType == token.DESC
+        }
+        terms = append(terms, ast.OrderingTerm{Node: expr, Descending: descending})
+    }
+    return ast.NewOrderByNode(terms), nil
 }
 
 func (p *Parser) disjunction() (ast.ExpressionNode, error) {
@@ -385,9 +658,18 @@ func (p *Parser) primary() (ast.ExpressionNode, error) {
     case p.match(token.FLOAT):
         return p.float()
     case p.match(token.IDENTIFIER):
+        if p.check(token.L_PAREN) {
+            return p.functionCall()
+        }
         return p.identifier()
     case p.match(token.STRING):
         return p.string()
+    case p.match(token.TRUE, token.FALSE):
+        return ast.NewBooleanLiteralNode(p.previous().TokenType == token.TRUE), nil
+    case p.match(token.PLACEHOLDER):
+        return p.placeholder()
+    case p.match(token.TIMESTAMP, token.DATE, token.INTERVAL):
+        return p.temporal()
     case p.match(token.L_PAREN):
         expr, err := p.disjunction()
         if err != nil {
@@ -435,7 +717,135 @@ func (p *Parser) float() (ast.ExpressionNode, error) {
 
 func (p *Parser) identifier() (ast.ExpressionNode, error) {
     tok := p.previous()
-    return ast.NewColumnIdentifierNode(tok.Lexeme), nil
+    id := ast.NewColumnIdentifierNode(tok.Lexeme)
+    id.Position = tok.Position
+    return id, nil
+}
+
+func (p *Parser) temporal() (ast.ExpressionNode, error) {
+    kind := p.previous()
+    if !p.match(token.STRING) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.STRING},
+            Received: p.peek(),
+        }
+    }
+    tok := p.previous()
+
+    switch kind.TokenType {
+    case token.TIMESTAMP:
+        value, err := types.ParseTimestamp(tok.Lexeme)
+        if err != nil {
+            return nil, ConversionError{Value: tok, err: err}
+        }
+        return ast.NewTimestampLiteralNode(value), nil
+    case token.DATE:
+        value, err := types.ParseDate(tok.Lexeme)
+        if err != nil {
+            return nil, ConversionError{Value: tok, err: err}
+        }
+        return ast.NewDateLiteralNode(value), nil
+    default:
+        value, err := types.ParseInterval(tok.Lexeme)
+        if err != nil {
+            return nil, ConversionError{Value: tok, err: err}
+        }
+        return ast.NewIntervalLiteralNode(value), nil
+    }
+}
+
+func (p *Parser) functionCall() (ast.ExpressionNode, error) {
+    name := p.previous()
+    p.advance() // consume '('
+
+    if strings.EqualFold(name.Lexeme, ast.FunctionExtract) {
+        return p.extract(name)
+    }
+
+    var arguments []ast.ExpressionNode
+    if !p.check(token.R_PAREN) {
+        for ok := true; ok; ok = p.match(token.COMMA) {
+            if p.match(token.ASTERISK) {
+                arguments = append(arguments, ast.NewAsteriskLiteralNode()) // COUNT(*)
+                continue
+            }
+            argument, err := p.disjunction()
+            if err != nil {
+                return nil, err
+            }
+            arguments = append(arguments, argument)
+        }
+    }
+
+    if !p.match(token.R_PAREN) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.COMMA, token.R_PAREN},
+            Received: p.peek(),
+        }
+    }
+    call := ast.NewFunctionCallNode(name.Lexeme, arguments)
+    call.Position = name.Position
+    return call, nil
+}
+
+// extract parses the argument list of EXTRACT(field FROM expression). The field becomes the
+// first argument of the call, as an upper-cased string.
+func (p *Parser) extract(name token.Token) (ast.ExpressionNode, error) {
+    if !p.match(token.IDENTIFIER) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.IDENTIFIER},
+            Received: p.peek(),
+        }
+    }
+    field := p.previous()
+    if !types.ValidExtractField(field.Lexeme) {
+        return nil, ConversionError{Value: field, err: fmt.Errorf("invalid EXTRACT field '%s'", field.Lexeme)}
+    }
+
+    if !p.match(token.FROM) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.FROM},
+            Received: p.peek(),
+        }
+    }
+    source, err := p.disjunction()
+    if err != nil {
+        return nil, err
+    }
+    if !p.match(token.R_PAREN) {
+        return nil, ParseError{
+            Expected: []token.TokenType{token.R_PAREN},
+            Received: p.peek(),
+        }
+    }
+
+    arguments := []ast.ExpressionNode{ast.NewStringLiteralNode(strings.ToUpper(field.Lexeme)), source}
+    call := ast.NewFunctionCallNode(ast.FunctionExtract, arguments)
+    call.Position = name.Position
+    return call, nil
+}
+
+// placeholder numbers '?' placeholders by their position in the statement, and '$n' placeholders
+// explicitly. The two styles cannot be mixed in one statement.
+func (p *Parser) placeholder() (ast.ExpressionNode, error) {
+    tok := p.previous()
+    if tok.Lexeme == "?" {
+        if p.numbered {
+            return nil, ConversionError{Value: tok, err: errors.New("cannot mix '?' and '$n' placeholders")}
+        }
+        p.positional++
+        return ast.NewPlaceholderNode(p.positional), nil
+    }
+
+    if p.positional > 0 {
+        return nil, ConversionError{Value: tok, err: errors.New("cannot mix '?' and '$n' placeholders")}
+    }
+    index, err := strconv.Atoi(tok.Lexeme[1:])
+    if err != nil {
+        return nil, ConversionError{Value: tok, err: err}
+    }
+    p.numbered = true
+    return ast.NewPlaceholderNode(index), nil
 }
 
 func (p *Parser) string() (ast.ExpressionNode, error) {
@@ -489,8 +899,58 @@ type ParseError struct {
 }
 
 func (e ParseError) Error() string {
-    return fmt.Sprintf("parser expected one of '%s' received '%s' at line: %d, column: %d",
-        e.Expected, e.Received.Lexeme, e.Received.Position.Line, e.Received.Position.Column)
+    return e.Diagnostic().Error()
+}
+
+// Diagnostic describes the error at the position of the unexpected token. An unexpected
+// identifier is compared against the expected keywords, or failing that against all keywords, to
+// suggest what may have been meant.
+func (e ParseError) Diagnostic() *diagnostic.Diagnostic {
+    expected := make([]string, len(e.Expected))
+    var keywords []string
+    for i, tokenType := range e.Expected {
+        expected[i] = describeTokenType(tokenType)
+        if _, ok := token.LookupKeyword(tokenType.String()); ok {
+            keywords = append(keywords, tokenType.String())
+        }
+    }
+
+    received := "end of input"
+    if e.Received.TokenType != token.EOF {
+        received = fmt.Sprintf("'%s'", e.Received.Lexeme)
+    }
+
+    d := diagnostic.New(diagnostic.SyntaxError, e.Received.Position, "unexpected %s, expected %s",
+        received, strings.Join(expected, ", "))
+    if e.Received.TokenType == token.IDENTIFIER {
+        if d.WithSuggestions(e.Received.Lexeme, keywords); len(d.Suggestions) == 0 {
+            d.WithSuggestions(e.Received.Lexeme, token.Keywords())
+        }
+    }
+    return d
+}
+
+func describeTokenType(tokenType token.TokenType) string {
+    switch tokenType {
+    case token.IDENTIFIER:
+        return "identifier"
+    case token.STRING:
+        return "string"
+    case token.PLACEHOLDER:
+        return "placeholder"
+    case token.COMMA:
+        return "','"
+    case token.SEMICOLON:
+        return "';'"
+    case token.L_PAREN:
+        return "'('"
+    case token.R_PAREN:
+        return "')'"
+    case token.EOF:
+        return "end of input"
+    default:
+        return tokenType.String()
+    }
 }
 
 type ConversionError struct {
@@ -499,10 +959,27 @@ type ConversionError struct {
 }
 
 func (e ConversionError) Error() string {
-    return fmt.Sprintf("parser cannot convert token '%s' to concrete type: %s",
-        e.Value.Lexeme, e.err)
+    return e.Diagnostic().Error()
+}
+
+func (e ConversionError) Diagnostic() *diagnostic.Diagnostic {
+    return diagnostic.New(diagnostic.SyntaxError, e.Value.Position, "invalid value '%s': %s", e.Value.Lexeme, e.err)
 }
 
 func (e ConversionError) Unwrap() error {
     return e.err
 }
+
+// diagnose converts the errors of the parser into diagnostics.
+func diagnose(err error) error {
+    var parseErr ParseError
+    var conversionErr ConversionError
+    switch {
+    case errors.As(err, &parseErr):
+        return parseErr.Diagnostic()
+    case errors.As(err, &conversionErr):
+        return conversionErr.Diagnostic()
+    default:
+        return err
+    }
+}
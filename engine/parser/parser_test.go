@@ -1,12 +1,15 @@
 package parser
 
 import (
+    "errors"
     "fmt"
     "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
     "github.com/aleph-zero/flutterdb/engine/evaluator"
     "github.com/aleph-zero/flutterdb/engine/token"
     "github.com/google/go-cmp/cmp"
     "github.com/google/go-cmp/cmp/cmpopts"
+    "strings"
     "testing"
     "text/scanner"
 )
@@ -51,6 +54,374 @@ func TestParser_ParseShowTablesStatement(t *testing.T) {
     }
 }
 
+func TestParser_ParseExplainStatement(t *testing.T) {
+    tests := []struct {
+        stmt    string
+        analyze bool
+        format  ast.ExplainFormat
+    }{
+        {`EXPLAIN SELECT a FROM t`, false, ast.ExplainFormatText},
+        {`EXPLAIN ANALYZE SELECT a FROM t WHERE a = 5 LIMIT 1`, true, ast.ExplainFormatText},
+        {`EXPLAIN FORMAT TEXT SELECT a FROM t`, false, ast.ExplainFormatText},
+        {`explain analyze format json SELECT a FROM t`, true, ast.ExplainFormatJSON},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := parse(tt.stmt)
+            if err != nil {
+                t.Fatal(err)
+            }
+            explain, ok := root.(*ast.ExplainStatementNode)
+            if !ok {
+                t.Fatalf("expected explain statement node, received %T", root)
+            }
+            if explain.Analyze != tt.analyze || explain.Format != tt.format {
+                t.Errorf("expected analyze=%t format=%d, received analyze=%t format=%d",
+                    tt.analyze, tt.format, explain.Analyze, explain.Format)
+            }
+            if _, ok := explain.Statement.(*ast.SelectStatementNode); !ok {
+                t.Errorf("expected select statement node, received %T", explain.Statement)
+            }
+        })
+    }
+}
+
+func TestParser_ParseFunctionCallAndOrderBy(t *testing.T) {
+    root, err := parse(`SELECT a FROM t WHERE match(b, 'red apple') ORDER BY _score DESC, a`)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    stmt, ok := root.(*ast.SelectStatementNode)
+    if !ok {
+        t.Fatalf("expected select statement node, received %T", root)
+    }
+
+    expected := ast.NewFunctionCallNode("MATCH", []ast.ExpressionNode{
+        ast.NewColumnIdentifierNode("b"),
+        ast.NewStringLiteralNode("red apple"),
+    })
+    if diff := cmp.Diff(expected, stmt.Predicate.Node, ignorePositions); diff != "" {
+        t.Errorf("failed to parse function call (-expected, +received):\n%s", diff)
+    }
+
+    terms := []ast.OrderingTerm{
+        {Node: ast.NewColumnIdentifierNode("_score"), Descending: true},
+        {Node: ast.NewColumnIdentifierNode("a"), Descending: false},
+    }
+    if diff := cmp.Diff(ast.NewOrderByNode(terms), stmt.OrderBy, ignorePositions); diff != "" {
+        t.Errorf("failed to parse order by (-expected, +received):\n%s", diff)
+    }
+}
+
+func TestParser_ParseTemporalLiterals(t *testing.T) {
+    root, err := parse(`SELECT EXTRACT(year FROM d) FROM t WHERE d >= TIMESTAMP '2024-01-01 10:00:00' - INTERVAL '1 day 2 hours'`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    stmt := root.(*ast.SelectStatementNode)
+
+    extract := ast.NewFunctionCallNode("EXTRACT", []ast.ExpressionNode{
+        ast.NewStringLiteralNode("YEAR"),
+        ast.NewColumnIdentifierNode("d"),
+    })
+    if diff := cmp.Diff(extract, stmt.Expressions[0], ignorePositions); diff != "" {
+        t.Errorf("failed to parse EXTRACT (-expected, +received):\n%s", diff)
+    }
+
+    expected := "d >= TIMESTAMP '2024-01-01T10:00:00Z' - INTERVAL '1 day 2 hours'"
+    if received := stmt.Predicate.Node.String(); received != expected {
+        t.Errorf("failed to parse temporal literals, expected %q, received %q", expected, received)
+    }
+}
+
+func TestParser_ParsePreparedStatements(t *testing.T) {
+    root, err := parse(`PREPARE Q1 AS SELECT a FROM t WHERE a = $2 AND b > $1 LIMIT 5`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    prepare := root.(*ast.PrepareStatementNode)
+    if prepare.Name != "q1" {
+        t.Errorf("failed to parse PREPARE name, expected %q, received %q", "q1", prepare.Name)
+    }
+    expected := "a = $2 AND b > $1"
+    if received := prepare.Statement.(*ast.SelectStatementNode).Predicate.Node.String(); received != expected {
+        t.Errorf("failed to parse placeholders, expected %q, received %q", expected, received)
+    }
+
+    root, err = parse(`SELECT a FROM t WHERE a = ? OR b = ?`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected = "a = $1 OR b = $2"
+    if received := root.(*ast.SelectStatementNode).Predicate.Node.String(); received != expected {
+        t.Errorf("failed to number positional placeholders, expected %q, received %q", expected, received)
+    }
+
+    root, err = parse(`EXECUTE q1(5, 'abc', -1.5)`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    execute := root.(*ast.ExecuteStatementNode)
+    if execute.Name != "q1" || len(execute.Arguments) != 3 {
+        t.Errorf("failed to parse EXECUTE, received %v", execute)
+    }
+
+    root, err = parse(`DEALLOCATE q1`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if name := root.(*ast.DeallocateStatementNode).Name; name != "q1" {
+        t.Errorf("failed to parse DEALLOCATE name, expected %q, received %q", "q1", name)
+    }
+}
+
+func TestParser_ParseScript(t *testing.T) {
+    script := `
+        -- schema setup
+        CREATE TABLE a (c1 KEYWORD);
+        CREATE TABLE b (c1 KEYWORD, c2 INTEGER) PARTITION BY c1 ;;
+        SELECT c1 FROM a WHERE c1 = 'x;y' /* trailing */;
+        SELECT $1, ?`
+
+    statements, err := ParseScript(script)
+    if err == nil {
+        t.Fatalf("expected error for mixed placeholders")
+    }
+
+    statements, err = ParseScript(strings.Replace(script, "$1", "?", 1))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := []string{
+        "CREATE TABLE a (c1 KEYWORD)",
+        "CREATE TABLE b (c1 KEYWORD, c2 INTEGER) PARTITION BY c1",
+        "SELECT c1 FROM a WHERE c1 = 'x;y' /* trailing */",
+        "SELECT ?, ?",
+    }
+    received := make([]string, len(statements))
+    for i, stmt := range statements {
+        received[i] = stmt.Text
+    }
+    if diff := cmp.Diff(expected, received); diff != "" {
+        t.Errorf("failed to split script (-expected, +received):\n%s", diff)
+    }
+    if _, ok := statements[1].Node.(*ast.CreateTableStatementNode); !ok {
+        t.Errorf("expected CREATE TABLE statement, received %T", statements[1].Node)
+    }
+    if stmt, ok := statements[3].Node.(*ast.SelectStatementNode); !ok || stmt.Expressions[1].String() != "$2" {
+        t.Errorf("expected placeholders to be numbered per statement, received %v", statements[3].Node)
+    }
+
+    for _, script := range []string{``, `;`, ` ; -- nothing`} {
+        statements, err := ParseScript(script)
+        if err != nil || len(statements) != 0 {
+            t.Errorf("expected empty script for %q, received %v, %v", script, statements, err)
+        }
+    }
+
+    for _, script := range []string{`SELECT 1 SELECT 2`, `SELECT 1; SELECT`, `SELECT 'a`} {
+        if _, err := ParseScript(script); err == nil {
+            t.Errorf("expected error for script %q", script)
+        }
+    }
+}
+
+func TestParser_PrintRoundTrip(t *testing.T) {
+    tests := []struct {
+        stmt     string
+        expected string
+    }{
+        {`select a from t`, `SELECT a FROM t`},
+        {`SELECT a+b*c, (a+b)*c, a-(b-c), a-b-c, - -1, -(a+1) FROM t`,
+            `SELECT a + b * c, (a + b) * c, a - (b - c), a - b - c, - -1, -(a + 1) FROM t`},
+        {`SELECT 1.0, 2.5e-3, .5, 'it''s' FROM t`, `SELECT 1.0, 0.0025, 0.5, 'it''s' FROM t`},
+        {`SELECT "order", "a b", "x""y" FROM "table"`, `SELECT "order", "a b", "x""y" FROM "table"`},
+        {`SELECT a FROM t WHERE a <> 5 and not (b = 6 or c like 'x%') order by a asc, b desc limit 3`,
+            `SELECT a FROM t WHERE a != 5 AND NOT (b = 6 OR c LIKE 'x%') ORDER BY a, b DESC LIMIT 3`},
+        {`SELECT a FROM t WHERE NOT NOT a = 1 AND b >= 2 OR c < 3`, `SELECT a FROM t WHERE NOT NOT a = 1 AND b >= 2 OR c < 3`},
+        {`SELECT extract(year from d), date_trunc('month', d), now() FROM t`,
+            `SELECT EXTRACT(YEAR FROM d), DATE_TRUNC('month', d), NOW() FROM t`},
+        {`SELECT a FROM t WHERE d > TIMESTAMP '2024-01-01 10:00:00' - INTERVAL '1 year 14 months 36 hours'`,
+            `SELECT a FROM t WHERE d > TIMESTAMP '2024-01-01T10:00:00Z' - INTERVAL '2 years 2 months 36 hours'`},
+        {`SELECT a FROM t WHERE d < DATE '2024-01-01' AND a = ? AND b = ?`,
+            `SELECT a FROM t WHERE d < DATE '2024-01-01' AND a = $1 AND b = $2`},
+        {`SELECT * FROM t WHERE MATCH(b, 'apple')`, `SELECT * FROM t WHERE MATCH(b, 'apple')`},
+        {`SELECT true, False FROM t WHERE a = TRUE OR NOT false`, `SELECT TRUE, FALSE FROM t WHERE a = TRUE OR NOT FALSE`},
+        {`explain analyze format json select a from t`, `EXPLAIN ANALYZE FORMAT JSON SELECT a FROM t`},
+        {`explain format text select a from t`, `EXPLAIN SELECT a FROM t`},
+        {`prepare Q as select a from t where a = $1`, `PREPARE q AS SELECT a FROM t WHERE a = $1`},
+        {`execute q(1, -2.5, 'a')`, `EXECUTE q(1, -2.5, 'a')`},
+        {`deallocate q;`, `DEALLOCATE q`},
+        {`show tables`, `SHOW TABLES`},
+        {`create table t (c1 keyword, "text" text) partition by c1`,
+            `CREATE TABLE t (c1 KEYWORD, "text" TEXT) PARTITION BY c1`},
+    }
+
+    ignoreSyntax := append(cmp.Options{
+        cmpopts.IgnoreFields(token.Token{}, "Lexeme"),
+        cmpopts.IgnoreFields(ast.TableIdentifierNode{}, "Position"),
+    }, ignorePositions...)
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := ParseStatement(tt.stmt)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if printed := ast.Print(root); printed != tt.expected {
+                t.Errorf("failed to print statement, expected %q, received %q", tt.expected, printed)
+            }
+
+            for _, printed := range []string{ast.Print(root), ast.PrettyPrint(root)} {
+                reparsed, err := ParseStatement(printed)
+                if err != nil {
+                    t.Fatalf("failed to parse printed statement %q: %s", printed, err)
+                }
+                if diff := cmp.Diff(root, reparsed, ignoreSyntax); diff != "" {
+                    t.Errorf("printed statement %q does not round trip (-original, +reparsed):\n%s", printed, diff)
+                }
+            }
+        })
+    }
+}
+
+func TestParser_PrintOptimizedExpressions(t *testing.T) {
+    minus := token.Token{TokenType: token.MINUS, Lexeme: "-"}
+    times := token.Token{TokenType: token.ASTERISK, Lexeme: "*"}
+    tests := []struct {
+        node     ast.ExpressionNode
+        expected string
+    }{
+        {ast.NewUnaryExpressionNode(minus, ast.NewIntegerLiteralNode(-1)), `- -1`},
+        {ast.NewBinaryExpressionNode(times, ast.NewColumnIdentifierNode("a"), ast.NewFloatLiteralNode(-3)), `a * -3.0`},
+        {ast.NewBinaryExpressionNode(times,
+            ast.NewBinaryExpressionNode(minus, ast.NewColumnIdentifierNode("a"), ast.NewIntegerLiteralNode(1)),
+            ast.NewBinaryExpressionNode(minus, ast.NewColumnIdentifierNode("b"), ast.NewIntegerLiteralNode(2))),
+            `(a - 1) * (b - 2)`},
+    }
+
+    for _, tt := range tests {
+        if printed := ast.Print(tt.node); printed != tt.expected {
+            t.Errorf("failed to print expression, expected %q, received %q", tt.expected, printed)
+        }
+    }
+}
+
+func TestParser_PrintNormalized(t *testing.T) {
+    tests := []struct {
+        stmt     string
+        expected string
+    }{
+        {`SELECT a FROM t WHERE a = 5 AND b = 'x' LIMIT 10`, `SELECT a FROM t WHERE a = $1 AND b = $2 LIMIT 10`},
+        {`SELECT a FROM t WHERE a = -5.5 OR b > - c`, `SELECT a FROM t WHERE a = $1 OR b > -c`},
+        {`SELECT a FROM t WHERE b = $2 AND a = $1`, `SELECT a FROM t WHERE b = $1 AND a = $2`},
+        {`SELECT EXTRACT(year FROM d) FROM t WHERE d > DATE '2024-01-01' - INTERVAL '1 day'`,
+            `SELECT EXTRACT(YEAR FROM d) FROM t WHERE d > $1 - $2`},
+        {`EXECUTE q(1, 'a')`, `EXECUTE q($1, $2)`},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            root, err := ParseStatement(tt.stmt)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if normalized := ast.PrintNormalized(root); normalized != tt.expected {
+                t.Errorf("failed to normalize statement, expected %q, received %q", tt.expected, normalized)
+            }
+        })
+    }
+}
+
+func TestFormat(t *testing.T) {
+    script := `-- schema
+create table t (a keyword, b integer);
+select a, b from t where b > 1 order by b desc limit 5; ;`
+
+    formatted, err := Format(script, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := "CREATE TABLE t (a KEYWORD, b INTEGER);\nSELECT a, b FROM t WHERE b > 1 ORDER BY b DESC LIMIT 5;\n"
+    if formatted != expected {
+        t.Errorf("failed to format script, expected %q, received %q", expected, formatted)
+    }
+
+    formatted, err = Format(script, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected = `CREATE TABLE t (
+    a KEYWORD,
+    b INTEGER
+);
+
+SELECT a, b
+FROM t
+WHERE b > 1
+ORDER BY b DESC
+LIMIT 5;
+`
+    if formatted != expected {
+        t.Errorf("failed to pretty print script, expected %q, received %q", expected, formatted)
+    }
+
+    if again, err := Format(formatted, true); err != nil || again != formatted {
+        t.Errorf("formatting is not idempotent, received %q, %v", again, err)
+    }
+
+    if _, err := Format(`SELECT 1; SELEC 2`, false); err == nil {
+        t.Error("expected error formatting an invalid script")
+    }
+}
+
+func TestParser_Diagnostics(t *testing.T) {
+    tests := []struct {
+        stmt        string
+        code        diagnostic.Code
+        line        int
+        column      int
+        suggestions []string
+    }{
+        {`SELEC a FROM t`, diagnostic.SyntaxError, 1, 1, []string{"SELECT"}},
+        {`SELECT a FRM t`, diagnostic.SyntaxError, 1, 10, []string{"FROM"}},
+        {"SELECT a\nFROM t\nWHERE a = 'x", diagnostic.LexicalError, 3, 11, nil},
+        {`SELECT a FROM t LIMIT 'a'`, diagnostic.SyntaxError, 1, 23, nil},
+        {`SELECT a FROM t WHERE a = $1 OR b = ?`, diagnostic.SyntaxError, 1, 37, nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            _, err := ParseStatement(tt.stmt)
+            var d *diagnostic.Diagnostic
+            if !errors.As(err, &d) {
+                t.Fatalf("expected a diagnostic, received %v", err)
+            }
+            if d.Code != tt.code || d.Line != tt.line || d.Column != tt.column {
+                t.Errorf("expected %s at %d:%d, received %s at %d:%d", tt.code, tt.line, tt.column, d.Code, d.Line, d.Column)
+            }
+            if diff := cmp.Diff(tt.suggestions, d.Suggestions); diff != "" {
+                t.Errorf("unexpected suggestions (-expected, +received):\n%s", diff)
+            }
+            if d.Excerpt == "" {
+                t.Errorf("expected an excerpt of the statement")
+            }
+        })
+    }
+
+    _, err := ParseScript("SELEC a FROM t;\nSELECT b FROM t;\nSELECT c FRM t;")
+    var list diagnostic.List
+    if !errors.As(err, &list) || len(list) != 2 {
+        t.Fatalf("expected a diagnostic for each statement in error, received %v", err)
+    }
+    if list[0].Line != 1 || list[1].Line != 3 || list[1].Excerpt != "SELECT c FRM t;\n         ^" {
+        t.Errorf("unexpected diagnostics: %v", list)
+    }
+}
+
 func TestParser_ParseStatements(t *testing.T) {
     tests := []struct {
         stmt     string
@@ -70,7 +441,7 @@ func TestParser_ParseStatements(t *testing.T) {
                 },
             ),
         },
-        {`SELECT --1`,
+        {`SELECT - -1`,
             ast.NewSelectStatementNode(
                 []ast.ExpressionNode{
                     ast.NewUnaryExpressionNode(
@@ -147,7 +518,7 @@ func TestParser_ParseStatements(t *testing.T) {
                 },
             ),
         },
-        {`SELECT 1 + "abc"`,
+        {`SELECT 1 + 'abc'`,
             ast.NewSelectStatementNode(
                 []ast.ExpressionNode{
                     ast.NewBinaryExpressionNode(
@@ -263,8 +634,7 @@ func TestParser_ParseStatements(t *testing.T) {
                 t.Error(err)
             }
 
-            if diff := cmp.Diff(tt.expected, root,
-                cmpopts.IgnoreFields(token.Token{}, "Position")); diff != "" {
+            if diff := cmp.Diff(tt.expected, root, ignorePositions); diff != "" {
                 t.Errorf("failed to parse (-expected, +received):\n%s", diff)
             }
         })
@@ -283,7 +653,7 @@ func TestParser_ParseValidExpressions(t *testing.T) {
 
         // unary negation
         {`SELECT -5`, -5.0},
-        {`SELECT --5`, 5.0},
+        {`SELECT - -5`, 5.0},
 
         // arithmetic operators
         {`SELECT 5 + 6`, 11.0},
@@ -359,7 +729,7 @@ func TestParser_ParseValidExpressionLists(t *testing.T) {
         expected int
     }{
         {`SELECT 1, 2, a + 4`, 3},
-        {`SELECT (2 + 4), 5, "a"`, 3},
+        {`SELECT (2 + 4), 5, 'a'`, 3},
     }
 
     for _, tt := range tests {
@@ -386,7 +756,7 @@ func TestParser_ParseValidStatements(t *testing.T) {
     tests := []struct {
         stmt string
     }{
-        {`SELECT "a"`},
+        {`SELECT 'a'`},
         {`SELECT a`},
         {`SELECT a + b`},
         {`SELECT a + (b * c)`},
@@ -399,7 +769,23 @@ func TestParser_ParseValidStatements(t *testing.T) {
         {`SELECT a FROM t WHERE a = 5 AND NOT b = 6`},
         {`SELECT a FROM t LIMIT 1`},
         {`SELECT a FROM t WHERE a = 5 AND NOT b = 6 LIMIT 1`},
-        {`SELECT a FROM t WHERE a LIKE "%apple%"`},
+        {`SELECT a FROM t WHERE a LIKE '%apple%'`},
+        {`SELECT a, _score FROM t WHERE MATCH(b, 'apple')`},
+        {`SELECT a FROM t WHERE MATCH_QUERY(b, '+apple -pie') AND a > 5`},
+        {`SELECT a FROM t ORDER BY a`},
+        {`SELECT a FROM t WHERE a = 5 ORDER BY _score DESC, a ASC LIMIT 10`},
+        {`SELECT NOW()`},
+        {`SELECT a FROM t WHERE d > TIMESTAMP '2024-01-01 10:00:00' - INTERVAL '7 days'`},
+        {`SELECT EXTRACT(year FROM d), DATE_TRUNC('month', d) FROM t WHERE d < DATE '2024-01-01'`},
+        {`SELECT a FROM t WHERE a = $1`},
+        {`SELECT a + ? FROM t WHERE b = ?`},
+        {`PREPARE q AS SELECT a FROM t WHERE a = $1`},
+        {`PREPARE q AS EXPLAIN ANALYZE SELECT a FROM t WHERE a = $1`},
+        {`EXECUTE q`},
+        {`EXECUTE q(1, 'a', TIMESTAMP '2024-01-01 10:00:00')`},
+        {`DEALLOCATE q`},
+        {`SELECT a FROM t;`},
+        {`SHOW TABLES;`},
     }
 
     for _, tt := range tests {
@@ -430,8 +816,22 @@ func TestParser_ParseInvalidStatements(t *testing.T) {
         {`SELECT FROM`},
         {`SELECT a FROM t WHERE`},
         {`SELECT a FROM t LIMIT 5.1`},
-        {`SELECT a FROM t LIMIT "a"`},
+        {`SELECT a FROM t LIMIT 'a'`},
         {`SELECT a FROM t LIMIT a`},
+        {`SELECT a FROM t WHERE MATCH(b, 'apple'`},
+        {`SELECT a FROM t WHERE MATCH(b,)`},
+        {`SELECT a FROM t ORDER a`},
+        {`SELECT a FROM t ORDER BY`},
+        {`SELECT a FROM t ORDER BY a DESC,`},
+        {`SELECT a FROM t LIMIT 1 ORDER BY a`},
+        {`SELECT TIMESTAMP`},
+        {`SELECT TIMESTAMP 'yesterday'`},
+        {`SELECT DATE '2024-01-01 10:00:00'`},
+        {`SELECT INTERVAL '7 fortnights'`},
+        {`SELECT INTERVAL 7`},
+        {`SELECT EXTRACT(CENTURY FROM d)`},
+        {`SELECT EXTRACT(YEAR, d)`},
+        {`SELECT EXTRACT(YEAR FROM d`},
 
         {`CREATE TABLE t ( c1 TEXT`},
         {`CREATE TABLE t ( c1 ABC )`},
@@ -439,6 +839,28 @@ func TestParser_ParseInvalidStatements(t *testing.T) {
         {`CREATE TABLE t (c1 TEXT) PARTITION`},
         {`CREATE TABLE t (c1 TEXT) PARTITION BY`},
         {`CREATE TABLE t (c1 TEXT) PARTITION BY 'a'`},
+
+        {`EXPLAIN`},
+        {`EXPLAIN SHOW TABLES`},
+        {`EXPLAIN FORMAT YAML SELECT a FROM t`},
+        {`EXPLAIN ANALYZE ANALYZE SELECT a FROM t`},
+
+        {`SELECT a FROM t WHERE a = $0`},
+        {`SELECT a FROM t WHERE a = $`},
+        {`SELECT a FROM t WHERE a = $1 OR b = ?`},
+        {`SELECT a FROM t LIMIT $1`},
+        {`PREPARE q SELECT a FROM t`},
+        {`PREPARE AS SELECT a FROM t`},
+        {`PREPARE q AS SHOW TABLES`},
+        {`PREPARE q AS PREPARE r AS SELECT a FROM t`},
+        {`EXECUTE`},
+        {`EXECUTE q()`},
+        {`EXECUTE q(1`},
+        {`EXECUTE q(1) x`},
+        {`DEALLOCATE`},
+        {`SHOW TABLES x`},
+        {`SELECT a FROM t; SELECT b FROM t`},
+        {`SELECT a FROM t;;`},
     }
 
     for _, tt := range tests {
@@ -454,6 +876,12 @@ func TestParser_ParseInvalidStatements(t *testing.T) {
     }
 }
 
+var ignorePositions = cmp.Options{
+    cmpopts.IgnoreFields(token.Token{}, "Position"),
+    cmpopts.IgnoreFields(ast.ColumnIdentifierNode{}, "Position"),
+    cmpopts.IgnoreFields(ast.FunctionCallNode{}, "Position"),
+}
+
 func parse(statement string) (ast.VisitableNode, error) {
     tokens, err := LexicalScan(statement)
     //printTokens(tokens)
@@ -0,0 +1,354 @@
+package physical
+
+import (
+    "context"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "github.com/aleph-zero/flutterdb/service/index"
+    "github.com/aleph-zero/flutterdb/service/metastore"
+    "github.com/blugelabs/bluge"
+    "github.com/blugelabs/bluge/search"
+    "github.com/blugelabs/bluge/search/aggregations"
+    "math"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// AggregateOperator computes aggregate functions over every record of its child and emits a single
+// record holding their results, in columns named by the calls. Aggregates that the search index
+// can answer are computed by an IndexAggregateOperator instead.
+type AggregateOperator struct {
+    child        OperatorNode
+    aggregates   []*ast.FunctionCallNode
+    names        []string
+    accumulators []*accumulator
+    source       <-chan *engine.Batch
+    sink         chan *engine.Batch
+    Stats        AggregateOperatorStats
+    *lifecycle
+}
+
+type AggregateOperatorStats struct {
+    Records uint64
+    Elapsed time.Duration
+}
+
+// accumulator folds the values of the argument of an aggregate function over the records of a
+// relation. Records without a value for the argument are left out, except by COUNT(*), which
+// counts every record.
+type accumulator struct {
+    name     string
+    star     bool       // the argument is '*'
+    column   string     // the column the argument reads, if it is a plain column
+    argument Expression // the compiled argument, if it is neither
+    merge    bool       // the column holds partial results of the function, which are merged
+    count    int64
+    value    engine.Value // the least or greatest value so far, for MIN and MAX
+}
+
+func newAccumulator(call *ast.FunctionCallNode, now time.Time) *accumulator {
+    a := &accumulator{name: call.Name}
+    switch argument := call.Arguments[0].(type) {
+    case *ast.AsteriskLiteralNode:
+        a.star = true
+    case *ast.ColumnIdentifierNode:
+        a.column = argument.Value
+    default:
+        a.argument = Compile(argument, now)
+    }
+    return a
+}
+
+// newMerger returns an accumulator that merges the partial results of an aggregate function, read
+// from the column named by name, as the workers of a parallel scan compute them.
+func newMerger(call *ast.FunctionCallNode, name string) *accumulator {
+    return &accumulator{name: call.Name, column: name, merge: true}
+}
+
+func (a *accumulator) add(batch *engine.Batch, row int) error {
+    if a.star {
+        a.count++
+        return nil
+    }
+
+    var value engine.Value
+    if a.argument == nil {
+        value, _ = batch.Value(a.column, row)
+    } else {
+        var err error
+        if value, err = a.argument(batch, row); missing(err) {
+            return nil
+        } else if err != nil {
+            return err
+        }
+    }
+    if !value.IsValid() {
+        return nil
+    }
+    if a.merge && a.name == ast.FunctionCount {
+        a.count += value.MustInt()
+        return nil
+    }
+
+    a.count++
+    switch a.name {
+    case ast.FunctionMin:
+        if !a.value.IsValid() || comparison(&value, &a.value, token.LT).ToBoolean() {
+            a.value = value
+        }
+    case ast.FunctionMax:
+        if !a.value.IsValid() || comparison(&value, &a.value, token.GT).ToBoolean() {
+            a.value = value
+        }
+    }
+    return nil
+}
+
+// result returns the value of the aggregate function. MIN and MAX have no value if no record had
+// one for their argument.
+func (a *accumulator) result() engine.Value {
+    if a.name == ast.FunctionCount {
+        return engine.NewIntValue(a.count)
+    }
+    return a.value
+}
+
+func NewAggregateOperator(child OperatorNode, aggregates []*ast.FunctionCallNode, names []string, now time.Time) *AggregateOperator {
+    accumulators := make([]*accumulator, len(aggregates))
+    for i, aggregate := range aggregates {
+        accumulators[i] = newAccumulator(aggregate, now)
+    }
+    return &AggregateOperator{
+        child:        child,
+        aggregates:   aggregates,
+        names:        names,
+        accumulators: accumulators,
+        source:       child.Sink(),
+        sink:         make(chan *engine.Batch),
+        lifecycle:    newLifecycle(),
+    }
+}
+
+// merge has the operator merge the partial results of its aggregates, which the workers of the
+// parallel scan below it compute, rather than aggregate the records of its child.
+func (operator *AggregateOperator) merge(scan *ScanOperator, now time.Time) {
+    scan.Aggregate(operator.aggregates, operator.names, now)
+    for i, aggregate := range operator.aggregates {
+        operator.accumulators[i] = newMerger(aggregate, operator.names[i])
+    }
+}
+
+func (operator *AggregateOperator) Sink() <-chan *engine.Batch {
+    return operator.sink
+}
+
+func (operator *AggregateOperator) Accept(ctx context.Context, visitor OperatorNodeVisitor) error {
+    return visitor.VisitAggregateOperator(ctx, operator)
+}
+
+func (operator *AggregateOperator) Open(ctx context.Context) error {
+    start := time.Now()
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+
+        for {
+            batch, ok := operator.next(ctx, operator.source)
+            if !ok {
+                break
+            }
+            for row := 0; row < batch.Len(); row++ {
+                for i, accumulator := range operator.accumulators {
+                    if err := accumulator.add(batch, row); err != nil {
+                        fail(ctx, Error{ErrorCode: EvaluationError, Operator: "Aggregate", Message: fmt.Sprintf("evaluating %s", operator.names[i]), Err: err})
+                        return
+                    }
+                }
+            }
+        }
+
+        values := make([]engine.Value, len(operator.accumulators))
+        for i, accumulator := range operator.accumulators {
+            values[i] = accumulator.result()
+        }
+        if !operator.emit(ctx, operator.sink, aggregateBatch(operator.names, values)) {
+            return
+        }
+        operator.Stats.Records++
+    })
+    return nil
+}
+
+func (operator *AggregateOperator) Close() {
+    operator.halt()
+    operator.child.Close()
+    operator.wait()
+}
+
+// IndexAggregateOperator answers aggregate functions over a scan from the search index, without
+// decoding a single stored field. COUNT(*) is the number of hits of the predicate pushed into the
+// scan, or of documents in the index if there is none, and MIN and MAX of numeric columns are
+// computed from their doc values.
+type IndexAggregateOperator struct {
+    table      *metastore.TableMetadata
+    predicate  ast.ExpressionNode
+    query      bluge.Query
+    aggregates []*ast.FunctionCallNode
+    names      []string
+    indexSvc   index.Service
+    sink       chan *engine.Batch
+    Stats      IndexAggregateOperatorStats
+    *lifecycle
+}
+
+// IndexAggregateOperatorStats counts the hits the aggregates were computed over.
+type IndexAggregateOperatorStats struct {
+    Records uint64
+    Matches uint64
+    Elapsed time.Duration
+}
+
+// NewIndexAggregateOperator creates the aggregation of a scan by its search index. It reports
+// false if an aggregate is not COUNT(*), or MIN or MAX of an INTEGER or FLOAT column, or if the
+// scan filters the records it reads, in which case the aggregates must be computed over the
+// records of the scan.
+func NewIndexAggregateOperator(scan *ScanOperator, aggregates []*ast.FunctionCallNode, names []string) (*IndexAggregateOperator, bool) {
+    if scan.residual != nil {
+        return nil, false
+    }
+    for _, aggregate := range aggregates {
+        if !indexAggregatable(scan.table, aggregate) {
+            return nil, false
+        }
+    }
+    return &IndexAggregateOperator{
+        table:      scan.table,
+        predicate:  scan.predicate,
+        query:      scan.query,
+        aggregates: aggregates,
+        names:      names,
+        indexSvc:   scan.indexSvc,
+        sink:       make(chan *engine.Batch),
+        lifecycle:  newLifecycle(),
+    }, true
+}
+
+func indexAggregatable(table *metastore.TableMetadata, aggregate *ast.FunctionCallNode) bool {
+    switch argument := aggregate.Arguments[0].(type) {
+    case *ast.AsteriskLiteralNode:
+        return aggregate.Name == ast.FunctionCount
+    case *ast.ColumnIdentifierNode:
+        if aggregate.Name == ast.FunctionCount {
+            return false // the hits without a value for the column would be counted
+        }
+        cmd, ok := table.Columns[argument.Value]
+        return ok && (cmd.ColumnType == types.INTEGER || cmd.ColumnType == types.FLOAT)
+    default:
+        return false
+    }
+}
+
+func (operator *IndexAggregateOperator) Sink() <-chan *engine.Batch {
+    return operator.sink
+}
+
+func (operator *IndexAggregateOperator) Accept(ctx context.Context, visitor OperatorNodeVisitor) error {
+    return visitor.VisitIndexAggregateOperator(ctx, operator)
+}
+
+// Open computes the aggregates before it returns, as a scan searches the index, and then emits
+// their results.
+func (operator *IndexAggregateOperator) Open(ctx context.Context) error {
+    start := time.Now()
+    values, err := operator.aggregate(ctx)
+    if err != nil {
+        close(operator.sink)
+        return Error{ErrorCode: SearchError, Operator: "IndexAggregate", Message: fmt.Sprintf("aggregating table %s", operator.table.TableName), Err: err}
+    }
+
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        if !operator.emit(ctx, operator.sink, aggregateBatch(operator.names, values)) {
+            return
+        }
+        operator.Stats.Records++
+    })
+    return nil
+}
+
+func (operator *IndexAggregateOperator) Close() {
+    operator.halt()
+    operator.wait()
+}
+
+// aggregate computes the results of the aggregates. Counting every document of the index needs no
+// search at all.
+func (operator *IndexAggregateOperator) aggregate(ctx context.Context) ([]engine.Value, error) {
+    values := make([]engine.Value, len(operator.aggregates))
+    counts := true
+    for _, aggregate := range operator.aggregates {
+        counts = counts && aggregate.Name == ast.FunctionCount
+    }
+    if operator.predicate == nil && counts {
+        count, err := operator.indexSvc.Count(ctx, operator.table.TableName)
+        if err != nil {
+            return nil, err
+        }
+        operator.Stats.Matches = count
+        for i := range values {
+            values[i] = engine.NewIntValue(int64(count))
+        }
+        return values, nil
+    }
+
+    request := bluge.NewAllMatches(operator.query)
+    request.AddAggregation("count", aggregations.CountMatches())
+    for i, aggregate := range operator.aggregates {
+        field := search.Field(aggregate.Arguments[0].String())
+        switch aggregate.Name {
+        case ast.FunctionMin:
+            request.AddAggregation(strconv.Itoa(i), aggregations.Min(field))
+        case ast.FunctionMax:
+            request.AddAggregation(strconv.Itoa(i), aggregations.Max(field))
+        }
+    }
+    bucket, err := operator.indexSvc.Aggregate(ctx, operator.table.TableName, request)
+    if err != nil {
+        return nil, err
+    }
+
+    operator.Stats.Matches = bucket.Count()
+    for i, aggregate := range operator.aggregates {
+        if aggregate.Name == ast.FunctionCount {
+            values[i] = engine.NewIntValue(int64(bucket.Count()))
+            continue
+        }
+        // the least and greatest values start out infinite, and stay so if no hit has a value
+        metric := bucket.Metric(strconv.Itoa(i))
+        if math.IsInf(metric, 0) {
+            continue
+        }
+        if operator.table.Columns[aggregate.Arguments[0].String()].ColumnType == types.INTEGER {
+            values[i] = engine.NewIntValue(int64(metric))
+        } else {
+            values[i] = engine.NewFloatValue(metric)
+        }
+    }
+    return values, nil
+}
+
+// aggregateBatch lays out the results of aggregate functions as a batch of one record.
+func aggregateBatch(names []string, values []engine.Value) *engine.Batch {
+    batch := engine.NewBatch(engine.NewSchema(names), 1)
+    batch.Append(values, 0)
+    return batch
+}
+
+func describeAggregates(names []string) string {
+    return strings.Join(names, ", ")
+}
@@ -0,0 +1,508 @@
+package physical
+
+import (
+    "errors"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "golang.org/x/exp/constraints"
+    "math"
+    "time"
+)
+
+// Expression is an expression compiled into a tree of closures, which evaluates the expression
+// against a record of a batch. Every closure is specialized for its node when the expression is
+// compiled: operators are chosen by the types the type checker inferred for their operands, LIKE
+// patterns given as literals are compiled once, and columns are looked up in the schema once per
+// schema rather than once per record. An Expression caches that lookup, so it must not be shared
+// between goroutines; operators compile their own.
+type Expression func(batch *engine.Batch, row int) (engine.Value, error)
+
+// Compile compiles a resolved, type-annotated expression, in which NOW() evaluates to the
+// timestamp of the statement. An expression that cannot be evaluated record by record, such as a
+// search predicate or an unbound parameter, compiles into an Expression that returns the error
+// for every record.
+func Compile(node ast.ExpressionNode, now time.Time) Expression {
+    c := &compiler{now: engine.NewTimeValue(now)}
+    expression, err := c.compile(node)
+    if err != nil {
+        return func(*engine.Batch, int) (engine.Value, error) {
+            return engine.Value{}, err
+        }
+    }
+    return expression
+}
+
+type compiler struct {
+    expression Expression
+    now        engine.Value
+}
+
+func (c *compiler) compile(node ast.ExpressionNode) (Expression, error) {
+    if err := node.Accept(c); err != nil {
+        return nil, err
+    }
+    return c.expression, nil
+}
+
+// constant compiles an expression that evaluates to the same value for every record.
+func constant(v engine.Value) Expression {
+    return func(*engine.Batch, int) (engine.Value, error) {
+        return v, nil
+    }
+}
+
+// binary compiles an expression that evaluates both of its operands and combines their values.
+func binary(left, right Expression, combine func(l, r engine.Value) (engine.Value, error)) Expression {
+    return func(batch *engine.Batch, row int) (engine.Value, error) {
+        l, err := left(batch, row)
+        if err != nil {
+            return engine.Value{}, err
+        }
+        r, err := right(batch, row)
+        if err != nil {
+            return engine.Value{}, err
+        }
+        return combine(l, r)
+    }
+}
+
+func (c *compiler) VisitBinaryExpressionNode(node *ast.BinaryExpressionNode) error {
+    left, err := c.compile(node.Left)
+    if err != nil {
+        return err
+    }
+    right, err := c.compile(node.Right)
+    if err != nil {
+        return err
+    }
+
+    lt, lok := ast.TypeOf(node.Left)
+    rt, rok := ast.TypeOf(node.Right)
+    typed := lok && rok
+    op := node.Op.TokenType
+
+    switch op {
+    case token.EQUAL, token.NOT_EQUAL, token.GT, token.GTE, token.LT, token.LTE:
+        if typed {
+            c.expression = binary(left, right, compileTypedComparison(lt, rt, op))
+        } else {
+            c.expression = binary(left, right, func(l, r engine.Value) (engine.Value, error) {
+                return *comparison(&l, &r, op), nil
+            })
+        }
+    case token.PLUS, token.MINUS, token.ASTERISK, token.DIVIDE, token.MODULO:
+        if t, ok := ast.TypeOf(node); ok && typed {
+            c.expression = binary(left, right, compileTypedArithmetic(t, op))
+        } else {
+            c.expression = binary(left, right, func(l, r engine.Value) (engine.Value, error) {
+                v, err := arithmetic(&l, &r, op)
+                if err != nil {
+                    return engine.Value{}, err
+                }
+                return *v, nil
+            })
+        }
+    case token.LIKE:
+        if pattern, ok := node.Right.(*ast.StringLiteralNode); ok {
+            re, err := likePattern(pattern.Value)
+            if err != nil {
+                return err
+            }
+            c.expression = func(batch *engine.Batch, row int) (engine.Value, error) {
+                l, err := left(batch, row)
+                if err != nil {
+                    return engine.Value{}, err
+                }
+                value, ok := l.StringVal()
+                if !ok {
+                    value = l.String()
+                }
+                return engine.NewBooleanValue(re.MatchString(value)), nil
+            }
+        } else {
+            matcher := &likeMatcher{}
+            c.expression = binary(left, right, func(l, r engine.Value) (engine.Value, error) {
+                v, err := matcher.like(&l, &r)
+                if err != nil {
+                    return engine.Value{}, err
+                }
+                return *v, nil
+            })
+        }
+    case token.AND, token.OR:
+        decisive := op == token.OR
+        c.expression = func(batch *engine.Batch, row int) (engine.Value, error) {
+            l, lerr := left(batch, row)
+            if lerr != nil && !missing(lerr) {
+                return engine.Value{}, lerr
+            }
+            if lerr == nil && l.ToBoolean() == decisive {
+                return engine.NewBooleanValue(decisive), nil
+            }
+            r, rerr := right(batch, row)
+            return settle(decisive, lerr, r, rerr)
+        }
+    default:
+        return fmt.Errorf("cannot evaluate binary operator '%s'", op)
+    }
+    return nil
+}
+
+// compileTypedComparison chooses how to compare two values by the types the type checker inferred
+// for them, as typedComparison does for every record.
+func compileTypedComparison(lt, rt types.Type, op token.TokenType) func(l, r engine.Value) (engine.Value, error) {
+    switch {
+    case lt.IsString() && rt.IsString():
+        cmp := ordered[string](op)
+        return func(l, r engine.Value) (engine.Value, error) {
+            return engine.NewBooleanValue(cmp(l.MustString(), r.MustString())), nil
+        }
+    case lt == types.INTEGER && rt == types.INTEGER, lt == types.BOOLEAN && rt == types.BOOLEAN:
+        cmp := ordered[int64](op)
+        return func(l, r engine.Value) (engine.Value, error) {
+            return engine.NewBooleanValue(cmp(l.ToInt(), r.ToInt())), nil
+        }
+    case lt.IsNumeric() && rt.IsNumeric():
+        cmp := ordered[float64](op)
+        return func(l, r engine.Value) (engine.Value, error) {
+            return engine.NewBooleanValue(cmp(l.ToFloat(), r.ToFloat())), nil
+        }
+    default:
+        return func(l, r engine.Value) (engine.Value, error) {
+            return *comparison(&l, &r, op), nil
+        }
+    }
+}
+
+// compileTypedArithmetic chooses how to apply an arithmetic operator by the result type the type
+// checker inferred for it, as typedArithmetic does for every record.
+func compileTypedArithmetic(result types.Type, op token.TokenType) func(l, r engine.Value) (engine.Value, error) {
+    divides := op == token.DIVIDE || op == token.MODULO
+    switch result {
+    case types.INTEGER:
+        calculate := operation[int64](op)
+        if op == token.MODULO {
+            calculate = func(l, r int64) int64 { return l % r }
+        }
+        return func(l, r engine.Value) (engine.Value, error) {
+            li, ri := l.ToInt(), r.ToInt()
+            if divides && ri == 0 {
+                return engine.Value{}, errors.New("division by zero")
+            }
+            return engine.NewIntValue(calculate(li, ri)), nil
+        }
+    case types.FLOAT:
+        calculate := operation[float64](op)
+        if op == token.MODULO {
+            calculate = math.Mod
+        }
+        return func(l, r engine.Value) (engine.Value, error) {
+            lf, rf := l.ToFloat(), r.ToFloat()
+            if divides && rf == 0 {
+                return engine.Value{}, errors.New("division by zero")
+            }
+            return engine.NewFloatValue(calculate(lf, rf)), nil
+        }
+    default:
+        return func(l, r engine.Value) (engine.Value, error) {
+            v, err := temporalArithmetic(&l, &r, op)
+            if err != nil {
+                return engine.Value{}, err
+            }
+            return *v, nil
+        }
+    }
+}
+
+// ordered returns the comparison that a comparison operator stands for.
+func ordered[T constraints.Ordered](op token.TokenType) func(l, r T) bool {
+    switch op {
+    case token.EQUAL:
+        return func(l, r T) bool { return l == r }
+    case token.NOT_EQUAL:
+        return func(l, r T) bool { return l != r }
+    case token.GT:
+        return func(l, r T) bool { return l > r }
+    case token.GTE:
+        return func(l, r T) bool { return l >= r }
+    case token.LT:
+        return func(l, r T) bool { return l < r }
+    default:
+        return func(l, r T) bool { return l <= r }
+    }
+}
+
+// operation returns the calculation that an arithmetic operator other than modulo stands for.
+func operation[T calculable](op token.TokenType) func(l, r T) T {
+    switch op {
+    case token.PLUS:
+        return func(l, r T) T { return l + r }
+    case token.MINUS:
+        return func(l, r T) T { return l - r }
+    case token.ASTERISK:
+        return func(l, r T) T { return l * r }
+    default:
+        return func(l, r T) T { return l / r }
+    }
+}
+
+func (c *compiler) VisitColumnIdentifierNode(node *ast.ColumnIdentifierNode) error {
+    column := node.Value
+    var schema *engine.Schema
+    var index int
+    var found bool
+    c.expression = func(batch *engine.Batch, row int) (engine.Value, error) {
+        if batch.Schema != schema {
+            schema = batch.Schema
+            index, found = schema.Index(column)
+        }
+        if found {
+            if value := batch.Vectors[index][row]; value.IsValid() {
+                return value, nil
+            }
+        }
+        return engine.Value{}, noValueError{column: column}
+    }
+    return nil
+}
+
+// noValueError reports a column that a record has no value for.
+type noValueError struct {
+    column string
+}
+
+func (e noValueError) Error() string {
+    return fmt.Sprintf("no value for column '%s' in record", e.column)
+}
+
+// missing reports whether an expression has no value because it reads a column the record has no
+// value for. Such an expression is NULL: a predicate is not satisfied by it, a projection of it is
+// empty, aggregates skip it and sorts order it last.
+func missing(err error) bool {
+    return errors.As(err, &noValueError{})
+}
+
+// settle settles AND and OR once their left operand has neither failed nor decided the result,
+// by three-valued logic in which an operand without a value is unknown. A decisive right operand,
+// false for AND and true for OR, decides the result whether or not the left one has a value;
+// otherwise the result is unknown if either operand is.
+func settle(decisive bool, lerr error, r engine.Value, rerr error) (engine.Value, error) {
+    if rerr != nil && !missing(rerr) {
+        return engine.Value{}, rerr
+    }
+    if rerr == nil && r.ToBoolean() == decisive {
+        return engine.NewBooleanValue(decisive), nil
+    }
+    if lerr != nil {
+        return engine.Value{}, lerr
+    }
+    if rerr != nil {
+        return engine.Value{}, rerr
+    }
+    return engine.NewBooleanValue(!decisive), nil
+}
+
+func (c *compiler) VisitIntegerLiteralNode(node *ast.IntegerLiteralNode) error {
+    c.expression = constant(engine.NewIntValue(node.Value))
+    return nil
+}
+
+func (c *compiler) VisitFloatLiteralNode(node *ast.FloatLiteralNode) error {
+    c.expression = constant(engine.NewFloatValue(node.Value))
+    return nil
+}
+
+func (c *compiler) VisitStringLiteralNode(node *ast.StringLiteralNode) error {
+    c.expression = constant(engine.NewStringValue(node.Value))
+    return nil
+}
+
+func (c *compiler) VisitBooleanLiteralNode(node *ast.BooleanLiteralNode) error {
+    c.expression = constant(engine.NewBooleanValue(node.Value))
+    return nil
+}
+
+func (c *compiler) VisitTimestampLiteralNode(node *ast.TimestampLiteralNode) error {
+    c.expression = constant(engine.NewTimeValue(node.Value))
+    return nil
+}
+
+func (c *compiler) VisitIntervalLiteralNode(node *ast.IntervalLiteralNode) error {
+    c.expression = constant(engine.NewIntervalValue(node.Value))
+    return nil
+}
+
+func (c *compiler) VisitUnaryExpressionNode(node *ast.UnaryExpressionNode) error {
+    if node.Op.TokenType != token.MINUS {
+        return fmt.Errorf("unexpected operator type '%s'", node.Op.TokenType)
+    }
+    operand, err := c.compile(node.Node)
+    if err != nil {
+        return err
+    }
+    c.expression = func(batch *engine.Batch, row int) (engine.Value, error) {
+        value, err := operand(batch, row)
+        if err != nil {
+            return engine.Value{}, err
+        }
+        switch value.Kind() {
+        case engine.Float:
+            return engine.NewFloatValue(-1 * value.MustFloat()), nil
+        case engine.Int:
+            return engine.NewIntValue(-1 * value.MustInt()), nil
+        default:
+            return engine.Value{}, fmt.Errorf("improper value type for negation '%s'", value.Kind())
+        }
+    }
+    return nil
+}
+
+func (c *compiler) VisitLogicalNegationNode(node *ast.LogicalNegationNode) error {
+    operand, err := c.compile(node.Node)
+    if err != nil {
+        return err
+    }
+    c.expression = func(batch *engine.Batch, row int) (engine.Value, error) {
+        value, err := operand(batch, row)
+        if err != nil {
+            return engine.Value{}, err
+        }
+        return engine.NewBooleanValue(!value.ToBoolean()), nil
+    }
+    return nil
+}
+
+func (c *compiler) VisitParenthesizedExpression(node *ast.ParenthesizedExpressionNode) error {
+    return node.Node.Accept(c)
+}
+
+func (c *compiler) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    if signature, ok := ast.LookupFunction(node.Name); ok && signature.Search {
+        return fmt.Errorf("search predicate '%s' must be answered by the search index", node.Name)
+    }
+
+    arguments := make([]Expression, len(node.Arguments))
+    for i, argument := range node.Arguments {
+        compiled, err := c.compile(argument)
+        if err != nil {
+            return err
+        }
+        arguments[i] = compiled
+    }
+
+    var call func(values []engine.Value) (engine.Value, error)
+    switch node.Name {
+    case ast.FunctionGeoDistance:
+        call = func(values []engine.Value) (engine.Value, error) {
+            v, err := geoDistance(&values[0], &values[1], &values[2])
+            if err != nil {
+                return engine.Value{}, err
+            }
+            return *v, nil
+        }
+    case ast.FunctionNow:
+        call = func([]engine.Value) (engine.Value, error) {
+            return c.now, nil
+        }
+    case ast.FunctionDateTrunc:
+        call = func(values []engine.Value) (engine.Value, error) {
+            unit, _ := values[0].StringVal()
+            t, ok := timestamp(&values[1])
+            if !ok {
+                return engine.Value{}, fmt.Errorf("%s requires a timestamp, received '%s'", node.Name, values[1].Kind())
+            }
+            truncated, err := types.TruncateTime(unit, t)
+            if err != nil {
+                return engine.Value{}, err
+            }
+            return engine.NewTimeValue(truncated), nil
+        }
+    case ast.FunctionExtract:
+        call = func(values []engine.Value) (engine.Value, error) {
+            field, _ := values[0].StringVal()
+            t, ok := timestamp(&values[1])
+            if !ok {
+                return engine.Value{}, fmt.Errorf("%s requires a timestamp, received '%s'", node.Name, values[1].Kind())
+            }
+            extracted, err := types.ExtractField(field, t)
+            if err != nil {
+                return engine.Value{}, err
+            }
+            return engine.NewIntValue(extracted), nil
+        }
+    default:
+        return fmt.Errorf("cannot evaluate function '%s'", node.Name)
+    }
+
+    values := make([]engine.Value, len(arguments))
+    c.expression = func(batch *engine.Batch, row int) (engine.Value, error) {
+        for i, argument := range arguments {
+            value, err := argument(batch, row)
+            if err != nil {
+                return engine.Value{}, err
+            }
+            values[i] = value
+        }
+        return call(values)
+    }
+    return nil
+}
+
+func (c *compiler) VisitPlaceholderNode(node *ast.PlaceholderNode) error {
+    return fmt.Errorf("cannot evaluate unbound parameter '%s'", node.String())
+}
+
+func (c *compiler) VisitOrderByNode(node *ast.OrderByNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitPredicateNode(node *ast.PredicateNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitAsteriskLiteralNode(node *ast.AsteriskLiteralNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitLimitNode(node *ast.LimitNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitSelectStatementNode(node *ast.SelectStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitCreateTableStatementNode(node *ast.CreateTableStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitShowTablesStatementNode(node *ast.ShowTablesStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitExecuteStatementNode(node *ast.ExecuteStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitDeallocateStatementNode(node *ast.DeallocateStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitColumnDefinitionNode(node *ast.ColumnDefinitionNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (c *compiler) VisitTableIdentifierNode(node *ast.TableIdentifierNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
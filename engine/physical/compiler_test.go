@@ -0,0 +1,214 @@
+package physical
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "github.com/aleph-zero/flutterdb/service/index"
+    "github.com/aleph-zero/flutterdb/service/metastore"
+    "github.com/stretchr/testify/require"
+    "testing"
+    "time"
+)
+
+func TestCompile_MatchesEvaluator(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+
+    published := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)
+    now := time.Now().UTC()
+    record := recordWithValues(map[string]engine.Value{
+        "c1": engine.NewStringValue("apple"),
+        "c2": engine.NewStringValue("apple pie"),
+        "c3": engine.NewIntValue(5),
+        "c4": engine.NewFloatValue(2.5),
+        "c5": engine.NewGeoPointValue(40.7128, -74.0060),
+        "c6": engine.NewTimeValue(published),
+    })
+
+    expressions := []string{
+        `c3`, `1`, `0`, `-1`, `-c4`, `NOT c3`, `NOT NOT 1`, `(c3)`, `'a'`, `''`,
+        `c3 = 5`, `c3 != 5`, `c3 > c4`, `c3 >= 5`, `c3 < c4`, `c4 <= 2.5`, `5 = c3`,
+        `c1 = 'apple'`, `c1 < 'banana'`, `c1 > c2`, `c1 < '9'`,
+        `c3 + 1`, `c3 - c4`, `c3 * c3`, `c3 / 2`, `c4 / 2`, `c3 % 3`, `c4 % 2`, `1.5 * 3 = 4.5`,
+        `c3 * 2 > (c3 + (c4 * 2))`, `(1 + 2) > c3 AND (1.5 * 3) = c4`,
+        `c2 LIKE '%ppl%'`, `c2 LIKE 'apple _ie'`, `c1 LIKE c1`, `c1 LIKE 'a%' AND c2 LIKE '%e'`,
+        `c3 = 5 AND c1 = 'apple'`, `c3 = 4 AND c1 = 'apple'`, `c3 = 4 OR c1 = 'apple'`, `c3 = 4 OR c1 = 'pear'`,
+        `c6 > '2024-01-01'`, `c6 = TIMESTAMP '2024-03-15 10:30:00'`, `c6 + INTERVAL '1 day'`,
+        `c6 - INTERVAL '1 year 6 months' < c6`, `c6 - c6`, `EXTRACT(YEAR FROM c6)`, `DATE_TRUNC('month', c6)`,
+        `GEO_DISTANCE(c5, 40.7128, -74.0060) < 1`, `NOW()`, `NOW() - c6`, `c6 < NOW()`,
+    }
+    for _, expression := range expressions {
+        t.Run(expression, func(t *testing.T) {
+            node := projection(t, metaSvc, indexSvc, expression)
+            batch := batchOf(record)
+
+            evaluator := NewPredicateEvaluator(now)
+            evaluator.at(batch, 0)
+            require.NoError(t, node.Accept(evaluator))
+            expected := evaluator.stack.MustPop()
+
+            actual, err := Compile(node, now)(batch, 0)
+            require.NoError(t, err)
+            require.True(t, expected.Equal(actual), "expected %s, received %s", expected.String(), actual.String())
+        })
+    }
+}
+
+func TestCompile_Errors(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+
+    tests := []struct {
+        expression string
+        record     *engine.Record
+        err        string
+    }{
+        {`c3 / (c3 - 5)`, recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(5)}), "division by zero"},
+        {`c4 % 0.0`, recordWithValues(map[string]engine.Value{"c4": engine.NewFloatValue(2.5)}), "division by zero"},
+        {`c3 + 1`, nil, "no value for column 'c3' in record"},
+        {`c3 % (c3 - 5)`, recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(5)}), "division by zero"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.expression, func(t *testing.T) {
+            node := projection(t, metaSvc, indexSvc, tt.expression)
+            _, err := Compile(node, time.Now())(batchOf(tt.record), 0)
+            require.ErrorContains(t, err, tt.err)
+        })
+    }
+}
+
+func TestCompile_MissingValues(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+
+    // c3 has no value: an expression reading it is NULL unless AND or OR is decided without it
+    record := recordWithValues(map[string]engine.Value{"c1": engine.NewStringValue("apple")})
+    tests := []struct {
+        expression string
+        expected   string
+    }{
+        {`c3 > 1`, "NULL"},
+        {`NOT c3 > 1`, "NULL"},
+        {`c3 > 1 OR c1 = 'apple'`, "true"},
+        {`c1 = 'apple' OR c3 > 1`, "true"},
+        {`c3 > 1 OR c1 = 'pear'`, "NULL"},
+        {`c3 > 1 AND c1 = 'pear'`, "false"},
+        {`c1 = 'pear' AND c3 > 1`, "false"},
+        {`c3 > 1 AND c1 = 'apple'`, "NULL"},
+        {`NOT (c3 > 1 AND c1 = 'pear')`, "true"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.expression, func(t *testing.T) {
+            node := projection(t, metaSvc, indexSvc, tt.expression)
+            batch := batchOf(record)
+
+            evaluator := NewPredicateEvaluator(time.Now())
+            evaluator.at(batch, 0)
+            err := node.Accept(evaluator)
+
+            actual, cerr := Compile(node, time.Now())(batch, 0)
+            if tt.expected == "NULL" {
+                require.True(t, missing(err), "expected no value, received %v", err)
+                require.True(t, missing(cerr), "expected no value, received %v", cerr)
+                require.Zero(t, evaluator.stack.Len())
+                return
+            }
+            require.NoError(t, err)
+            require.Equal(t, tt.expected, evaluator.stack.MustPop().String())
+            require.NoError(t, cerr)
+            require.Equal(t, tt.expected, actual.String())
+        })
+    }
+}
+
+func TestArithmetic_DivisionByZero(t *testing.T) {
+    operands := []struct {
+        left, right engine.Value
+        result      types.Type
+    }{
+        {engine.NewIntValue(10), engine.NewIntValue(0), types.INTEGER},
+        {engine.NewFloatValue(2.5), engine.NewFloatValue(0), types.FLOAT},
+        {engine.NewIntValue(10), engine.NewFloatValue(0), types.FLOAT},
+    }
+    for _, op := range []token.TokenType{token.DIVIDE, token.MODULO} {
+        for _, o := range operands {
+            // the untyped evaluation agrees with the typed one rather than panicking
+            _, err := arithmetic(&o.left, &o.right, op)
+            require.EqualError(t, err, "division by zero", "%s %s %s", o.left.String(), op, o.right.String())
+            _, err = typedArithmetic(&o.left, &o.right, o.result, op)
+            require.EqualError(t, err, "division by zero", "%s %s %s", o.left.String(), op, o.right.String())
+        }
+    }
+}
+
+func TestCompile_ColumnAcrossSchemas(t *testing.T) {
+    column := &ast.ColumnIdentifierNode{Value: "c3"}
+    expression := Compile(column, time.Now())
+
+    first := batchOf(recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(1)}))
+    second := batchOf(recordWithValues(map[string]engine.Value{"a": engine.NewIntValue(0), "c3": engine.NewIntValue(2)}))
+
+    for batch, expected := range map[*engine.Batch]int64{first: 1, second: 2} {
+        value, err := expression(batch, 0)
+        require.NoError(t, err)
+        require.Equal(t, expected, value.MustInt())
+    }
+}
+
+// projection resolves an expression by planning it as the projection of a query over t1.
+func projection(t testing.TB, metaSvc metastore.Service, indexSvc index.Service, expression string) ast.ExpressionNode {
+    p := unoptimizedPlan(t, metaSvc, indexSvc, fmt.Sprintf("SELECT %s FROM t1", expression))
+    project, ok := p.RootOperator.(*ProjectOperator)
+    require.True(t, ok)
+    return project.projections[0]
+}
+
+func BenchmarkExpression(b *testing.B) {
+    teardown, metaSvc, indexSvc := setup(b, data)
+    defer teardown(b)
+
+    records := make([]*engine.Record, DefaultBatchSize)
+    for i := range records {
+        records[i] = recordWithValues(map[string]engine.Value{
+            "c1": engine.NewStringValue(fmt.Sprintf("apple-%d", i%10)),
+            "c3": engine.NewIntValue(int64(i)),
+            "c4": engine.NewFloatValue(float64(i) / 2),
+        })
+    }
+    batch := engine.NewBatches(records, DefaultBatchSize)[0]
+
+    predicates := []string{
+        `c3 > 500`,
+        `c3 * 2 + c4 > 1000`,
+        `c1 LIKE '%-7'`,
+        `c3 > 10 AND c4 < 400.0 AND c1 = 'apple-3'`,
+    }
+    for _, predicate := range predicates {
+        node := projection(b, metaSvc, indexSvc, predicate)
+        b.Run(fmt.Sprintf("%s/evaluator", predicate), func(b *testing.B) {
+            evaluator := NewPredicateEvaluator(time.Now())
+            for i := 0; i < b.N; i++ {
+                for row := 0; row < batch.Len(); row++ {
+                    evaluator.at(batch, row)
+                    if err := node.Accept(evaluator); err != nil {
+                        b.Fatal(err)
+                    }
+                    evaluator.stack.MustPop()
+                }
+            }
+        })
+        b.Run(fmt.Sprintf("%s/compiled", predicate), func(b *testing.B) {
+            expression := Compile(node, time.Now())
+            for i := 0; i < b.N; i++ {
+                for row := 0; row < batch.Len(); row++ {
+                    if _, err := expression(batch, row); err != nil {
+                        b.Fatal(err)
+                    }
+                }
+            }
+        })
+    }
+}
@@ -12,7 +12,7 @@ type CreateOperator struct {
     Columns   []*ast.ColumnDefinitionNode
     Partition string
     metaSvc   metastore.Service
-    sink      chan *engine.Result
+    sink      chan *engine.Batch
 }
 
 func NewCreateOperator(metaSvc metastore.Service, name string, columns []*ast.ColumnDefinitionNode, partition string) *CreateOperator {
@@ -21,11 +21,11 @@ func NewCreateOperator(metaSvc metastore.Service, name string, columns []*ast.Co
         Columns:   columns,
         Partition: partition,
         metaSvc:   metaSvc,
-        sink:      make(chan *engine.Result),
+        sink:      make(chan *engine.Batch),
     }
 }
 
-func (operator *CreateOperator) Sink() <-chan *engine.Result {
+func (operator *CreateOperator) Sink() <-chan *engine.Batch {
     return operator.sink
 }
 
@@ -33,7 +33,10 @@ func (operator *CreateOperator) Accept(ctx context.Context, visitor OperatorNode
     return visitor.VisitCreateOperator(ctx, operator)
 }
 
+// Open creates the table before returning. The operator produces no records, so its sink is
+// closed as soon as the table exists or creating it has failed.
 func (operator *CreateOperator) Open(ctx context.Context) error {
+    defer close(operator.sink)
     columns := make(map[string]metastore.ColumnMetadata, len(operator.Columns))
     for _, col := range operator.Columns {
         columns[col.Value] = toColumnMetadata(col)
@@ -45,6 +48,9 @@ func (operator *CreateOperator) Open(ctx context.Context) error {
     return operator.metaSvc.Persist()
 }
 
+// Close does nothing, since the operator does all of its work in Open.
+func (operator *CreateOperator) Close() {}
+
 func toColumnMetadata(column *ast.ColumnDefinitionNode) metastore.ColumnMetadata {
     return metastore.ColumnMetadata{
         ColumnName: column.Value,
@@ -0,0 +1,76 @@
+package physical
+
+import (
+    "context"
+    "fmt"
+)
+
+/* *** Errors *** */
+
+type ErrorCode int
+
+const (
+    _ ErrorCode = iota
+    EvaluationError // an expression could not be evaluated against a record
+    DecodingError   // a stored field could not be decoded into a value
+    SearchError     // the search index could not be read
+)
+
+func (c ErrorCode) String() string {
+    switch c {
+    case EvaluationError:
+        return "evaluation"
+    case DecodingError:
+        return "decoding"
+    case SearchError:
+        return "search"
+    default:
+        return "unknown"
+    }
+}
+
+// Error is raised by an operator of a physical plan while the plan executes. The first error
+// raised by any operator cancels the plan and is returned by QueryPlan.Execute.
+type Error struct {
+    ErrorCode ErrorCode
+    Operator  string
+    Message   string
+    Err       error
+}
+
+func (e Error) Error() string {
+    if e.Err == nil {
+        return fmt.Sprintf("%s: %s", e.Operator, e.Message)
+    }
+    return fmt.Sprintf("%s: %s: %v", e.Operator, e.Message, e.Err)
+}
+
+func (e Error) Unwrap() error {
+    return e.Err
+}
+
+// Is reports whether the target is an Error with the same code, or with no code at all, so that
+// errors.Is(err, Error{}) matches any error raised by an operator.
+func (e Error) Is(target error) bool {
+    if other, ok := target.(Error); ok {
+        return other.ErrorCode == 0 || other.ErrorCode == e.ErrorCode
+    }
+    return false
+}
+
+type failureKey struct{}
+
+// withFailure derives a context for executing a plan, which is cancelled by the first error
+// that an operator of the plan reports through fail. Later errors are dropped, and
+// context.Cause of the derived context returns the first one.
+func withFailure(ctx context.Context) (context.Context, context.CancelCauseFunc) {
+    ctx, cancel := context.WithCancelCause(ctx)
+    return context.WithValue(ctx, failureKey{}, cancel), cancel
+}
+
+// fail reports an error raised while executing a plan and cancels the rest of the plan.
+func fail(ctx context.Context, err error) {
+    if cancel, ok := ctx.Value(failureKey{}).(context.CancelCauseFunc); ok {
+        cancel(err)
+    }
+}
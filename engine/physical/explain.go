@@ -0,0 +1,182 @@
+package physical
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/logical"
+    "strings"
+    "time"
+)
+
+// ExplainOperator describes the plan of the statement it wraps instead of returning that
+// statement's results, along with the optimizer rules that rewrote it. With ANALYZE the wrapped
+// plan is executed to completion first and the runtime statistics of every operator are reported
+// alongside the plan.
+type ExplainOperator struct {
+    explain *logical.ExplainNode
+    plan    *QueryPlan
+    size    int
+    sink    chan *engine.Batch
+    Stats   ExplainOperatorStats
+    *lifecycle
+}
+
+type ExplainOperatorStats struct {
+    Records uint64
+    Elapsed time.Duration
+}
+
+// ExplainDocument is the JSON rendering of an explained plan.
+type ExplainDocument struct {
+    Logical  []string            `json:"logical"`
+    Physical *OperatorStatistics `json:"physical"`
+    Rules    []string            `json:"rules"`
+    Analyzed bool                `json:"analyzed"`
+}
+
+func NewExplainOperator(explain *logical.ExplainNode, plan *QueryPlan, size int) *ExplainOperator {
+    return &ExplainOperator{
+        explain:   explain,
+        plan:      plan,
+        size:      size,
+        sink:      make(chan *engine.Batch),
+        lifecycle: newLifecycle(),
+    }
+}
+
+// Columns returns the names of the columns emitted by the operator, in display order.
+func (operator *ExplainOperator) Columns() []string {
+    if operator.explain.Format == ast.ExplainFormatText && operator.explain.Analyze {
+        return []string{"operator", "rows", "bytes", "bytes_skipped", "time_ms"}
+    }
+    return []string{"plan"}
+}
+
+func (operator *ExplainOperator) Sink() <-chan *engine.Batch {
+    return operator.sink
+}
+
+func (operator *ExplainOperator) Accept(ctx context.Context, visitor OperatorNodeVisitor) error {
+    return visitor.VisitExplainOperator(ctx, operator)
+}
+
+func (operator *ExplainOperator) Open(ctx context.Context) error {
+    start := time.Now()
+
+    records, err := operator.explainPlan(ctx)
+    if err != nil {
+        close(operator.sink)
+        return err
+    }
+
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        for _, batch := range engine.NewBatches(records, operator.size) {
+            if !operator.emit(ctx, operator.sink, batch) {
+                return
+            }
+            operator.Stats.Records += uint64(batch.Len())
+        }
+    })
+    return nil
+}
+
+func (operator *ExplainOperator) Close() {
+    operator.halt()
+    operator.wait()
+}
+
+func (operator *ExplainOperator) explainPlan(ctx context.Context) ([]*engine.Record, error) {
+    lines, err := logical.ExplainQueryPlan(operator.explain.Plan)
+    if err != nil {
+        return nil, err
+    }
+
+    if operator.explain.Analyze {
+        if _, err := operator.plan.Execute(ctx); err != nil {
+            return nil, err
+        }
+    } else {
+        stats := &OperatorStatsCollector{}
+        if err := operator.plan.RootOperator.Accept(ctx, stats); err != nil {
+            return nil, err
+        }
+        operator.plan.Statistics = stats.Statistics()
+    }
+
+    rules := make([]string, len(operator.explain.Rules))
+    for i, rule := range operator.explain.Rules {
+        rules[i] = rule.String()
+    }
+
+    if operator.explain.Format == ast.ExplainFormatJSON {
+        data, err := json.Marshal(ExplainDocument{
+            Logical:  lines,
+            Physical: operator.plan.Statistics,
+            Rules:    rules,
+            Analyzed: operator.explain.Analyze,
+        })
+        if err != nil {
+            return nil, fmt.Errorf("marshalling explain document: %w", err)
+        }
+        return []*engine.Record{planRecord(string(data))}, nil
+    }
+
+    records := make([]*engine.Record, 0)
+    if operator.explain.Analyze {
+        walkStatistics(operator.plan.Statistics, 0, func(stats *OperatorStatistics, depth int) {
+            record := engine.NewRecord()
+            record.AddValue("operator", engine.NewStringValue(describeOperator(stats, depth)))
+            record.AddValue("rows", engine.NewIntValue(int64(stats.Records)))
+            record.AddValue("bytes", engine.NewIntValue(int64(stats.Bytes)))
+            record.AddValue("bytes_skipped", engine.NewIntValue(int64(stats.Skipped)))
+            record.AddValue("time_ms", engine.NewFloatValue(float64(stats.Elapsed.Microseconds())/1000))
+            records = append(records, record)
+        })
+        return records, nil
+    }
+
+    records = append(records, planRecord("Logical Plan"))
+    for _, line := range lines {
+        records = append(records, planRecord("  "+line))
+    }
+    records = append(records, planRecord("Physical Plan"))
+    walkStatistics(operator.plan.Statistics, 1, func(stats *OperatorStatistics, depth int) {
+        records = append(records, planRecord(describeOperator(stats, depth)))
+    })
+    if len(rules) > 0 {
+        records = append(records, planRecord("Optimizer Rules"))
+        for _, rule := range rules {
+            records = append(records, planRecord("  "+rule))
+        }
+    }
+    return records, nil
+}
+
+func planRecord(line string) *engine.Record {
+    record := engine.NewRecord()
+    record.AddValue("plan", engine.NewStringValue(line))
+    return record
+}
+
+func describeOperator(stats *OperatorStatistics, depth int) string {
+    indent := strings.Repeat("  ", depth)
+    if stats.Detail == "" {
+        return indent + stats.Operator
+    }
+    return fmt.Sprintf("%s%s [%s]", indent, stats.Operator, stats.Detail)
+}
+
+func walkStatistics(stats *OperatorStatistics, depth int, fn func(*OperatorStatistics, int)) {
+    if stats == nil {
+        return
+    }
+    fn(stats, depth)
+    for _, child := range stats.Children {
+        walkStatistics(child, depth+1, fn)
+    }
+}
@@ -0,0 +1,188 @@
+package physical
+
+import (
+    "context"
+    "encoding/json"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "github.com/aleph-zero/flutterdb/service/index"
+    "github.com/aleph-zero/flutterdb/service/metastore"
+    "github.com/stretchr/testify/require"
+    "testing"
+)
+
+func TestExplainOperator_Explain(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `EXPLAIN SELECT c1 FROM t1 WHERE c3 > 5 AND c3 * 2 < 20 LIMIT 2`)
+    require.Equal(t, []string{"plan"}, p.Columns)
+
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+
+    lines := make([]string, len(results))
+    for i, result := range results {
+        lines[i] = result.Record.Values["plan"].MustString()
+    }
+    require.Equal(t, []string{
+        "Logical Plan",
+        "  Project [c1]",
+        "    Limit 2",
+        "      Select predicate: c3 * 2 < 20",
+        "        Relation t1 pushed: c3 > 5 columns: [c1, c3]",
+        "Physical Plan",
+        "  Project [c1]",
+        "    Limit [2]",
+        "      Filter [c3 * 2 < 20]",
+        "        Scan [t1 query: NumericRangeQuery pushed: c3 > 5 columns: [c1, c3]]",
+        "Optimizer Rules",
+        "  pass 1: ProjectionPushdown rewrote Project",
+        "  pass 1: PredicatePushdown rewrote Select",
+    }, lines)
+}
+
+func TestExplainOperator_Analyze(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `EXPLAIN ANALYZE SELECT c1 FROM t WHERE c3 * 2 > 2 LIMIT 1`)
+    require.Equal(t, []string{"operator", "rows", "bytes", "bytes_skipped", "time_ms"}, p.Columns)
+
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 4)
+
+    expected := []struct {
+        operator string
+        rows     int64
+    }{
+        {"Project [c1]", 1},
+        {"  Limit [1]", 1},
+        {"    Filter [c3 * 2 > 2]", 2}, // the filter passes a batch on whole, and the limit takes one record of it
+        {"      Scan [t query: MatchAllQuery columns: [c1, c3]]", 3},
+    }
+    for i, e := range expected {
+        require.Equal(t, e.operator, results[i].Record.Values["operator"].MustString())
+        require.Equal(t, e.rows, results[i].Record.Values["rows"].MustInt())
+    }
+    require.Positive(t, results[3].Record.Values["bytes"].MustInt())
+    require.Positive(t, results[3].Record.Values["bytes_skipped"].MustInt()) // c2, c4 and c5 are not decoded
+    require.Zero(t, results[0].Record.Values["bytes_skipped"].MustInt())
+}
+
+func TestExplainOperator_AnalyzePushdown(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `EXPLAIN ANALYZE SELECT c1 FROM t WHERE c1 = 'b'`)
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 2)
+
+    // the scan reads only the matching document, and there is nothing left to filter
+    require.Equal(t, "  Scan [t query: TermQuery pushed: c1 = 'b' columns: [c1]]", results[1].Record.Values["operator"].MustString())
+    require.Equal(t, int64(1), results[1].Record.Values["rows"].MustInt())
+}
+
+func TestExplainOperator_AnalyzeJSON(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `EXPLAIN ANALYZE FORMAT JSON SELECT c1 FROM t`)
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 1)
+
+    var document ExplainDocument
+    require.NoError(t, json.Unmarshal([]byte(results[0].Record.Values["plan"].MustString()), &document))
+    require.True(t, document.Analyzed)
+    require.Equal(t, []string{"Project [c1]", "  Select", "    Relation t columns: [c1]"}, document.Logical)
+    require.Equal(t, []string{"pass 1: ProjectionPushdown rewrote Project"}, document.Rules)
+    require.Equal(t, "Project", document.Physical.Operator)
+    require.Equal(t, uint64(3), document.Physical.Records)
+    require.Len(t, document.Physical.Children, 1)
+    require.Equal(t, "Scan", document.Physical.Children[0].Operator)
+}
+
+// setupIndex creates a table 't' in a temporary metastore and indexes three documents into it.
+func setupIndex(tb testing.TB) (func(tb testing.TB), metastore.Service, index.Service) {
+    ms := metastore.NewService(tb.TempDir())
+    table := metastore.NewTableMetadata("t", map[string]metastore.ColumnMetadata{
+        "c1": {ColumnName: "c1", ColumnType: types.KEYWORD},
+        "c2": {ColumnName: "c2", ColumnType: types.TEXT},
+        "c3": {ColumnName: "c3", ColumnType: types.INTEGER},
+        "c4": {ColumnName: "c4", ColumnType: types.GEOPOINT},
+        "c5": {ColumnName: "c5", ColumnType: types.DATETIME, ColumnOptions: map[string]string{"format": "DateTime"}},
+    }, "")
+    ctx := context.Background()
+    require.NoError(tb, ms.CreateTable(ctx, table))
+
+    indexSvc := index.NewService(ms)
+    _, err := indexSvc.Index(ctx, "t", []*index.Document{
+        {Fields: map[string]interface{}{"c1": "a", "c2": "red apple pie", "c3": float64(1),
+            "c4": map[string]interface{}{"lat": 40.7128, "lon": -74.0060}, "c5": "2024-01-15 09:30:00"}}, // New York
+        {Fields: map[string]interface{}{"c1": "b", "c2": "green apple", "c3": float64(2),
+            "c4": "42.3601,-71.0589", "c5": "2024-02-29 18:00:00"}}, // Boston
+        {Fields: map[string]interface{}{"c1": "c", "c2": "blue sky", "c3": float64(3),
+            "c4": []interface{}{-0.1278, 51.5074}, "c5": "2024-07-04 12:00:00"}}, // London
+    })
+    require.NoError(tb, err)
+    return func(tb testing.TB) { require.NoError(tb, indexSvc.Close()) }, ms, indexSvc
+}
+
+func TestExplainOperator_ExplainWithoutFrom(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `EXPLAIN SELECT 1 + 2`)
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+
+    lines := make([]string, len(results))
+    for i, result := range results {
+        lines[i] = result.Record.Values["plan"].MustString()
+    }
+    require.Equal(t, []string{
+        "Logical Plan",
+        "  Project [3]",
+        "    Select",
+        "      Values",
+        "Physical Plan",
+        "  Project [3]",
+        "    Values",
+        "Optimizer Rules",
+        "  pass 1: ConstantExpressionEvaluator rewrote Project",
+    }, lines)
+}
+
+func TestExplainOperator_ExplainContradiction(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `EXPLAIN SELECT c1 FROM t1 WHERE c3 > 5 AND 1 = 0`)
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+
+    lines := make([]string, len(results))
+    for i, result := range results {
+        lines[i] = result.Record.Values["plan"].MustString()
+    }
+    require.Equal(t, []string{
+        "Logical Plan",
+        "  Project [c1]",
+        "    Select",
+        "      Values empty",
+        "Physical Plan",
+        "  Project [c1]",
+        "    Values [empty]",
+        "Optimizer Rules",
+        "  pass 1: ProjectionPushdown rewrote Project",
+        "  pass 1: ConstantExpressionEvaluator rewrote Select",
+    }, lines)
+}
@@ -7,29 +7,43 @@ import (
     "github.com/aleph-zero/flutterdb/engine"
     "github.com/aleph-zero/flutterdb/engine/ast"
     "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "github.com/blugelabs/bluge/numeric/geo"
     "golang.org/x/exp/constraints"
     "math"
+    "regexp"
+    "strings"
+    "time"
 )
 
 type FilterOperator struct {
-    child     OperatorNode
-    predicate ast.ExpressionNode
-    evaluator *PredicateEvaluator
-    source    <-chan *engine.Result
-    sink      chan *engine.Result
+    child      OperatorNode
+    predicate  ast.ExpressionNode
+    expression Expression
+    source     <-chan *engine.Batch
+    sink       chan *engine.Batch
+    Stats      FilterOperatorStats
+    *lifecycle
 }
 
-func NewFilterOperator(child OperatorNode, predicate ast.ExpressionNode) *FilterOperator {
+type FilterOperatorStats struct {
+    Records uint64
+    Bytes   uint64
+    Elapsed time.Duration
+}
+
+func NewFilterOperator(child OperatorNode, predicate ast.ExpressionNode, now time.Time) *FilterOperator {
     return &FilterOperator{
-        child:     child,
-        predicate: predicate,
-        evaluator: NewPredicateEvaluator(),
-        source:    child.Sink(),
-        sink:      make(chan *engine.Result),
+        child:      child,
+        predicate:  predicate,
+        expression: Compile(predicate, now),
+        source:     child.Sink(),
+        sink:       make(chan *engine.Batch),
+        lifecycle:  newLifecycle(),
     }
 }
 
-func (operator *FilterOperator) Sink() <-chan *engine.Result {
+func (operator *FilterOperator) Sink() <-chan *engine.Batch {
     return operator.sink
 }
 
@@ -38,56 +52,97 @@ func (operator *FilterOperator) Accept(ctx context.Context, visitor OperatorNode
 }
 
 func (operator *FilterOperator) Open(ctx context.Context) error {
-    go func() {
+    start := time.Now()
+    operator.start(func() {
         defer close(operator.sink)
-        for result := range operator.source {
-            r, err := operator.filter(result.Record)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        for {
+            batch, ok := operator.next(ctx, operator.source)
+            if !ok {
+                return
+            }
+            rows, err := operator.filter(batch)
             if err != nil {
-                // TODO XXX SIGNAL ERROR UPSTREAM
+                fail(ctx, Error{ErrorCode: EvaluationError, Operator: "Filter", Message: fmt.Sprintf("evaluating %s", operator.predicate.String()), Err: err})
+                return
+            }
+            if len(rows) == 0 {
+                continue
+            }
+            if len(rows) < batch.Len() {
+                batch = batch.Select(rows)
             }
-            if r {
-                operator.evaluator.stack.Clear()
-                operator.sink <- result
+            if !operator.emit(ctx, operator.sink, batch) {
+                return
             }
+            operator.Stats.Records += uint64(batch.Len())
+            operator.Stats.Bytes += uint64(batch.Bytes())
         }
-    }()
+    })
     return nil
 }
 
-func (operator *FilterOperator) filter(record *engine.Record) (bool, error) {
-    operator.evaluator.record = record
-    if err := operator.predicate.Accept(operator.evaluator); err != nil {
-        return false, err
-    }
-
-    final := operator.evaluator.stack.MustPop()
-    if operator.evaluator.stack.Len() != 0 {
-        panic("filter evaluator stack not empty")
-    }
+func (operator *FilterOperator) Close() {
+    operator.halt()
+    operator.child.Close()
+    operator.wait()
+}
 
-    fmt.Printf("final value: %v\n", final.String())
-    fmt.Printf("final value kind: %v\n", final.Kind())
-    fmt.Printf("final truth value: %t\n", final.ToBoolean())
+// filter evaluates the compiled predicate against every record of a batch and returns the
+// positions of the records it holds for. A predicate that is NULL for a record does not hold.
+func (operator *FilterOperator) filter(batch *engine.Batch) ([]int, error) {
+    return filterRows(batch, operator.expression)
+}
 
-    return final.ToBoolean(), nil
+func filterRows(batch *engine.Batch, predicate Expression) ([]int, error) {
+    rows := make([]int, 0, batch.Len())
+    for row := 0; row < batch.Len(); row++ {
+        value, err := predicate(batch, row)
+        if err != nil && !missing(err) {
+            return nil, err
+        }
+        if err == nil && value.ToBoolean() {
+            rows = append(rows, row)
+        }
+    }
+    return rows, nil
 }
 
+// PredicateEvaluator evaluates an expression against a record of a batch by walking its nodes,
+// leaving the value of the expression on its stack. Operators evaluate compiled expressions
+// instead; the evaluator remains the reference that compiled expressions are checked against.
 type PredicateEvaluator struct {
-    record *engine.Record
-    stack  *engine.Stack[*engine.Value]
+    batch *engine.Batch
+    row   int
+    stack *engine.Stack[*engine.Value]
+    likes map[*ast.BinaryExpressionNode]*likeMatcher
+    now   engine.Value
 }
 
-func NewPredicateEvaluator() *PredicateEvaluator {
+// NewPredicateEvaluator creates an evaluator in which NOW() evaluates to the timestamp of the
+// statement.
+func NewPredicateEvaluator(now time.Time) *PredicateEvaluator {
     return &PredicateEvaluator{
         stack: engine.NewStack[*engine.Value](),
+        now:   engine.NewTimeValue(now),
+        likes: make(map[*ast.BinaryExpressionNode]*likeMatcher),
     }
 }
 
+// at positions the evaluator at a record of a batch.
+func (pe *PredicateEvaluator) at(batch *engine.Batch, row int) {
+    pe.batch = batch
+    pe.row = row
+}
+
 func (pe *PredicateEvaluator) comparable() bool {
     return true
 }
 
 func (pe *PredicateEvaluator) VisitBinaryExpressionNode(node *ast.BinaryExpressionNode) error {
+    if node.Op.TokenType == token.AND || node.Op.TokenType == token.OR {
+        return pe.logical(node)
+    }
     if err := node.Left.Accept(pe); err != nil {
         return err
     }
@@ -98,38 +153,149 @@ func (pe *PredicateEvaluator) VisitBinaryExpressionNode(node *ast.BinaryExpressi
     r := pe.stack.MustPop()
     l := pe.stack.MustPop()
 
-    fmt.Printf("values after popping stack left: %v, right: %v\n", l.String(), r.String())
+    lt, lok := ast.TypeOf(node.Left)
+    rt, rok := ast.TypeOf(node.Right)
+    typed := lok && rok
 
     switch node.Op.TokenType {
     case token.EQUAL, token.NOT_EQUAL, token.GT, token.GTE, token.LT, token.LTE:
-        pe.stack.Push(comparison(l, r, node.Op.TokenType))
+        if typed {
+            pe.stack.Push(typedComparison(l, r, lt, rt, node.Op.TokenType))
+        } else {
+            pe.stack.Push(comparison(l, r, node.Op.TokenType))
+        }
     case token.PLUS, token.MINUS, token.ASTERISK, token.DIVIDE, token.MODULO:
-        v, err := arithmetic(l, r, node.Op.TokenType)
+        var v *engine.Value
+        var err error
+        if t, ok := ast.TypeOf(node); ok && typed {
+            v, err = typedArithmetic(l, r, t, node.Op.TokenType)
+        } else {
+            v, err = arithmetic(l, r, node.Op.TokenType)
+        }
         if err != nil {
             return err
         }
         pe.stack.Push(v)
     case token.LIKE:
-        panic("like unimplemented")
-    case token.AND:
-        v := engine.NewBooleanValue(l.ToBoolean() && r.ToBoolean())
-        pe.stack.Push(&v)
-    case token.OR:
-        v := engine.NewBooleanValue(l.ToBoolean() || r.ToBoolean())
-        pe.stack.Push(&v)
+        matcher, ok := pe.likes[node]
+        if !ok {
+            matcher = &likeMatcher{}
+            pe.likes[node] = matcher
+        }
+        v, err := matcher.like(l, r)
+        if err != nil {
+            return err
+        }
+        pe.stack.Push(v)
     default:
         panic("unimplemented binary operator")
     }
     return nil
 }
 
-func like(left, right *engine.Value) (*engine.Value, error) {
+// logical evaluates AND and OR by three-valued logic, short-circuiting as compiled expressions do.
+func (pe *PredicateEvaluator) logical(node *ast.BinaryExpressionNode) error {
+    decisive := node.Op.TokenType == token.OR
+    l, lerr := pe.operand(node.Left)
+    if lerr != nil && !missing(lerr) {
+        return lerr
+    }
+    if lerr == nil && l.ToBoolean() == decisive {
+        v := engine.NewBooleanValue(decisive)
+        pe.stack.Push(&v)
+        return nil
+    }
+
+    var r engine.Value
+    value, rerr := pe.operand(node.Right)
+    if rerr == nil {
+        r = *value
+    }
+    v, err := settle(decisive, lerr, r, rerr)
+    if err != nil {
+        return err
+    }
+    pe.stack.Push(&v)
+    return nil
+}
+
+// operand evaluates an operand and pops its value, leaving the stack as it was if it fails.
+func (pe *PredicateEvaluator) operand(node ast.ExpressionNode) (*engine.Value, error) {
+    depth := pe.stack.Len()
+    if err := node.Accept(pe); err != nil {
+        for pe.stack.Len() > depth {
+            pe.stack.MustPop()
+        }
+        return nil, err
+    }
+    return pe.stack.MustPop(), nil
+}
+
+// likeMatcher matches values against the SQL LIKE patterns of one LIKE operator, where '%'
+// matches any sequence of characters and '_' matches exactly one character. The pattern is
+// usually the same for every record, so the regular expression of the last pattern is kept
+// rather than compiled anew for every record.
+type likeMatcher struct {
+    pattern string
+    re      *regexp.Regexp
+}
+
+func (m *likeMatcher) like(left, right *engine.Value) (*engine.Value, error) {
+    pattern, ok := right.StringVal()
+    if !ok {
+        return nil, fmt.Errorf("LIKE pattern must be a string, received '%s'", right.Kind())
+    }
+
+    if m.re == nil || pattern != m.pattern {
+        re, err := likePattern(pattern)
+        if err != nil {
+            return nil, err
+        }
+        m.pattern, m.re = pattern, re
+    }
+    re := m.re
+
+    value, ok := left.StringVal()
+    if !ok {
+        value = left.String()
+    }
+    v := engine.NewBooleanValue(re.MatchString(value))
+    return &v, nil
+}
+
+// likePattern translates a SQL LIKE pattern into an anchored regular expression.
+func likePattern(pattern string) (*regexp.Regexp, error) {
+    var sb strings.Builder
+    sb.WriteString("(?s)^")
+    for _, r := range pattern {
+        switch r {
+        case '%':
+            sb.WriteString(".*")
+        case '_':
+            sb.WriteString(".")
+        default:
+            sb.WriteString(regexp.QuoteMeta(string(r)))
+        }
+    }
+    sb.WriteString("$")
 
-    return nil, nil
+    re, err := regexp.Compile(sb.String())
+    if err != nil {
+        return nil, fmt.Errorf("invalid LIKE pattern '%s': %w", pattern, err)
+    }
+    return re, nil
 }
 
 func arithmetic(left, right *engine.Value, op token.TokenType) (*engine.Value, error) {
+    if left.Kind() == engine.DateTime || left.Kind() == engine.Interval ||
+        right.Kind() == engine.DateTime || right.Kind() == engine.Interval {
+        return temporalArithmetic(left, right, op)
+    }
+
     if left.CanInt() && right.CanInt() {
+        if (op == token.DIVIDE || op == token.MODULO) && right.ToInt() == 0 {
+            return nil, errors.New("division by zero")
+        }
         if op == token.MODULO {
             v := engine.NewIntValue(left.ToInt() % right.ToInt())
             return &v, nil
@@ -152,6 +318,69 @@ func arithmetic(left, right *engine.Value, op token.TokenType) (*engine.Value, e
     return &v, nil
 }
 
+// typedArithmetic applies an arithmetic operator whose result type was inferred by the type
+// checker, without inspecting the kinds of the operands.
+func typedArithmetic(left, right *engine.Value, result types.Type, op token.TokenType) (*engine.Value, error) {
+    switch result {
+    case types.INTEGER:
+        l, r := left.ToInt(), right.ToInt()
+        if (op == token.DIVIDE || op == token.MODULO) && r == 0 {
+            return nil, errors.New("division by zero")
+        }
+        if op == token.MODULO {
+            v := engine.NewIntValue(l % r)
+            return &v, nil
+        }
+        v := engine.NewIntValue(apply(l, r, op))
+        return &v, nil
+    case types.FLOAT:
+        l, r := left.ToFloat(), right.ToFloat()
+        if (op == token.DIVIDE || op == token.MODULO) && r == 0 {
+            return nil, errors.New("division by zero")
+        }
+        if op == token.MODULO {
+            v := engine.NewFloatValue(math.Mod(l, r))
+            return &v, nil
+        }
+        v := engine.NewFloatValue(apply(l, r, op))
+        return &v, nil
+    default:
+        return temporalArithmetic(left, right, op)
+    }
+}
+
+// temporalArithmetic adds or subtracts an interval to or from a timestamp or another interval,
+// or subtracts two timestamps.
+func temporalArithmetic(left, right *engine.Value, op token.TokenType) (*engine.Value, error) {
+    lt, ltok := left.TimeVal()
+    li, liok := left.IntervalVal()
+    rt, rtok := right.TimeVal()
+    ri, riok := right.IntervalVal()
+
+    switch {
+    case ltok && riok && op == token.PLUS:
+        v := engine.NewTimeValue(ri.AddTo(lt))
+        return &v, nil
+    case ltok && riok && op == token.MINUS:
+        v := engine.NewTimeValue(ri.Negate().AddTo(lt))
+        return &v, nil
+    case liok && rtok && op == token.PLUS:
+        v := engine.NewTimeValue(li.AddTo(rt))
+        return &v, nil
+    case ltok && rtok && op == token.MINUS:
+        v := engine.NewIntervalValue(types.Interval{Duration: lt.Sub(rt)})
+        return &v, nil
+    case liok && riok && op == token.PLUS:
+        v := engine.NewIntervalValue(li.Add(ri))
+        return &v, nil
+    case liok && riok && op == token.MINUS:
+        v := engine.NewIntervalValue(li.Add(ri.Negate()))
+        return &v, nil
+    default:
+        return nil, fmt.Errorf("cannot apply operator '%s' to '%s' and '%s'", op, left.Kind(), right.Kind())
+    }
+}
+
 type calculable interface {
     constraints.Integer | constraints.Float
 }
@@ -176,6 +405,16 @@ func comparison(left, right *engine.Value, op token.TokenType) *engine.Value {
         return compare(left.MustString(), right.MustString(), op)
     }
 
+    if left.Kind() == engine.DateTime || right.Kind() == engine.DateTime {
+        l, lok := timestamp(left)
+        r, rok := timestamp(right)
+        if !lok || !rok {
+            v := engine.NewBooleanValue(op == token.NOT_EQUAL)
+            return &v
+        }
+        return compare(l.UnixNano(), r.UnixNano(), op)
+    }
+
     if left.CanInt() && right.CanInt() {
         return compare(left.ToInt(), right.ToInt(), op)
     }
@@ -183,6 +422,36 @@ func comparison(left, right *engine.Value, op token.TokenType) *engine.Value {
     return compare(left.ToFloat(), right.ToFloat(), op)
 }
 
+// typedComparison compares two values whose types were inferred by the type checker. Strings are
+// compared as strings and numbers as numbers, whatever they hold; timestamps compared with strings
+// fall back to comparison, which parses the string.
+func typedComparison(left, right *engine.Value, lt, rt types.Type, op token.TokenType) *engine.Value {
+    switch {
+    case lt.IsString() && rt.IsString():
+        return compare(left.MustString(), right.MustString(), op)
+    case lt == types.INTEGER && rt == types.INTEGER:
+        return compare(left.ToInt(), right.ToInt(), op)
+    case lt.IsNumeric() && rt.IsNumeric():
+        return compare(left.ToFloat(), right.ToFloat(), op)
+    case lt == types.BOOLEAN && rt == types.BOOLEAN:
+        return compare(left.ToInt(), right.ToInt(), op)
+    default:
+        return comparison(left, right, op)
+    }
+}
+
+// timestamp returns the time held by a datetime value, or parsed from a string value.
+func timestamp(value *engine.Value) (time.Time, bool) {
+    if t, ok := value.TimeVal(); ok {
+        return t, true
+    }
+    if s, ok := value.StringVal(); ok {
+        t, err := types.ParseTimestamp(s)
+        return t, err == nil
+    }
+    return time.Time{}, false
+}
+
 func compare[T constraints.Ordered](left, right T, op token.TokenType) *engine.Value {
     switch op {
     case token.EQUAL:
@@ -209,9 +478,9 @@ func compare[T constraints.Ordered](left, right T, op token.TokenType) *engine.V
 }
 
 func (pe *PredicateEvaluator) VisitColumnIdentifierNode(node *ast.ColumnIdentifierNode) error {
-    value, ok := pe.record.Values[node.Value]
+    value, ok := pe.batch.Value(node.Value, pe.row)
     if !ok {
-        panic(fmt.Sprintf("no value for column '%s' in record", node.Value))
+        return noValueError{column: node.Value}
     }
     pe.stack.Push(&value)
     return nil
@@ -235,6 +504,24 @@ func (pe *PredicateEvaluator) VisitStringLiteralNode(node *ast.StringLiteralNode
     return nil
 }
 
+func (pe *PredicateEvaluator) VisitBooleanLiteralNode(node *ast.BooleanLiteralNode) error {
+    v := engine.NewBooleanValue(node.Value)
+    pe.stack.Push(&v)
+    return nil
+}
+
+func (pe *PredicateEvaluator) VisitTimestampLiteralNode(node *ast.TimestampLiteralNode) error {
+    v := engine.NewTimeValue(node.Value)
+    pe.stack.Push(&v)
+    return nil
+}
+
+func (pe *PredicateEvaluator) VisitIntervalLiteralNode(node *ast.IntervalLiteralNode) error {
+    v := engine.NewIntervalValue(node.Value)
+    pe.stack.Push(&v)
+    return nil
+}
+
 func (pe *PredicateEvaluator) VisitUnaryExpressionNode(node *ast.UnaryExpressionNode) error {
     if err := node.Node.Accept(pe); err != nil {
         return err
@@ -271,6 +558,76 @@ func (pe *PredicateEvaluator) VisitParenthesizedExpression(node *ast.Parenthesiz
     return node.Node.Accept(pe)
 }
 
+func (pe *PredicateEvaluator) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    if signature, ok := ast.LookupFunction(node.Name); ok && signature.Search {
+        return fmt.Errorf("search predicate '%s' must be answered by the search index", node.Name)
+    }
+
+    arguments := make([]*engine.Value, len(node.Arguments))
+    for i, argument := range node.Arguments {
+        if err := argument.Accept(pe); err != nil {
+            return err
+        }
+        arguments[i] = pe.stack.MustPop()
+    }
+
+    switch node.Name {
+    case ast.FunctionGeoDistance:
+        v, err := geoDistance(arguments[0], arguments[1], arguments[2])
+        if err != nil {
+            return err
+        }
+        pe.stack.Push(v)
+    case ast.FunctionNow:
+        v := pe.now
+        pe.stack.Push(&v)
+    case ast.FunctionDateTrunc:
+        unit, _ := arguments[0].StringVal()
+        t, ok := timestamp(arguments[1])
+        if !ok {
+            return fmt.Errorf("%s requires a timestamp, received '%s'", node.Name, arguments[1].Kind())
+        }
+        truncated, err := types.TruncateTime(unit, t)
+        if err != nil {
+            return err
+        }
+        v := engine.NewTimeValue(truncated)
+        pe.stack.Push(&v)
+    case ast.FunctionExtract:
+        field, _ := arguments[0].StringVal()
+        t, ok := timestamp(arguments[1])
+        if !ok {
+            return fmt.Errorf("%s requires a timestamp, received '%s'", node.Name, arguments[1].Kind())
+        }
+        extracted, err := types.ExtractField(field, t)
+        if err != nil {
+            return err
+        }
+        v := engine.NewIntValue(extracted)
+        pe.stack.Push(&v)
+    default:
+        return fmt.Errorf("cannot evaluate function '%s'", node.Name)
+    }
+    return nil
+}
+
+// geoDistance returns the distance in meters between a geopoint and the given coordinates.
+func geoDistance(point, lat, lon *engine.Value) (*engine.Value, error) {
+    p, ok := point.GeoPointVal()
+    if !ok {
+        return nil, fmt.Errorf("GEO_DISTANCE requires a geopoint, received '%s'", point.Kind())
+    }
+    if !lat.CanFloat() || !lon.CanFloat() {
+        return nil, fmt.Errorf("GEO_DISTANCE requires numeric coordinates, received '%s', '%s'", lat.Kind(), lon.Kind())
+    }
+    v := engine.NewFloatValue(geo.Haversin(p.Lon(), p.Lat(), lon.ToFloat(), lat.ToFloat()) * 1000)
+    return &v, nil
+}
+
+func (pe *PredicateEvaluator) VisitOrderByNode(node *ast.OrderByNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
 func (pe *PredicateEvaluator) VisitPredicateNode(node *ast.PredicateNode) error {
     return fmt.Errorf("cannot evaluate node type '%T'", node)
 }
@@ -295,6 +652,26 @@ func (pe *PredicateEvaluator) VisitShowTablesStatementNode(node *ast.ShowTablesS
     return fmt.Errorf("cannot evaluate node type '%T'", node)
 }
 
+func (pe *PredicateEvaluator) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (pe *PredicateEvaluator) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (pe *PredicateEvaluator) VisitExecuteStatementNode(node *ast.ExecuteStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (pe *PredicateEvaluator) VisitDeallocateStatementNode(node *ast.DeallocateStatementNode) error {
+    return fmt.Errorf("cannot evaluate node type '%T'", node)
+}
+
+func (pe *PredicateEvaluator) VisitPlaceholderNode(node *ast.PlaceholderNode) error {
+    return fmt.Errorf("cannot evaluate unbound parameter '%s'", node.String())
+}
+
 func (pe *PredicateEvaluator) VisitColumnDefinitionNode(node *ast.ColumnDefinitionNode) error {
     return fmt.Errorf("cannot evaluate node type '%T'", node)
 }
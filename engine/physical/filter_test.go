@@ -25,7 +25,7 @@ func TestFilterOperator_True(t *testing.T) {
         {`SELECT * FROM t1 WHERE 1`, nil},
         {`SELECT * FROM t1 WHERE 1.0`, nil},
         {`SELECT * FROM t1 WHERE -1`, nil},
-        {`SELECT * FROM t1 WHERE "1"`, nil},
+        {`SELECT * FROM t1 WHERE '1'`, nil},
         {`SELECT * FROM t1 WHERE NOT 0`, nil},
         {`SELECT * FROM t1 WHERE NOT NOT 1`, nil},
         {`SELECT * FROM t1 WHERE (1)`, nil},
@@ -43,37 +43,39 @@ func TestFilterOperator_True(t *testing.T) {
             `SELECT * FROM t1 WHERE c3 < (1 + c4)`, // column comparison w/sub-expression
             recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(5), "c4": engine.NewIntValue(5)}),
         },
-        {`SELECT * FROM t1 WHERE "a" = "a"`, nil},
-        {`SELECT * FROM t1 WHERE "a" < "z"`, nil},
-        {`SELECT * FROM t1 WHERE  "1" = c3`,
+        {`SELECT * FROM t1 WHERE 'a' = 'a'`, nil},
+        {`SELECT * FROM t1 WHERE 'a' < 'z'`, nil},
+        {`SELECT * FROM t1 WHERE  1 = c3`,
             recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(1)})},
-        {`SELECT * FROM t1 WHERE  "0" != c3`,
+        {`SELECT * FROM t1 WHERE  0 != c3`,
             recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(1)})},
         {`SELECT * FROM t1 WHERE  c3 > 5`,
             recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(10)})},
-        {`SELECT * FROM t1 WHERE  c1 = "apple"`,
+        {`SELECT * FROM t1 WHERE  c1 = 'apple'`,
             recordWithValues(map[string]engine.Value{"c1": engine.NewStringValue("apple")})},
-        {`SELECT * FROM t1 WHERE 1 = 1 AND "a" = "a"`, nil},
-        {`SELECT * FROM t1 WHERE 1 = 1 AND NOT "a" != "a"`, nil},
-        {`SELECT * FROM t1 WHERE 1 = 2 OR "a" = "a"`, nil},
+        {`SELECT * FROM t1 WHERE 1 = 1 AND 'a' = 'a'`, nil},
+        {`SELECT * FROM t1 WHERE 1 = 1 AND NOT 'a' != 'a'`, nil},
+        {`SELECT * FROM t1 WHERE 1 = 2 OR 'a' = 'a'`, nil},
         {`SELECT * FROM t1 WHERE (1 + 2) > c4`,
             recordWithValues(map[string]engine.Value{"c4": engine.NewFloatValue(2.5)})},
         {`SELECT * FROM t1 WHERE (1 + 2) > c3 AND (1.5 * 3) = c4`,
             recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(2), "c4": engine.NewFloatValue(4.5)})},
-        {`SELECT * FROM t1 WHERE c1 > (c3 + (c4 * 2))`,
-            recordWithValues(map[string]engine.Value{"c1": engine.NewStringValue("10"), "c3": engine.NewIntValue(2), "c4": engine.NewFloatValue(1.5)})},
-        {`SELECT * FROM t1 WHERE c2 LIKE "%ppl%"`,
+        {`SELECT * FROM t1 WHERE c3 * 2 > (c3 + (c4 * 2))`,
+            recordWithValues(map[string]engine.Value{"c3": engine.NewIntValue(10), "c4": engine.NewFloatValue(1.5)})},
+        {`SELECT * FROM t1 WHERE c1 < '9'`, // strings compare as strings, even if they hold numbers
+            recordWithValues(map[string]engine.Value{"c1": engine.NewStringValue("10")})},
+        {`SELECT * FROM t1 WHERE c2 LIKE '%ppl%'`,
             recordWithValues(map[string]engine.Value{"c2": engine.NewStringValue("apple")})},
     }
     for _, tt := range tests {
         t.Run(tt.stmt, func(t *testing.T) {
-            p := plan(t, metaSvc, indexSvc, tt.stmt)
+            p := unoptimizedPlan(t, metaSvc, indexSvc, tt.stmt)
             f := &FilterOperatorFinder{}
             p.RootOperator.Accept(ctx, f)
             require.NotNil(t, f.operator)
-            r, err := f.operator.filter(tt.record)
+            rows, err := f.operator.filter(batchOf(tt.record))
             require.NoError(t, err)
-            require.True(t, r)
+            require.Equal(t, []int{0}, rows)
         })
     }
 }
@@ -91,22 +93,22 @@ func TestFilterOperator_False(t *testing.T) {
         {`SELECT * FROM t1 WHERE -0`, nil},         // negative zero
         {`SELECT * FROM t1 WHERE NOT 1`, nil},      // integer negation
         {`SELECT * FROM t1 WHERE 1 = 2`, nil},      // false integer equality
-        {`SELECT * FROM t1 WHERE "a"`, nil},        // false string false
-        {`SELECT * FROM t1 WHERE "0"`, nil},        // false string as int
-        {`SELECT * FROM t1 WHERE ""`, nil},         // false empty string
-        {`SELECT * FROM t1 WHERE "a" != "a"`, nil}, // false string comparison
-        {`SELECT * FROM t1 WHERE "a" > "z"`, nil},  // false string gt
-        {`SELECT * FROM t1 WHERE  c1 = "apple"`,
+        {`SELECT * FROM t1 WHERE 'a'`, nil},        // false string false
+        {`SELECT * FROM t1 WHERE '0'`, nil},        // false string as int
+        {`SELECT * FROM t1 WHERE ''`, nil},         // false empty string
+        {`SELECT * FROM t1 WHERE 'a' != 'a'`, nil}, // false string comparison
+        {`SELECT * FROM t1 WHERE 'a' > 'z'`, nil},  // false string gt
+        {`SELECT * FROM t1 WHERE  c1 = 'apple'`,
             recordWithValues(map[string]engine.Value{"c1": engine.NewStringValue("pumpkin")})},
     }
     for _, tt := range tests {
         t.Run(tt.stmt, func(t *testing.T) {
-            p := plan(t, metaSvc, indexSvc, tt.stmt)
+            p := unoptimizedPlan(t, metaSvc, indexSvc, tt.stmt)
             f := &FilterOperatorFinder{}
             p.RootOperator.Accept(ctx, f)
-            r, err := f.operator.filter(tt.record)
+            rows, err := f.operator.filter(batchOf(tt.record))
             require.NoError(t, err)
-            require.False(t, r)
+            require.Empty(t, rows)
         })
     }
 }
@@ -123,6 +125,21 @@ func (f *FilterOperatorFinder) VisitLimitOperator(ctx context.Context, operator
     operator.child.Accept(ctx, f)
     return nil
 }
+func (f *FilterOperatorFinder) VisitSortOperator(ctx context.Context, operator *SortOperator) error {
+    operator.child.Accept(ctx, f)
+    return nil
+}
+func (f *FilterOperatorFinder) VisitTopNOperator(ctx context.Context, operator *TopNOperator) error {
+    operator.child.Accept(ctx, f)
+    return nil
+}
+func (f *FilterOperatorFinder) VisitAggregateOperator(ctx context.Context, operator *AggregateOperator) error {
+    operator.child.Accept(ctx, f)
+    return nil
+}
+func (f *FilterOperatorFinder) VisitIndexAggregateOperator(ctx context.Context, operator *IndexAggregateOperator) error {
+    return nil
+}
 func (f *FilterOperatorFinder) VisitProjectOperator(ctx context.Context, operator *ProjectOperator) error {
     operator.child.Accept(ctx, f)
     return nil
@@ -133,9 +150,18 @@ func (f *FilterOperatorFinder) VisitScanOperator(ctx context.Context, operator *
 func (f *FilterOperatorFinder) VisitCreateOperator(ctx context.Context, operator *CreateOperator) error {
     return nil
 }
+func (f *FilterOperatorFinder) VisitSystemScanOperator(ctx context.Context, operator *SystemScanOperator) error {
+    return nil
+}
+func (f *FilterOperatorFinder) VisitValuesOperator(ctx context.Context, operator *ValuesOperator) error {
+    return nil
+}
 func (f *FilterOperatorFinder) VisitShowTablesOperator(ctx context.Context, operator *ShowTablesOperator) error {
     return nil
 }
+func (f *FilterOperatorFinder) VisitExplainOperator(ctx context.Context, operator *ExplainOperator) error {
+    return nil
+}
 
 func recordWithValues(values map[string]engine.Value) *engine.Record {
     r := engine.NewRecord()
@@ -145,7 +171,15 @@ func recordWithValues(values map[string]engine.Value) *engine.Record {
     return r
 }
 
-func plan(t testing.TB, metaSvc metastore.Service, indexSvc index.Service, query string) *QueryPlan {
+// batchOf lays out a record, or an empty record if it is nil, as a batch of one.
+func batchOf(record *engine.Record) *engine.Batch {
+    if record == nil {
+        record = engine.NewRecord()
+    }
+    return engine.NewBatches([]*engine.Record{record}, 1)[0]
+}
+
+func plan(t testing.TB, metaSvc metastore.Service, indexSvc index.Service, query string, options ...Option) *QueryPlan {
     tokens, err := parser.LexicalScan(query)
     require.NoError(t, err)
     root, err := parser.New(tokens).Parse()
@@ -156,7 +190,21 @@ func plan(t testing.TB, metaSvc metastore.Service, indexSvc index.Service, query
     require.NoError(t, err)
     physicalPlan, err := logical.OptimizeQueryPlan(logicalPlan)
     require.NoError(t, err)
-    finalPlan, err := NewQueryPlan(metaSvc, indexSvc, physicalPlan)
+    finalPlan, err := NewQueryPlan(metaSvc, indexSvc, physicalPlan, options...)
+    require.NoError(t, err)
+    return finalPlan
+}
+
+// unoptimizedPlan plans a query without optimizing it, so that constant predicates reach the
+// filter operator rather than being folded away.
+func unoptimizedPlan(t testing.TB, metaSvc metastore.Service, indexSvc index.Service, query string) *QueryPlan {
+    root, err := parser.ParseStatement(query)
+    require.NoError(t, err)
+    _, err = engine.ResolveSymbols(metaSvc, root)
+    require.NoError(t, err)
+    logicalPlan, err := logical.NewQueryPlan(root)
+    require.NoError(t, err)
+    finalPlan, err := NewQueryPlan(metaSvc, indexSvc, logicalPlan)
     require.NoError(t, err)
     return finalPlan
 }
@@ -166,5 +214,35 @@ func setup(tb testing.TB, testdata string) (func(tb testing.TB), metastore.Servi
     if err := ms.Open(); err != nil {
         tb.Fatal(err)
     }
-    return func(tb testing.TB) { /* no-op teardown */ }, ms, index.NewService(ms)
+    indexSvc := index.NewService(ms)
+    return func(tb testing.TB) { require.NoError(tb, indexSvc.Close()) }, ms, indexSvc
+}
+
+func TestLikeMatcher(t *testing.T) {
+    matcher := &likeMatcher{}
+    tests := []struct {
+        value   string
+        pattern string
+        match   bool
+    }{
+        {"apple pie", "apple%", true},
+        {"pumpkin pie", "apple%", false},
+        {"pumpkin pie", "%pie", true}, // the pattern changes between records
+        {"apple pie", "apple _ie", true},
+        {"apple pie", "apple _", false},
+        {"apple pie", "apple%", true},
+    }
+    for _, tt := range tests {
+        value, pattern := engine.NewStringValue(tt.value), engine.NewStringValue(tt.pattern)
+        v, err := matcher.like(&value, &pattern)
+        require.NoError(t, err)
+        require.Equal(t, engine.NewBooleanValue(tt.match), *v, "%s LIKE %s", tt.value, tt.pattern)
+    }
+
+    // the regular expression of an unchanged pattern is reused
+    re := matcher.re
+    value, pattern := engine.NewStringValue("apple tart"), engine.NewStringValue("apple%")
+    _, err := matcher.like(&value, &pattern)
+    require.NoError(t, err)
+    require.Same(t, re, matcher.re)
 }
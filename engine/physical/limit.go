@@ -3,30 +3,35 @@ package physical
 import (
     "context"
     "github.com/aleph-zero/flutterdb/engine"
+    "time"
 )
 
 type LimitOperator struct {
     child  OperatorNode
     limit  uint64
-    source <-chan *engine.Result
-    sink   chan *engine.Result
+    source <-chan *engine.Batch
+    sink   chan *engine.Batch
     Stats  LimitOperatorStats
+    *lifecycle
 }
 
 type LimitOperatorStats struct {
     Processed uint64
+    Bytes     uint64
+    Elapsed   time.Duration
 }
 
 func NewLimitOperator(child OperatorNode, limit uint64) *LimitOperator {
     return &LimitOperator{
-        limit:  limit,
-        child:  child,
-        source: child.Sink(),
-        sink:   make(chan *engine.Result),
+        limit:     limit,
+        child:     child,
+        source:    child.Sink(),
+        sink:      make(chan *engine.Batch),
+        lifecycle: newLifecycle(),
     }
 }
 
-func (operator *LimitOperator) Sink() <-chan *engine.Result {
+func (operator *LimitOperator) Sink() <-chan *engine.Batch {
     return operator.sink
 }
 
@@ -34,17 +39,34 @@ func (operator *LimitOperator) Accept(ctx context.Context, visitor OperatorNodeV
     return visitor.VisitLimitOperator(ctx, operator)
 }
 
+// Open starts emitting the records of the child until the limit is reached. The child is closed
+// as soon as the limit is satisfied, so that a scan below it stops reading the index.
 func (operator *LimitOperator) Open(ctx context.Context) error {
-    go func() {
+    start := time.Now()
+    operator.start(func() {
         defer close(operator.sink)
-        for result := range operator.source {
-            if operator.Stats.Processed >= operator.limit {
-                // TODO SIGNAL UP THE CHAIN TO TERMINATE
-                continue
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        defer operator.child.Close()
+        for operator.Stats.Processed < operator.limit {
+            batch, ok := operator.next(ctx, operator.source)
+            if !ok {
+                return
             }
-            operator.Stats.Processed++
-            operator.sink <- result
+            if remaining := operator.limit - operator.Stats.Processed; uint64(batch.Len()) > remaining {
+                batch = batch.Slice(0, int(remaining))
+            }
+            if !operator.emit(ctx, operator.sink, batch) {
+                return
+            }
+            operator.Stats.Processed += uint64(batch.Len())
+            operator.Stats.Bytes += uint64(batch.Bytes())
         }
-    }()
+    })
     return nil
 }
+
+func (operator *LimitOperator) Close() {
+    operator.halt()
+    operator.child.Close()
+    operator.wait()
+}
@@ -2,49 +2,128 @@ package physical
 
 import (
     "context"
+    "fmt"
     "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
     "github.com/aleph-zero/flutterdb/engine/logical"
     "github.com/aleph-zero/flutterdb/service/index"
     "github.com/aleph-zero/flutterdb/service/metastore"
     log "github.com/go-chi/httplog/v2"
+    "strings"
     "sync"
+    "sync/atomic"
+    "time"
 )
 
 type QueryPlan struct {
     RootOperator OperatorNode
+    Columns      []string
+    Statistics   *OperatorStatistics
 }
 
-func NewQueryPlan(metaSvc metastore.Service, indexSvc index.Service, plan *logical.QueryPlan) (*QueryPlan, error) {
-    visitor := &LogicalPlanVisitor{metaSvc: metaSvc, indexSvc: indexSvc}
+func NewQueryPlan(metaSvc metastore.Service, indexSvc index.Service, plan *logical.QueryPlan, options ...Option) (*QueryPlan, error) {
+    visitor := &LogicalPlanVisitor{metaSvc: metaSvc, indexSvc: indexSvc, config: NewConfig(options...)}
     if err := plan.ProjectNode.Accept(visitor); err != nil {
         return nil, err
     }
-    return &QueryPlan{RootOperator: visitor.operator}, nil
+    return &QueryPlan{RootOperator: visitor.operator, Columns: visitor.columns}, nil
 }
 
+/* *** Query Plan Config *** */
+
+// DefaultBatchSize is the number of records operators move between them at a time, unless the
+// plan is created with WithBatchSize.
+const DefaultBatchSize = 1024
+
+// DefaultParallelism is the number of goroutines a scan reads the hits of the search index on,
+// unless the plan is created with WithParallelism.
+const DefaultParallelism = 1
+
+type Config struct {
+    BatchSize   int
+    Parallelism int
+    Now         time.Time
+}
+
+type Option func(*Config)
+
+func NewConfig(options ...Option) *Config {
+    cfg := &Config{BatchSize: DefaultBatchSize, Parallelism: DefaultParallelism, Now: time.Now().UTC()}
+    for _, option := range options {
+        option(cfg)
+    }
+    return cfg
+}
+
+// WithBatchSize sets the most records a batch holds. With a batch size of 1, every batch holds a
+// single record.
+func WithBatchSize(size int) Option {
+    return func(config *Config) {
+        config.BatchSize = max(size, 1)
+    }
+}
+
+// WithParallelism sets the number of goroutines a scan reads the hits of the search index on. The
+// workers of a parallel scan each match the hits of their own range of documents, decode their
+// stored fields and evaluate the predicate of the filter above the scan, if there is one, before
+// the batches are merged in no particular order.
+func WithParallelism(workers int) Option {
+    return func(config *Config) {
+        config.Parallelism = max(workers, 1)
+    }
+}
+
+// WithNow sets the timestamp NOW() evaluates to. Every NOW() of a statement is the same instant,
+// the time the plan is created at unless the statement was timestamped earlier.
+func WithNow(now time.Time) Option {
+    return func(config *Config) {
+        config.Now = now.UTC()
+    }
+}
+
+// Execute runs the plan to completion and returns its results. The first error raised by an
+// operator, or the cancellation of the context, stops every operator of the plan and is returned
+// instead of the results.
 func (plan *QueryPlan) Execute(ctx context.Context) ([]*engine.Result, error) {
     log.LogEntry(ctx).Info("Executing query", "queryId", engine.QueryIdFromContext(ctx))
+    ctx, cancel := withFailure(ctx)
+    defer cancel(nil)
+
     results := make([]*engine.Result, 0)
     var wg sync.WaitGroup
 
-    wg.Go(func() {
-        for result := range plan.RootOperator.Sink() {
-            results = append(results, result)
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for batch := range plan.RootOperator.Sink() {
+            if batch.Error != nil {
+                fail(ctx, batch.Error)
+                continue
+            }
+            for row := 0; row < batch.Len(); row++ {
+                results = append(results, &engine.Result{Record: batch.Record(row), Bytes: batch.Sizes[row]})
+            }
         }
         log.LogEntry(ctx).Info("Query plan executor finished reading results", "queryId", engine.QueryIdFromContext(ctx))
-    })
+    }()
 
     opener := &OperatorNodeOpener{}
     if err := plan.RootOperator.Accept(ctx, opener); err != nil {
-        return nil, err
+        fail(ctx, err)
     }
 
     wg.Wait()
+    plan.RootOperator.Close() // wait for every operator to exit before reading their statistics
+    if err := context.Cause(ctx); err != nil {
+        log.LogEntry(ctx).Error("Query failed", "queryId", engine.QueryIdFromContext(ctx), "error", err)
+        return nil, err
+    }
 
     stats := &OperatorStatsCollector{}
     if err := plan.RootOperator.Accept(ctx, stats); err != nil {
         return nil, err
     }
+    plan.Statistics = stats.Statistics()
 
     return results, nil
 }
@@ -52,50 +131,305 @@ func (plan *QueryPlan) Execute(ctx context.Context) ([]*engine.Result, error) {
 type OperatorNodeVisitor interface {
     VisitFilterOperator(context.Context, *FilterOperator) error
     VisitLimitOperator(context.Context, *LimitOperator) error
+    VisitSortOperator(context.Context, *SortOperator) error
+    VisitTopNOperator(context.Context, *TopNOperator) error
+    VisitAggregateOperator(context.Context, *AggregateOperator) error
+    VisitIndexAggregateOperator(context.Context, *IndexAggregateOperator) error
     VisitProjectOperator(context.Context, *ProjectOperator) error
     VisitScanOperator(context.Context, *ScanOperator) error
+    VisitSystemScanOperator(context.Context, *SystemScanOperator) error
+    VisitValuesOperator(context.Context, *ValuesOperator) error
     VisitCreateOperator(context.Context, *CreateOperator) error
     VisitShowTablesOperator(context.Context, *ShowTablesOperator) error
+    VisitExplainOperator(context.Context, *ExplainOperator) error
 }
 
 /* *** operator stats collector *** */
 
-type OperatorStatsCollector struct{}
+// OperatorStatistics is the runtime profile of a single operator in an executed physical
+// plan. Records and Bytes count what the operator emitted to its parent, and Elapsed is the
+// wall time between the operator being opened and its sink being closed. Skipped counts the bytes
+// of stored fields a scan left undecoded because the plan does not read them.
+type OperatorStatistics struct {
+    Operator string                `json:"operator"`
+    Detail   string                `json:"detail,omitempty"`
+    Records  uint64                `json:"rows"`
+    Bytes    uint64                `json:"bytes"`
+    Skipped  uint64                `json:"bytes_skipped,omitempty"`
+    Elapsed  time.Duration         `json:"elapsed"`
+    Children []*OperatorStatistics `json:"children,omitempty"`
+}
 
-func (osc *OperatorStatsCollector) VisitFilterOperator(ctx context.Context, operator *FilterOperator) error {
+// ScannedBytes returns the number of bytes the scans of the plan read from the search index.
+func (s *OperatorStatistics) ScannedBytes() uint64 {
+    if s == nil {
+        return 0
+    }
+    var bytes uint64
+    if s.Operator == "Scan" {
+        bytes = s.Bytes
+    }
+    for _, child := range s.Children {
+        bytes += child.ScannedBytes()
+    }
+    return bytes
+}
+
+// OperatorStatsCollector walks a physical plan and assembles the statistics of every
+// operator into a tree that mirrors the shape of the plan.
+type OperatorStatsCollector struct {
+    root   *OperatorStatistics
+    parent *OperatorStatistics
+}
+
+func (osc *OperatorStatsCollector) Statistics() *OperatorStatistics {
+    return osc.root
+}
+
+func (osc *OperatorStatsCollector) add(ctx context.Context, stats *OperatorStatistics, child OperatorNode) error {
+    if osc.parent == nil {
+        osc.root = stats
+    } else {
+        osc.parent.Children = append(osc.parent.Children, stats)
+    }
+    if child == nil {
+        return nil
+    }
+
+    parent := osc.parent
+    osc.parent = stats
+    defer func() { osc.parent = parent }()
+    return child.Accept(ctx, osc)
+}
 
-    panic("implement me")
+func (osc *OperatorStatsCollector) VisitFilterOperator(ctx context.Context, operator *FilterOperator) error {
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Filter",
+        Detail:   operator.predicate.String(),
+        Records:  operator.Stats.Records,
+        Bytes:    operator.Stats.Bytes,
+        Elapsed:  operator.Stats.Elapsed,
+    }, operator.child)
 }
 
 func (osc *OperatorStatsCollector) VisitLimitOperator(ctx context.Context, operator *LimitOperator) error {
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Limit",
+        Detail:   fmt.Sprintf("%d", operator.limit),
+        Records:  operator.Stats.Processed,
+        Bytes:    operator.Stats.Bytes,
+        Elapsed:  operator.Stats.Elapsed,
+    }, operator.child)
+}
+
+func (osc *OperatorStatsCollector) VisitSortOperator(ctx context.Context, operator *SortOperator) error {
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Sort",
+        Detail:   describeOrdering(operator.terms),
+        Records:  operator.Stats.Records,
+        Bytes:    operator.Stats.Bytes,
+        Elapsed:  operator.Stats.Elapsed,
+    }, operator.child)
+}
+
+func (osc *OperatorStatsCollector) VisitTopNOperator(ctx context.Context, operator *TopNOperator) error {
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "TopN",
+        Detail:   fmt.Sprintf("%d %s", operator.limit, describeOrdering(operator.terms)),
+        Records:  operator.Stats.Records,
+        Bytes:    operator.Stats.Bytes,
+        Elapsed:  operator.Stats.Elapsed,
+    }, operator.child)
+}
 
-    panic("implement me")
+func (osc *OperatorStatsCollector) VisitAggregateOperator(ctx context.Context, operator *AggregateOperator) error {
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Aggregate",
+        Detail:   describeAggregates(operator.names),
+        Records:  operator.Stats.Records,
+        Elapsed:  operator.Stats.Elapsed,
+    }, operator.child)
+}
+
+func (osc *OperatorStatsCollector) VisitIndexAggregateOperator(ctx context.Context, operator *IndexAggregateOperator) error {
+    detail := fmt.Sprintf("%s query: %s", operator.table.TableName, describeSearchQuery(operator.query))
+    if operator.predicate != nil {
+        detail = fmt.Sprintf("%s pushed: %s", detail, operator.predicate.String())
+    }
+    detail = fmt.Sprintf("%s aggregates: %s matches: %d", detail, describeAggregates(operator.names), operator.Stats.Matches)
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "IndexAggregate",
+        Detail:   detail,
+        Records:  operator.Stats.Records,
+        Elapsed:  operator.Stats.Elapsed,
+    }, nil)
 }
 
 func (osc *OperatorStatsCollector) VisitProjectOperator(ctx context.Context, operator *ProjectOperator) error {
-    // TODO implement me
-    panic("implement me")
+    projections := make([]string, len(operator.projections))
+    for i, projection := range operator.projections {
+        projections[i] = projection.String()
+    }
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Project",
+        Detail:   strings.Join(projections, ", "),
+        Records:  operator.Stats.Records,
+        Bytes:    operator.Stats.Bytes,
+        Elapsed:  operator.Stats.Elapsed,
+    }, operator.child)
 }
 
 func (osc *OperatorStatsCollector) VisitScanOperator(ctx context.Context, operator *ScanOperator) error {
-    // TODO implement me
-    panic("implement me")
+    detail := fmt.Sprintf("%s query: %s", operator.table.TableName, describeQuery(operator.request))
+    if operator.predicate != nil {
+        detail = fmt.Sprintf("%s pushed: %s", detail, operator.predicate.String())
+    }
+    if operator.columns != nil {
+        detail = fmt.Sprintf("%s columns: [%s]", detail, strings.Join(operator.columns, ", "))
+    }
+    if operator.residual != nil {
+        detail = fmt.Sprintf("%s filter: %s", detail, operator.residual.String())
+    }
+    if operator.order != nil {
+        detail = fmt.Sprintf("%s top: %d %s", detail, operator.limit, describeOrdering(operator.order))
+    }
+    if operator.aggregates != nil {
+        detail = fmt.Sprintf("%s partial: %s", detail, describeAggregates(operator.names))
+    }
+    if operator.Workers() > 1 {
+        detail = fmt.Sprintf("%s workers: %d", detail, operator.Workers())
+    }
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Scan",
+        Detail:   detail,
+        Records:  operator.Stats.Records,
+        Bytes:    operator.Stats.Bytes,
+        Skipped:  operator.Stats.Skipped,
+        Elapsed:  operator.Stats.Elapsed,
+    }, nil)
+}
+
+func (osc *OperatorStatsCollector) VisitSystemScanOperator(ctx context.Context, operator *SystemScanOperator) error {
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "SystemScan",
+        Detail:   operator.table.Metadata().TableName,
+        Records:  operator.Stats.Records,
+        Elapsed:  operator.Stats.Elapsed,
+    }, nil)
+}
+
+func (osc *OperatorStatsCollector) VisitValuesOperator(ctx context.Context, operator *ValuesOperator) error {
+    detail := ""
+    if operator.empty {
+        detail = "empty"
+    }
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Values",
+        Detail:   detail,
+        Records:  operator.Stats.Records,
+        Elapsed:  operator.Stats.Elapsed,
+    }, nil)
 }
 
 func (osc *OperatorStatsCollector) VisitCreateOperator(ctx context.Context, operator *CreateOperator) error {
-    // TODO implement me
-    panic("implement me")
+    return osc.add(ctx, &OperatorStatistics{Operator: "Create", Detail: operator.Name}, nil)
 }
 
 func (osc *OperatorStatsCollector) VisitShowTablesOperator(ctx context.Context, operator *ShowTablesOperator) error {
-    // TODO implement me
-    panic("implement me")
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "ShowTables",
+        Records:  operator.Stats.Records,
+        Elapsed:  operator.Stats.Elapsed,
+    }, nil)
 }
 
+func (osc *OperatorStatsCollector) VisitExplainOperator(ctx context.Context, operator *ExplainOperator) error {
+    return osc.add(ctx, &OperatorStatistics{
+        Operator: "Explain",
+        Records:  operator.Stats.Records,
+        Elapsed:  operator.Stats.Elapsed,
+    }, nil)
+}
+
+// OperatorNode is an operator of a physical plan. Open starts the operator, which then emits its
+// records on Sink in batches until they are exhausted. Every batch an operator emits carries the
+// same schema. Close stops the operator and its children before
+// they are exhausted and waits for their goroutines to exit; it is safe to call more than once.
 type OperatorNode interface {
     Accept(context.Context, OperatorNodeVisitor) error
-    Sink() <-chan *engine.Result
+    Sink() <-chan *engine.Batch
     Open(ctx context.Context) error
+    Close()
+}
+
+// lifecycle tracks the goroutine an operator starts when it is opened. Every operator stops
+// when it is closed or the context of the query is cancelled, whichever comes first.
+type lifecycle struct {
+    done     chan struct{}
+    finished chan struct{}
+    stop     sync.Once
+    opened   atomic.Bool
+}
+
+func newLifecycle() *lifecycle {
+    return &lifecycle{
+        done:     make(chan struct{}),
+        finished: make(chan struct{}),
+    }
+}
+
+// start runs fn on the goroutine of the operator.
+func (lc *lifecycle) start(fn func()) {
+    lc.opened.Store(true)
+    go func() {
+        defer close(lc.finished)
+        fn()
+    }()
+}
+
+// halt signals the goroutine of the operator to stop without waiting for it.
+func (lc *lifecycle) halt() {
+    lc.stop.Do(func() { close(lc.done) })
+}
+
+// wait blocks until the goroutine of the operator has exited, if the operator was opened.
+func (lc *lifecycle) wait() {
+    if lc.opened.Load() {
+        <-lc.finished
+    }
+}
+
+// next receives the next batch from the child of the operator. It reports false once the child
+// is exhausted, the operator has been closed or the query has been cancelled.
+func (lc *lifecycle) next(ctx context.Context, source <-chan *engine.Batch) (*engine.Batch, bool) {
+    select {
+    case batch, ok := <-source:
+        return batch, ok
+    case <-lc.done:
+        return nil, false
+    case <-ctx.Done():
+        return nil, false
+    }
+}
+
+// emit sends a batch to the parent of the operator. It reports false if the operator has been
+// closed or the query has been cancelled, in which case the operator should stop.
+func (lc *lifecycle) emit(ctx context.Context, sink chan<- *engine.Batch, batch *engine.Batch) bool {
+    select {
+    case <-lc.done:
+        return false
+    case <-ctx.Done():
+        return false
+    default:
+    }
+    select {
+    case sink <- batch:
+        return true
+    case <-lc.done:
+        return false
+    case <-ctx.Done():
+        return false
+    }
 }
 
 /* *** physical plan opener *** */
@@ -116,6 +450,31 @@ func (op *OperatorNodeOpener) VisitLimitOperator(ctx context.Context, operator *
     return operator.child.Accept(ctx, op)
 }
 
+func (op *OperatorNodeOpener) VisitSortOperator(ctx context.Context, operator *SortOperator) error {
+    if err := operator.Open(ctx); err != nil {
+        return err
+    }
+    return operator.child.Accept(ctx, op)
+}
+
+func (op *OperatorNodeOpener) VisitTopNOperator(ctx context.Context, operator *TopNOperator) error {
+    if err := operator.Open(ctx); err != nil {
+        return err
+    }
+    return operator.child.Accept(ctx, op)
+}
+
+func (op *OperatorNodeOpener) VisitAggregateOperator(ctx context.Context, operator *AggregateOperator) error {
+    if err := operator.Open(ctx); err != nil {
+        return err
+    }
+    return operator.child.Accept(ctx, op)
+}
+
+func (op *OperatorNodeOpener) VisitIndexAggregateOperator(ctx context.Context, operator *IndexAggregateOperator) error {
+    return operator.Open(ctx)
+}
+
 func (op *OperatorNodeOpener) VisitFilterOperator(ctx context.Context, operator *FilterOperator) error {
     if err := operator.Open(ctx); err != nil {
         return err
@@ -127,6 +486,14 @@ func (op *OperatorNodeOpener) VisitScanOperator(ctx context.Context, operator *S
     return operator.Open(ctx)
 }
 
+func (op *OperatorNodeOpener) VisitSystemScanOperator(ctx context.Context, operator *SystemScanOperator) error {
+    return operator.Open(ctx)
+}
+
+func (op *OperatorNodeOpener) VisitValuesOperator(ctx context.Context, operator *ValuesOperator) error {
+    return operator.Open(ctx)
+}
+
 func (op *OperatorNodeOpener) VisitShowTablesOperator(ctx context.Context, operator *ShowTablesOperator) error {
     if err := operator.Open(ctx); err != nil {
         return err
@@ -135,17 +502,21 @@ func (op *OperatorNodeOpener) VisitShowTablesOperator(ctx context.Context, opera
 }
 
 func (op *OperatorNodeOpener) VisitCreateOperator(ctx context.Context, operator *CreateOperator) error {
-    panic("implement me")
+    return operator.Open(ctx)
 }
 
-/* *** operator stats collector *** */
+func (op *OperatorNodeOpener) VisitExplainOperator(ctx context.Context, operator *ExplainOperator) error {
+    return operator.Open(ctx)
+}
 
 /* *** logical plan visitor *** */
 
 type LogicalPlanVisitor struct {
     metaSvc  metastore.Service
     indexSvc index.Service
+    config   *Config
     operator OperatorNode
+    columns  []string
 }
 
 func (lpv *LogicalPlanVisitor) VisitTableNode(node *logical.TableNode) error {
@@ -154,7 +525,7 @@ func (lpv *LogicalPlanVisitor) VisitTableNode(node *logical.TableNode) error {
 }
 
 func (lpv *LogicalPlanVisitor) VisitTablesNode(node *logical.TablesNode) error {
-    lpv.operator = NewShowTablesOperator(lpv.metaSvc)
+    lpv.operator = NewShowTablesOperator(lpv.metaSvc, lpv.config.BatchSize)
     return nil
 }
 
@@ -163,11 +534,21 @@ func (lpv *LogicalPlanVisitor) VisitProjectNode(node *logical.ProjectNode) error
         return err
     }
 
-    columns := make([]string, len(node.Projections()))
-    for i, projection := range node.Projections() {
-        columns[i] = projection.String()
+    project := NewProjectOperator(lpv.operator, node.Projections(), node.Names(), lpv.config.Now)
+    lpv.operator = project
+    if len(project.columns) > 0 {
+        lpv.columns = project.columns
+    }
+    return nil
+}
+
+func (lpv *LogicalPlanVisitor) VisitExplainNode(node *logical.ExplainNode) error {
+    plan, err := NewQueryPlan(lpv.metaSvc, lpv.indexSvc, node.Plan, WithBatchSize(lpv.config.BatchSize), WithParallelism(lpv.config.Parallelism), WithNow(lpv.config.Now))
+    if err != nil {
+        return err
     }
-    lpv.operator = NewProjectOperator(lpv.operator, columns)
+    lpv.operator = NewExplainOperator(node, plan, lpv.config.BatchSize)
+    lpv.columns = lpv.operator.(*ExplainOperator).Columns()
     return nil
 }
 
@@ -179,21 +560,91 @@ func (lpv *LogicalPlanVisitor) VisitLimitNode(node *logical.LimitNode) error {
     return nil
 }
 
+func (lpv *LogicalPlanVisitor) VisitSortNode(node *logical.SortNode) error {
+    if err := node.Child().Accept(lpv); err != nil {
+        return err
+    }
+    lpv.operator = NewSortOperator(lpv.operator, node.Terms, lpv.config.BatchSize, lpv.config.Now)
+    return nil
+}
+
+// VisitTopNNode has the search index order the hits of a scan directly below the top-N if it can,
+// and otherwise keeps the first records in a top-N operator.
+func (lpv *LogicalPlanVisitor) VisitTopNNode(node *logical.TopNNode) error {
+    if err := node.Child().Accept(lpv); err != nil {
+        return err
+    }
+    if scan, ok := lpv.operator.(*ScanOperator); ok && scan.TopN(node.Terms, int(node.Limit.Value)) {
+        return nil
+    }
+    lpv.operator = NewTopNOperator(lpv.operator, node.Terms, uint64(node.Limit.Value), lpv.config.BatchSize, lpv.config.Now)
+    return nil
+}
+
+// VisitAggregateNode has the search index answer the aggregates of a scan directly below it if it
+// can, and otherwise computes them over the records of its child. The workers of a parallel scan
+// compute partial aggregates, which are merged above the scan.
+func (lpv *LogicalPlanVisitor) VisitAggregateNode(node *logical.AggregateNode) error {
+    if err := node.Child().Accept(lpv); err != nil {
+        return err
+    }
+    if scan, ok := lpv.operator.(*ScanOperator); ok {
+        if operator, ok := NewIndexAggregateOperator(scan, node.Aggregates, node.Names); ok {
+            lpv.operator = operator
+            return nil
+        }
+    }
+    aggregate := NewAggregateOperator(lpv.operator, node.Aggregates, node.Names, lpv.config.Now)
+    if scan, ok := lpv.operator.(*ScanOperator); ok && scan.Workers() > 1 {
+        aggregate.merge(scan, lpv.config.Now)
+    }
+    lpv.operator = aggregate
+    return nil
+}
+
 func (lpv *LogicalPlanVisitor) VisitSelectNode(node *logical.SelectNode) error {
     if err := node.Child().Accept(lpv); err != nil {
         return err
     }
-    if node.Predicate != nil {
-        lpv.operator = NewFilterOperator(lpv.operator, node.Predicate)
+    if node.Predicate == nil {
+        return nil
+    }
+    if scan, ok := lpv.operator.(*ScanOperator); ok && scan.Workers() > 1 {
+        scan.Filter(node.Predicate, lpv.config.Now)
+        return nil
     }
+    lpv.operator = NewFilterOperator(lpv.operator, node.Predicate, lpv.config.Now)
+    return nil
+}
+
+func (lpv *LogicalPlanVisitor) VisitValuesNode(node *logical.ValuesNode) error {
+    lpv.operator = NewValuesOperator(node.Empty)
     return nil
 }
 
 func (lpv *LogicalPlanVisitor) VisitRelationNode(node *logical.RelationNode) error {
+    if provider, ok := lpv.metaSvc.(engine.SystemTableProvider); ok {
+        if table, ok := provider.SystemTable(node.Relation.ResolvedTableSymbol.TableName); ok {
+            if ast.ContainsSearchPredicate(node.PushedPredicate) || len(node.Highlights) > 0 {
+                return fmt.Errorf("system table '%s' does not support search predicates", table.Metadata().TableName)
+            }
+            // system tables have no search index, so predicates pushed down are evaluated row by row
+            lpv.operator = NewSystemScanOperator(table, lpv.config.BatchSize)
+            if node.PushedPredicate != nil {
+                lpv.operator = NewFilterOperator(lpv.operator, node.PushedPredicate, lpv.config.Now)
+            }
+            return nil
+        }
+    }
+
     tmd, err := lpv.metaSvc.GetTable(node.Relation.ResolvedTableSymbol.TableName)
     if err != nil {
         return err
     }
-    lpv.operator = NewScanOperator(lpv.indexSvc, tmd)
+    scan, err := NewScanOperator(lpv.indexSvc, tmd, node.PushedPredicate, node.Highlights, node.Columns, lpv.config.BatchSize, lpv.config.Parallelism)
+    if err != nil {
+        return err
+    }
+    lpv.operator = scan
     return nil
 }
@@ -2,26 +2,50 @@ package physical
 
 import (
     "context"
+    "fmt"
     "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "time"
 )
 
 type ProjectOperator struct {
-    child   OperatorNode
-    columns []string
-    source  <-chan *engine.Result
-    sink    chan *engine.Result
+    child       OperatorNode
+    columns     []string
+    schema      *engine.Schema
+    projections []ast.ExpressionNode
+    expressions []Expression
+    source      <-chan *engine.Batch
+    sink        chan *engine.Batch
+    Stats       ProjectOperatorStats
+    *lifecycle
 }
 
-func NewProjectOperator(child OperatorNode, columns []string) *ProjectOperator {
+type ProjectOperatorStats struct {
+    Records uint64
+    Bytes   uint64
+    Elapsed time.Duration
+}
+
+func NewProjectOperator(child OperatorNode, projections []ast.ExpressionNode, columns []string, now time.Time) *ProjectOperator {
+    expressions := make([]Expression, len(projections))
+    for i, projection := range projections {
+        if _, ok := projection.(*ast.ColumnIdentifierNode); !ok {
+            expressions[i] = Compile(projection, now)
+        }
+    }
     return &ProjectOperator{
-        child:   child,
-        columns: columns,
-        source:  child.Sink(),
-        sink:    make(chan *engine.Result),
+        child:       child,
+        columns:     columns,
+        schema:      engine.NewSchema(columns),
+        projections: projections,
+        expressions: expressions,
+        source:      child.Sink(),
+        sink:        make(chan *engine.Batch),
+        lifecycle:   newLifecycle(),
     }
 }
 
-func (operator *ProjectOperator) Sink() <-chan *engine.Result {
+func (operator *ProjectOperator) Sink() <-chan *engine.Batch {
     return operator.sink
 }
 
@@ -30,25 +54,76 @@ func (operator *ProjectOperator) Accept(ctx context.Context, visitor OperatorNod
 }
 
 func (operator *ProjectOperator) Open(ctx context.Context) error {
-    go func() {
+    start := time.Now()
+    operator.start(func() {
         defer close(operator.sink)
-        for result := range operator.source {
-            for k, _ := range result.Record.Values {
-                if operator.columns != nil && len(operator.columns) > 0 && !exists(k, operator.columns) {
-                    delete(result.Record.Values, k)
-                }
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        for {
+            batch, ok := operator.next(ctx, operator.source)
+            if !ok {
+                return
+            }
+            projected, err := operator.project(batch)
+            if err != nil {
+                fail(ctx, err)
+                return
             }
-            operator.sink <- result
+            if !operator.emit(ctx, operator.sink, projected) {
+                return
+            }
+            operator.Stats.Records += uint64(projected.Len())
+            operator.Stats.Bytes += uint64(projected.Bytes())
         }
-    }()
+    })
     return nil
 }
 
-func exists(key string, values []string) bool {
-    for _, value := range values {
-        if value == key {
-            return true
+func (operator *ProjectOperator) Close() {
+    operator.halt()
+    operator.child.Close()
+    operator.wait()
+}
+
+// project lays out a batch by the schema of the projections. Plain columns share their vector
+// with the batch, and the other projections are compiled expressions evaluated against every
+// record, unless the batch already holds a column of the same name, such as the highlighted
+// fragments produced by the scan. A plan without projections passes its batches through unchanged.
+func (operator *ProjectOperator) project(batch *engine.Batch) (*engine.Batch, error) {
+    if len(operator.columns) == 0 {
+        return batch, nil
+    }
+
+    projected := &engine.Batch{
+        Schema:  operator.schema,
+        Vectors: make([][]engine.Value, len(operator.projections)),
+        Sizes:   batch.Sizes,
+    }
+    for i, projection := range operator.projections {
+        name := operator.columns[i]
+        if column, ok := projection.(*ast.ColumnIdentifierNode); ok {
+            name = column.Value
+        }
+        if j, ok := batch.Schema.Index(name); ok {
+            projected.Vectors[i] = batch.Vectors[j]
+            continue
+        }
+        if _, ok := projection.(*ast.ColumnIdentifierNode); ok {
+            projected.Vectors[i] = make([]engine.Value, batch.Len()) // no record has a value for the column
+            continue
+        }
+
+        vector := make([]engine.Value, batch.Len())
+        for row := range vector {
+            value, err := operator.expressions[i](batch, row)
+            if missing(err) {
+                continue // the projection is empty for a record without a value it reads
+            }
+            if err != nil {
+                return nil, Error{ErrorCode: EvaluationError, Operator: "Project", Message: fmt.Sprintf("evaluating %s", projection.String()), Err: err}
+            }
+            vector[row] = value
         }
+        projected.Vectors[i] = vector
     }
-    return false
+    return projected, nil
 }
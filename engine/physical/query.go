@@ -0,0 +1,447 @@
+package physical
+
+import (
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "github.com/aleph-zero/flutterdb/service/metastore"
+    "github.com/blugelabs/bluge"
+    "github.com/blugelabs/bluge/analysis/analyzer"
+    "github.com/blugelabs/bluge/numeric/geo"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// NewSearchQuery compiles a predicate pushed into a relation into a query answered by the
+// search index. A nil predicate matches every document in the table.
+func NewSearchQuery(table *metastore.TableMetadata, predicate ast.ExpressionNode) (bluge.Query, error) {
+    if predicate == nil {
+        return bluge.NewMatchAllQuery(), nil
+    }
+    return compileQuery(table, predicate)
+}
+
+func compileQuery(table *metastore.TableMetadata, node ast.ExpressionNode) (bluge.Query, error) {
+    switch v := node.(type) {
+    case *ast.ParenthesizedExpressionNode:
+        return compileQuery(table, v.Node)
+    case *ast.LogicalNegationNode:
+        return compileNegation(table, v.Node)
+    case *ast.BinaryExpressionNode:
+        if ast.IsGeoDistancePredicate(v) {
+            return compileGeoDistance(table, v)
+        }
+        if ast.IsDateRangePredicate(v) {
+            return compileDateRange(v)
+        }
+        if ast.IsTermRangePredicate(v) {
+            return compileTermRange(v)
+        }
+        left, err := compileQuery(table, v.Left)
+        if err != nil {
+            return nil, err
+        }
+        right, err := compileQuery(table, v.Right)
+        if err != nil {
+            return nil, err
+        }
+        switch v.Op.TokenType {
+        case token.AND:
+            return bluge.NewBooleanQuery().AddMust(left, right), nil
+        case token.OR:
+            return bluge.NewBooleanQuery().AddShould(left, right), nil
+        default:
+            return nil, fmt.Errorf("cannot push down operator '%s'", v.Op.TokenType)
+        }
+    case *ast.FunctionCallNode:
+        return compileFunction(table, v)
+    default:
+        return nil, fmt.Errorf("cannot push down expression '%s'", node.String())
+    }
+}
+
+// compileNegation compiles NOT over a predicate into a query for the documents the predicate is
+// false for. A comparison against a column that a document has no value for is neither true nor
+// false, so the document matches neither the comparison nor its negation. NOT is moved through AND
+// and OR down to the comparisons, where it is answered as the documents that have a value for the
+// column but do not match the comparison. Full-text predicates are false for a document without a
+// value, so their negation matches it.
+func compileNegation(table *metastore.TableMetadata, node ast.ExpressionNode) (bluge.Query, error) {
+    switch v := node.(type) {
+    case *ast.ParenthesizedExpressionNode:
+        return compileNegation(table, v.Node)
+    case *ast.LogicalNegationNode:
+        return compileQuery(table, v.Node)
+    case *ast.BinaryExpressionNode:
+        if v.Op.TokenType == token.AND || v.Op.TokenType == token.OR {
+            left, err := compileNegation(table, v.Left)
+            if err != nil {
+                return nil, err
+            }
+            right, err := compileNegation(table, v.Right)
+            if err != nil {
+                return nil, err
+            }
+            if v.Op.TokenType == token.AND {
+                return bluge.NewBooleanQuery().AddShould(left, right), nil
+            }
+            return bluge.NewBooleanQuery().AddMust(left, right), nil
+        }
+    }
+
+    query, err := compileQuery(table, node)
+    if err != nil {
+        return nil, err
+    }
+    negation := bluge.NewBooleanQuery().AddMustNot(query)
+    if field, columnType, ok := comparedColumn(table, node); ok {
+        return negation.AddMust(existsQuery(field, columnType)), nil
+    }
+    return negation.AddMust(bluge.NewMatchAllQuery()), nil
+}
+
+// comparedColumn returns the column of a predicate that is neither true nor false for a document
+// without a value for the column.
+func comparedColumn(table *metastore.TableMetadata, node ast.ExpressionNode) (string, types.Type, bool) {
+    var column *ast.ColumnIdentifierNode
+    switch v := node.(type) {
+    case *ast.BinaryExpressionNode:
+        if ast.IsGeoDistancePredicate(v) {
+            column, _ = v.Left.(*ast.FunctionCallNode).Arguments[0].(*ast.ColumnIdentifierNode)
+        } else if c, _, _, ok := ast.DateRange(v); ok {
+            column = c
+        } else if c, _, _, ok := ast.TermRange(v); ok {
+            column = c
+        }
+    case *ast.FunctionCallNode:
+        if v.Name == ast.FunctionGeoWithinBox {
+            column, _ = v.Arguments[0].(*ast.ColumnIdentifierNode)
+        }
+    }
+    if column == nil {
+        return "", 0, false
+    }
+    cmd, ok := table.Columns[column.Value]
+    if !ok {
+        return "", 0, false
+    }
+    return column.Value, cmd.ColumnType, true
+}
+
+// existsQuery returns a query for the documents that have a value for a KEYWORD, numeric,
+// DATETIME or GEOPOINT column.
+func existsQuery(field string, columnType types.Type) bluge.Query {
+    switch columnType {
+    case types.GEOPOINT:
+        return bluge.NewGeoBoundingBoxQuery(-180, 90, 180, -90).SetField(field)
+    case types.INTEGER, types.FLOAT, types.DATETIME:
+        return bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, bluge.MaxNumeric, true, true).SetField(field)
+    default:
+        return bluge.NewWildcardQuery("*").SetField(field)
+    }
+}
+
+func compileFunction(table *metastore.TableMetadata, node *ast.FunctionCallNode) (bluge.Query, error) {
+    switch node.Name {
+    case ast.FunctionMatch, ast.FunctionMatchPhrase, ast.FunctionMatchQuery:
+        return compileMatch(table, node)
+    case ast.FunctionGeoWithinBox:
+        return compileGeoWithinBox(table, node)
+    default:
+        return nil, fmt.Errorf("cannot push down function '%s'", node.Name)
+    }
+}
+
+func compileMatch(table *metastore.TableMetadata, node *ast.FunctionCallNode) (bluge.Query, error) {
+    if len(node.Arguments) != 2 {
+        return nil, fmt.Errorf("function '%s' expects 2 arguments, received %d", node.Name, len(node.Arguments))
+    }
+    column, ok := node.Arguments[0].(*ast.ColumnIdentifierNode)
+    if !ok {
+        return nil, fmt.Errorf("first argument of '%s' must be a column, received '%s'", node.Name, node.Arguments[0].String())
+    }
+    text, ok := node.Arguments[1].(*ast.StringLiteralNode)
+    if !ok {
+        return nil, fmt.Errorf("second argument of '%s' must be a string, received '%s'", node.Name, node.Arguments[1].String())
+    }
+
+    cmd, ok := table.Columns[column.Value]
+    if !ok {
+        return nil, fmt.Errorf("column '%s' does not exist in table '%s'", column.Value, table.TableName)
+    }
+    if cmd.ColumnType != types.TEXT && cmd.ColumnType != types.KEYWORD {
+        return nil, fmt.Errorf("function '%s' requires a TEXT or KEYWORD column, '%s' is %s", node.Name, column.Value, cmd.ColumnType)
+    }
+    keyword := cmd.ColumnType == types.KEYWORD
+
+    switch node.Name {
+    case ast.FunctionMatch:
+        return newMatchQuery(column.Value, text.Value, keyword), nil
+    case ast.FunctionMatchPhrase:
+        return newMatchPhraseQuery(column.Value, text.Value, keyword), nil
+    default:
+        return parseQueryString(column.Value, text.Value, keyword)
+    }
+}
+
+// compileGeoDistance compiles a comparison of GEO_DISTANCE against a distance into a geo
+// distance query. The distance is either a number of meters or a string with a unit, such as
+// '10km' or '5mi'. Bluge distance queries are inclusive, so '<' and '<=' are equivalent. '>' and
+// '>=' match the documents that have a geopoint outside the distance.
+func compileGeoDistance(table *metastore.TableMetadata, node *ast.BinaryExpressionNode) (bluge.Query, error) {
+    fn := node.Left.(*ast.FunctionCallNode)
+    field, err := geoColumn(table, fn)
+    if err != nil {
+        return nil, err
+    }
+    lat, err := coordinate(fn, fn.Arguments[1], 90)
+    if err != nil {
+        return nil, err
+    }
+    lon, err := coordinate(fn, fn.Arguments[2], 180)
+    if err != nil {
+        return nil, err
+    }
+
+    var distance string
+    switch v := node.Right.(type) {
+    case *ast.StringLiteralNode:
+        if _, err := geo.ParseDistance(v.Value); err != nil {
+            return nil, fmt.Errorf("invalid distance '%s': %w", v.Value, err)
+        }
+        distance = v.Value
+    default:
+        meters, ok := numericLiteral(v)
+        if !ok {
+            return nil, fmt.Errorf("invalid distance '%s'", v.String())
+        }
+        distance = strconv.FormatFloat(meters, 'f', -1, 64) + "m"
+    }
+
+    query := bluge.NewGeoDistanceQuery(lon, lat, distance).SetField(field)
+    switch node.Op.TokenType {
+    case token.GT, token.GTE:
+        return bluge.NewBooleanQuery().AddMust(existsQuery(field, types.GEOPOINT)).AddMustNot(query), nil
+    default:
+        return query, nil
+    }
+}
+
+// compileDateRange compiles a comparison of a DATETIME column against a timestamp into a date
+// range query. Bluge treats a zero time as an open endpoint.
+func compileDateRange(node *ast.BinaryExpressionNode) (bluge.Query, error) {
+    column, op, ts, _ := ast.DateRange(node)
+    var query *bluge.DateRangeQuery
+    switch op {
+    case token.EQUAL:
+        query = bluge.NewDateRangeInclusiveQuery(ts.Value, ts.Value, true, true)
+    case token.GT:
+        query = bluge.NewDateRangeInclusiveQuery(ts.Value, time.Time{}, false, false)
+    case token.GTE:
+        query = bluge.NewDateRangeInclusiveQuery(ts.Value, time.Time{}, true, false)
+    case token.LT:
+        query = bluge.NewDateRangeInclusiveQuery(time.Time{}, ts.Value, false, false)
+    case token.LTE:
+        query = bluge.NewDateRangeInclusiveQuery(time.Time{}, ts.Value, false, true)
+    default:
+        return nil, fmt.Errorf("cannot push down operator '%s'", op)
+    }
+    return query.SetField(column.Value), nil
+}
+
+// compileTermRange compiles a comparison of a KEYWORD column against a string into a term or
+// term range query, and of a numeric column against a number into a numeric range query.
+func compileTermRange(node *ast.BinaryExpressionNode) (bluge.Query, error) {
+    column, op, value, _ := ast.TermRange(node)
+    if _, ok := value.(*ast.PlaceholderNode); ok {
+        return nil, fmt.Errorf("parameter '%s' is not bound", value.String())
+    }
+    if s, ok := value.(*ast.StringLiteralNode); ok {
+        var query *bluge.TermRangeQuery
+        switch op {
+        case token.EQUAL:
+            return bluge.NewTermQuery(s.Value).SetField(column.Value), nil
+        case token.GT:
+            query = bluge.NewTermRangeInclusiveQuery(s.Value, "", false, false)
+        case token.GTE:
+            query = bluge.NewTermRangeInclusiveQuery(s.Value, "", true, false)
+        case token.LT:
+            query = bluge.NewTermRangeInclusiveQuery("", s.Value, false, false)
+        case token.LTE:
+            query = bluge.NewTermRangeInclusiveQuery("", s.Value, false, true)
+        default:
+            return nil, fmt.Errorf("cannot push down operator '%s'", op)
+        }
+        return query.SetField(column.Value), nil
+    }
+
+    n, _ := numericLiteral(value)
+    var query *bluge.NumericRangeQuery
+    switch op {
+    case token.EQUAL:
+        query = bluge.NewNumericRangeInclusiveQuery(n, n, true, true)
+    case token.GT:
+        query = bluge.NewNumericRangeInclusiveQuery(n, bluge.MaxNumeric, false, false)
+    case token.GTE:
+        query = bluge.NewNumericRangeInclusiveQuery(n, bluge.MaxNumeric, true, false)
+    case token.LT:
+        query = bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, n, false, false)
+    case token.LTE:
+        query = bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, n, false, true)
+    default:
+        return nil, fmt.Errorf("cannot push down operator '%s'", op)
+    }
+    return query.SetField(column.Value), nil
+}
+
+// compileGeoWithinBox compiles GEO_WITHIN_BOX(column, top_left_lat, top_left_lon,
+// bottom_right_lat, bottom_right_lon) into a geo bounding box query.
+func compileGeoWithinBox(table *metastore.TableMetadata, node *ast.FunctionCallNode) (bluge.Query, error) {
+    field, err := geoColumn(table, node)
+    if err != nil {
+        return nil, err
+    }
+    if len(node.Arguments) != 5 {
+        return nil, fmt.Errorf("function '%s' expects 5 arguments, received %d", node.Name, len(node.Arguments))
+    }
+
+    var coordinates [4]float64
+    for i := range coordinates {
+        limit := 90.0
+        if i%2 == 1 {
+            limit = 180
+        }
+        if coordinates[i], err = coordinate(node, node.Arguments[i+1], limit); err != nil {
+            return nil, err
+        }
+    }
+
+    topLeftLat, topLeftLon, bottomRightLat, bottomRightLon := coordinates[0], coordinates[1], coordinates[2], coordinates[3]
+    return bluge.NewGeoBoundingBoxQuery(topLeftLon, topLeftLat, bottomRightLon, bottomRightLat).SetField(field), nil
+}
+
+func geoColumn(table *metastore.TableMetadata, node *ast.FunctionCallNode) (string, error) {
+    column, ok := node.Arguments[0].(*ast.ColumnIdentifierNode)
+    if !ok {
+        return "", fmt.Errorf("first argument of '%s' must be a column, received '%s'", node.Name, node.Arguments[0].String())
+    }
+    cmd, ok := table.Columns[column.Value]
+    if !ok {
+        return "", fmt.Errorf("column '%s' does not exist in table '%s'", column.Value, table.TableName)
+    }
+    if cmd.ColumnType != types.GEOPOINT {
+        return "", fmt.Errorf("function '%s' requires a GEOPOINT column, '%s' is %s", node.Name, column.Value, cmd.ColumnType)
+    }
+    return column.Value, nil
+}
+
+func coordinate(fn *ast.FunctionCallNode, node ast.ExpressionNode, limit float64) (float64, error) {
+    v, ok := numericLiteral(node)
+    if !ok {
+        return 0, fmt.Errorf("coordinates of '%s' must be numeric literals, received '%s'", fn.Name, node.String())
+    }
+    if v < -limit || v > limit {
+        return 0, fmt.Errorf("coordinate %g of '%s' out of range [-%g, %g]", v, fn.Name, limit, limit)
+    }
+    return v, nil
+}
+
+// numericLiteral returns the value of a possibly negated integer or float literal.
+func numericLiteral(node ast.ExpressionNode) (float64, bool) {
+    switch v := node.(type) {
+    case *ast.IntegerLiteralNode:
+        return float64(v.Value), true
+    case *ast.FloatLiteralNode:
+        return v.Value, true
+    case *ast.ParenthesizedExpressionNode:
+        return numericLiteral(v.Node)
+    case *ast.UnaryExpressionNode:
+        if v.Op.TokenType != token.MINUS {
+            return 0, false
+        }
+        f, ok := numericLiteral(v.Node)
+        return -f, ok
+    default:
+        return 0, false
+    }
+}
+
+func newMatchQuery(field, text string, keyword bool) bluge.Query {
+    query := bluge.NewMatchQuery(text).SetField(field)
+    if keyword {
+        query.SetAnalyzer(analyzer.NewKeywordAnalyzer())
+    }
+    return query
+}
+
+func newMatchPhraseQuery(field, text string, keyword bool) bluge.Query {
+    query := bluge.NewMatchPhraseQuery(text).SetField(field)
+    if keyword {
+        query.SetAnalyzer(analyzer.NewKeywordAnalyzer())
+    }
+    return query
+}
+
+// parseQueryString parses the small query-string syntax accepted by MATCH_QUERY. Terms are
+// separated by whitespace; a '+' prefix makes a term required, a '-' prefix excludes it, and
+// double quotes group words into a phrase. Unprefixed terms are optional and only raise the
+// score of the documents they match, unless there are no required terms at all, in which case
+// at least one of them must match.
+func parseQueryString(field, text string, keyword bool) (bluge.Query, error) {
+    query := bluge.NewBooleanQuery()
+    var must, should int
+
+    for i := 0; i < len(text); {
+        if text[i] == ' ' || text[i] == '\t' {
+            i++
+            continue
+        }
+
+        occur := byte(0)
+        if text[i] == '+' || text[i] == '-' {
+            occur = text[i]
+            i++
+        }
+
+        var clause bluge.Query
+        if i < len(text) && text[i] == '"' {
+            end := strings.IndexByte(text[i+1:], '"')
+            if end < 0 {
+                return nil, fmt.Errorf("unterminated phrase in query string '%s'", text)
+            }
+            clause = newMatchPhraseQuery(field, text[i+1:i+1+end], keyword)
+            i += end + 2
+        } else {
+            end := strings.IndexAny(text[i:], " \t")
+            if end < 0 {
+                end = len(text) - i
+            }
+            if end == 0 {
+                return nil, fmt.Errorf("dangling operator in query string '%s'", text)
+            }
+            clause = newMatchQuery(field, text[i:i+end], keyword)
+            i += end
+        }
+
+        switch occur {
+        case '+':
+            query.AddMust(clause)
+            must++
+        case '-':
+            query.AddMustNot(clause)
+        default:
+            query.AddShould(clause)
+            should++
+        }
+    }
+
+    switch {
+    case must == 0 && should == 0:
+        return nil, fmt.Errorf("query string '%s' contains no positive terms", text)
+    case must == 0:
+        query.SetMinShould(1)
+    }
+    return query, nil
+}
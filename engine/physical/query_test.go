@@ -0,0 +1,898 @@
+package physical
+
+import (
+    "context"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/logical"
+    "github.com/aleph-zero/flutterdb/engine/parser"
+    "github.com/aleph-zero/flutterdb/service/index"
+    "github.com/aleph-zero/flutterdb/service/metastore"
+    "github.com/stretchr/testify/require"
+    "testing"
+    "time"
+)
+
+func TestScanOperator_FullTextPredicates(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT c1 FROM t WHERE MATCH(c2, 'apple') ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE MATCH(c2, 'APPLE sky') ORDER BY c1`, []string{"a", "b", "c"}},
+        {`SELECT c1 FROM t WHERE MATCH_PHRASE(c2, 'green apple')`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE MATCH_PHRASE(c2, 'apple green')`, []string{}},
+        {`SELECT c1 FROM t WHERE MATCH_QUERY(c2, '+apple -pie')`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE MATCH_QUERY(c2, 'sky "red apple"') ORDER BY c1 DESC`, []string{"c", "a"}},
+        {`SELECT c1 FROM t WHERE MATCH(c2, 'apple') AND NOT MATCH(c2, 'red')`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE MATCH(c2, 'apple') AND c3 > 1`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE MATCH(c2, 'apple') OR c3 = 3 ORDER BY c1`, []string{"a", "b", "c"}},
+        {`SELECT c1 FROM t WHERE MATCH(c1, 'c')`, []string{"c"}},
+        {`SELECT c1 FROM t ORDER BY c3 DESC LIMIT 2`, []string{"c", "b"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            p := plan(t, metaSvc, indexSvc, tt.stmt)
+            results, err := p.Execute(ctx)
+            require.NoError(t, err)
+
+            received := make([]string, 0)
+            for _, result := range results {
+                received = append(received, result.Record.Values["c1"].MustString())
+            }
+            require.Equal(t, tt.expected, received)
+        })
+    }
+}
+
+func TestScanOperator_GeoPredicates(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT c1 FROM t WHERE GEO_DISTANCE(c4, 40.73, -73.99) < '10km'`, []string{"a"}},
+        {`SELECT c1 FROM t WHERE GEO_DISTANCE(c4, 40.73, -73.99) <= 400000 ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE GEO_DISTANCE(c4, 40.73, -73.99) > '400km'`, []string{"c"}},
+        {`SELECT c1 FROM t WHERE GEO_WITHIN_BOX(c4, 45, -80, 40, -70) ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE GEO_WITHIN_BOX(c4, 45, -80, 40, -70) AND c3 > 1`, []string{"b"}},
+        {`SELECT c1 FROM t ORDER BY GEO_DISTANCE(c4, 51.5, 0)`, []string{"c", "b", "a"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            p := plan(t, metaSvc, indexSvc, tt.stmt)
+            results, err := p.Execute(ctx)
+            require.NoError(t, err)
+
+            received := make([]string, 0)
+            for _, result := range results {
+                received = append(received, result.Record.Values["c1"].MustString())
+            }
+            require.Equal(t, tt.expected, received)
+        })
+    }
+}
+
+func TestProjectOperator_GeoDistance(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `SELECT c1, GEO_DISTANCE(c4, 40.7128, -74.0060) FROM t ORDER BY c1`)
+    require.Equal(t, []string{"c1", "GEO_DISTANCE(c4, 40.7128, -74.006)"}, p.Columns)
+
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 3)
+
+    distances := make([]float64, len(results))
+    for i, result := range results {
+        distances[i] = result.Record.Values["GEO_DISTANCE(c4, 40.7128, -74.006)"].MustFloat()
+    }
+    require.Less(t, distances[0], 10.0)              // New York to itself
+    require.InDelta(t, 306000, distances[1], 5000)   // New York to Boston
+    require.InDelta(t, 5570000, distances[2], 50000) // New York to London
+
+    // a record without a location is kept, without a distance
+    _, err = indexSvc.Index(ctx, "t", []*index.Document{{Fields: map[string]interface{}{"c1": "d"}}})
+    require.NoError(t, err)
+    results, err = plan(t, metaSvc, indexSvc, `SELECT c1, GEO_DISTANCE(c4, 40.7128, -74.0060) FROM t ORDER BY c1`).Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 4)
+    require.Equal(t, "d", results[3].Record.Values["c1"].MustString())
+    require.NotContains(t, results[3].Record.Values, "GEO_DISTANCE(c4, 40.7128, -74.006)")
+}
+
+func TestQueryPlan_MissingValues(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    // a record without c3: a predicate on it is not satisfied, a projection of it is empty,
+    // aggregates skip it and sorts order it last
+    _, err := indexSvc.Index(ctx, "t", []*index.Document{{Fields: map[string]interface{}{"c1": "d", "c2": "apple"}}})
+    require.NoError(t, err)
+
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT c1 FROM t WHERE c3 + 1 > 2 ORDER BY c1`, []string{"b", "c"}},
+        {`SELECT c1 FROM t WHERE NOT c3 + 1 > 2 ORDER BY c1`, []string{"a"}},
+        {`SELECT c1 FROM t WHERE c3 * 2 > 2 OR c1 = 'd' ORDER BY c1`, []string{"b", "c", "d"}},
+        {`SELECT c1 FROM t WHERE c3 * 2 > 2 AND c1 = 'd'`, []string{}},
+        {`SELECT c1 FROM t WHERE NOT (c3 * 2 > 2 AND c1 = 'b') ORDER BY c1`, []string{"a", "c", "d"}},
+        {`SELECT c1 FROM t WHERE NOT (c3 * 2 > 2 AND c1 = 'c' OR c1 = 'd')`, []string{"a", "b"}},
+        {`SELECT c1 FROM t ORDER BY c3 * 2 DESC`, []string{"c", "b", "a", "d"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            results, err := plan(t, metaSvc, indexSvc, tt.stmt).Execute(ctx)
+            require.NoError(t, err)
+
+            received := make([]string, 0)
+            for _, result := range results {
+                received = append(received, result.Record.Values["c1"].MustString())
+            }
+            require.Equal(t, tt.expected, received)
+        })
+    }
+
+    results, err := plan(t, metaSvc, indexSvc, `SELECT c1, c3 * 2 FROM t ORDER BY c1`).Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 4)
+    require.Equal(t, int64(6), results[2].Record.Values["c3 * 2"].MustInt())
+    require.NotContains(t, results[3].Record.Values, "c3 * 2")
+
+    results, err = plan(t, metaSvc, indexSvc, `SELECT COUNT(c3 + 1), MIN(c3 + 1) FROM t`).Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 1)
+    require.Equal(t, int64(3), results[0].Record.Values["COUNT(c3 + 1)"].MustInt())
+    require.Equal(t, int64(2), results[0].Record.Values["MIN(c3 + 1)"].MustInt())
+}
+
+func TestScanOperator_DatePredicates(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT c1 FROM t WHERE c5 >= TIMESTAMP '2024-02-29 18:00:00' ORDER BY c1`, []string{"b", "c"}},
+        {`SELECT c1 FROM t WHERE c5 > TIMESTAMP '2024-02-29 18:00:00'`, []string{"c"}},
+        {`SELECT c1 FROM t WHERE c5 < DATE '2024-02-01'`, []string{"a"}},
+        {`SELECT c1 FROM t WHERE DATE '2024-02-01' < c5 AND c5 <= '2024-03-01' ORDER BY c1`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE c5 = TIMESTAMP '2024-07-04T12:00:00Z'`, []string{"c"}},
+        {`SELECT c1 FROM t WHERE c5 > TIMESTAMP '2024-07-04 12:00:00' - INTERVAL '1 month 5 days' ORDER BY c1`, []string{"c"}},
+        {`SELECT c1 FROM t WHERE c5 + INTERVAL '1 week' > DATE '2024-03-01' ORDER BY c1`, []string{"b", "c"}},
+        {`SELECT c1 FROM t WHERE c5 < NOW() - INTERVAL '1 day' ORDER BY c1`, []string{"a", "b", "c"}},
+        {`SELECT c1 FROM t WHERE EXTRACT(MONTH FROM c5) = 2 OR c3 = 1 ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE DATE_TRUNC('month', c5) = DATE '2024-07-01'`, []string{"c"}},
+        {`SELECT c1 FROM t ORDER BY c5 DESC`, []string{"c", "b", "a"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            p := plan(t, metaSvc, indexSvc, tt.stmt)
+            results, err := p.Execute(ctx)
+            require.NoError(t, err)
+
+            received := make([]string, 0)
+            for _, result := range results {
+                received = append(received, result.Record.Values["c1"].MustString())
+            }
+            require.Equal(t, tt.expected, received)
+        })
+    }
+}
+
+func TestScanOperator_TermRangePredicates(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT c1 FROM t WHERE c1 = 'b'`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE c1 > 'a' ORDER BY c1`, []string{"b", "c"}},
+        {`SELECT c1 FROM t WHERE 'b' >= c1 ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE c1 < 'c' AND c1 >= 'b'`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE c3 = 2`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE c3 = 2.5`, []string{}},
+        {`SELECT c1 FROM t WHERE c3 > 1.5 ORDER BY c1`, []string{"b", "c"}},
+        {`SELECT c1 FROM t WHERE c3 <= 2 AND c3 > -1 ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE c3 < 2 OR c1 = 'c' ORDER BY c1`, []string{"a", "c"}},
+        {`SELECT c1 FROM t WHERE NOT c3 = 2 ORDER BY c1`, []string{"a", "c"}},
+        {`SELECT c1 FROM t WHERE NOT (c3 > 1 AND c1 < 'c') ORDER BY c1`, []string{"a", "c"}},
+        {`SELECT c1 FROM t WHERE c3 >= 2 AND c3 * 10 < 25`, []string{"b"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            // the predicates are answered by the search index, or by the filter if not optimized
+            for _, p := range []*QueryPlan{plan(t, metaSvc, indexSvc, tt.stmt), unoptimizedPlan(t, metaSvc, indexSvc, tt.stmt)} {
+                results, err := p.Execute(ctx)
+                require.NoError(t, err)
+
+                received := make([]string, 0)
+                for _, result := range results {
+                    received = append(received, result.Record.Values["c1"].MustString())
+                }
+                require.Equal(t, tt.expected, received)
+            }
+        })
+    }
+}
+
+func TestScanOperator_NegationWithoutValue(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    _, err := indexSvc.Index(ctx, "t", []*index.Document{
+        {Fields: map[string]interface{}{"c1": "d"}},
+        {Fields: map[string]interface{}{"c1": "e", "c3": float64(5)}},
+    })
+    require.NoError(t, err)
+
+    // a comparison against a column a document has no value for is neither true nor false
+    tests := []struct {
+        stmt     string
+        expected []string
+    }{
+        {`SELECT c1 FROM t WHERE NOT c3 = 2 ORDER BY c1`, []string{"a", "c", "e"}},
+        {`SELECT c1 FROM t WHERE NOT (c3 > 1 AND c1 < 'c') ORDER BY c1`, []string{"a", "c", "d", "e"}},
+        {`SELECT c1 FROM t WHERE NOT (c3 > 2 OR c1 = 'a') ORDER BY c1`, []string{"b"}},
+        {`SELECT c1 FROM t WHERE NOT NOT c3 < 3 ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE NOT c5 > '2024-03-01 00:00:00' ORDER BY c1`, []string{"a", "b"}},
+        {`SELECT c1 FROM t WHERE GEO_DISTANCE(c4, 40.73, -73.99) > '400km'`, []string{"c"}},
+        {`SELECT c1 FROM t WHERE NOT GEO_DISTANCE(c4, 40.73, -73.99) < '10km' ORDER BY c1`, []string{"b", "c"}},
+        {`SELECT c1 FROM t WHERE NOT GEO_WITHIN_BOX(c4, 45, -80, 40, -70)`, []string{"c"}},
+        // a full-text predicate is false for a document without a value
+        {`SELECT c1 FROM t WHERE NOT MATCH(c2, 'apple') ORDER BY c1`, []string{"c", "d", "e"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            p := plan(t, metaSvc, indexSvc, tt.stmt)
+            results, err := p.Execute(ctx)
+            require.NoError(t, err)
+
+            received := make([]string, 0)
+            for _, result := range results {
+                received = append(received, result.Record.Values["c1"].MustString())
+            }
+            require.Equal(t, tt.expected, received)
+        })
+    }
+}
+
+func TestScanOperator_Columns(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    table, err := metaSvc.GetTable("t")
+    require.NoError(t, err)
+
+    for _, columns := range [][]string{nil, {}, {"c1", "c3"}} {
+        scan, err := NewScanOperator(indexSvc, table, nil, nil, columns, DefaultBatchSize, DefaultParallelism)
+        require.NoError(t, err)
+        results, err := (&QueryPlan{RootOperator: scan}).Execute(ctx)
+        require.NoError(t, err)
+
+        for _, result := range results {
+            expected := []string{"c1", "c2", "c3", "c4", "c5"}
+            if columns != nil {
+                expected = columns
+            }
+            for _, column := range expected {
+                require.Contains(t, result.Record.Values, column)
+            }
+            require.Len(t, result.Record.Values, len(expected)+1) // and the relevance score
+        }
+        require.Len(t, results, 3)
+        if columns == nil {
+            require.Zero(t, scan.Stats.Skipped)
+        } else {
+            require.Positive(t, scan.Stats.Skipped)
+        }
+    }
+}
+
+func TestLimitOperator_StopsScan(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    documents := make([]*index.Document, 100)
+    for i := range documents {
+        documents[i] = &index.Document{Fields: map[string]interface{}{"c1": "z", "c3": float64(i)}}
+    }
+    _, err := indexSvc.Index(ctx, "t", documents)
+    require.NoError(t, err)
+
+    const size = 10
+    for _, query := range []string{`SELECT c1 FROM t LIMIT 1`, `SELECT c1 FROM t WHERE c3 * 2 >= 0 LIMIT 2`} {
+        t.Run(query, func(t *testing.T) {
+            p := plan(t, metaSvc, indexSvc, query, WithBatchSize(size))
+            results, err := p.Execute(ctx)
+            require.NoError(t, err)
+            require.NotEmpty(t, results)
+
+            // once the limit is satisfied the scan stops reading the index, having handed at
+            // most one more batch to the operator above it
+            scan := p.Statistics
+            for len(scan.Children) > 0 {
+                scan = scan.Children[0]
+            }
+            require.Equal(t, "Scan", scan.Operator)
+            require.LessOrEqual(t, scan.Records, uint64(2*size))
+        })
+    }
+}
+
+func TestQueryPlan_Cancelled(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+
+    for _, query := range []string{`SELECT c1 FROM t`, `SELECT c1 FROM t ORDER BY c3 LIMIT 2`, `SELECT 1`, `SHOW TABLES`} {
+        t.Run(query, func(t *testing.T) {
+            ctx, cancel := context.WithCancel(context.Background())
+            cancel()
+            _, err := plan(t, metaSvc, indexSvc, query).Execute(ctx)
+            require.ErrorIs(t, err, context.Canceled)
+        })
+    }
+}
+
+func TestQueryPlan_BatchSizes(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    queries := []string{
+        `SELECT c1, c3 * 10 FROM t`,
+        `SELECT c1 FROM t WHERE c3 * 2 > 2`,
+        `SELECT c1, c3 FROM t ORDER BY c3 DESC LIMIT 2`,
+        `SELECT c1 FROM t WHERE c3 * 2 >= 2 ORDER BY c1 LIMIT 2`,
+        `SELECT c1, HIGHLIGHT(c2) FROM t WHERE MATCH(c2, 'apple')`,
+    }
+    for _, query := range queries {
+        t.Run(query, func(t *testing.T) {
+            expected, err := plan(t, metaSvc, indexSvc, query, WithBatchSize(1)).Execute(ctx)
+            require.NoError(t, err)
+            require.NotEmpty(t, expected)
+
+            // batches that split and straddle the records must not change the results
+            for _, size := range []int{2, DefaultBatchSize} {
+                results, err := plan(t, metaSvc, indexSvc, query, WithBatchSize(size)).Execute(ctx)
+                require.NoError(t, err)
+                require.Len(t, results, len(expected))
+                for i := range results {
+                    require.Equal(t, expected[i].Record, results[i].Record, "batch size %d", size)
+                }
+            }
+        })
+    }
+}
+
+func TestQueryPlan_Parallelism(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    documents := make([]*index.Document, 1000)
+    for i := range documents {
+        documents[i] = &index.Document{Fields: map[string]interface{}{"c1": fmt.Sprintf("d%d", i), "c3": float64(i + 10)}}
+    }
+    _, err := indexSvc.Index(ctx, "t", documents)
+    require.NoError(t, err)
+
+    queries := []struct {
+        query   string
+        ordered bool
+    }{
+        {`SELECT c1, c3 * 10 FROM t`, false},
+        {`SELECT c1 FROM t WHERE c3 % 7 = 0`, false},
+        {`SELECT c1, HIGHLIGHT(c2) FROM t WHERE MATCH(c2, 'apple')`, false},
+        {`SELECT c1, c3 FROM t WHERE c3 % 3 = 1 ORDER BY c3 DESC LIMIT 20`, true},
+    }
+    for _, tt := range queries {
+        t.Run(tt.query, func(t *testing.T) {
+            expected, err := plan(t, metaSvc, indexSvc, tt.query, WithBatchSize(16)).Execute(ctx)
+            require.NoError(t, err)
+            require.NotEmpty(t, expected)
+
+            // the workers of a parallel scan emit the same records, though not in the same order
+            for _, workers := range []int{2, 4} {
+                results, err := plan(t, metaSvc, indexSvc, tt.query, WithBatchSize(16), WithParallelism(workers)).Execute(ctx)
+                require.NoError(t, err)
+                require.Len(t, results, len(expected))
+                if tt.ordered {
+                    for i := range results {
+                        require.Equal(t, expected[i].Record, results[i].Record, "workers %d", workers)
+                    }
+                    continue
+                }
+                records := make([]*engine.Record, len(results))
+                for i := range results {
+                    records[i] = results[i].Record
+                }
+                want := make([]*engine.Record, len(expected))
+                for i := range expected {
+                    want[i] = expected[i].Record
+                }
+                require.ElementsMatch(t, want, records, "workers %d", workers)
+            }
+        })
+    }
+
+    t.Run("limit", func(t *testing.T) {
+        results, err := plan(t, metaSvc, indexSvc, `SELECT c1 FROM t LIMIT 5`, WithBatchSize(16), WithParallelism(4)).Execute(ctx)
+        require.NoError(t, err)
+        require.Len(t, results, 5)
+    })
+
+    t.Run("filter", func(t *testing.T) {
+        // the workers evaluate the predicate, so the plan has no filter operator
+        p := plan(t, metaSvc, indexSvc, `SELECT c1 FROM t WHERE c3 % 7 = 0`, WithParallelism(4))
+        _, err := p.Execute(ctx)
+        require.NoError(t, err)
+        scan := p.Statistics.Children[0]
+        require.Equal(t, "Scan", scan.Operator)
+        require.Contains(t, scan.Detail, "filter: c3 % 7 = 0")
+        require.Contains(t, scan.Detail, "workers: 4")
+        require.Less(t, scan.Records, uint64(len(documents)))
+
+        _, err = plan(t, metaSvc, indexSvc, `SELECT c1 FROM t WHERE 10 / (c3 - 2) > 1`, WithParallelism(4)).Execute(ctx)
+        require.ErrorIs(t, err, Error{ErrorCode: EvaluationError})
+        var operatorErr Error
+        require.ErrorAs(t, err, &operatorErr)
+        require.Equal(t, "Scan", operatorErr.Operator)
+    })
+
+    t.Run("aggregate", func(t *testing.T) {
+        // the workers fold their records into partial aggregates, which are merged above the scan
+        query := `SELECT COUNT(*), MIN(c1), MAX(c3 * 2) FROM t WHERE c3 % 7 = 0`
+        expected, err := plan(t, metaSvc, indexSvc, query).Execute(ctx)
+        require.NoError(t, err)
+        require.Len(t, expected, 1)
+
+        p := plan(t, metaSvc, indexSvc, query, WithBatchSize(16), WithParallelism(4))
+        results, err := p.Execute(ctx)
+        require.NoError(t, err)
+        require.Len(t, results, 1)
+        require.Equal(t, expected[0].Record, results[0].Record)
+
+        aggregate := p.Statistics.Children[0]
+        require.Equal(t, "Aggregate", aggregate.Operator)
+        scan := aggregate.Children[0]
+        require.Equal(t, "Scan", scan.Operator)
+        require.Contains(t, scan.Detail, "partial: COUNT(*), MIN(c1), MAX(c3 * 2)")
+        require.Equal(t, uint64(expected[0].Record.Values["COUNT(*)"].MustInt()), scan.Records)
+    })
+
+    t.Run("cancelled", func(t *testing.T) {
+        cancelled, cancel := context.WithCancel(ctx)
+        cancel()
+        _, err := plan(t, metaSvc, indexSvc, `SELECT c1 FROM t`, WithParallelism(4)).Execute(cancelled)
+        require.ErrorIs(t, err, context.Canceled)
+    })
+}
+
+func TestQueryPlan_TopN(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+    documents := make([]*index.Document, 1000)
+    for i := range documents {
+        documents[i] = &index.Document{Fields: map[string]interface{}{
+            "c1": fmt.Sprintf("d%03d", i),
+            "c3": float64((i * 7) % 100),
+            "c5": start.Add(time.Duration(i*37%1000) * time.Hour).Format(time.DateTime),
+        }}
+    }
+    _, err := indexSvc.Index(ctx, "t", documents)
+    require.NoError(t, err)
+
+    tests := []struct {
+        query    string
+        limit    int
+        operator string // the operator below the projection
+        ties     bool   // whether records with the same keys are ordered by the scan
+    }{
+        {`SELECT c1, c3 FROM t ORDER BY c3 DESC, c1`, 10, "Scan", false},
+        {`SELECT c1 FROM t ORDER BY c1 DESC`, 5, "Scan", false},
+        {`SELECT c1, c5 FROM t ORDER BY c5`, 5, "Scan", false},
+        {`SELECT c1 FROM t WHERE c3 > 40 ORDER BY c3, c1`, 7, "Scan", false},
+        {`SELECT c1 FROM t WHERE MATCH(c2, 'apple') ORDER BY _score DESC, c1`, 2, "Scan", false},
+        {`SELECT c1, c3 FROM t WHERE c3 * 2 > 40 ORDER BY c3 DESC, c1`, 10, "TopN", false},
+        {`SELECT c1, c3 FROM t ORDER BY c3 % 10`, 15, "TopN", true},
+        {`SELECT c1 FROM t WHERE MATCH(c2, 'apple') ORDER BY c2 DESC, c1`, 1, "TopN", false},
+        {`SELECT c1 FROM t ORDER BY c3`, 0, "TopN", false},
+    }
+    for _, tt := range tests {
+        query := fmt.Sprintf("%s LIMIT %d", tt.query, tt.limit)
+        t.Run(query, func(t *testing.T) {
+            // the first records of the sorted table
+            sorted, err := plan(t, metaSvc, indexSvc, tt.query).Execute(ctx)
+            require.NoError(t, err)
+            expected := sorted[:min(tt.limit, len(sorted))]
+
+            options := [][]Option{{WithBatchSize(4)}, {WithBatchSize(DefaultBatchSize)}}
+            if !tt.ties {
+                options = append(options, []Option{WithBatchSize(4), WithParallelism(4)})
+            }
+            for _, opts := range options {
+                p := plan(t, metaSvc, indexSvc, query, opts...)
+                results, err := p.Execute(ctx)
+                require.NoError(t, err)
+                require.Len(t, results, len(expected))
+                for i := range results {
+                    require.Equal(t, expected[i].Record, results[i].Record)
+                }
+
+                operator := p.Statistics.Children[0]
+                require.Equal(t, tt.operator, operator.Operator)
+                if tt.operator == "Scan" {
+                    // the search index reads no more hits than the limit
+                    require.Contains(t, operator.Detail, "top: ")
+                    require.LessOrEqual(t, operator.Records, uint64(tt.limit))
+                }
+            }
+        })
+    }
+}
+
+func TestQueryPlan_NullOrdering(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    _, err := indexSvc.Index(ctx, "t", []*index.Document{
+        {Fields: map[string]interface{}{"c1": "d"}},
+        {Fields: map[string]interface{}{"c1": "e", "c3": float64(0)}},
+        {Fields: map[string]interface{}{"c1": "f"}},
+    })
+    require.NoError(t, err)
+
+    // the search index, the heap of a top-N and a sort all order the records without c3 last
+    tests := []struct {
+        direction string
+        expected  []string
+    }{
+        {"ASC", []string{"e", "a", "b", "c", "d", "f"}},
+        {"DESC", []string{"c", "b", "a", "e", "d", "f"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.direction, func(t *testing.T) {
+            for _, path := range []struct {
+                query    string
+                operator string
+            }{
+                {`SELECT c1 FROM t ORDER BY c3 %s, c1 LIMIT 6`, "Scan"},
+                {`SELECT c1 FROM t WHERE c1 <> 'zz' ORDER BY c3 %s, c1 LIMIT 6`, "TopN"},
+                {`SELECT c1 FROM t ORDER BY c3 %s, c1`, "Sort"},
+                {`SELECT c1 FROM t ORDER BY c3 + 1 %s, c1`, "Sort"},
+            } {
+                p := plan(t, metaSvc, indexSvc, fmt.Sprintf(path.query, tt.direction), WithBatchSize(2))
+                results, err := p.Execute(ctx)
+                require.NoError(t, err)
+                require.Equal(t, path.operator, p.Statistics.Children[0].Operator)
+
+                values := make([]string, len(results))
+                for i, result := range results {
+                    values[i] = result.Record.Values["c1"].MustString()
+                }
+                require.Equal(t, tt.expected, values, path.query)
+            }
+        })
+    }
+}
+
+func TestQueryPlan_Aggregates(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    tests := []struct {
+        query    string
+        expected map[string]engine.Value
+        operator string // the operator below the projection
+    }{
+        {`SELECT COUNT(*) FROM t`, map[string]engine.Value{"COUNT(*)": engine.NewIntValue(3)}, "IndexAggregate"},
+        {`SELECT COUNT(*), MIN(c3), MAX(c3) FROM t WHERE c3 > 1`, map[string]engine.Value{
+            "COUNT(*)": engine.NewIntValue(2), "MIN(c3)": engine.NewIntValue(2), "MAX(c3)": engine.NewIntValue(3)}, "IndexAggregate"},
+        {`SELECT COUNT(*) FROM t WHERE MATCH(c2, 'apple')`, map[string]engine.Value{"COUNT(*)": engine.NewIntValue(2)}, "IndexAggregate"},
+        {`SELECT COUNT(*), MIN(c3), MAX(c3) FROM t WHERE c3 * 2 > 2`, map[string]engine.Value{
+            "COUNT(*)": engine.NewIntValue(2), "MIN(c3)": engine.NewIntValue(2), "MAX(c3)": engine.NewIntValue(3)}, "Aggregate"},
+        {`SELECT MIN(c1), MAX(c1) FROM t`, map[string]engine.Value{
+            "MIN(c1)": engine.NewStringValue("a"), "MAX(c1)": engine.NewStringValue("c")}, "Aggregate"},
+        {`SELECT COUNT(c2), MAX(c3 * 10) FROM t WHERE MATCH(c2, 'apple')`, map[string]engine.Value{
+            "COUNT(c2)": engine.NewIntValue(2), "MAX(c3 * 10)": engine.NewIntValue(20)}, "Aggregate"},
+        {`SELECT COUNT(*), MIN(c3) FROM t WHERE c3 > 5`, map[string]engine.Value{"COUNT(*)": engine.NewIntValue(0)}, "IndexAggregate"},
+        {`SELECT COUNT(*), MAX(c3) FROM t WHERE c3 * 2 > 10`, map[string]engine.Value{"COUNT(*)": engine.NewIntValue(0)}, "Aggregate"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            for _, opts := range [][]Option{{WithBatchSize(2)}, {WithParallelism(4)}} {
+                p := plan(t, metaSvc, indexSvc, tt.query, opts...)
+                results, err := p.Execute(ctx)
+                require.NoError(t, err)
+                require.Len(t, results, 1)
+                // MIN and MAX over no values have no value
+                require.Equal(t, tt.expected, results[0].Record.Values)
+
+                operator := p.Statistics.Children[0]
+                require.Equal(t, tt.operator, operator.Operator)
+                if tt.operator == "IndexAggregate" {
+                    // the search index answers without a scan decoding stored fields
+                    require.Empty(t, operator.Children)
+                    require.Zero(t, p.Statistics.ScannedBytes())
+                }
+            }
+        })
+    }
+}
+
+func TestValuesOperator_Aggregates(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+    ctx := context.Background()
+
+    // a select without FROM aggregates over its single record, or none if its predicate is false
+    results, err := plan(t, metaSvc, indexSvc, `SELECT COUNT(*), MAX(1 + 2)`).Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 1)
+    require.Equal(t, map[string]engine.Value{"COUNT(*)": engine.NewIntValue(1), "MAX(1 + 2)": engine.NewIntValue(3)}, results[0].Record.Values)
+
+    results, err = plan(t, metaSvc, indexSvc, `SELECT COUNT(*) WHERE 1 = 2`).Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 1)
+    require.Equal(t, engine.NewIntValue(0), results[0].Record.Values["COUNT(*)"])
+}
+
+func TestQueryPlan_OperatorErrors(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    // c3 - 2 is zero for the second document
+    tests := []struct {
+        query    string
+        operator string
+    }{
+        {`SELECT c1 FROM t WHERE 10 / (c3 - 2) > 1`, "Filter"},
+        {`SELECT 10 / (c3 - 2) FROM t`, "Project"},
+        {`SELECT c1 FROM t ORDER BY 10 / (c3 - 2)`, "Sort"},
+        {`SELECT c1 FROM t ORDER BY 10 / (c3 - 2) LIMIT 1`, "TopN"},
+        {`SELECT MIN(10 / (c3 - 2)) FROM t`, "Aggregate"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            // the failing record is never skipped, whether or not it shares a batch with the others
+            for _, size := range []int{1, DefaultBatchSize} {
+                results, err := plan(t, metaSvc, indexSvc, tt.query, WithBatchSize(size)).Execute(ctx)
+                require.ErrorIs(t, err, Error{ErrorCode: EvaluationError}, "batch size %d", size)
+                require.ErrorContains(t, err, "division by zero")
+                require.Nil(t, results)
+
+                var operatorErr Error
+                require.ErrorAs(t, err, &operatorErr)
+                require.Equal(t, tt.operator, operatorErr.Operator)
+            }
+        })
+    }
+}
+
+func TestScanOperator_DecodingError(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    table, err := metaSvc.GetTable("t")
+    require.NoError(t, err)
+
+    // a stored field the table does not declare cannot be decoded
+    stale := *table
+    stale.Columns = map[string]metastore.ColumnMetadata{"c1": table.Columns["c1"]}
+    scan, err := NewScanOperator(indexSvc, &stale, nil, nil, nil, DefaultBatchSize, DefaultParallelism)
+    require.NoError(t, err)
+
+    _, err = (&QueryPlan{RootOperator: scan}).Execute(ctx)
+    require.ErrorIs(t, err, Error{ErrorCode: DecodingError})
+    require.ErrorContains(t, err, "unknown field")
+}
+
+func TestProjectOperator_DateFunctions(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc,
+        `SELECT EXTRACT(YEAR FROM c5), DATE_TRUNC('quarter', c5), c5 - DATE '2024-01-01' FROM t WHERE c1 = 'b'`)
+    require.Equal(t, []string{
+        "EXTRACT(YEAR FROM c5)",
+        "DATE_TRUNC('quarter', c5)",
+        "c5 - DATE '2024-01-01'",
+    }, p.Columns)
+
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 1)
+
+    values := results[0].Record.Values
+    require.Equal(t, int64(2024), values["EXTRACT(YEAR FROM c5)"].MustInt())
+    require.Equal(t, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), values["DATE_TRUNC('quarter', c5)"].MustTime())
+    interval, ok := values["c5 - DATE '2024-01-01'"].IntervalVal()
+    require.True(t, ok)
+    require.Equal(t, (59*24+18)*time.Hour, interval.Duration)
+}
+
+func TestScanOperator_RelevanceScore(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `SELECT c1, _score FROM t WHERE MATCH(c2, 'apple') ORDER BY _score DESC`)
+    require.Equal(t, []string{"c1", "_score"}, p.Columns)
+
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 2)
+
+    first := results[0].Record.Values["_score"].MustFloat()
+    second := results[1].Record.Values["_score"].MustFloat()
+    require.Positive(t, second)
+    require.GreaterOrEqual(t, first, second)
+    require.Equal(t, "b", results[0].Record.Values["c1"].MustString()) // the shorter document ranks higher
+}
+
+func TestScanOperator_Highlight(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+    ctx := context.Background()
+
+    p := plan(t, metaSvc, indexSvc, `SELECT c1, HIGHLIGHT(c2) FROM t WHERE MATCH(c2, 'apple') ORDER BY c1`)
+    require.Equal(t, []string{"c1", "HIGHLIGHT(c2)"}, p.Columns)
+
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 2)
+    require.Equal(t, "red <mark>apple</mark> pie", results[0].Record.Values["HIGHLIGHT(c2)"].MustString())
+    require.Equal(t, "green <mark>apple</mark>", results[1].Record.Values["HIGHLIGHT(c2)"].MustString())
+    require.NotContains(t, results[0].Record.Values, "c2")
+}
+
+func TestValuesOperator_SelectWithoutFrom(t *testing.T) {
+    teardown, metaSvc, indexSvc := setup(t, data)
+    defer teardown(t)
+    ctx := context.Background()
+
+    tests := []struct {
+        stmt     string
+        column   string
+        expected engine.Value
+    }{
+        {`SELECT 1 + 2`, "1 + 2", engine.NewIntValue(3)},
+        {`SELECT 'ok'`, "'ok'", engine.NewStringValue("ok")},
+        {`SELECT EXTRACT(YEAR FROM DATE '2024-03-01')`, "EXTRACT(YEAR FROM DATE '2024-03-01')", engine.NewIntValue(2024)},
+        {`SELECT 1 WHERE 1 = 1`, "1", engine.NewIntValue(1)},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.stmt, func(t *testing.T) {
+            p := plan(t, metaSvc, indexSvc, tt.stmt)
+            results, err := p.Execute(ctx)
+            require.NoError(t, err)
+            require.Len(t, results, 1)
+            require.Equal(t, tt.expected, results[0].Record.Values[tt.column])
+        })
+    }
+
+    p := plan(t, metaSvc, indexSvc, `SELECT 1 WHERE 1 = 2`)
+    results, err := p.Execute(ctx)
+    require.NoError(t, err)
+    require.Empty(t, results)
+
+    p = plan(t, metaSvc, indexSvc, `SELECT NOW()`)
+    results, err = p.Execute(ctx)
+    require.NoError(t, err)
+    require.Len(t, results, 1)
+    require.Equal(t, engine.DateTime, results[0].Record.Values["NOW()"].Kind())
+}
+
+func TestScanOperator_InvalidFullTextPredicates(t *testing.T) {
+    teardown, metaSvc, indexSvc := setupIndex(t)
+    defer teardown(t)
+
+    tests := []string{
+        `SELECT c1 FROM t WHERE MATCH(c3, 'apple')`,
+        `SELECT c1 FROM t WHERE MATCH(c2, c1)`,
+        `SELECT c1 FROM t WHERE MATCH_QUERY(c2, '-apple')`,
+        `SELECT c1 FROM t WHERE MATCH_QUERY(c2, '"red apple')`,
+        `SELECT c1 FROM t WHERE GEO_DISTANCE(c4, 100, 0) < '10km'`,
+        `SELECT c1 FROM t WHERE GEO_DISTANCE(c4, 40, 0) < '10 parsecs'`,
+        `SELECT c1 FROM t WHERE GEO_WITHIN_BOX(c4, c3, -80, 40, -70)`,
+    }
+
+    for _, stmt := range tests {
+        t.Run(stmt, func(t *testing.T) {
+            tokens, err := parser.LexicalScan(stmt)
+            require.NoError(t, err)
+            root, err := parser.New(tokens).Parse()
+            require.NoError(t, err)
+            _, err = engine.ResolveSymbols(metaSvc, root)
+            require.NoError(t, err)
+            logicalPlan, err := logical.NewQueryPlan(root)
+            require.NoError(t, err)
+            logicalPlan, err = logical.OptimizeQueryPlan(logicalPlan)
+            require.NoError(t, err)
+            _, err = NewQueryPlan(metaSvc, indexSvc, logicalPlan)
+            require.Error(t, err)
+        })
+    }
+}
+
+// BenchmarkQueryPlan compares batches of a single record with batches of the default size, and
+// with scanning on four workers. A batch size of 1 still runs the batched operators, so it shows
+// the cost of small batches, not that of the per-record pipeline the batches replaced.
+func BenchmarkQueryPlan(b *testing.B) {
+    teardown, metaSvc, indexSvc := setupIndex(b)
+    defer teardown(b)
+    ctx := context.Background()
+
+    documents := make([]*index.Document, 10000)
+    for i := range documents {
+        documents[i] = &index.Document{Fields: map[string]interface{}{"c1": "z", "c3": float64(i)}}
+    }
+    _, err := indexSvc.Index(ctx, "t", documents)
+    require.NoError(b, err)
+
+    queries := map[string]string{
+        "project": `SELECT c1, c3 * 2 + 1 FROM t`,
+        "filter":  `SELECT c1, c3 FROM t WHERE c3 % 7 = 0`,
+        "limit":   `SELECT c1, c3 FROM t LIMIT 5000`,
+        "sort":    `SELECT c1, c3 FROM t ORDER BY c3 DESC`,
+        "topn":    `SELECT c1, c3 FROM t ORDER BY c3 DESC LIMIT 10`,
+        "heap":    `SELECT c1, c3 FROM t ORDER BY c3 * -1 LIMIT 10`,
+    }
+    // a plan runs once, so every iteration plans the query anew, off the clock
+    execute := func(b *testing.B, query string, options ...Option) {
+        for i := 0; i < b.N; i++ {
+            b.StopTimer()
+            p := plan(b, metaSvc, indexSvc, query, options...)
+            b.StartTimer()
+            if _, err := p.Execute(ctx); err != nil {
+                b.Fatal(err)
+            }
+        }
+    }
+    for name, query := range queries {
+        for _, size := range []int{1, DefaultBatchSize} {
+            b.Run(fmt.Sprintf("%s/batchsize=%d", name, size), func(b *testing.B) {
+                execute(b, query, WithBatchSize(size))
+            })
+        }
+        b.Run(fmt.Sprintf("%s/workers=4", name), func(b *testing.B) {
+            execute(b, query, WithParallelism(4))
+        })
+    }
+}
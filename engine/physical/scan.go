@@ -4,38 +4,121 @@ import (
     "context"
     "fmt"
     "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
     "github.com/aleph-zero/flutterdb/engine/types"
     "github.com/aleph-zero/flutterdb/service/index"
     "github.com/aleph-zero/flutterdb/service/metastore"
     "github.com/blugelabs/bluge"
+    "github.com/blugelabs/bluge/search"
     log "github.com/go-chi/httplog/v2"
+    "sort"
+    "strings"
+    "sync"
+    "time"
 )
 
 type ScanOperator struct {
-    table     *metastore.TableMetadata
-    request   bluge.SearchRequest
-    indexSvc  index.Service
-    sink      chan *engine.Result
-    collector *engine.HitCollector // collects hits from the search index
-    Stats     ScanOperatorStats
+    table      *metastore.TableMetadata
+    predicate  ast.ExpressionNode      // predicate pushed into the search index, if any
+    residual   ast.ExpressionNode      // predicate the workers of a parallel scan evaluate, if any
+    aggregates []*ast.FunctionCallNode // aggregates the workers of a parallel scan compute, if any
+    names      []string                // the columns of the partial aggregates
+    columns    []string                // stored fields decoded into records, or nil for all of them
+    decoded    map[string]bool
+    query      bluge.Query
+    highlights []string
+    order      []ast.OrderingTerm // ordering of the hits by the search index, if any
+    limit      int                // the most hits read in that order
+    request    bluge.SearchRequest
+    indexSvc   index.Service
+    sink       chan *engine.Batch
+    partitions []*scanPartition
+    Stats      ScanOperatorStats
+    *lifecycle
 }
 
-func NewScanOperator(indexSvc index.Service, table *metastore.TableMetadata) *ScanOperator {
-    return &ScanOperator{
-        table:     table,
-        indexSvc:  indexSvc,
-        request:   bluge.NewAllMatches(bluge.NewMatchAllQuery()),
-        collector: engine.NewHitCollector(),
-        sink:      make(chan *engine.Result),
+// scanPartition is the share of the hits of a scan that one worker reads from the search index.
+// A scan that is not parallel has a single partition.
+type scanPartition struct {
+    collector *engine.HitCollector // collects hits from the search index into batches
+    filter    Expression           // the compiled residual predicate, if any
+    partials  []*accumulator       // the partial aggregates of the records read, if any
+    records   uint64
+    bytes     uint64
+    skipped   uint64
+}
+
+// NewScanOperator creates a scan of a table that emits batches of at most size records. Only the
+// stored fields named by columns are decoded into records, unless columns is nil, in which case
+// all of them are. A scan with more than one worker reads the stored fields of the hits on that
+// many goroutines and emits their batches in no particular order.
+func NewScanOperator(indexSvc index.Service, table *metastore.TableMetadata, predicate ast.ExpressionNode, highlights []string, columns []string, size int, workers int) (*ScanOperator, error) {
+    query, err := NewSearchQuery(table, predicate)
+    if err != nil {
+        return nil, err
+    }
+
+    var decoded map[string]bool
+    fields := columns
+    if columns != nil {
+        decoded = make(map[string]bool, len(columns))
+        for _, column := range columns {
+            decoded[column] = true
+        }
+    } else {
+        fields = make([]string, 0, len(table.Columns))
+        for column := range table.Columns {
+            fields = append(fields, column)
+        }
+        sort.Strings(fields)
+    }
+
+    // every batch holds the decoded fields, the relevance score and the highlighted fragments
+    columnNames := append(append([]string{}, fields...), ast.ScoreColumn)
+    for _, field := range highlights {
+        columnNames = append(columnNames, ast.HighlightColumn(field))
     }
+    schema := engine.NewSchema(columnNames)
+
+    request := bluge.NewAllMatches(query)
+    if len(highlights) > 0 {
+        request.IncludeLocations()
+    }
+    partitions := make([]*scanPartition, max(workers, 1))
+    for i := range partitions {
+        collector := engine.NewHitCollector(schema, size)
+        if len(highlights) > 0 {
+            collector.SetHighlights(highlights)
+        }
+        partitions[i] = &scanPartition{collector: collector}
+    }
+
+    return &ScanOperator{
+        table:      table,
+        predicate:  predicate,
+        columns:    columns,
+        decoded:    decoded,
+        query:      query,
+        highlights: highlights,
+        indexSvc:   indexSvc,
+        request:    request,
+        partitions: partitions,
+        sink:       make(chan *engine.Batch),
+        lifecycle:  newLifecycle(),
+    }, nil
 }
 
+// ScanOperatorStats counts the records a scan emitted, or folded into partial aggregates. Bytes
+// counts the bytes of every record read from the search index, including the records a residual
+// predicate filtered out.
 type ScanOperatorStats struct {
     Records uint64
     Bytes   uint64
+    Skipped uint64 // bytes of stored fields that were not decoded because no operator reads them
+    Elapsed time.Duration
 }
 
-func (operator *ScanOperator) Sink() <-chan *engine.Result {
+func (operator *ScanOperator) Sink() <-chan *engine.Batch {
     return operator.sink
 }
 
@@ -43,65 +126,251 @@ func (operator *ScanOperator) Accept(ctx context.Context, visitor OperatorNodeVi
     return visitor.VisitScanOperator(ctx, operator)
 }
 
-func (operator *ScanOperator) Open(ctx context.Context) error {
-    go func() {
-        defer close(operator.sink)
-        for result := range operator.collector.Source() {
-            operator.Stats.Records++
-            operator.Stats.Bytes += uint64(result.Bytes)
-            if result.Error != nil {
-                // TODO XXX HANDLE ERROR
-                log.LogEntry(ctx).Error("Scan error", "queryId", engine.QueryIdFromContext(ctx), "error", result.Error)
-            }
-            operator.sink <- result
+// Workers returns the number of goroutines that read the hits of the scan.
+func (operator *ScanOperator) Workers() int {
+    return len(operator.partitions)
+}
+
+// Filter has the workers of a parallel scan evaluate a predicate against the records they read,
+// rather than a filter operator evaluating it on a goroutine of its own. Every worker compiles the
+// predicate for itself.
+func (operator *ScanOperator) Filter(predicate ast.ExpressionNode, now time.Time) {
+    operator.residual = predicate
+    for _, partition := range operator.partitions {
+        partition.filter = Compile(predicate, now)
+    }
+}
+
+// Aggregate has the workers of a parallel scan fold the records they read into partial aggregates
+// of their own. Rather than the records, every worker emits a single record holding its partial
+// results, in columns named by names, which the aggregate operator above the scan merges.
+func (operator *ScanOperator) Aggregate(aggregates []*ast.FunctionCallNode, names []string, now time.Time) {
+    operator.aggregates = aggregates
+    operator.names = names
+    for _, partition := range operator.partitions {
+        partition.partials = make([]*accumulator, len(aggregates))
+        for i, aggregate := range aggregates {
+            partition.partials[i] = newAccumulator(aggregate, now)
+        }
+    }
+}
+
+// TopN has the search index find the first limit hits of the scan in the order of the terms, so
+// that no operator above the scan has to order every record. It reports false, leaving the scan as
+// it was, if a term is not a column the index can sort by, or the scan filters the records it
+// reads. The hits are read on a single worker, so that they are emitted in order. Documents
+// without a value for a column are ordered after the others.
+func (operator *ScanOperator) TopN(terms []ast.OrderingTerm, limit int) bool {
+    if operator.residual != nil || limit <= 0 {
+        return false
+    }
+    order := make(search.SortOrder, len(terms))
+    for i, term := range terms {
+        column, ok := term.Node.(*ast.ColumnIdentifierNode)
+        if !ok {
+            return false
+        }
+        if column.Value == ast.ScoreColumn {
+            order[i] = search.SortBy(&search.ScoreSource{})
+        } else if cmd, ok := operator.table.Columns[column.Value]; ok && sortableByIndex(cmd.ColumnType) {
+            order[i] = search.SortBy(search.Field(column.Value))
+        } else {
+            return false
+        }
+        if term.Descending {
+            order[i].Desc()
         }
-        log.LogEntry(ctx).Info("Scan finished", "records", operator.Stats.Records, "queryId", operator.Stats.Records)
-    }()
+    }
 
-    return operator.indexSvc.Search(
-        ctx,
-        operator.table.TableName,
-        operator.request,
-        operator.collector,
-        operator.processor)
+    request := bluge.NewTopNSearch(limit, operator.query).SortByCustom(order)
+    if len(operator.highlights) > 0 {
+        request.IncludeLocations()
+    }
+    operator.request = request
+    operator.order = terms
+    operator.limit = limit
+    operator.partitions = operator.partitions[:1]
+    return true
 }
 
-func (operator *ScanOperator) processor(field string, value []byte) bool {
-    if field == "_id" {
+// sortableByIndex reports whether the search index orders the values of a column as the sort operator
+// does. Text is ordered by its analyzed terms and geopoints by their encoding, so neither is.
+func sortableByIndex(columnType types.Type) bool {
+    switch columnType {
+    case types.KEYWORD, types.INTEGER, types.FLOAT, types.DATETIME:
         return true
+    default:
+        return false
     }
-    cmd, ok := operator.table.Columns[field]
-    if !ok {
-        panic(fmt.Sprintf("unknown field %s", field))
+}
+
+// Open searches the index of the table and emits a record for every hit. The search runs until
+// the hits are exhausted or the operator stops consuming them, because it has been closed or the
+// query has been cancelled, at which point the index reader is released.
+func (operator *ScanOperator) Open(ctx context.Context) error {
+    start := time.Now()
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+
+        var wg sync.WaitGroup
+        for _, partition := range operator.partitions {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                operator.forward(ctx, partition)
+            }()
+        }
+        wg.Wait()
+
+        for _, partition := range operator.partitions {
+            operator.Stats.Records += partition.records
+            operator.Stats.Bytes += partition.bytes
+        }
+        log.LogEntry(ctx).Info("Scan finished", "records", operator.Stats.Records, "queryId", engine.QueryIdFromContext(ctx))
+    })
+
+    var err error
+    if len(operator.partitions) == 1 {
+        partition := operator.partitions[0]
+        err = operator.indexSvc.Search(ctx, operator.table.TableName, operator.request, partition.collector, operator.processor(partition))
+    } else {
+        partitions := make([]index.Partition, len(operator.partitions))
+        for i, partition := range operator.partitions {
+            partitions[i] = index.Partition{Collector: partition.collector, Processor: operator.processor(partition)}
+        }
+        err = operator.indexSvc.SearchParallel(ctx, operator.table.TableName, operator.request, partitions)
+    }
+    for _, partition := range operator.partitions {
+        operator.Stats.Skipped += partition.skipped
+    }
+    if err != nil {
+        return Error{ErrorCode: SearchError, Operator: "Scan", Message: fmt.Sprintf("searching table %s", operator.table.TableName), Err: err}
     }
+    return nil
+}
 
-    switch cmd.ColumnType {
-    case types.TEXT, types.KEYWORD:
-        operator.collector.AddValue(field, engine.NewStringValue(string(value)))
-    case types.FLOAT:
-        v, err := bluge.DecodeNumericFloat64(value)
-        if err != nil {
-            operator.collector.Err = fmt.Errorf("error decoding numeric value: %w", err)
+// forward emits the batches collected by a partition, less the records the residual predicate
+// does not hold for. A partition that aggregates folds the records into its partial aggregates
+// instead, and emits their results once the hits are exhausted.
+func (operator *ScanOperator) forward(ctx context.Context, partition *scanPartition) {
+    defer partition.collector.Stop()
+    for {
+        batch, ok := operator.next(ctx, partition.collector.Source())
+        if !ok {
+            if partition.partials != nil && ctx.Err() == nil {
+                values := make([]engine.Value, len(partition.partials))
+                for i, partial := range partition.partials {
+                    values[i] = partial.result()
+                }
+                operator.emit(ctx, operator.sink, aggregateBatch(operator.names, values))
+            }
+            return
         }
-        operator.collector.AddValue(field, engine.NewFloatValue(v))
-    case types.INTEGER:
-        v, err := bluge.DecodeNumericFloat64(value)
-        if err != nil {
-            operator.collector.Err = fmt.Errorf("error decoding numeric value: %w", err)
+        if batch.Error != nil {
+            fail(ctx, Error{ErrorCode: DecodingError, Operator: "Scan", Message: fmt.Sprintf("reading table %s", operator.table.TableName), Err: batch.Error})
+            return
         }
-        operator.collector.AddValue(field, engine.NewIntValue(int64(v)))
-    case types.DATETIME:
-        v, err := bluge.DecodeDateTime(value)
-        if err != nil {
-            operator.collector.Err = fmt.Errorf("error decoding datetime: %w", err)
+        bytes := uint64(batch.Bytes())
+        if partition.filter != nil {
+            rows, err := filterRows(batch, partition.filter)
+            if err != nil {
+                fail(ctx, Error{ErrorCode: EvaluationError, Operator: "Scan", Message: fmt.Sprintf("evaluating %s", operator.residual.String()), Err: err})
+                return
+            }
+            if len(rows) < batch.Len() {
+                batch = batch.Select(rows)
+            }
         }
-        operator.collector.AddValue(field, engine.NewTimeValue(v))
-    case types.GEOPOINT:
-        lat, lon, err := bluge.DecodeGeoLonLat(value)
-        if err != nil {
-            operator.collector.Err = fmt.Errorf("error decoding geopoint: %w", err)
+        if partition.partials != nil {
+            for row := 0; row < batch.Len(); row++ {
+                for i, partial := range partition.partials {
+                    if err := partial.add(batch, row); err != nil {
+                        fail(ctx, Error{ErrorCode: EvaluationError, Operator: "Scan", Message: fmt.Sprintf("evaluating %s", operator.names[i]), Err: err})
+                        return
+                    }
+                }
+            }
+        } else if batch.Len() > 0 && !operator.emit(ctx, operator.sink, batch) {
+            return
         }
-        operator.collector.AddValue(field, engine.NewGeoPointValue(lat, lon))
+        partition.records += uint64(batch.Len())
+        partition.bytes += bytes
     }
-    return true
+}
+
+func (operator *ScanOperator) Close() {
+    operator.halt()
+    operator.wait()
+}
+
+// processor returns the visitor that decodes the stored fields of a hit into the collector of a
+// partition.
+func (operator *ScanOperator) processor(partition *scanPartition) func(string, []byte) bool {
+    collector := partition.collector
+    return func(field string, value []byte) bool {
+        if field == "_id" || field == ast.ScoreColumn {
+            return true
+        }
+        if operator.decoded != nil && !operator.decoded[field] {
+            partition.skipped += uint64(len(value))
+            return true
+        }
+        cmd, ok := operator.table.Columns[field]
+        if !ok {
+            collector.Err = fmt.Errorf("unknown field '%s'", field)
+            return false
+        }
+
+        switch cmd.ColumnType {
+        case types.TEXT, types.KEYWORD:
+            collector.AddValue(field, engine.NewStringValue(string(value)))
+        case types.FLOAT:
+            v, err := bluge.DecodeNumericFloat64(value)
+            if err != nil {
+                collector.Err = fmt.Errorf("error decoding numeric value of field '%s': %w", field, err)
+                return false
+            }
+            collector.AddValue(field, engine.NewFloatValue(v))
+        case types.INTEGER:
+            v, err := bluge.DecodeNumericFloat64(value)
+            if err != nil {
+                collector.Err = fmt.Errorf("error decoding numeric value of field '%s': %w", field, err)
+                return false
+            }
+            collector.AddValue(field, engine.NewIntValue(int64(v)))
+        case types.DATETIME:
+            v, err := bluge.DecodeDateTime(value)
+            if err != nil {
+                collector.Err = fmt.Errorf("error decoding datetime of field '%s': %w", field, err)
+                return false
+            }
+            collector.AddValue(field, engine.NewTimeValue(v))
+        case types.GEOPOINT:
+            lon, lat, err := bluge.DecodeGeoLonLat(value)
+            if err != nil {
+                collector.Err = fmt.Errorf("error decoding geopoint of field '%s': %w", field, err)
+                return false
+            }
+            collector.AddValue(field, engine.NewGeoPointValue(lat, lon))
+        }
+        return true
+    }
+}
+
+func describeQuery(request bluge.SearchRequest) string {
+    var query bluge.Query
+    switch r := request.(type) {
+    case *bluge.AllMatches:
+        query = r.Query()
+    case *bluge.TopNSearch:
+        query = r.Query()
+    default:
+        return fmt.Sprintf("%T", request)
+    }
+    return describeSearchQuery(query)
+}
+
+func describeSearchQuery(query bluge.Query) string {
+    return strings.TrimPrefix(fmt.Sprintf("%T", query), "*bluge.")
 }
@@ -4,21 +4,32 @@ import (
     "context"
     "github.com/aleph-zero/flutterdb/engine"
     "github.com/aleph-zero/flutterdb/service/metastore"
+    "time"
 )
 
 type ShowTablesOperator struct {
     metaSvc metastore.Service
-    sink    chan *engine.Result
+    size    int
+    sink    chan *engine.Batch
+    Stats   ShowTablesOperatorStats
+    *lifecycle
 }
 
-func NewShowTablesOperator(metaSvc metastore.Service) *ShowTablesOperator {
+type ShowTablesOperatorStats struct {
+    Records uint64
+    Elapsed time.Duration
+}
+
+func NewShowTablesOperator(metaSvc metastore.Service, size int) *ShowTablesOperator {
     return &ShowTablesOperator{
-        metaSvc: metaSvc,
-        sink:    make(chan *engine.Result),
+        metaSvc:   metaSvc,
+        size:      size,
+        sink:      make(chan *engine.Batch),
+        lifecycle: newLifecycle(),
     }
 }
 
-func (operator *ShowTablesOperator) Sink() <-chan *engine.Result {
+func (operator *ShowTablesOperator) Sink() <-chan *engine.Batch {
     return operator.sink
 }
 
@@ -27,14 +38,28 @@ func (operator *ShowTablesOperator) Accept(ctx context.Context, visitor Operator
 }
 
 func (operator *ShowTablesOperator) Open(ctx context.Context) error {
-    go func() {
+    start := time.Now()
+    operator.start(func() {
         defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
         tables := operator.metaSvc.GetTables()
-        for _, table := range tables {
-            record := engine.NewRecord()
-            record.AddValue("table", engine.NewStringValue(table.TableName))
-            operator.sink <- &engine.Result{Record: record}
+        schema := engine.NewSchema([]string{"table"})
+        for start := 0; start < len(tables); start += operator.size {
+            end := min(start+operator.size, len(tables))
+            batch := engine.NewBatch(schema, end-start)
+            for _, table := range tables[start:end] {
+                batch.Append([]engine.Value{engine.NewStringValue(table.TableName)}, 0)
+            }
+            if !operator.emit(ctx, operator.sink, batch) {
+                return
+            }
+            operator.Stats.Records += uint64(batch.Len())
         }
-    }()
+    })
     return nil
 }
+
+func (operator *ShowTablesOperator) Close() {
+    operator.halt()
+    operator.wait()
+}
@@ -0,0 +1,158 @@
+package physical
+
+import (
+    "context"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "sort"
+    "strings"
+    "time"
+)
+
+// SortOperator orders the records of its child by one or more ordering terms. Sorting is a
+// blocking operation: every record is read from the child before the first is emitted.
+type SortOperator struct {
+    child       OperatorNode
+    terms       []ast.OrderingTerm
+    expressions []Expression
+    size        int
+    source      <-chan *engine.Batch
+    sink        chan *engine.Batch
+    Stats       SortOperatorStats
+    *lifecycle
+}
+
+type SortOperatorStats struct {
+    Records uint64
+    Bytes   uint64
+    Elapsed time.Duration
+}
+
+type sortable struct {
+    batch *engine.Batch
+    row   int
+    keys  []engine.Value
+}
+
+// NewSortOperator creates a sort that emits the ordered records in batches of at most size.
+func NewSortOperator(child OperatorNode, terms []ast.OrderingTerm, size int, now time.Time) *SortOperator {
+    expressions := make([]Expression, len(terms))
+    for i, term := range terms {
+        expressions[i] = Compile(term.Node, now)
+    }
+    return &SortOperator{
+        child:       child,
+        terms:       terms,
+        expressions: expressions,
+        size:        size,
+        source:      child.Sink(),
+        sink:        make(chan *engine.Batch),
+        lifecycle:   newLifecycle(),
+    }
+}
+
+func (operator *SortOperator) Sink() <-chan *engine.Batch {
+    return operator.sink
+}
+
+func (operator *SortOperator) Accept(ctx context.Context, visitor OperatorNodeVisitor) error {
+    return visitor.VisitSortOperator(ctx, operator)
+}
+
+func (operator *SortOperator) Open(ctx context.Context) error {
+    start := time.Now()
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+
+        rows := make([]sortable, 0)
+        for {
+            batch, ok := operator.next(ctx, operator.source)
+            if !ok {
+                break
+            }
+            for row := 0; row < batch.Len(); row++ {
+                keys, err := sortKeys(operator.expressions, batch, row)
+                if err != nil {
+                    fail(ctx, Error{ErrorCode: EvaluationError, Operator: "Sort", Message: fmt.Sprintf("evaluating %s", describeOrdering(operator.terms)), Err: err})
+                    return
+                }
+                rows = append(rows, sortable{batch: batch, row: row, keys: keys})
+            }
+        }
+
+        sort.SliceStable(rows, func(i, j int) bool {
+            return sortsBefore(operator.terms, rows[i].keys, rows[j].keys)
+        })
+
+        for start := 0; start < len(rows); start += operator.size {
+            end := min(start+operator.size, len(rows))
+            batch := engine.NewBatch(rows[start].batch.Schema, end-start)
+            for _, row := range rows[start:end] {
+                batch.AppendFrom(row.batch, row.row)
+            }
+            if !operator.emit(ctx, operator.sink, batch) {
+                return
+            }
+            operator.Stats.Records += uint64(batch.Len())
+            operator.Stats.Bytes += uint64(batch.Bytes())
+        }
+    })
+    return nil
+}
+
+func (operator *SortOperator) Close() {
+    operator.halt()
+    operator.child.Close()
+    operator.wait()
+}
+
+// sortKeys evaluates the ordering terms of a sort against a record of a batch. A term that reads a
+// column the record has no value for is NULL.
+func sortKeys(expressions []Expression, batch *engine.Batch, row int) ([]engine.Value, error) {
+    keys := make([]engine.Value, len(expressions))
+    for i, expression := range expressions {
+        key, err := expression(batch, row)
+        if err != nil && !missing(err) {
+            return nil, err
+        }
+        keys[i] = key
+    }
+    return keys, nil
+}
+
+// sortsBefore reports whether a record with the left keys is ordered before one with the right
+// keys by the ordering terms. NULLs are ordered after every value in both directions, as the
+// search index orders the documents without a value for a column.
+func sortsBefore(terms []ast.OrderingTerm, left, right []engine.Value) bool {
+    for i, term := range terms {
+        if l, r := left[i].IsValid(), right[i].IsValid(); !l || !r {
+            if l == r {
+                continue
+            }
+            return l
+        }
+        if comparison(&left[i], &right[i], token.EQUAL).ToBoolean() {
+            continue
+        }
+        if term.Descending {
+            return comparison(&left[i], &right[i], token.GT).ToBoolean()
+        }
+        return comparison(&left[i], &right[i], token.LT).ToBoolean()
+    }
+    return false
+}
+
+func describeOrdering(terms []ast.OrderingTerm) string {
+    descriptions := make([]string, len(terms))
+    for i, term := range terms {
+        if term.Descending {
+            descriptions[i] = term.Node.String() + " DESC"
+        } else {
+            descriptions[i] = term.Node.String() + " ASC"
+        }
+    }
+    return strings.Join(descriptions, ", ")
+}
@@ -0,0 +1,65 @@
+package physical
+
+import (
+    "context"
+    "github.com/aleph-zero/flutterdb/engine"
+    "time"
+)
+
+// SystemScanOperator emits the records of a system table, which the server produces on demand
+// rather than reading them from a search index.
+type SystemScanOperator struct {
+    table engine.SystemTable
+    size  int
+    sink  chan *engine.Batch
+    Stats SystemScanOperatorStats
+    *lifecycle
+}
+
+type SystemScanOperatorStats struct {
+    Records uint64
+    Elapsed time.Duration
+}
+
+func NewSystemScanOperator(table engine.SystemTable, size int) *SystemScanOperator {
+    return &SystemScanOperator{
+        table:     table,
+        size:      size,
+        sink:      make(chan *engine.Batch),
+        lifecycle: newLifecycle(),
+    }
+}
+
+func (operator *SystemScanOperator) Sink() <-chan *engine.Batch {
+    return operator.sink
+}
+
+func (operator *SystemScanOperator) Accept(ctx context.Context, visitor OperatorNodeVisitor) error {
+    return visitor.VisitSystemScanOperator(ctx, operator)
+}
+
+func (operator *SystemScanOperator) Open(ctx context.Context) error {
+    start := time.Now()
+    records, err := operator.table.Records(ctx)
+    if err != nil {
+        close(operator.sink)
+        return err
+    }
+
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        for _, batch := range engine.NewBatches(records, operator.size) {
+            if !operator.emit(ctx, operator.sink, batch) {
+                return
+            }
+            operator.Stats.Records += uint64(batch.Len())
+        }
+    })
+    return nil
+}
+
+func (operator *SystemScanOperator) Close() {
+    operator.halt()
+    operator.wait()
+}
@@ -0,0 +1,163 @@
+package physical
+
+import (
+    "container/heap"
+    "context"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "sort"
+    "time"
+)
+
+// TopNOperator emits the first records of its child in the order of one or more ordering terms,
+// as a sort followed by a limit would, but holds no more records than the limit while it reads
+// the child. Like a sort, it reads every record of the child before the first is emitted.
+type TopNOperator struct {
+    child       OperatorNode
+    terms       []ast.OrderingTerm
+    expressions []Expression
+    limit       uint64
+    size        int
+    source      <-chan *engine.Batch
+    sink        chan *engine.Batch
+    Stats       TopNOperatorStats
+    *lifecycle
+}
+
+type TopNOperatorStats struct {
+    Records uint64
+    Bytes   uint64
+    Elapsed time.Duration
+}
+
+// candidate is a record held by a top-N. Its values are copied out of the batch it was read from,
+// so that the batch is not retained. Ties between records with the same keys are broken by the
+// order they were read in, as a stable sort breaks them.
+type candidate struct {
+    values []engine.Value
+    size   int
+    keys   []engine.Value
+    seq    uint64
+}
+
+// candidates is a heap of the records held by a top-N, with the record ordered last at its root,
+// so that it is the one a record ordered before it replaces.
+type candidates struct {
+    terms []ast.OrderingTerm
+    items []*candidate
+}
+
+func (c *candidates) before(left, right *candidate) bool {
+    if sortsBefore(c.terms, left.keys, right.keys) {
+        return true
+    }
+    return !sortsBefore(c.terms, right.keys, left.keys) && left.seq < right.seq
+}
+
+func (c *candidates) Len() int           { return len(c.items) }
+func (c *candidates) Less(i, j int) bool { return c.before(c.items[j], c.items[i]) }
+func (c *candidates) Swap(i, j int)      { c.items[i], c.items[j] = c.items[j], c.items[i] }
+func (c *candidates) Push(x any)         { c.items = append(c.items, x.(*candidate)) }
+func (c *candidates) Pop() any {
+    last := c.items[len(c.items)-1]
+    c.items = c.items[:len(c.items)-1]
+    return last
+}
+
+// NewTopNOperator creates a top-N that emits at most limit ordered records in batches of at most
+// size.
+func NewTopNOperator(child OperatorNode, terms []ast.OrderingTerm, limit uint64, size int, now time.Time) *TopNOperator {
+    expressions := make([]Expression, len(terms))
+    for i, term := range terms {
+        expressions[i] = Compile(term.Node, now)
+    }
+    return &TopNOperator{
+        child:       child,
+        terms:       terms,
+        expressions: expressions,
+        limit:       limit,
+        size:        size,
+        source:      child.Sink(),
+        sink:        make(chan *engine.Batch),
+        lifecycle:   newLifecycle(),
+    }
+}
+
+func (operator *TopNOperator) Sink() <-chan *engine.Batch {
+    return operator.sink
+}
+
+func (operator *TopNOperator) Accept(ctx context.Context, visitor OperatorNodeVisitor) error {
+    return visitor.VisitTopNOperator(ctx, operator)
+}
+
+func (operator *TopNOperator) Open(ctx context.Context) error {
+    start := time.Now()
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        defer operator.child.Close()
+
+        held := &candidates{terms: operator.terms}
+        var schema *engine.Schema
+        var seq uint64
+        for operator.limit > 0 {
+            batch, ok := operator.next(ctx, operator.source)
+            if !ok {
+                break
+            }
+            schema = batch.Schema
+            for row := 0; row < batch.Len(); row, seq = row+1, seq+1 {
+                keys, err := sortKeys(operator.expressions, batch, row)
+                if err != nil {
+                    fail(ctx, Error{ErrorCode: EvaluationError, Operator: "TopN", Message: fmt.Sprintf("evaluating %s", describeOrdering(operator.terms)), Err: err})
+                    return
+                }
+                if uint64(held.Len()) < operator.limit {
+                    values := make([]engine.Value, len(batch.Vectors))
+                    heap.Push(held, operator.hold(batch, row, values, keys, seq))
+                    continue
+                }
+                // the record replaces the last one held only if it is ordered before it; a tie
+                // keeps the record that was read first
+                if last := held.items[0]; sortsBefore(operator.terms, keys, last.keys) {
+                    held.items[0] = operator.hold(batch, row, last.values, keys, seq)
+                    heap.Fix(held, 0)
+                }
+            }
+        }
+
+        sort.Slice(held.items, func(i, j int) bool {
+            return held.before(held.items[i], held.items[j])
+        })
+
+        for start := 0; start < len(held.items); start += operator.size {
+            end := min(start+operator.size, len(held.items))
+            batch := engine.NewBatch(schema, end-start)
+            for _, candidate := range held.items[start:end] {
+                batch.Append(candidate.values, candidate.size)
+            }
+            if !operator.emit(ctx, operator.sink, batch) {
+                return
+            }
+            operator.Stats.Records += uint64(batch.Len())
+            operator.Stats.Bytes += uint64(batch.Bytes())
+        }
+    })
+    return nil
+}
+
+func (operator *TopNOperator) Close() {
+    operator.halt()
+    operator.child.Close()
+    operator.wait()
+}
+
+// hold holds a record of a batch as a candidate, copying its values into the given slice.
+func (operator *TopNOperator) hold(batch *engine.Batch, row int, values []engine.Value, keys []engine.Value, seq uint64) *candidate {
+    for i, vector := range batch.Vectors {
+        values[i] = vector[row]
+    }
+    return &candidate{values: values, size: batch.Sizes[row], keys: keys, seq: seq}
+}
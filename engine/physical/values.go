@@ -0,0 +1,59 @@
+package physical
+
+import (
+    "context"
+    "github.com/aleph-zero/flutterdb/engine"
+    "time"
+)
+
+// ValuesOperator emits a single record without columns, so that a SELECT without a FROM clause
+// evaluates its select list exactly once, or no record at all if it is empty.
+type ValuesOperator struct {
+    empty bool
+    sink  chan *engine.Batch
+    Stats ValuesOperatorStats
+    *lifecycle
+}
+
+type ValuesOperatorStats struct {
+    Records uint64
+    Elapsed time.Duration
+}
+
+func NewValuesOperator(empty bool) *ValuesOperator {
+    return &ValuesOperator{
+        empty:     empty,
+        sink:      make(chan *engine.Batch),
+        lifecycle: newLifecycle(),
+    }
+}
+
+func (operator *ValuesOperator) Sink() <-chan *engine.Batch {
+    return operator.sink
+}
+
+func (operator *ValuesOperator) Accept(ctx context.Context, visitor OperatorNodeVisitor) error {
+    return visitor.VisitValuesOperator(ctx, operator)
+}
+
+func (operator *ValuesOperator) Open(ctx context.Context) error {
+    start := time.Now()
+    operator.start(func() {
+        defer close(operator.sink)
+        defer func() { operator.Stats.Elapsed = time.Since(start) }()
+        if operator.empty {
+            return
+        }
+        batch := engine.NewBatch(engine.NewSchema(nil), 1)
+        batch.Append(nil, 0)
+        if operator.emit(ctx, operator.sink, batch) {
+            operator.Stats.Records++
+        }
+    })
+    return nil
+}
+
+func (operator *ValuesOperator) Close() {
+    operator.halt()
+    operator.wait()
+}
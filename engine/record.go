@@ -4,11 +4,16 @@ import (
     "context"
     "encoding/json"
     "fmt"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "github.com/blugelabs/bluge/search"
+    "github.com/blugelabs/bluge/search/highlight"
     "github.com/google/uuid"
     "math"
     "sort"
     "strconv"
     "strings"
+    "sync"
     "time"
     "unicode/utf8"
 )
@@ -33,35 +38,110 @@ func QueryIdFromContext(ctx context.Context) string {
     return v
 }
 
+// HitCollector gathers the stored fields of search hits into batches of records laid out by
+// a schema, and sends every full batch to its consumer.
 type HitCollector struct {
-    record *Record
-    Bytes  int
-    Err    error
-    ch     chan *Result
-}
-
-func NewHitCollector() *HitCollector {
+    schema      *Schema
+    size        int
+    batch       *Batch
+    row         []Value // values of the hit being collected, one for every column of the schema
+    Bytes       int
+    Err         error
+    ch          chan *Batch
+    done        chan struct{}
+    stop        sync.Once
+    highlights  []string
+    highlighter *highlight.SimpleHighlighter
+}
+
+// NewHitCollector creates a collector that sends batches of at most size records. Fields that
+// are not columns of the schema are dropped.
+func NewHitCollector(schema *Schema, size int) *HitCollector {
     return &HitCollector{
-        record: NewRecord(),
-        ch:     make(chan *Result),
+        schema: schema,
+        size:   size,
+        batch:  NewBatch(schema, size),
+        row:    make([]Value, schema.Len()),
+        ch:     make(chan *Batch),
+        done:   make(chan struct{}),
     }
 }
 
-func (hc *HitCollector) Source() <-chan *Result {
+func (hc *HitCollector) Source() <-chan *Batch {
     return hc.ch
 }
 
-func (hc *HitCollector) Emit() {
-    hc.ch <- &Result{Record: hc.record, Bytes: hc.Bytes, Error: hc.Err}
-    hc.record = NewRecord()
+// Emit adds the current hit to the batch being collected, and sends the batch to the consumer
+// of the collector once it is full or the hit could not be collected. It reports false if the
+// consumer has stopped the collector, in which case the search should not produce more hits.
+func (hc *HitCollector) Emit() bool {
+    hc.batch.Append(hc.row, hc.Bytes)
+    hc.batch.Error = hc.Err
+    clear(hc.row)
+    if hc.batch.Len() < hc.size && hc.Err == nil {
+        return true
+    }
+    return hc.flush()
+}
+
+func (hc *HitCollector) flush() bool {
+    select {
+    case hc.ch <- hc.batch:
+        hc.batch = NewBatch(hc.schema, hc.size)
+        hc.Err = nil
+        return true
+    case <-hc.done:
+        return false
+    }
 }
 
+// Close sends the batch collected so far, unless it is empty or the collector has been stopped,
+// and tells the consumer that there are no more batches.
 func (hc *HitCollector) Close() {
+    if hc.batch.Len() > 0 {
+        hc.flush()
+    }
     close(hc.ch)
 }
 
+// Stop tells the search feeding the collector that its consumer wants no more hits. It may be
+// called more than once, and from a goroutine other than the one running the search.
+func (hc *HitCollector) Stop() {
+    hc.stop.Do(func() { close(hc.done) })
+}
+
+// SetHighlights requests highlighted fragments for the given TEXT fields. Hits must then
+// carry term locations, which are turned into fragments by Highlight.
+func (hc *HitCollector) SetHighlights(fields []string) {
+    hc.highlights = fields
+    hc.highlighter = highlight.NewHTMLHighlighter()
+}
+
+// Highlight adds the best matching fragment of every highlighted field to the current record.
+// It must be called after the stored fields of the hit have been added.
+func (hc *HitCollector) Highlight(match *search.DocumentMatch) {
+    if len(hc.highlights) == 0 {
+        return
+    }
+    if match.Locations == nil {
+        match.Complete(nil)
+    }
+    for _, field := range hc.highlights {
+        fragment := ""
+        if i, ok := hc.schema.Index(field); ok {
+            if value, ok := hc.row[i].StringVal(); ok {
+                fragment = hc.highlighter.BestFragment(match.Locations[field], []byte(value))
+            }
+        }
+        hc.AddValue(ast.HighlightColumn(field), NewStringValue(fragment))
+    }
+}
+
+// AddValue sets a field of the current hit.
 func (hc *HitCollector) AddValue(name string, value Value) {
-    hc.record.AddValue(name, value)
+    if i, ok := hc.schema.Index(name); ok {
+        hc.row[i] = value
+    }
 }
 
 type Result struct {
@@ -114,6 +194,9 @@ type GeoPointValue struct {
     lon float64
 }
 
+func (g GeoPointValue) Lat() float64 { return g.lat }
+func (g GeoPointValue) Lon() float64 { return g.lon }
+
 type Kind uint8
 
 const (
@@ -124,6 +207,7 @@ const (
     DateTime
     GeoPoint
     Boolean
+    Interval
 )
 
 func (k Kind) String() string {
@@ -140,6 +224,8 @@ func (k Kind) String() string {
         return "geopoint"
     case Boolean:
         return "boolean"
+    case Interval:
+        return "interval"
     default:
         return "invalid"
     }
@@ -155,6 +241,7 @@ type Value struct {
     t time.Time
     g GeoPointValue
     b bool
+    d types.Interval
 }
 
 // --- Constructors ---
@@ -164,6 +251,9 @@ func NewIntValue(v int64) Value      { return Value{k: Int, i: v} }
 func NewFloatValue(v float64) Value  { return Value{k: Float, f: v} }
 func NewBooleanValue(v bool) Value   { return Value{k: Boolean, b: v} }
 func NewTimeValue(v time.Time) Value { return Value{k: DateTime, t: v} }
+func NewIntervalValue(v types.Interval) Value {
+    return Value{k: Interval, d: v}
+}
 func NewGeoPointValue(lat, lon float64) Value {
     return Value{k: GeoPoint, g: GeoPointValue{lat: lat, lon: lon}}
 }
@@ -283,12 +373,13 @@ func (v Value) ToBoolean() bool {
 
 // --- Accessors (type-safe) ---
 
-func (v Value) StringVal() (string, bool)          { return v.s, v.k == String }
-func (v Value) IntVal() (int64, bool)              { return v.i, v.k == Int }
-func (v Value) FloatVal() (float64, bool)          { return v.f, v.k == Float }
-func (v Value) BooleanVal() (bool, bool)           { return v.b, v.k == Boolean }
-func (v Value) TimeVal() (time.Time, bool)         { return v.t, v.k == DateTime }
-func (v Value) GeoPointVal() (GeoPointValue, bool) { return v.g, v.k == GeoPoint }
+func (v Value) StringVal() (string, bool)           { return v.s, v.k == String }
+func (v Value) IntVal() (int64, bool)               { return v.i, v.k == Int }
+func (v Value) FloatVal() (float64, bool)           { return v.f, v.k == Float }
+func (v Value) BooleanVal() (bool, bool)            { return v.b, v.k == Boolean }
+func (v Value) TimeVal() (time.Time, bool)          { return v.t, v.k == DateTime }
+func (v Value) GeoPointVal() (GeoPointValue, bool)  { return v.g, v.k == GeoPoint }
+func (v Value) IntervalVal() (types.Interval, bool) { return v.d, v.k == Interval }
 
 // Must* helpers (panic on mismatch) — use carefully.
 
@@ -344,6 +435,8 @@ func (v Value) String() string {
         return v.t.Format(time.RFC3339Nano)
     case GeoPoint:
         return fmt.Sprintf("%.6f,%.6f", v.g.lat, v.g.lon)
+    case Interval:
+        return v.d.String()
     default:
         return "<invalid>"
     }
@@ -366,6 +459,8 @@ func (v Value) Equal(u Value) bool {
         return v.t.Equal(u.t)
     case GeoPoint:
         return v.g.lat == u.g.lat && v.g.lon == u.g.lon
+    case Interval:
+        return v.d == u.d
     default:
         return true // both invalid
     }
@@ -394,6 +489,8 @@ func (v Value) MarshalJSON() ([]byte, error) {
         w.Value = v.t.Format(time.RFC3339Nano)
     case GeoPoint:
         w.Value = map[string]float64{"lat": v.g.lat, "lon": v.g.lon}
+    case Interval:
+        w.Value = v.d.String()
     default:
         w.Kind = "invalid"
     }
@@ -530,6 +627,18 @@ func (v *Value) UnmarshalJSON(data []byte) error {
         }
         return fmt.Errorf("value(kind=geopoint) must be {\"lat\":..,\"lon\":..} or [lat,lon]")
 
+    case Interval:
+        // Quantity and unit pairs, e.g. "1 day 2 hours"
+        var s string
+        if err := json.Unmarshal(w.Value, &s); err != nil {
+            return fmt.Errorf("value(kind=interval) must be a string: %w", err)
+        }
+        d, err := types.ParseInterval(s)
+        if err != nil {
+            return fmt.Errorf("value(kind=interval) %w", err)
+        }
+        out.d = d
+
     case Invalid:
         // Allow {"kind":"invalid"} for explicit invalid values
         out = Value{}
@@ -555,6 +664,8 @@ func parseKind(s string) (Kind, error) {
         return GeoPoint, nil
     case "boolean", "bool":
         return Boolean, nil
+    case "interval":
+        return Interval, nil
     case "invalid":
         return Invalid, nil
     default:
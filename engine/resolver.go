@@ -1,10 +1,15 @@
 package engine
 
 import (
+    "errors"
     "fmt"
     "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
+    "github.com/aleph-zero/flutterdb/engine/types"
     "github.com/aleph-zero/flutterdb/service/metastore"
+    "sort"
     "strings"
+    "time"
 )
 
 func ResolveSymbols(meta metastore.Service, root ast.VisitableNode) (*metastore.SymbolTable, error) {
@@ -17,11 +22,15 @@ func ResolveSymbols(meta metastore.Service, root ast.VisitableNode) (*metastore.
         return nil, fmt.Errorf("resolving table names: %w", err)
     }
 
-    c := ColumnIdentifierResolver{symbols}
+    c := ColumnIdentifierResolver{SymbolTable: symbols}
     if err := root.Accept(&c); err != nil {
         return nil, fmt.Errorf("resolving column names: %w", err)
     }
 
+    if err := root.Accept(&TypeChecker{}); err != nil {
+        return nil, fmt.Errorf("checking types: %w", err)
+    }
+
     return symbols, nil
 }
 
@@ -34,6 +43,15 @@ type TableIdentifierResolver struct {
 
 func (t *TableIdentifierResolver) VisitTableIdentifierNode(node *ast.TableIdentifierNode) error {
     table, err := t.meta.GetTable(node.Value)
+    if errors.Is(err, metastore.Error{ErrorCode: metastore.NoSuchTable}) {
+        tables := t.meta.GetTables()
+        names := make([]string, len(tables))
+        for i, table := range tables {
+            names[i] = table.TableName
+        }
+        return diagnostic.New(diagnostic.UnknownTable, node.Position, "table '%s' does not exist", node.Value).
+            WithSuggestions(node.Value, names)
+    }
     if err != nil {
         return err
     }
@@ -47,6 +65,7 @@ func (t *TableIdentifierResolver) VisitTableIdentifierNode(node *ast.TableIdenti
                 ColumnType: c.ColumnType,
             })
         }
+        sort.Slice(columns, func(i, j int) bool { return columns[i].ColumnName < columns[j].ColumnName })
 
         entry := metastore.TableScopeSymbolTableEntry{
             TableName:          table.TableName,
@@ -70,6 +89,18 @@ func (t *TableIdentifierResolver) VisitCreateTableStatementNode(*ast.CreateTable
 func (t *TableIdentifierResolver) VisitShowTablesStatementNode(*ast.ShowTablesStatementNode) error {
     return nil
 }
+func (t *TableIdentifierResolver) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    return node.Statement.Accept(t)
+}
+func (t *TableIdentifierResolver) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return node.Statement.Accept(t)
+}
+func (t *TableIdentifierResolver) VisitExecuteStatementNode(*ast.ExecuteStatementNode) error {
+    return nil
+}
+func (t *TableIdentifierResolver) VisitDeallocateStatementNode(*ast.DeallocateStatementNode) error {
+    return nil
+}
 func (t *TableIdentifierResolver) VisitColumnDefinitionNode(*ast.ColumnDefinitionNode) error {
     return nil
 }
@@ -88,18 +119,33 @@ func (t *TableIdentifierResolver) VisitBinaryExpressionNode(*ast.BinaryExpressio
 func (t *TableIdentifierResolver) VisitStringLiteralNode(*ast.StringLiteralNode) error     { return nil }
 func (t *TableIdentifierResolver) VisitIntegerLiteralNode(*ast.IntegerLiteralNode) error   { return nil }
 func (t *TableIdentifierResolver) VisitFloatLiteralNode(*ast.FloatLiteralNode) error       { return nil }
+func (t *TableIdentifierResolver) VisitBooleanLiteralNode(*ast.BooleanLiteralNode) error   { return nil }
 func (t *TableIdentifierResolver) VisitAsteriskLiteralNode(*ast.AsteriskLiteralNode) error { return nil }
+func (t *TableIdentifierResolver) VisitPlaceholderNode(*ast.PlaceholderNode) error         { return nil }
+func (t *TableIdentifierResolver) VisitTimestampLiteralNode(*ast.TimestampLiteralNode) error {
+    return nil
+}
+func (t *TableIdentifierResolver) VisitIntervalLiteralNode(*ast.IntervalLiteralNode) error {
+    return nil
+}
 func (t *TableIdentifierResolver) VisitLimitNode(*ast.LimitNode) error                     { return nil }
+func (t *TableIdentifierResolver) VisitOrderByNode(*ast.OrderByNode) error                 { return nil }
+func (t *TableIdentifierResolver) VisitFunctionCallNode(*ast.FunctionCallNode) error       { return nil }
 
 /* *** Column Identifier Resolver *** */
 
 type ColumnIdentifierResolver struct {
     SymbolTable *metastore.SymbolTable
+    highlight   bool // HIGHLIGHT may only appear as a top-level projection
+    aggregate   bool // neither may aggregate functions
 }
 
 func (c *ColumnIdentifierResolver) VisitSelectStatementNode(node *ast.SelectStatementNode) error {
     if len(node.Expressions) == 1 {
         if _, ok := node.Expressions[0].(*ast.AsteriskLiteralNode); ok {
+            if node.Table == nil {
+                return errors.New("SELECT * requires a FROM clause")
+            }
             columns := make([]ast.ExpressionNode, 0)
             for _, tableScopeSymbol := range c.SymbolTable.TableScopeSymbols {
                 for _, columnScopeSymbol := range tableScopeSymbol.ColumnScopeSymbols {
@@ -111,14 +157,42 @@ func (c *ColumnIdentifierResolver) VisitSelectStatementNode(node *ast.SelectStat
     }
 
     for _, expr := range node.Expressions {
+        if fn, ok := expr.(*ast.FunctionCallNode); ok && fn.Name == ast.FunctionHighlight {
+            c.highlight = true
+        }
+        c.aggregate = ast.IsAggregate(expr)
         if err := expr.Accept(c); err != nil {
             return err
         }
+        c.highlight = false
+        c.aggregate = false
+    }
+    if aggregates := ast.Aggregates(node.Expressions); aggregates != nil {
+        // without GROUP BY, a select list with an aggregate function produces a single row
+        for _, expr := range node.Expressions {
+            if !ast.IsAggregate(expr) {
+                return fmt.Errorf("'%s' must be an aggregate function in a select list with one", expr.String())
+            }
+        }
+        if node.OrderBy != nil {
+            return errors.New("ORDER BY cannot be combined with aggregate functions")
+        }
+    }
+    if err := node.Predicate.Accept(c); err != nil {
+        return err
     }
-    return node.Predicate.Accept(c)
+    return node.OrderBy.Accept(c)
 }
 
 func (c *ColumnIdentifierResolver) VisitColumnIdentifierNode(node *ast.ColumnIdentifierNode) error {
+    if node.Value == ast.ScoreColumn {
+        node.ResolvedColumnSymbol = &metastore.ColumnScopeSymbolTableEntry{
+            ColumnName: ast.ScoreColumn,
+            ColumnType: types.FLOAT,
+        }
+        return nil
+    }
+
     for _, entry := range c.SymbolTable.TableScopeSymbols {
         for _, columnScopeSymbol := range entry.ColumnScopeSymbols {
             if node.Value == columnScopeSymbol.ColumnName {
@@ -128,13 +202,22 @@ func (c *ColumnIdentifierResolver) VisitColumnIdentifierNode(node *ast.ColumnIde
     }
 
     if node.ResolvedColumnSymbol == nil {
-        return fmt.Errorf("column '%s' does not exist in table list\n", node.Value)
+        names := []string{ast.ScoreColumn}
+        for _, entry := range c.SymbolTable.TableScopeSymbols {
+            for _, columnScopeSymbol := range entry.ColumnScopeSymbols {
+                names = append(names, columnScopeSymbol.ColumnName)
+            }
+        }
+        return diagnostic.New(diagnostic.UnknownColumn, node.Position, "column '%s' does not exist", node.Value).
+            WithSuggestions(node.Value, names)
     }
     return nil
 }
 
+// VisitAsteriskLiteralNode rejects '*' as the argument of any function but COUNT. The '*' of
+// SELECT * has been expanded into the columns of the table by the time it would be visited.
 func (c *ColumnIdentifierResolver) VisitAsteriskLiteralNode(*ast.AsteriskLiteralNode) error {
-    return nil
+    return fmt.Errorf("'*' is only allowed as the select list or the argument of '%s'", ast.FunctionCount)
 }
 
 func (c *ColumnIdentifierResolver) VisitBinaryExpressionNode(node *ast.BinaryExpressionNode) error {
@@ -144,6 +227,82 @@ func (c *ColumnIdentifierResolver) VisitBinaryExpressionNode(node *ast.BinaryExp
     return node.Right.Accept(c)
 }
 
+func (c *ColumnIdentifierResolver) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    signature, ok := ast.LookupFunction(node.Name)
+    if !ok {
+        return diagnostic.New(diagnostic.UnknownFunction, node.Position, "unknown function '%s'", node.Name).
+            WithSuggestions(node.Name, ast.FunctionNames())
+    }
+    if len(node.Arguments) < signature.MinArgs || len(node.Arguments) > signature.MaxArgs {
+        return fmt.Errorf("function '%s' expects %d argument(s), received %d",
+            node.Name, signature.MinArgs, len(node.Arguments))
+    }
+    if node.Name == ast.FunctionHighlight {
+        return c.resolveHighlight(node)
+    }
+    if signature.Aggregate {
+        return c.resolveAggregate(node)
+    }
+    for _, argument := range node.Arguments {
+        if err := argument.Accept(c); err != nil {
+            return err
+        }
+    }
+
+    switch node.Name {
+    case ast.FunctionGeoDistance, ast.FunctionGeoWithinBox:
+        column, ok := node.Arguments[0].(*ast.ColumnIdentifierNode)
+        if !ok || column.ResolvedColumnSymbol.ColumnType != types.GEOPOINT {
+            return fmt.Errorf("first argument of '%s' must be a GEOPOINT column, received '%s'",
+                node.Name, node.Arguments[0].String())
+        }
+    case ast.FunctionDateTrunc:
+        unit, ok := node.Arguments[0].(*ast.StringLiteralNode)
+        if !ok {
+            return fmt.Errorf("first argument of '%s' must be a string, received '%s'", node.Name, node.Arguments[0].String())
+        }
+        if _, err := types.TruncateTime(unit.Value, time.Time{}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *ColumnIdentifierResolver) resolveAggregate(node *ast.FunctionCallNode) error {
+    if !c.aggregate {
+        return fmt.Errorf("aggregate function '%s' is only allowed as a column in the select list", node.Name)
+    }
+    c.aggregate = false
+
+    if _, ok := node.Arguments[0].(*ast.AsteriskLiteralNode); ok {
+        if node.Name != ast.FunctionCount {
+            return fmt.Errorf("argument of '%s' must be an expression, received '*'", node.Name)
+        }
+        return nil
+    }
+    return node.Arguments[0].Accept(c)
+}
+
+func (c *ColumnIdentifierResolver) resolveHighlight(node *ast.FunctionCallNode) error {
+    if !c.highlight {
+        return fmt.Errorf("function '%s' is only allowed as a column in the select list", node.Name)
+    }
+    c.highlight = false
+
+    column, ok := node.Arguments[0].(*ast.ColumnIdentifierNode)
+    if !ok {
+        return fmt.Errorf("argument of '%s' must be a column, received '%s'", node.Name, node.Arguments[0].String())
+    }
+    if err := column.Accept(c); err != nil {
+        return err
+    }
+    if column.ResolvedColumnSymbol.ColumnType != types.TEXT {
+        return fmt.Errorf("function '%s' requires a TEXT column, '%s' is %s",
+            node.Name, column.Value, column.ResolvedColumnSymbol.ColumnType)
+    }
+    return nil
+}
+
 func (c *ColumnIdentifierResolver) VisitStringLiteralNode(*ast.StringLiteralNode) error { return nil }
 func (c *ColumnIdentifierResolver) VisitIntegerLiteralNode(node *ast.IntegerLiteralNode) error {
     return nil
@@ -151,6 +310,18 @@ func (c *ColumnIdentifierResolver) VisitIntegerLiteralNode(node *ast.IntegerLite
 func (c *ColumnIdentifierResolver) VisitFloatLiteralNode(node *ast.FloatLiteralNode) error {
     return nil
 }
+func (c *ColumnIdentifierResolver) VisitBooleanLiteralNode(node *ast.BooleanLiteralNode) error {
+    return nil
+}
+func (c *ColumnIdentifierResolver) VisitPlaceholderNode(node *ast.PlaceholderNode) error {
+    return nil
+}
+func (c *ColumnIdentifierResolver) VisitTimestampLiteralNode(node *ast.TimestampLiteralNode) error {
+    return nil
+}
+func (c *ColumnIdentifierResolver) VisitIntervalLiteralNode(node *ast.IntervalLiteralNode) error {
+    return nil
+}
 func (c *ColumnIdentifierResolver) VisitTableIdentifierNode(*ast.TableIdentifierNode) error {
     return nil
 }
@@ -192,8 +363,33 @@ func (c *ColumnIdentifierResolver) VisitShowTablesStatementNode(node *ast.ShowTa
     return nil
 }
 
+func (c *ColumnIdentifierResolver) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    return node.Statement.Accept(c)
+}
+
+func (c *ColumnIdentifierResolver) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return node.Statement.Accept(c)
+}
+
+func (c *ColumnIdentifierResolver) VisitExecuteStatementNode(node *ast.ExecuteStatementNode) error {
+    return nil
+}
+
+func (c *ColumnIdentifierResolver) VisitDeallocateStatementNode(node *ast.DeallocateStatementNode) error {
+    return nil
+}
+
 func (c *ColumnIdentifierResolver) VisitColumnDefinitionNode(node *ast.ColumnDefinitionNode) error {
     return nil
 }
 
+func (c *ColumnIdentifierResolver) VisitOrderByNode(node *ast.OrderByNode) error {
+    for _, term := range node.Terms {
+        if err := term.Node.Accept(c); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
 func (c *ColumnIdentifierResolver) VisitLimitNode(node *ast.LimitNode) error { return nil }
@@ -1,7 +1,10 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"github.com/aleph-zero/flutterdb/engine/ast"
+	"github.com/aleph-zero/flutterdb/engine/diagnostic"
 	"github.com/aleph-zero/flutterdb/engine/parser"
 	"github.com/aleph-zero/flutterdb/engine/types"
 	"github.com/aleph-zero/flutterdb/service/metastore"
@@ -17,13 +20,13 @@ func TestResolver_ValidSymbols(t *testing.T) {
 
 	symbols := metastore.SymbolTable{
 		TableScopeSymbols: map[string]metastore.TableScopeSymbolTableEntry{
-			"t1": {"t1", []metastore.ColumnScopeSymbolTableEntry{
-				{"t1", "c1", types.KEYWORD},
-				{"t1", "c2", types.TEXT},
-				{"t1", "c3", types.INTEGER},
-				{"t1", "c4", types.FLOAT},
-				{"t1", "c5", types.GEOPOINT},
-				{"t1", "c6", types.DATETIME},
+			"t1": {TableName: "t1", ColumnScopeSymbols: []metastore.ColumnScopeSymbolTableEntry{
+				{TableName: "t1", ColumnName: "c1", ColumnType: types.KEYWORD},
+				{TableName: "t1", ColumnName: "c2", ColumnType: types.TEXT},
+				{TableName: "t1", ColumnName: "c3", ColumnType: types.INTEGER},
+				{TableName: "t1", ColumnName: "c4", ColumnType: types.FLOAT},
+				{TableName: "t1", ColumnName: "c5", ColumnType: types.GEOPOINT},
+				{TableName: "t1", ColumnName: "c6", ColumnType: types.DATETIME},
 			}},
 		}}
 
@@ -32,12 +35,17 @@ func TestResolver_ValidSymbols(t *testing.T) {
 		st   metastore.SymbolTable
 	}{
 		{`SELECT c1 FROM t1`, symbols},
-		{`SELECT c2 FROM t1 WHERE c2 = 4`, symbols},
+		{`SELECT c2 FROM t1 WHERE c2 = 'a'`, symbols},
 		{`SELECT c2 FROM t1 WHERE c4 = 4.5`, symbols},
-		{`SELECT c1 FROM t1 WHERE c2 = 4 OR c3 = 'a'`, symbols},
+		{`SELECT c1 FROM t1 WHERE c2 = 'a' OR c3 = 4`, symbols},
 		{`SELECT * FROM t1`, symbols},
-
-		// TODO - Must also test for invalid comparisons, e.g. string > numeric
+		{`SELECT c1, _score FROM t1 WHERE MATCH(c2, 'apple')`, symbols},
+		{`SELECT c1 FROM t1 WHERE match_phrase(c2, 'red apple') ORDER BY _score DESC, c3`, symbols},
+		{`SELECT c1, HIGHLIGHT(c2) FROM t1 WHERE MATCH(c2, 'apple')`, symbols},
+		{`SELECT c1, GEO_DISTANCE(c5, 40.7, -74.0) FROM t1 WHERE GEO_WITHIN_BOX(c5, 45, -80, 40, -70)`, symbols},
+		{`SELECT EXTRACT(YEAR FROM c6) FROM t1 WHERE c6 > NOW() - INTERVAL '7 days'`, symbols},
+		{`SELECT DATE_TRUNC('week', c6) FROM t1 WHERE c6 < DATE '2024-01-01'`, symbols},
+		{`SELECT COUNT(*), MIN(c3), MAX(c6 + INTERVAL '1 day') FROM t1 WHERE c3 > 1 LIMIT 1`, symbols},
 	}
 
 	for _, tt := range tests {
@@ -81,6 +89,29 @@ func TestResolver_InvalidSymbols(t *testing.T) {
 		{`SELECT c5 FROM t2`},
 		{`SELECT c1, x FROM t1`},
 		{`SELECT c1 FROM t1 WHERE x = 5`},
+		{`SELECT c1 FROM t1 WHERE MATCH(x, 'apple')`},
+		{`SELECT c1 FROM t1 WHERE MATCH(c2)`},
+		{`SELECT c1 FROM t1 WHERE FUZZY(c2, 'apple')`},
+		{`SELECT c1 FROM t1 ORDER BY x`},
+		{`SELECT HIGHLIGHT(c1) FROM t1 WHERE MATCH(c1, 'a')`},
+		{`SELECT HIGHLIGHT(c2, c1) FROM t1 WHERE MATCH(c2, 'a')`},
+		{`SELECT c1 FROM t1 WHERE HIGHLIGHT(c2) = 'a'`},
+		{`SELECT c1 FROM t1 WHERE MATCH(c2, 'a') ORDER BY HIGHLIGHT(c2)`},
+		{`SELECT HIGHLIGHT(HIGHLIGHT(c2)) FROM t1 WHERE MATCH(c2, 'a')`},
+		{`SELECT c1 FROM t1 WHERE GEO_DISTANCE(c1, 40.7, -74.0) < '10km'`},
+		{`SELECT c1 FROM t1 WHERE GEO_WITHIN_BOX(c5, 45, -80, 40)`},
+		{`SELECT DATE_TRUNC('fortnight', c6) FROM t1`},
+		{`SELECT DATE_TRUNC(c1, c6) FROM t1`},
+		{`SELECT NOW(c6) FROM t1`},
+		{`SELECT *`},
+		{`SELECT c1, COUNT(*) FROM t1`},
+		{`SELECT COUNT(*) + 1 FROM t1`},
+		{`SELECT MIN(*) FROM t1`},
+		{`SELECT COUNT(MAX(c3)) FROM t1`},
+		{`SELECT c1 FROM t1 WHERE COUNT(*) > 1`},
+		{`SELECT COUNT(*) FROM t1 ORDER BY c1`},
+		{`SELECT COUNT(x) FROM t1`},
+		{`SELECT COUNT(c1, c3) FROM t1`},
 	}
 
 	for _, tt := range tests {
@@ -105,6 +136,130 @@ func TestResolver_InvalidSymbols(t *testing.T) {
 	}
 }
 
+func TestResolver_Diagnostics(t *testing.T) {
+	teardown, store := setupSuite(t, data)
+	defer teardown(t)
+
+	tests := []struct {
+		stmt        string
+		code        diagnostic.Code
+		column      int
+		suggestions []string
+	}{
+		{`SELECT city FROM citys`, diagnostic.UnknownTable, 18, []string{"cities"}},
+		{`SELECT city, populaton FROM cities`, diagnostic.UnknownColumn, 14, []string{"population"}},
+		{`SELECT city FROM cities ORDER BY _scor`, diagnostic.UnknownColumn, 34, []string{"_score"}},
+		{`SELECT c1 FROM t1 WHERE MATC(c2, 'apple')`, diagnostic.UnknownFunction, 25, []string{"MATCH"}},
+		{`SELECT zzz FROM t1`, diagnostic.UnknownColumn, 8, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			root, err := parser.ParseStatement(tt.stmt)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			_, err = ResolveSymbols(store, root)
+			var d *diagnostic.Diagnostic
+			if !errors.As(err, &d) {
+				t.Fatalf("expected a diagnostic, received %v", err)
+			}
+			if d.Code != tt.code || d.Line != 1 || d.Column != tt.column {
+				t.Errorf("expected %s at 1:%d, received %s at %d:%d", tt.code, tt.column, d.Code, d.Line, d.Column)
+			}
+			if diff := cmp.Diff(tt.suggestions, d.Suggestions); diff != "" {
+				t.Errorf("unexpected suggestions (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResolver_TypeErrors(t *testing.T) {
+	teardown, store := setupSuite(t, data)
+	defer teardown(t)
+
+	tests := []struct {
+		stmt   string
+		column int
+	}{
+		{`SELECT 'abc' + 1`, 14},
+		{`SELECT c1 FROM t1 WHERE c2 > 5`, 28},
+		{`SELECT c1 FROM t1 WHERE c3 = 'a'`, 28},
+		{`SELECT c3 * c1 FROM t1`, 11},
+		{`SELECT -c1 FROM t1`, 8},
+		{`SELECT c1 FROM t1 WHERE c3 LIKE 'a%'`, 28},
+		{`SELECT c1 FROM t1 WHERE c6 > 'yesterday'`, 28},
+		{`SELECT c1 FROM t1 WHERE c6 * INTERVAL '1 day' > NOW()`, 28},
+		{`SELECT c1 FROM t1 WHERE NOT c6`, 25},
+		{`SELECT c1 FROM t1 WHERE c6`, 25},
+		{`SELECT EXTRACT(YEAR FROM c3) FROM t1`, 8},
+		{`SELECT c1 FROM t1 WHERE MATCH(c2, 5)`, 25},
+		{`SELECT c1 FROM t1 WHERE c3 = 1 AND c6`, 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			root, err := parser.ParseStatement(tt.stmt)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			_, err = ResolveSymbols(store, root)
+			var d *diagnostic.Diagnostic
+			if !errors.As(err, &d) {
+				t.Fatalf("expected a diagnostic, received %v", err)
+			}
+			if d.Code != diagnostic.TypeError || d.Line != 1 || d.Column != tt.column {
+				t.Errorf("expected %s at 1:%d, received %s at %d:%d (%s)",
+					diagnostic.TypeError, tt.column, d.Code, d.Line, d.Column, d.Message)
+			}
+		})
+	}
+}
+
+func TestResolver_InferredTypes(t *testing.T) {
+	teardown, store := setupSuite(t, data)
+	defer teardown(t)
+
+	tests := []struct {
+		stmt     string
+		expected types.Type
+	}{
+		{`SELECT 1 + 2 FROM t1`, types.INTEGER},
+		{`SELECT c3 / 2 FROM t1`, types.INTEGER},
+		{`SELECT c3 * c4 FROM t1`, types.FLOAT},
+		{`SELECT -(c4) FROM t1`, types.FLOAT},
+		{`SELECT c3 > 1 OR NOT c1 = 'a' FROM t1`, types.BOOLEAN},
+		{`SELECT c6 + INTERVAL '1 day' FROM t1`, types.DATETIME},
+		{`SELECT NOW() - c6 FROM t1`, types.INTERVAL},
+		{`SELECT EXTRACT(YEAR FROM c6) FROM t1`, types.INTEGER},
+		{`SELECT GEO_DISTANCE(c5, 40.7, -74.0) FROM t1`, types.FLOAT},
+		{`SELECT c2 FROM t1`, types.TEXT},
+		{`SELECT COUNT(c6) FROM t1`, types.INTEGER},
+		{`SELECT MAX(c4) FROM t1`, types.FLOAT},
+		{`SELECT MIN(c6) FROM t1`, types.DATETIME},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			root, err := parser.ParseStatement(tt.stmt)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if _, err = ResolveSymbols(store, root); err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			expression := root.(*ast.SelectStatementNode).Expressions[0]
+			received, ok := ast.TypeOf(expression)
+			if !ok || received != tt.expected {
+				t.Errorf("expected %s to be %s, received %s", expression, tt.expected, received)
+			}
+		})
+	}
+}
+
 func setupSuite(tb testing.TB, testdata string) (func(tb testing.TB), metastore.Service) {
 	ms := metastore.NewService(testdata)
 	if err := ms.Open(); err != nil {
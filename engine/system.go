@@ -0,0 +1,19 @@
+package engine
+
+import (
+    "context"
+    "github.com/aleph-zero/flutterdb/service/metastore"
+)
+
+// SystemTable is a read-only table whose records are produced by the server on demand rather
+// than read from a search index.
+type SystemTable interface {
+    Metadata() *metastore.TableMetadata
+    Records(ctx context.Context) ([]*Record, error)
+}
+
+// SystemTableProvider is implemented by a metastore that also serves system tables. The tables
+// are resolved like any other through GetTable, and scanned through the provider.
+type SystemTableProvider interface {
+    SystemTable(name string) (SystemTable, bool)
+}
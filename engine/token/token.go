@@ -1,6 +1,9 @@
 package token
 
-import "text/scanner"
+import (
+    "strings"
+    "text/scanner"
+)
 
 type Token struct {
     TokenType
@@ -29,6 +32,8 @@ const (
     L_PAREN
     R_PAREN
     BANG
+    PLACEHOLDER
+    SEMICOLON
 
     /* sql keyword token types */
 
@@ -41,9 +46,23 @@ const (
     PARTITION
     BY
     ORDER
+    ASC
+    DESC
     LIKE
     SHOW
     TABLES
+    EXPLAIN
+    ANALYZE
+    FORMAT
+    TIMESTAMP
+    DATE
+    INTERVAL
+    PREPARE
+    EXECUTE
+    DEALLOCATE
+    AS
+    TRUE
+    FALSE
 
     /* arithmetic token types */
 
@@ -87,6 +106,8 @@ func (t TokenType) String() string {
         "L_PAREN",
         "R_PAREN",
         "BANG",
+        "PLACEHOLDER",
+        "SEMICOLON",
         "SELECT",
         "FROM",
         "WHERE",
@@ -96,9 +117,23 @@ func (t TokenType) String() string {
         "PARTITION",
         "BY",
         "ORDER",
+        "ASC",
+        "DESC",
         "LIKE",
         "SHOW",
         "TABLES",
+        "EXPLAIN",
+        "ANALYZE",
+        "FORMAT",
+        "TIMESTAMP",
+        "DATE",
+        "INTERVAL",
+        "PREPARE",
+        "EXECUTE",
+        "DEALLOCATE",
+        "AS",
+        "TRUE",
+        "FALSE",
         "ASTERISK",
         "PLUS",
         "MINUS",
@@ -115,3 +150,56 @@ func (t TokenType) String() string {
         "NOT",
         "EOF"}[t]
 }
+
+var keywords = map[string]TokenType{
+    "SELECT":     SELECT,
+    "FROM":       FROM,
+    "WHERE":      WHERE,
+    "CREATE":     CREATE,
+    "TABLE":      TABLE,
+    "LIMIT":      LIMIT,
+    "PARTITION":  PARTITION,
+    "BY":         BY,
+    "ORDER":      ORDER,
+    "ASC":        ASC,
+    "DESC":       DESC,
+    "LIKE":       LIKE,
+    "SHOW":       SHOW,
+    "TABLES":     TABLES,
+    "EXPLAIN":    EXPLAIN,
+    "ANALYZE":    ANALYZE,
+    "FORMAT":     FORMAT,
+    "TIMESTAMP":  TIMESTAMP,
+    "DATE":       DATE,
+    "INTERVAL":   INTERVAL,
+    "PREPARE":    PREPARE,
+    "EXECUTE":    EXECUTE,
+    "DEALLOCATE": DEALLOCATE,
+    "AS":         AS,
+    "TRUE":       TRUE,
+    "FALSE":      FALSE,
+    "AND":        AND,
+    "OR":         OR,
+    "NOT":        NOT,
+    "TEXT":       TEXT,
+    "KEYWORD":    KEYWORD,
+    "INTEGER":    INTEGER,
+    "FLOAT":      FLOAT,
+    "DATETIME":   DATETIME,
+    "GEOPOINT":   GEOPOINT,
+}
+
+// LookupKeyword returns the token type of a reserved word, matched case-insensitively.
+func LookupKeyword(ident string) (TokenType, bool) {
+    tokenType, ok := keywords[strings.ToUpper(ident)]
+    return tokenType, ok
+}
+
+// Keywords returns the reserved words of the language.
+func Keywords() []string {
+    words := make([]string, 0, len(keywords))
+    for word := range keywords {
+        words = append(words, word)
+    }
+    return words
+}
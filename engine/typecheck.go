@@ -0,0 +1,330 @@
+package engine
+
+import (
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
+    "github.com/aleph-zero/flutterdb/engine/token"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "text/scanner"
+)
+
+/* *** Type Checker *** */
+
+// TypeChecker infers the result type of every expression of a resolved statement and rejects
+// operators and function calls applied to operands of the wrong type. Literals and columns carry
+// their types already; the inferred types of operators and function calls are recorded in their
+// ResolvedType fields. Expressions whose type cannot be known until execution, such as unbound
+// parameters, are accepted as they are.
+type TypeChecker struct{}
+
+func (c *TypeChecker) VisitSelectStatementNode(node *ast.SelectStatementNode) error {
+    for _, expr := range node.Expressions {
+        if err := expr.Accept(c); err != nil {
+            return err
+        }
+    }
+    if err := node.Predicate.Accept(c); err != nil {
+        return err
+    }
+    return node.OrderBy.Accept(c)
+}
+
+func (c *TypeChecker) VisitPredicateNode(node *ast.PredicateNode) error {
+    if err := node.Node.Accept(c); err != nil {
+        return err
+    }
+    if t, ok := ast.TypeOf(node.Node); ok && !isTruthValue(t) {
+        return diagnostic.New(diagnostic.TypeError, position(node.Node),
+            "WHERE clause must be a truth value, '%s' is %s", node.Node.String(), t)
+    }
+    return nil
+}
+
+func (c *TypeChecker) VisitOrderByNode(node *ast.OrderByNode) error {
+    for _, term := range node.Terms {
+        if err := term.Node.Accept(c); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *TypeChecker) VisitParenthesizedExpression(node *ast.ParenthesizedExpressionNode) error {
+    if err := node.Node.Accept(c); err != nil {
+        return err
+    }
+    if t, ok := ast.TypeOf(node.Node); ok {
+        node.ResolvedType = &t
+    }
+    return nil
+}
+
+func (c *TypeChecker) VisitLogicalNegationNode(node *ast.LogicalNegationNode) error {
+    if err := node.Node.Accept(c); err != nil {
+        return err
+    }
+    if t, ok := ast.TypeOf(node.Node); ok && !isTruthValue(t) {
+        return diagnostic.New(diagnostic.TypeError, node.Op.Position,
+            "operator 'NOT' requires a truth value, '%s' is %s", node.Node.String(), t)
+    }
+    node.ResolvedType = typeRef(types.BOOLEAN)
+    return nil
+}
+
+func (c *TypeChecker) VisitUnaryExpressionNode(node *ast.UnaryExpressionNode) error {
+    if err := node.Node.Accept(c); err != nil {
+        return err
+    }
+    t, ok := ast.TypeOf(node.Node)
+    if !ok {
+        return nil
+    }
+    if !t.IsNumeric() {
+        return diagnostic.New(diagnostic.TypeError, node.Op.Position,
+            "operator '%s' requires a numeric operand, '%s' is %s", node.Op.Lexeme, node.Node.String(), t)
+    }
+    node.ResolvedType = &t
+    return nil
+}
+
+func (c *TypeChecker) VisitBinaryExpressionNode(node *ast.BinaryExpressionNode) error {
+    if err := node.Left.Accept(c); err != nil {
+        return err
+    }
+    if err := node.Right.Accept(c); err != nil {
+        return err
+    }
+
+    switch node.Op.TokenType {
+    case token.EQUAL, token.NOT_EQUAL, token.GT, token.GTE, token.LT, token.LTE, token.LIKE,
+        token.AND, token.OR:
+        node.ResolvedType = typeRef(types.BOOLEAN)
+    }
+
+    left, lok := ast.TypeOf(node.Left)
+    right, rok := ast.TypeOf(node.Right)
+    if !lok || !rok {
+        return nil
+    }
+
+    switch node.Op.TokenType {
+    case token.EQUAL, token.NOT_EQUAL, token.GT, token.GTE, token.LT, token.LTE:
+        if comparableTypes(node, left, right) {
+            return nil
+        }
+    case token.LIKE:
+        if left.IsString() && right.IsString() {
+            return nil
+        }
+    case token.AND, token.OR:
+        if isTruthValue(left) && isTruthValue(right) {
+            return nil
+        }
+    default:
+        if t, ok := arithmeticType(node.Op.TokenType, left, right); ok {
+            node.ResolvedType = &t
+            return nil
+        }
+    }
+    return diagnostic.New(diagnostic.TypeError, node.Op.Position,
+        "operator '%s' cannot be applied to %s and %s", operator(node.Op), left, right)
+}
+
+// comparableTypes reports whether the operands of a comparison can be compared. Timestamps may
+// be compared with strings in one of the layouts accepted by TIMESTAMP literals, and GEO_DISTANCE
+// with a distance such as '10km'.
+func comparableTypes(node *ast.BinaryExpressionNode, left, right types.Type) bool {
+    switch {
+    case left.IsNumeric() && right.IsNumeric():
+        return true
+    case left.IsString() && right.IsString():
+        return true
+    case left == types.BOOLEAN && right == types.BOOLEAN:
+        return node.Op.TokenType == token.EQUAL || node.Op.TokenType == token.NOT_EQUAL
+    case left == types.DATETIME && right == types.DATETIME:
+        return true
+    case left == types.DATETIME && right.IsString():
+        return isTimestampString(node.Right)
+    case left.IsString() && right == types.DATETIME:
+        return isTimestampString(node.Left)
+    default:
+        return ast.IsGeoDistancePredicate(node)
+    }
+}
+
+// isTruthValue reports whether values of the type can be taken as true or false. Besides
+// booleans, numbers are true if they are not zero, and strings if they spell a true value such as
+// 'yes' or a number other than zero.
+func isTruthValue(t types.Type) bool {
+    return t == types.BOOLEAN || t.IsNumeric() || t.IsString()
+}
+
+func isTimestampString(n ast.ExpressionNode) bool {
+    s, ok := n.(*ast.StringLiteralNode)
+    if !ok {
+        return false
+    }
+    _, err := types.ParseTimestamp(s.Value)
+    return err == nil
+}
+
+// arithmeticType returns the result type of an arithmetic operator, which is INTEGER if both
+// operands are integers and FLOAT for any other pair of numbers. Intervals may be added to and
+// subtracted from timestamps and other intervals, and timestamps subtracted from one another.
+func arithmeticType(op token.TokenType, left, right types.Type) (types.Type, bool) {
+    switch {
+    case left == types.INTEGER && right == types.INTEGER:
+        return types.INTEGER, true
+    case left.IsNumeric() && right.IsNumeric():
+        return types.FLOAT, true
+    case op != token.PLUS && op != token.MINUS:
+        return 0, false
+    case left == types.DATETIME && right == types.INTERVAL:
+        return types.DATETIME, true
+    case left == types.INTERVAL && right == types.DATETIME && op == token.PLUS:
+        return types.DATETIME, true
+    case left == types.DATETIME && right == types.DATETIME && op == token.MINUS:
+        return types.INTERVAL, true
+    case left == types.INTERVAL && right == types.INTERVAL:
+        return types.INTERVAL, true
+    default:
+        return 0, false
+    }
+}
+
+func (c *TypeChecker) VisitFunctionCallNode(node *ast.FunctionCallNode) error {
+    for _, argument := range node.Arguments {
+        if err := argument.Accept(c); err != nil {
+            return err
+        }
+    }
+
+    var result types.Type
+    switch node.Name {
+    case ast.FunctionMatch, ast.FunctionMatchPhrase, ast.FunctionMatchQuery:
+        if err := c.arguments(node, 1, types.KEYWORD); err != nil {
+            return err
+        }
+        result = types.BOOLEAN
+    case ast.FunctionGeoWithinBox:
+        if err := c.arguments(node, 1, types.FLOAT); err != nil {
+            return err
+        }
+        result = types.BOOLEAN
+    case ast.FunctionGeoDistance:
+        if err := c.arguments(node, 1, types.FLOAT); err != nil {
+            return err
+        }
+        result = types.FLOAT
+    case ast.FunctionHighlight:
+        result = types.TEXT
+    case ast.FunctionNow:
+        result = types.DATETIME
+    case ast.FunctionDateTrunc:
+        if err := c.arguments(node, 1, types.DATETIME); err != nil {
+            return err
+        }
+        result = types.DATETIME
+    case ast.FunctionExtract:
+        if err := c.arguments(node, 1, types.DATETIME); err != nil {
+            return err
+        }
+        result = types.INTEGER
+    case ast.FunctionCount:
+        result = types.INTEGER
+    case ast.FunctionMin, ast.FunctionMax:
+        t, ok := ast.TypeOf(node.Arguments[0])
+        if !ok {
+            return nil
+        }
+        result = t
+    default:
+        return nil
+    }
+    node.ResolvedType = &result
+    return nil
+}
+
+// arguments checks that the arguments of a function call from the given index onwards are of the
+// expected type. Any string or number satisfies KEYWORD or FLOAT respectively.
+func (c *TypeChecker) arguments(node *ast.FunctionCallNode, from int, expected types.Type) error {
+    for _, argument := range node.Arguments[from:] {
+        t, ok := ast.TypeOf(argument)
+        if !ok {
+            continue
+        }
+        switch {
+        case expected.IsString() && t.IsString():
+        case expected.IsNumeric() && t.IsNumeric():
+        case expected == t:
+        default:
+            return diagnostic.New(diagnostic.TypeError, node.Position,
+                "function '%s' requires a %s argument, '%s' is %s", node.Name, expected, argument.String(), t)
+        }
+    }
+    return nil
+}
+
+func (c *TypeChecker) VisitExplainStatementNode(node *ast.ExplainStatementNode) error {
+    return node.Statement.Accept(c)
+}
+
+func (c *TypeChecker) VisitPrepareStatementNode(node *ast.PrepareStatementNode) error {
+    return node.Statement.Accept(c)
+}
+
+func (c *TypeChecker) VisitColumnIdentifierNode(*ast.ColumnIdentifierNode) error   { return nil }
+func (c *TypeChecker) VisitStringLiteralNode(*ast.StringLiteralNode) error         { return nil }
+func (c *TypeChecker) VisitIntegerLiteralNode(*ast.IntegerLiteralNode) error       { return nil }
+func (c *TypeChecker) VisitFloatLiteralNode(*ast.FloatLiteralNode) error           { return nil }
+func (c *TypeChecker) VisitBooleanLiteralNode(*ast.BooleanLiteralNode) error       { return nil }
+func (c *TypeChecker) VisitTimestampLiteralNode(*ast.TimestampLiteralNode) error   { return nil }
+func (c *TypeChecker) VisitIntervalLiteralNode(*ast.IntervalLiteralNode) error     { return nil }
+func (c *TypeChecker) VisitPlaceholderNode(*ast.PlaceholderNode) error             { return nil }
+func (c *TypeChecker) VisitAsteriskLiteralNode(*ast.AsteriskLiteralNode) error     { return nil }
+func (c *TypeChecker) VisitTableIdentifierNode(*ast.TableIdentifierNode) error     { return nil }
+func (c *TypeChecker) VisitColumnDefinitionNode(*ast.ColumnDefinitionNode) error   { return nil }
+func (c *TypeChecker) VisitLimitNode(*ast.LimitNode) error                         { return nil }
+func (c *TypeChecker) VisitShowTablesStatementNode(*ast.ShowTablesStatementNode) error {
+    return nil
+}
+func (c *TypeChecker) VisitCreateTableStatementNode(*ast.CreateTableStatementNode) error {
+    return nil
+}
+func (c *TypeChecker) VisitExecuteStatementNode(*ast.ExecuteStatementNode) error {
+    return nil
+}
+func (c *TypeChecker) VisitDeallocateStatementNode(*ast.DeallocateStatementNode) error {
+    return nil
+}
+
+func typeRef(t types.Type) *types.Type {
+    return &t
+}
+
+func operator(op token.Token) string {
+    if op.Lexeme != "" {
+        return op.Lexeme
+    }
+    return op.TokenType.String()
+}
+
+// position returns where an expression appears in the statement, as far as it is known.
+func position(n ast.ExpressionNode) scanner.Position {
+    switch v := n.(type) {
+    case *ast.ColumnIdentifierNode:
+        return v.Position
+    case *ast.FunctionCallNode:
+        return v.Position
+    case *ast.BinaryExpressionNode:
+        return v.Op.Position
+    case *ast.UnaryExpressionNode:
+        return v.Op.Position
+    case *ast.LogicalNegationNode:
+        return v.Op.Position
+    case *ast.ParenthesizedExpressionNode:
+        return position(v.Node)
+    default:
+        return scanner.Position{}
+    }
+}
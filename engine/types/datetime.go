@@ -0,0 +1,186 @@
+package types
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// timestampLayouts are the layouts accepted by TIMESTAMP and DATE literals and by comparisons
+// between DATETIME values and strings. Timestamps without a zone are interpreted as UTC.
+var timestampLayouts = []string{
+    time.RFC3339Nano,
+    time.DateTime,
+    "2006-01-02T15:04:05",
+    time.DateOnly,
+}
+
+// ParseTimestamp parses a timestamp in one of the supported layouts.
+func ParseTimestamp(s string) (time.Time, error) {
+    s = strings.TrimSpace(s)
+    for _, layout := range timestampLayouts {
+        if t, err := time.Parse(layout, s); err == nil {
+            return t, nil
+        }
+    }
+    return time.Time{}, fmt.Errorf("invalid timestamp '%s'", s)
+}
+
+// ParseDate parses a date in the YYYY-MM-DD layout.
+func ParseDate(s string) (time.Time, error) {
+    t, err := time.Parse(time.DateOnly, strings.TrimSpace(s))
+    if err != nil {
+        return time.Time{}, fmt.Errorf("invalid date '%s'", s)
+    }
+    return t, nil
+}
+
+// Interval is a span of calendar time. Months and days are kept apart from the clock duration
+// because their length depends on the timestamp they are added to.
+type Interval struct {
+    Months   int
+    Days     int
+    Duration time.Duration
+}
+
+// ParseInterval parses a list of quantity and unit pairs, such as '7 days' or
+// '1 year 2 months 3 hours'. Units may be singular or plural.
+func ParseInterval(s string) (Interval, error) {
+    fields := strings.Fields(s)
+    if len(fields) == 0 || len(fields)%2 != 0 {
+        return Interval{}, fmt.Errorf("invalid interval '%s'", s)
+    }
+
+    var interval Interval
+    for i := 0; i < len(fields); i += 2 {
+        n, err := strconv.Atoi(fields[i])
+        if err != nil {
+            return Interval{}, fmt.Errorf("invalid interval quantity '%s' in '%s'", fields[i], s)
+        }
+        switch strings.TrimSuffix(strings.ToLower(fields[i+1]), "s") {
+        case "year":
+            interval.Months += 12 * n
+        case "month":
+            interval.Months += n
+        case "week":
+            interval.Days += 7 * n
+        case "day":
+            interval.Days += n
+        case "hour":
+            interval.Duration += time.Duration(n) * time.Hour
+        case "minute":
+            interval.Duration += time.Duration(n) * time.Minute
+        case "second":
+            interval.Duration += time.Duration(n) * time.Second
+        default:
+            return Interval{}, fmt.Errorf("invalid interval unit '%s' in '%s'", fields[i+1], s)
+        }
+    }
+    return interval, nil
+}
+
+// AddTo returns t shifted forward by the interval.
+func (i Interval) AddTo(t time.Time) time.Time {
+    return t.AddDate(0, i.Months, i.Days).Add(i.Duration)
+}
+
+// Negate returns the interval pointing in the opposite direction.
+func (i Interval) Negate() Interval {
+    return Interval{Months: -i.Months, Days: -i.Days, Duration: -i.Duration}
+}
+
+// Add returns the sum of two intervals.
+func (i Interval) Add(j Interval) Interval {
+    return Interval{Months: i.Months + j.Months, Days: i.Days + j.Days, Duration: i.Duration + j.Duration}
+}
+
+func (i Interval) String() string {
+    var parts []string
+    add := func(n int64, unit string) {
+        if n == 0 {
+            return
+        }
+        if n != 1 && n != -1 {
+            unit += "s"
+        }
+        parts = append(parts, fmt.Sprintf("%d %s", n, unit))
+    }
+
+    add(int64(i.Months/12), "year")
+    add(int64(i.Months%12), "month")
+    add(int64(i.Days), "day")
+    d := i.Duration
+    add(int64(d/time.Hour), "hour")
+    add(int64(d%time.Hour/time.Minute), "minute")
+    add(int64(d%time.Minute/time.Second), "second")
+    if len(parts) == 0 {
+        return "0 seconds"
+    }
+    return strings.Join(parts, " ")
+}
+
+// TruncateTime truncates a timestamp to the start of the given unit: year, quarter, month,
+// week (starting on Monday), day, hour, minute or second.
+func TruncateTime(unit string, t time.Time) (time.Time, error) {
+    switch strings.ToLower(unit) {
+    case "year":
+        return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location()), nil
+    case "quarter":
+        month := time.Month((int(t.Month())-1)/3*3 + 1)
+        return time.Date(t.Year(), month, 1, 0, 0, 0, 0, t.Location()), nil
+    case "month":
+        return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()), nil
+    case "week":
+        day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+        return day.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7)), nil
+    case "day":
+        return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+    case "hour":
+        return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()), nil
+    case "minute":
+        return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location()), nil
+    case "second":
+        return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, t.Location()), nil
+    default:
+        return time.Time{}, fmt.Errorf("invalid DATE_TRUNC unit '%s'", unit)
+    }
+}
+
+// ValidExtractField reports whether EXTRACT supports the given field.
+func ValidExtractField(field string) bool {
+    _, err := ExtractField(field, time.Time{})
+    return err == nil
+}
+
+// ExtractField returns a field of a timestamp: YEAR, QUARTER, MONTH, WEEK (ISO week), DAY,
+// DOW (0 for Sunday), DOY, HOUR, MINUTE, SECOND or EPOCH (seconds since the Unix epoch).
+func ExtractField(field string, t time.Time) (int64, error) {
+    switch strings.ToUpper(field) {
+    case "YEAR":
+        return int64(t.Year()), nil
+    case "QUARTER":
+        return int64((t.Month()-1)/3 + 1), nil
+    case "MONTH":
+        return int64(t.Month()), nil
+    case "WEEK":
+        _, week := t.ISOWeek()
+        return int64(week), nil
+    case "DAY":
+        return int64(t.Day()), nil
+    case "DOW":
+        return int64(t.Weekday()), nil
+    case "DOY":
+        return int64(t.YearDay()), nil
+    case "HOUR":
+        return int64(t.Hour()), nil
+    case "MINUTE":
+        return int64(t.Minute()), nil
+    case "SECOND":
+        return int64(t.Second()), nil
+    case "EPOCH":
+        return t.Unix(), nil
+    default:
+        return 0, fmt.Errorf("invalid EXTRACT field '%s'", field)
+    }
+}
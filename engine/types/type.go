@@ -15,11 +15,15 @@ const (
     FLOAT
     GEOPOINT
     DATETIME
+
+    // BOOLEAN and INTERVAL are only the result types of expressions; columns cannot hold them.
+    BOOLEAN
+    INTERVAL
 )
 
 func (t Type) String() string {
-    names := [...]string{"KEYWORD", "TEXT", "INTEGER", "FLOAT", "GEOPOINT", "DATETIME"}
-    if t < KEYWORD || t > DATETIME {
+    names := [...]string{"KEYWORD", "TEXT", "INTEGER", "FLOAT", "GEOPOINT", "DATETIME", "BOOLEAN", "INTERVAL"}
+    if t < KEYWORD || t > INTERVAL {
         return fmt.Sprintf("Type(%d)", t)
     }
     return names[t]
@@ -29,6 +33,16 @@ func (t Type) GoString() string {
     return "types." + t.String()
 }
 
+// IsNumeric reports whether values of the type take part in arithmetic.
+func (t Type) IsNumeric() bool {
+    return t == INTEGER || t == FLOAT
+}
+
+// IsString reports whether values of the type are strings.
+func (t Type) IsString() bool {
+    return t == KEYWORD || t == TEXT
+}
+
 func New(t string) (Type, error) {
     switch strings.ToUpper(t) {
     case "KEYWORD":
@@ -5,6 +5,7 @@ import (
     "errors"
     "fmt"
     "github.com/aleph-zero/flutterdb/api"
+    "github.com/aleph-zero/flutterdb/engine/physical"
     "github.com/aleph-zero/flutterdb/service/cluster"
     "github.com/aleph-zero/flutterdb/service/identity"
     "github.com/aleph-zero/flutterdb/service/index"
@@ -39,6 +40,7 @@ type Config struct {
     Port            uint16
     ClusterConfig   *ClusterConfig
     MetastoreConfig *metastore.Config
+    Parallelism     int
 }
 
 type Option func(*Config)
@@ -75,6 +77,14 @@ func WithMetastoreConfig(metastoreConfig *metastore.Config) Option {
     }
 }
 
+// WithParallelism sets the number of goroutines the scans of a statement read the search index
+// on, unless the statement asks for another number.
+func WithParallelism(parallelism int) Option {
+    return func(c *Config) {
+        c.Parallelism = parallelism
+    }
+}
+
 /* *** Cluster Config *** */
 
 type ClusterConfig struct {
@@ -183,8 +193,13 @@ func Bootstrap(config *Config) {
         router.Get("/membership", handler.GetMembership)
     }
     {
-        handler := api.NewQueryHandler(query.NewService(metaSvc, indexSvc))
+        handler := api.NewQueryHandler(query.NewService(metaSvc, indexSvc, physical.WithParallelism(config.Parallelism)))
         router.Get("/sql", handler.Query)
+        router.Post("/sql", handler.QueryWithParameters)
+        router.Post("/sql/script", handler.Script)
+        router.Post("/sql/format", handler.Format)
+        router.Get("/sql/stats", handler.Statistics)
+        router.Delete("/sql/stats", handler.ResetStatistics)
     }
     {
         handler := api.NewMetastoreHandler(metaSvc)
@@ -216,5 +231,9 @@ func Bootstrap(config *Config) {
         logger.ErrorContext(ctx, "Error shutting down server", "err", err)
         os.Exit(1)
     }
+    if err := indexSvc.Close(); err != nil {
+        logger.ErrorContext(ctx, "Error closing index service", "err", err)
+        os.Exit(1)
+    }
     logger.InfoContext(ctx, "Server shutdown complete")
 }
@@ -4,75 +4,301 @@ import (
 	"context"
 	"fmt"
 	"github.com/aleph-zero/flutterdb/engine"
+	"github.com/aleph-zero/flutterdb/engine/ast"
 	"github.com/aleph-zero/flutterdb/engine/types"
 	"github.com/aleph-zero/flutterdb/service/metastore"
 	"github.com/aleph-zero/flutterdb/telemetry"
 	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/search"
 	log "github.com/go-chi/httplog/v2"
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Service interface {
 	Index(ctx context.Context, table string, documents []*Document) (*DocumentIndexResult, error)
 	Search(ctx context.Context, table string, request bluge.SearchRequest, collector *engine.HitCollector, processor func(string, []byte) bool) error
+	SearchParallel(ctx context.Context, table string, request bluge.SearchRequest, partitions []Partition) error
+	// Count returns the number of documents in the index of a table.
+	Count(ctx context.Context, table string) (uint64, error)
+	// Aggregate matches the hits of a request and returns their aggregations, without reading the
+	// stored fields of any hit.
+	Aggregate(ctx context.Context, table string, request *bluge.AllMatches) (*search.Bucket, error)
+	// Close closes the writers and readers of every table. The service cannot be used once it
+	// is closed.
+	Close() error
 }
 
 type ServiceProvider struct {
-	meta metastore.Service
+	meta    metastore.Service
+	indexes *manager
 }
 
 func NewService(meta metastore.Service) *ServiceProvider {
 	return &ServiceProvider{
-		meta: meta,
+		meta:    meta,
+		indexes: newManager(),
 	}
 }
 
+func (s *ServiceProvider) Close() error {
+	return s.indexes.Close()
+}
+
 func (s *ServiceProvider) Search(ctx context.Context, table string, request bluge.SearchRequest, collector *engine.HitCollector, processor func(string, []byte) bool) error {
 	ctx, span := telemetry.StartSpan(ctx, "index.Search", trace.WithAttributes(attribute.String("queryId", engine.QueryIdFromContext(ctx))))
 	defer span.End()
 	log.LogEntry(ctx).Info("Executing search", "table", table)
 
-	tbl, err := s.meta.GetTable(table)
+	defer collector.Close()
+
+	reader, closer, err := s.openReader(ctx, table)
 	if err != nil {
 		return err
 	}
+	defer closer()
 
-	reader, closer, err := newIndexReader(tbl.Directory)
+	dmi, err := reader.Search(ctx, request)
+	if err != nil {
+		log.LogEntry(ctx).Error("Error searching index", "table", table, "error", err)
+		return err
+	}
+
+	return collect(ctx, table, dmi, collector, processor)
+}
+
+// Partition is the share of a parallel search read by one worker: the stored fields of the hits
+// the worker matches are passed to Processor and collected by Collector.
+type Partition struct {
+	Collector *engine.HitCollector
+	Processor func(string, []byte) bool
+}
+
+// SearchParallel searches like Search, but on one worker goroutine for every partition. The
+// documents of the reader are split into as many ranges of document numbers as there are
+// partitions, and each worker matches, scores and reads the stored fields of the hits in its own
+// range with its own iterator over the same reader, so the partitions receive the hits in no
+// particular order. The ranges are split by the number of live documents, so deleted documents
+// not yet merged away make them uneven. The search stops once the consumers of every partition
+// have stopped, and the first error of a worker stops the others.
+func (s *ServiceProvider) SearchParallel(ctx context.Context, table string, request bluge.SearchRequest, partitions []Partition) error {
+	ctx, span := telemetry.StartSpan(ctx, "index.SearchParallel", trace.WithAttributes(
+		attribute.String("queryId", engine.QueryIdFromContext(ctx)),
+		attribute.Int("workers", len(partitions))))
+	defer span.End()
+	log.LogEntry(ctx).Info("Executing parallel search", "table", table, "workers", len(partitions))
+
+	defer func() {
+		for _, partition := range partitions {
+			partition.Collector.Close()
+		}
+	}()
+
+	reader, closer, err := s.openReader(ctx, table)
 	if err != nil {
-		log.LogEntry(ctx).Error("Error creating index reader", "table", table, "error", err)
 		return err
 	}
 	defer closer()
 
+	count, err := reader.Count()
+	if err != nil {
+		log.LogEntry(ctx).Error("Error counting documents", "table", table, "error", err)
+		return fmt.Errorf("error counting documents: %w", err)
+	}
+	ranges := split(request, count, len(partitions))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var first error
+	var wg sync.WaitGroup
+	for i, partition := range partitions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := searchRange(ctx, reader, table, &ranges[i], partition); err != nil {
+				once.Do(func() {
+					first = err
+					cancel() // stop the other workers
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return first
+}
+
+// searchRange searches the hits of a range of document numbers into a partition.
+func searchRange(ctx context.Context, reader *bluge.Reader, table string, request *rangeRequest, partition Partition) error {
 	dmi, err := reader.Search(ctx, request)
 	if err != nil {
 		log.LogEntry(ctx).Error("Error searching index", "table", table, "error", err)
 		return err
 	}
+	return collect(ctx, table, dmi, partition.Collector, partition.Processor)
+}
 
-	next, err := dmi.Next()
+// split divides a request over the document numbers of a reader holding count live documents
+// into n ranges of about the same size, the last of which is unbounded so that no document is
+// left out.
+func split(request bluge.SearchRequest, count uint64, n int) []rangeRequest {
+	size := (count + uint64(n) - 1) / uint64(n)
+	ranges := make([]rangeRequest, n)
+	for i := range ranges {
+		ranges[i] = rangeRequest{SearchRequest: request, from: uint64(i) * size, to: uint64(i+1) * size}
+	}
+	ranges[n-1].to = math.MaxUint64
+	return ranges
+}
+
+// rangeRequest is a search request whose hits are limited to the documents numbered from 'from'
+// up to, but not including, 'to'.
+type rangeRequest struct {
+	bluge.SearchRequest
+	from, to uint64
+}
+
+func (r *rangeRequest) Searcher(reader search.Reader, config bluge.Config) (search.Searcher, error) {
+	searcher, err := r.SearchRequest.Searcher(reader, config)
+	if err != nil {
+		return nil, err
+	}
+	return &rangeSearcher{Searcher: searcher, from: r.from, to: r.to}, nil
+}
+
+// rangeSearcher matches the documents of a range. It advances to the first document of the range
+// rather than matching the documents before it, and stops at the first match past the range.
+type rangeSearcher struct {
+	search.Searcher
+	from, to uint64
+	started  bool
+	done     bool
+}
+
+func (s *rangeSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	if !s.started {
+		return s.Advance(ctx, s.from)
+	}
+	if s.done {
+		return nil, nil
+	}
+	return s.within(s.Searcher.Next(ctx))
+}
+
+func (s *rangeSearcher) Advance(ctx *search.Context, number uint64) (*search.DocumentMatch, error) {
+	s.started = true
+	if s.done {
+		return nil, nil
+	}
+	return s.within(s.Searcher.Advance(ctx, max(number, s.from)))
+}
+
+func (s *rangeSearcher) within(match *search.DocumentMatch, err error) (*search.DocumentMatch, error) {
+	if err != nil || match == nil || match.Number < s.to {
+		return match, err
+	}
+	s.done = true
+	return nil, nil
+}
+
+// collect reads the stored fields of hits into a collector until the hits are exhausted or the
+// consumer of the collector stops it.
+func collect(ctx context.Context, table string, hits search.DocumentMatchIterator, collector *engine.HitCollector, processor func(string, []byte) bool) error {
+	next, err := hits.Next()
 	for err == nil && next != nil {
 		err = next.VisitStoredFields(processor)
 		if err != nil {
-			panic("visit stored fields") // TODO XXX IMPLEMENT ME
+			log.LogEntry(ctx).Error("Error reading stored fields", "table", table, "error", err)
+			return fmt.Errorf("error reading stored fields: %w", err)
 		}
+		collector.AddValue(ast.ScoreColumn, engine.NewFloatValue(next.Score))
+		collector.Highlight(next)
 		collector.Bytes = next.Size()
-		collector.Emit()
-		next, err = dmi.Next()
+		if !collector.Emit() {
+			// the consumer is done, e.g. a LIMIT is satisfied or the query was cancelled,
+			// so stop iterating and release the reader
+			log.LogEntry(ctx).Info("Search stopped by consumer", "table", table)
+			break
+		}
+		next, err = hits.Next()
 	}
-	collector.Close()
 
 	if err != nil {
 		log.LogEntry(ctx).Error("Error iterating search results", "table", table, "error", err)
+		return fmt.Errorf("error iterating search results: %w", err)
 	}
 
 	return nil
 }
 
+func (s *ServiceProvider) Count(ctx context.Context, table string) (uint64, error) {
+	ctx, span := telemetry.StartSpan(ctx, "index.Count", trace.WithAttributes(attribute.String("queryId", engine.QueryIdFromContext(ctx))))
+	defer span.End()
+
+	reader, closer, err := s.openReader(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	defer closer()
+
+	count, err := reader.Count()
+	if err != nil {
+		log.LogEntry(ctx).Error("Error counting documents", "table", table, "error", err)
+		return 0, fmt.Errorf("error counting documents: %w", err)
+	}
+	return count, nil
+}
+
+func (s *ServiceProvider) Aggregate(ctx context.Context, table string, request *bluge.AllMatches) (*search.Bucket, error) {
+	ctx, span := telemetry.StartSpan(ctx, "index.Aggregate", trace.WithAttributes(attribute.String("queryId", engine.QueryIdFromContext(ctx))))
+	defer span.End()
+	log.LogEntry(ctx).Info("Executing aggregation", "table", table)
+
+	reader, closer, err := s.openReader(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	dmi, err := reader.Search(ctx, request)
+	if err != nil {
+		log.LogEntry(ctx).Error("Error searching index", "table", table, "error", err)
+		return nil, err
+	}
+	// the aggregations are computed as the hits are iterated
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		log.LogEntry(ctx).Error("Error iterating search results", "table", table, "error", err)
+		return nil, fmt.Errorf("error iterating search results: %w", err)
+	}
+	return dmi.Aggregations(), nil
+}
+
+func (s *ServiceProvider) openReader(ctx context.Context, table string) (*bluge.Reader, func(), error) {
+	tbl, err := s.meta.GetTable(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapshot, err := s.indexes.acquire(tbl.Directory)
+	if err != nil {
+		log.LogEntry(ctx).Error("Error creating index reader", "table", table, "error", err)
+		return nil, nil, err
+	}
+	return snapshot.reader, snapshot.release, nil
+}
+
 func (s *ServiceProvider) Index(ctx context.Context, table string, documents []*Document) (*DocumentIndexResult, error) {
 	_, span := otel.GetTracerProvider().Tracer("flutterdb").Start(ctx, "index.Index")
 	telemetry.SetAttributes(span)
@@ -89,12 +315,11 @@ func (s *ServiceProvider) Index(ctx context.Context, table string, documents []*
 	// TODO 1. test error paths
 	// TODO 2. test batching into chunks of 1000 docs
 
-	writer, closer, err := newIndexWriter(tbl.Directory)
+	writer, err := s.indexes.writer(tbl.Directory)
 	if err != nil {
 		log.LogEntry(ctx).Error("Error creating index writer", "err", err)
 		return nil, err
 	}
-	defer closer()
 
 	var errorCount = 0
 	var successCount = 0
@@ -125,6 +350,10 @@ func (s *ServiceProvider) Index(ctx context.Context, table string, documents []*
 		log.LogEntry(ctx).Error("Writing documents failed", "err", err)
 		return nil, err
 	}
+	if err := s.indexes.refresh(tbl.Directory); err != nil {
+		log.LogEntry(ctx).Error("Refreshing index reader failed", "err", err)
+		return nil, err
+	}
 
 	log.LogEntry(ctx).Info("Finished indexing documents", "table", table, "success", successCount, "errors", errorCount)
 	span.AddEvent("indexer.batch.added",
@@ -139,26 +368,14 @@ func (s *ServiceProvider) Index(ctx context.Context, table string, documents []*
 	}, nil
 }
 
-func newIndexReader(path string) (*bluge.Reader, func(), error) {
-	reader, err := bluge.OpenReader(bluge.DefaultConfig(path))
-	if err != nil {
-		return nil, nil, err
-	}
-	return reader, func() { reader.Close() }, nil
-}
-
-func newIndexWriter(path string) (*bluge.Writer, func(), error) {
-	writer, err := bluge.OpenWriter(bluge.DefaultConfig(path))
-	if err != nil {
-		return nil, nil, err
-	}
-	return writer, func() { writer.Close() }, nil
-}
-
-const defaultTextIndexingOptions = bluge.Index | bluge.Sortable | bluge.Store
+// TEXT fields are indexed with the locations of their terms, which HIGHLIGHT turns into fragments.
+// Bluge records the same locations for HighlightMatches as for SearchTermPositions, which TEXT
+// fields have always been indexed with, so indexes built before HIGHLIGHT existed need no reindex.
+const defaultTextIndexingOptions = bluge.Index | bluge.Sortable | bluge.Store | bluge.SearchTermPositions
 const defaultKeywordIndexingOptions = bluge.Index | bluge.Sortable | bluge.Store
 const defaultNumericIndexingOptions = bluge.Index | bluge.Sortable | bluge.Store | bluge.Aggregatable
 const defaultDateTimeIndexingOptions = bluge.Index | bluge.Sortable | bluge.Store | bluge.Aggregatable
+const defaultGeoPointIndexingOptions = bluge.Index | bluge.Sortable | bluge.Store
 
 func createField(name string, value interface{}, cmd metastore.ColumnMetadata) (bluge.Field, error) {
 	switch cmd.ColumnType {
@@ -203,12 +420,65 @@ func createField(name string, value interface{}, cmd metastore.ColumnMetadata) (
 		f.FieldOptions = defaultDateTimeIndexingOptions
 		return f, nil
 	case types.GEOPOINT:
-		return nil, fmt.Errorf("geopoint types are not yet supported")
+		lat, lon, err := parseGeoPoint(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse geopoint value for column '%s': %w", cmd.ColumnName, err)
+		}
+		f := bluge.NewGeoPointField(name, lon, lat)
+		f.FieldOptions = defaultGeoPointIndexingOptions
+		return f, nil
 	default:
 		return nil, fmt.Errorf("unknown column type: %s", cmd.ColumnType)
 	}
 }
 
+// parseGeoPoint accepts a geopoint as an object {"lat": .., "lon": ..}, a string "lat,lon"
+// or an array [lon, lat], the latter following the GeoJSON coordinate order.
+func parseGeoPoint(value interface{}) (lat, lon float64, err error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var ok bool
+		if lat, ok = v["lat"].(float64); !ok {
+			return 0, 0, fmt.Errorf("missing or non-numeric 'lat'")
+		}
+		if lon, ok = v["lon"].(float64); !ok {
+			return 0, 0, fmt.Errorf("missing or non-numeric 'lon'")
+		}
+	case string:
+		parts := strings.Split(v, ",")
+		if len(parts) != 2 {
+			return 0, 0, fmt.Errorf("expected \"lat,lon\", received %q", v)
+		}
+		if lat, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid latitude %q", parts[0])
+		}
+		if lon, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid longitude %q", parts[1])
+		}
+	case []interface{}:
+		if len(v) != 2 {
+			return 0, 0, fmt.Errorf("expected [lon, lat], received %d elements", len(v))
+		}
+		var ok bool
+		if lon, ok = v[0].(float64); !ok {
+			return 0, 0, fmt.Errorf("non-numeric longitude %v", v[0])
+		}
+		if lat, ok = v[1].(float64); !ok {
+			return 0, 0, fmt.Errorf("non-numeric latitude %v", v[1])
+		}
+	default:
+		return 0, 0, fmt.Errorf("unsupported geopoint value of type %T", value)
+	}
+
+	if lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("latitude %g out of range [-90, 90]", lat)
+	}
+	if lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("longitude %g out of range [-180, 180]", lon)
+	}
+	return lat, lon, nil
+}
+
 var timeLayouts = map[string]string{
 	"DateTime": time.DateTime,
 	"DateOnly": time.DateOnly,
@@ -0,0 +1,104 @@
+package index
+
+import (
+	"context"
+	"github.com/blugelabs/bluge"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseGeoPoint(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		lat   float64
+		lon   float64
+	}{
+		{map[string]interface{}{"lat": 40.7128, "lon": -74.006}, 40.7128, -74.006},
+		{"40.7128,-74.006", 40.7128, -74.006},
+		{" 40.7128 , -74.006 ", 40.7128, -74.006},
+		{[]interface{}{-74.006, 40.7128}, 40.7128, -74.006},
+	}
+
+	for _, tt := range tests {
+		lat, lon, err := parseGeoPoint(tt.value)
+		require.NoError(t, err)
+		require.Equal(t, tt.lat, lat)
+		require.Equal(t, tt.lon, lon)
+	}
+}
+
+func TestParseGeoPoint_Invalid(t *testing.T) {
+	tests := []interface{}{
+		map[string]interface{}{"lat": 40.7128},
+		map[string]interface{}{"lat": "40.7128", "lon": -74.006},
+		"40.7128",
+		"north,west",
+		[]interface{}{-74.006},
+		[]interface{}{-74.006, 91.0},
+		"40.7128,-181",
+		float64(40.7128),
+	}
+
+	for _, value := range tests {
+		_, _, err := parseGeoPoint(value)
+		require.Error(t, err, "value: %v", value)
+	}
+}
+
+func TestTextIndexingOptions_Locations(t *testing.T) {
+	// HIGHLIGHT relies on the term locations that TEXT fields have been indexed with all along
+	require.True(t, defaultTextIndexingOptions.IncludeLocations())
+}
+
+func TestSplit_PartitionsMatches(t *testing.T) {
+	svc, table := setupTable(t)
+	defer svc.Close()
+	ctx := context.Background()
+
+	// every write adds a segment, so the ranges span segments
+	for writer := range 5 {
+		_, err := svc.Index(ctx, "t", documents(writer, 7))
+		require.NoError(t, err)
+	}
+	snapshot, err := svc.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+	defer snapshot.release()
+	count, err := snapshot.reader.Count()
+	require.NoError(t, err)
+
+	queries := []bluge.Query{
+		bluge.NewMatchAllQuery(),
+		bluge.NewTermQuery("w3-d4").SetField("c1"),
+		bluge.NewWildcardQuery("w*-d2").SetField("c1"),
+	}
+	for _, query := range queries {
+		expected := numbers(t, snapshot.reader, bluge.NewAllMatches(query))
+		require.NotEmpty(t, expected)
+		for _, n := range []int{1, 2, 3, 4, 16} {
+			// every match is found in exactly one range, and only in its own
+			var received []uint64
+			for _, r := range split(bluge.NewAllMatches(query), count, n) {
+				matched := numbers(t, snapshot.reader, &r)
+				for _, number := range matched {
+					require.True(t, number >= r.from && number < r.to, "%d outside [%d, %d)", number, r.from, r.to)
+				}
+				received = append(received, matched...)
+			}
+			require.Equal(t, expected, received, "%d ranges", n)
+		}
+	}
+}
+
+// numbers returns the document numbers of the hits of a search in the order they are matched.
+func numbers(t *testing.T, reader *bluge.Reader, request bluge.SearchRequest) []uint64 {
+	dmi, err := reader.Search(context.Background(), request)
+	require.NoError(t, err)
+	var numbers []uint64
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		numbers = append(numbers, next.Number)
+		next, err = dmi.Next()
+	}
+	require.NoError(t, err)
+	return numbers
+}
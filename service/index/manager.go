@@ -0,0 +1,163 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blugelabs/bluge"
+	"sync"
+)
+
+var errManagerClosed = errors.New("index manager is closed")
+
+// manager owns the search indexes of the tables, keyed by their directory. Each table has at most
+// one writer, which is opened on the first write and kept until the manager is closed, so that
+// concurrent writes to a table share it rather than contend for the lock on its directory. Queries
+// search a reader snapshot of the table, which is shared between them and replaced after every
+// write. A snapshot is closed once it has been replaced and the last query searching it has
+// released it.
+type manager struct {
+	mu      sync.Mutex
+	indexes map[string]*tableIndex
+	closed  bool
+}
+
+type tableIndex struct {
+	directory string
+	writer    *bluge.Writer
+	current   *snapshot
+}
+
+// snapshot is a reference-counted reader of a table. The manager holds a reference to the current
+// snapshot of every table, and every query searching it holds another.
+type snapshot struct {
+	reader *bluge.Reader
+	refs   int
+	mu     *sync.Mutex // the lock of the manager, which guards refs
+}
+
+func newManager() *manager {
+	return &manager{indexes: make(map[string]*tableIndex)}
+}
+
+// acquire returns the current snapshot of the table in a directory, opening one if the table has
+// none. The caller must release the snapshot once it is done searching it.
+func (m *manager) acquire(directory string) (*snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, err := m.index(directory)
+	if err != nil {
+		return nil, err
+	}
+	if index.current == nil {
+		var reader *bluge.Reader
+		if index.writer != nil {
+			reader, err = index.writer.Reader()
+		} else {
+			reader, err = bluge.OpenReader(bluge.DefaultConfig(directory))
+		}
+		if err != nil {
+			return nil, err
+		}
+		index.current = &snapshot{reader: reader, refs: 1, mu: &m.mu}
+	}
+	index.current.refs++
+	return index.current, nil
+}
+
+// release gives up a reference to the snapshot, closing its reader if it was the last one.
+func (s *snapshot) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unref()
+}
+
+func (s *snapshot) unref() {
+	s.refs--
+	if s.refs == 0 {
+		s.reader.Close()
+	}
+}
+
+// writer returns the writer of the table in a directory, opening it on first use.
+func (m *manager) writer(directory string) (*bluge.Writer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, err := m.index(directory)
+	if err != nil {
+		return nil, err
+	}
+	if index.writer == nil {
+		if index.writer, err = bluge.OpenWriter(bluge.DefaultConfig(directory)); err != nil {
+			return nil, err
+		}
+	}
+	return index.writer, nil
+}
+
+// refresh replaces the current snapshot of the table in a directory with one that sees every
+// write made so far. Queries already searching the previous snapshot keep it until they release
+// it.
+func (m *manager) refresh(directory string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, err := m.index(directory)
+	if err != nil {
+		return err
+	}
+	if index.writer == nil {
+		return fmt.Errorf("no writer for index '%s'", directory)
+	}
+	reader, err := index.writer.Reader()
+	if err != nil {
+		return err
+	}
+	if index.current != nil {
+		index.current.unref()
+	}
+	index.current = &snapshot{reader: reader, refs: 1, mu: &m.mu}
+	return nil
+}
+
+// Close releases the snapshots and closes the writers of every table. Snapshots still being
+// searched are closed when they are released. The manager cannot be used once it is closed.
+func (m *manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	var errs []error
+	for _, index := range m.indexes {
+		if index.current != nil {
+			index.current.unref()
+			index.current = nil
+		}
+		if index.writer != nil {
+			if err := index.writer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing writer of index '%s': %w", index.directory, err))
+			}
+		}
+	}
+	clear(m.indexes)
+	return errors.Join(errs...)
+}
+
+// index returns the table in a directory, adding it if it is not yet managed. The lock of the
+// manager must be held.
+func (m *manager) index(directory string) (*tableIndex, error) {
+	if m.closed {
+		return nil, errManagerClosed
+	}
+	index, ok := m.indexes[directory]
+	if !ok {
+		index = &tableIndex{directory: directory}
+		m.indexes[directory] = index
+	}
+	return index, nil
+}
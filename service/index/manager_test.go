@@ -0,0 +1,130 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"github.com/aleph-zero/flutterdb/engine/types"
+	"github.com/aleph-zero/flutterdb/service/metastore"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestServiceProvider_ConcurrentWrites(t *testing.T) {
+	svc, table := setupTable(t)
+	defer svc.Close()
+	ctx := context.Background()
+
+	// every request shares the writer of the table rather than contending for its lock
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = svc.Index(ctx, "t", documents(i, 10))
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	snapshot, err := svc.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+	defer snapshot.release()
+	count, err := snapshot.reader.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(80), count)
+}
+
+func TestServiceProvider_SnapshotRefresh(t *testing.T) {
+	svc, table := setupTable(t)
+	defer svc.Close()
+	ctx := context.Background()
+
+	_, err := svc.Index(ctx, "t", documents(0, 5))
+	require.NoError(t, err)
+	before, err := svc.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+
+	// a write replaces the snapshot, but a query still searching the old one keeps it
+	_, err = svc.Index(ctx, "t", documents(1, 5))
+	require.NoError(t, err)
+	after, err := svc.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+	require.NotSame(t, before, after)
+
+	count, err := before.reader.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), count)
+	before.release()
+
+	count, err = after.reader.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), count)
+	after.release()
+
+	// queries between writes share a snapshot
+	first, err := svc.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+	second, err := svc.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+	require.Same(t, first, second)
+	first.release()
+	second.release()
+}
+
+func TestServiceProvider_Close(t *testing.T) {
+	svc, table := setupTable(t)
+	ctx := context.Background()
+
+	_, err := svc.Index(ctx, "t", documents(0, 5))
+	require.NoError(t, err)
+	snapshot, err := svc.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Close())
+	require.NoError(t, svc.Close())
+
+	// a snapshot being searched outlives the manager until it is released
+	count, err := snapshot.reader.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), count)
+	snapshot.release()
+
+	_, err = svc.Index(ctx, "t", documents(1, 5))
+	require.ErrorIs(t, err, errManagerClosed)
+	_, err = svc.indexes.acquire(table.Directory)
+	require.ErrorIs(t, err, errManagerClosed)
+
+	// the documents written before the service closed were persisted
+	reopened := NewService(svc.meta)
+	defer reopened.Close()
+	snapshot, err = reopened.indexes.acquire(table.Directory)
+	require.NoError(t, err)
+	defer snapshot.release()
+	count, err = snapshot.reader.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), count)
+}
+
+// setupTable creates a table 't' in a temporary metastore.
+func setupTable(t *testing.T) (*ServiceProvider, *metastore.TableMetadata) {
+	ms := metastore.NewService(t.TempDir())
+	table := metastore.NewTableMetadata("t", map[string]metastore.ColumnMetadata{
+		"c1": {ColumnName: "c1", ColumnType: types.KEYWORD},
+	}, "")
+	require.NoError(t, ms.CreateTable(context.Background(), table))
+	table, err := ms.GetTable("t")
+	require.NoError(t, err)
+	return NewService(ms), table
+}
+
+func documents(writer, count int) []*Document {
+	docs := make([]*Document, count)
+	for i := range docs {
+		docs[i] = &Document{Fields: map[string]interface{}{"c1": fmt.Sprintf("w%d-d%d", writer, i)}}
+	}
+	return docs
+}
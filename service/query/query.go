@@ -2,7 +2,10 @@ package query
 
 import (
     "context"
+    "fmt"
     "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/diagnostic"
     "github.com/aleph-zero/flutterdb/engine/logical"
     "github.com/aleph-zero/flutterdb/engine/parser"
     "github.com/aleph-zero/flutterdb/engine/physical"
@@ -12,36 +15,212 @@ import (
     log "github.com/go-chi/httplog/v2"
     "go.opentelemetry.io/otel/attribute"
     "go.opentelemetry.io/otel/trace"
+    "runtime"
     "strings"
     "time"
 )
 
 type Service interface {
-    Execute(ctx context.Context, query string) (*QueryResult, error)
+    // Execute runs a statement. Parameters are bound, in order, to the placeholders of the
+    // statement, or of the prepared statement named by an EXECUTE without arguments.
+    Execute(ctx context.Context, query string, parameters ...engine.Value) (*QueryResult, error)
+
+    // ExecuteScript runs the semicolon-separated statements of a script in order. Unless
+    // continueOnError is set it stops at the first statement that fails. The returned results
+    // cover every statement that was run; the error reports a script that fails to parse.
+    ExecuteScript(ctx context.Context, script string, continueOnError bool) ([]*StatementResult, error)
+
+    // Statistics returns the execution statistics of the statements run so far, aggregated by
+    // fingerprint and ordered by total time, the most expensive first.
+    Statistics() []*StatementStatistics
+
+    // ResetStatistics discards the execution statistics gathered so far.
+    ResetStatistics()
 }
 
 type ServiceProvider struct {
     metaSvc  metastore.Service
     indexSvc index.Service
+    sessions *sessionStore
+    stats    *statementStats
+    options  []physical.Option
 }
 
-func NewService(metaSvc metastore.Service, indexSvc index.Service) Service {
+// NewService creates a query service whose physical plans are created with the given options,
+// unless the context of a statement overrides them.
+func NewService(metaSvc metastore.Service, indexSvc index.Service, options ...physical.Option) Service {
+    stats := newStatementStats()
     return &ServiceProvider{
-        metaSvc:  metaSvc,
-        indexSvc: indexSvc}
+        metaSvc:  newCatalog(metaSvc, newStatStatementsTable(stats)),
+        indexSvc: indexSvc,
+        sessions: newSessionStore(),
+        stats:    stats,
+        options:  options}
+}
+
+type parallelismKey struct{}
+
+// WithParallelism returns a context asking for the scans of a statement to read the search index
+// on the given number of goroutines instead of the parallelism of the service. The request is
+// capped at the parallelism of the service or runtime.GOMAXPROCS(0), whichever is larger, since
+// every worker holds a batch of its own.
+func WithParallelism(ctx context.Context, workers int) context.Context {
+    return context.WithValue(ctx, parallelismKey{}, workers)
+}
+
+func ParallelismFromContext(ctx context.Context) (int, bool) {
+    workers, ok := ctx.Value(parallelismKey{}).(int)
+    return workers, ok
+}
+
+// planOptions returns the options of the service, followed by those the context of a statement
+// overrides them with.
+func (sp *ServiceProvider) planOptions(ctx context.Context) []physical.Option {
+    options := append([]physical.Option{}, sp.options...)
+    if workers, ok := ParallelismFromContext(ctx); ok {
+        limit := max(physical.NewConfig(sp.options...).Parallelism, runtime.GOMAXPROCS(0))
+        options = append(options, physical.WithParallelism(min(workers, limit)))
+    }
+    return options
 }
 
-func (sp *ServiceProvider) Execute(ctx context.Context, query string) (*QueryResult, error) {
+func (sp *ServiceProvider) Statistics() []*StatementStatistics {
+    return sp.stats.snapshot()
+}
+
+func (sp *ServiceProvider) ResetStatistics() {
+    sp.stats.reset()
+}
+
+func (sp *ServiceProvider) Execute(ctx context.Context, query string, parameters ...engine.Value) (*QueryResult, error) {
     start := time.Now()
-    queryId := engine.NewQueryId()
-    ctx = engine.WithQueryId(ctx, queryId)
+    ctx = engine.WithQueryId(ctx, engine.NewQueryId())
+    root, err := parseStatement(ctx, query)
+    if err != nil {
+        sp.unparsed(query, start)
+        return nil, err
+    }
+    return sp.execute(ctx, start, query, query, root, parameters)
+}
 
-    plan, symbols, err := createQueryPlan(ctx, sp.metaSvc, sp.indexSvc, query)
+func (sp *ServiceProvider) ExecuteScript(ctx context.Context, script string, continueOnError bool) ([]*StatementResult, error) {
+    start := time.Now()
+    statements, err := parser.ParseScript(script)
     if err != nil {
+        log.LogEntry(ctx).Error("Error parsing script", "error", err)
+        sp.unparsed(script, start)
         return nil, err
     }
 
-    tables := symbols.GetTableNames()
+    results := make([]*StatementResult, 0, len(statements))
+    for _, stmt := range statements {
+        stmtCtx := engine.WithQueryId(ctx, engine.NewQueryId())
+        result, err := sp.execute(stmtCtx, time.Now(), stmt.Text, script, stmt.Node, nil)
+        results = append(results, &StatementResult{Statement: stmt.Text, Result: result, Err: err})
+        if result != nil && result.Session != "" {
+            // later statements of the script run in the session a PREPARE opened
+            ctx = WithSession(ctx, result.Session)
+        }
+        if err != nil && !continueOnError {
+            break
+        }
+    }
+    return results, nil
+}
+
+// unparsed records a statement that failed to parse in the statistics, under the fingerprint of
+// its text.
+func (sp *ServiceProvider) unparsed(text string, start time.Time) {
+    e := execution{elapsed: time.Since(start), failed: true}
+    e.fingerprint, e.query = engine.FingerprintText(text)
+    sp.stats.record(e)
+}
+
+// execute runs a parsed statement, which started at start. The source is the text the statement
+// was parsed from, which the positions of its diagnostics refer to: the query itself, or the
+// script it is part of.
+//
+// Every execution, successful or not, is recorded in the statistics under the fingerprint of the
+// statement; an EXECUTE is recorded under the fingerprint of the prepared statement it runs.
+func (sp *ServiceProvider) execute(ctx context.Context, start time.Time, query, source string, root ast.VisitableNode, parameters []engine.Value) (result *QueryResult, err error) {
+    queryId := engine.QueryIdFromContext(ctx)
+
+    var scanned uint64
+    statement := root
+    defer func() {
+        e := execution{elapsed: time.Since(start), bytes: scanned, failed: err != nil}
+        e.fingerprint, e.query = engine.Fingerprint(statement)
+        if result != nil {
+            e.rows = uint64(len(result.Records))
+        }
+        sp.stats.record(e)
+    }()
+
+    var arguments []ast.ExpressionNode
+    var prepared *PreparedStatement
+    switch stmt := root.(type) {
+    case *ast.PrepareStatementNode:
+        if len(parameters) > 0 {
+            return nil, fmt.Errorf("PREPARE does not accept parameters")
+        }
+        var session string
+        if session, err = sp.prepare(ctx, stmt, source); err != nil {
+            return nil, diagnostic.WithSource(err, source)
+        }
+        return &QueryResult{Duration: time.Since(start), Records: []*engine.Record{}, Session: session}, nil
+    case *ast.DeallocateStatementNode:
+        if err := sp.deallocate(ctx, stmt); err != nil {
+            return nil, err
+        }
+        return &QueryResult{Duration: time.Since(start), Records: []*engine.Record{}}, nil
+    case *ast.ExecuteStatementNode:
+        if prepared, err = sp.lookup(ctx, stmt.Name); err != nil {
+            return nil, err
+        }
+        source, statement = prepared.Source, prepared.Statement
+        arguments = stmt.Arguments
+        if len(arguments) > 0 && len(parameters) > 0 {
+            return nil, fmt.Errorf("EXECUTE '%s' received both arguments and parameters", stmt.Name)
+        }
+    }
+
+    if len(parameters) > 0 {
+        arguments = make([]ast.ExpressionNode, len(parameters))
+        for i, parameter := range parameters {
+            if arguments[i], err = engine.ParameterLiteral(parameter); err != nil {
+                return nil, fmt.Errorf("parameter $%d: %w", i+1, err)
+            }
+        }
+    }
+
+    var logicalPlan *logical.QueryPlan
+    var tables []string
+    if prepared != nil {
+        // the plan of a prepared statement was resolved and optimized when it was prepared
+        if err = engine.CheckParameters(prepared.Parameters, arguments); err == nil {
+            logicalPlan, err = logical.BindParameters(prepared.Plan, arguments)
+        }
+        if err != nil {
+            log.LogEntry(ctx).Error("Error binding parameters", "query", query, "queryId", queryId, "error", err)
+            return nil, diagnostic.WithSource(err, source)
+        }
+        tables = prepared.Tables
+    } else {
+        if root, err = engine.BindParameters(root, arguments); err != nil {
+            log.LogEntry(ctx).Error("Error binding parameters", "query", query, "queryId", queryId, "error", err)
+            return nil, err
+        }
+        if logicalPlan, tables, err = createLogicalPlan(ctx, sp.metaSvc, query, root, start); err != nil {
+            return nil, diagnostic.WithSource(err, source)
+        }
+    }
+
+    options := append(sp.planOptions(ctx), physical.WithNow(start))
+    plan, err := createPhysicalPlan(ctx, sp.metaSvc, sp.indexSvc, query, logicalPlan, options...)
+    if err != nil {
+        return nil, diagnostic.WithSource(err, source)
+    }
+
     ctx, span := telemetry.StartSpan(ctx, "query.Execute", trace.WithAttributes(
         attribute.String("queryId", queryId),
         attribute.String("db.query.text", query),
@@ -52,6 +231,7 @@ func (sp *ServiceProvider) Execute(ctx context.Context, query string) (*QueryRes
     if err != nil {
         return nil, err
     }
+    scanned = plan.Statistics.ScannedBytes()
 
     records := make([]*engine.Record, len(results))
     for i, result := range results {
@@ -60,50 +240,121 @@ func (sp *ServiceProvider) Execute(ctx context.Context, query string) (*QueryRes
 
     return &QueryResult{
         Duration: time.Since(start),
+        Columns:  plan.Columns,
         Records:  records,
     }, nil
 }
 
-type QueryResult struct {
-    Duration time.Duration    `json:"duration"`
-    Records  []*engine.Record `json:"records"`
+// prepare resolves and optimizes the plan of a statement with its placeholders and its NOW() in
+// place, and caches it in the session under its name, replacing any statement previously prepared
+// under the same name. It returns the id of the session, which is opened first unless the context carries
+// the id of a live one.
+func (sp *ServiceProvider) prepare(ctx context.Context, stmt *ast.PrepareStatementNode, source string) (string, error) {
+    count, err := engine.ParameterCount(stmt.Statement)
+    if err != nil {
+        return "", err
+    }
+    clone, err := engine.CloneStatement(stmt.Statement)
+    if err != nil {
+        return "", err
+    }
+    plan, tables, err := createLogicalPlan(ctx, sp.metaSvc, source, clone, time.Time{})
+    if err != nil {
+        return "", err
+    }
+
+    id, s, err := sp.sessions.open(SessionFromContext(ctx))
+    if err != nil {
+        return "", err
+    }
+
+    s.put(&PreparedStatement{
+        Name:       stmt.Name,
+        Statement:  stmt.Statement,
+        Source:     source,
+        Parameters: count,
+        Plan:       plan,
+        Tables:     tables,
+    })
+    return id, nil
 }
 
-func createQueryPlan(ctx context.Context, metaSvc metastore.Service, indexSvc index.Service, query string) (*physical.QueryPlan, *metastore.SymbolTable, error) {
-    tokens, err := parser.LexicalScan(query)
+func (sp *ServiceProvider) deallocate(ctx context.Context, stmt *ast.DeallocateStatementNode) error {
+    s, err := sp.sessions.get(SessionFromContext(ctx))
     if err != nil {
-        log.LogEntry(ctx).Error("Error parsing query", "query", query, "queryId", engine.QueryIdFromContext(ctx), "error", err)
-        return nil, nil, err
+        return err
+    }
+    if !s.remove(stmt.Name) {
+        return fmt.Errorf("prepared statement '%s' does not exist", stmt.Name)
+    }
+    return nil
+}
+
+func (sp *ServiceProvider) lookup(ctx context.Context, name string) (*PreparedStatement, error) {
+    s, err := sp.sessions.get(SessionFromContext(ctx))
+    if err != nil {
+        return nil, err
     }
+    prepared, ok := s.lookup(name)
+    if !ok {
+        return nil, fmt.Errorf("prepared statement '%s' does not exist", name)
+    }
+    return prepared, nil
+}
+
+// StatementResult is the outcome of one statement of a script: its result or its error.
+type StatementResult struct {
+    Statement string
+    Result    *QueryResult
+    Err       error
+}
+
+type QueryResult struct {
+    Duration time.Duration    `json:"duration"`
+    Columns  []string         `json:"columns,omitempty"`
+    Records  []*engine.Record `json:"records"`
+    Session  string           `json:"-"` // the session a PREPARE cached its statement in
+}
 
-    ast, err := parser.New(tokens).Parse()
+func parseStatement(ctx context.Context, query string) (ast.VisitableNode, error) {
+    root, err := parser.ParseStatement(query)
     if err != nil {
         log.LogEntry(ctx).Error("Error parsing query", "query", query, "queryId", engine.QueryIdFromContext(ctx), "error", err)
-        return nil, nil, err
+        return nil, err
     }
+    return root, nil
+}
 
-    symbols, err := engine.ResolveSymbols(metaSvc, ast)
+// createLogicalPlan resolves the symbols of a statement and returns its optimized logical plan,
+// along with the tables it reads. NOW() folds to the time the statement started at, now, unless
+// now is zero.
+func createLogicalPlan(ctx context.Context, metaSvc metastore.Service, query string, root ast.VisitableNode, now time.Time) (*logical.QueryPlan, []string, error) {
+    symbols, err := engine.ResolveSymbols(metaSvc, root)
     if err != nil {
         log.LogEntry(ctx).Error("Error resolving symbols", "query", query, "queryId", engine.QueryIdFromContext(ctx), "error", err)
         return nil, nil, err
     }
 
-    plan, err := logical.NewQueryPlan(ast)
+    plan, err := logical.NewQueryPlan(root)
     if err != nil {
         log.LogEntry(ctx).Error("Error creating logical plan", "query", query, "queryId", engine.QueryIdFromContext(ctx), "error", err)
         return nil, nil, err
     }
 
-    plan, err = logical.OptimizeQueryPlan(plan)
+    plan, trace, err := logical.NewOptimizer(logical.DefaultRules(now)...).Optimize(plan)
     if err != nil {
         log.LogEntry(ctx).Error("Error optimizing logical plan", "query", query, "queryId", engine.QueryIdFromContext(ctx), "error", err)
         return nil, nil, err
     }
+    log.LogEntry(ctx).Debug("Optimized logical plan", "queryId", engine.QueryIdFromContext(ctx), "rules", trace)
+    return plan, symbols.GetTableNames(), nil
+}
 
-    phys, err := physical.NewQueryPlan(metaSvc, indexSvc, plan)
+func createPhysicalPlan(ctx context.Context, metaSvc metastore.Service, indexSvc index.Service, query string, plan *logical.QueryPlan, options ...physical.Option) (*physical.QueryPlan, error) {
+    phys, err := physical.NewQueryPlan(metaSvc, indexSvc, plan, options...)
     if err != nil {
         log.LogEntry(ctx).Error("Error creating physical plan", "query", query, "queryId", engine.QueryIdFromContext(ctx), "error", err)
-        return nil, nil, err
+        return nil, err
     }
-    return phys, symbols, nil
+    return phys, nil
 }
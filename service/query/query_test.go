@@ -2,14 +2,20 @@ package query
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/aleph-zero/flutterdb/engine"
+	"github.com/aleph-zero/flutterdb/engine/physical"
 	"github.com/aleph-zero/flutterdb/service/index"
 	"github.com/aleph-zero/flutterdb/service/metastore"
 	"github.com/stretchr/testify/require"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 )
 
 const data = "../../testdata/metastore"
@@ -20,19 +26,314 @@ func TestServiceProvider_Execute(t *testing.T) {
 	defer teardown(t)
 
 	tests := []struct {
-		query string
+		query   string
+		records int
 	}{
-		{`SELECT city, description, population FROM cities`},
+		{`SELECT city, description, population FROM cities`, 10},
+		{`SELECT city FROM cities WHERE population > 5000`, 5},
+		{`SELECT city FROM cities WHERE city = 'Osaka'`, 1},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.query, func(t *testing.T) {
-			err := service.Execute(ctx, tt.query)
+			result, err := service.Execute(ctx, tt.query)
 			require.NoError(t, err)
+			require.Len(t, result.Records, tt.records)
+		})
+	}
+}
+
+func TestServiceProvider_DivisionByZero(t *testing.T) {
+	ctx := context.Background()
+	teardown, service := setupSuite(t, data)
+	defer teardown(t)
+
+	for _, query := range []string{
+		`SELECT 1/0`,
+		`SELECT 1 % 0`,
+		`SELECT city FROM cities WHERE population > 10 % 0`,
+	} {
+		t.Run(query, func(t *testing.T) {
+			_, err := service.Execute(ctx, query)
+			require.ErrorContains(t, err, "division by zero")
+		})
+	}
+}
+
+func TestServiceProvider_PreparedStatements(t *testing.T) {
+	teardown, service := setupSuite(t, data)
+	defer teardown(t)
+
+	// a session id the server did not hand out opens a new session
+	prepared, err := service.Execute(WithSession(context.Background(), "session-1"), `PREPARE by_city AS SELECT city, population FROM cities WHERE city = $1`)
+	require.NoError(t, err)
+	require.NotEmpty(t, prepared.Session)
+	require.NotEqual(t, "session-1", prepared.Session)
+	ctx := WithSession(context.Background(), prepared.Session)
+
+	// statements are scoped to the session that prepared them
+	_, err = service.Execute(WithSession(context.Background(), "session-1"), `EXECUTE by_city('Paris')`)
+	require.ErrorContains(t, err, "session has no prepared statements")
+	_, err = service.Execute(context.Background(), `EXECUTE by_city('Paris')`)
+	require.ErrorContains(t, err, "require a session")
+
+	// preparing again in a live session keeps it
+	again, err := service.Execute(ctx, `PREPARE by_population AS SELECT city FROM cities WHERE population > $1`)
+	require.NoError(t, err)
+	require.Equal(t, prepared.Session, again.Session)
+	result, err := service.Execute(ctx, `EXECUTE by_population(8000)`)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 2)
+
+	_, err = service.Execute(ctx, `EXECUTE by_city`)
+	require.ErrorContains(t, err, "expects 1 parameter(s), received 0")
+	_, err = service.Execute(ctx, `EXECUTE by_city('Paris', 'Rome')`)
+	require.ErrorContains(t, err, "expects 1 parameter(s), received 2")
+	_, err = service.Execute(ctx, `EXECUTE by_city('Paris')`, engine.NewStringValue("Rome"))
+	require.ErrorContains(t, err, "both arguments and parameters")
+	_, err = service.Execute(ctx, `EXECUTE by_city(city)`)
+	require.ErrorContains(t, err, "must be a literal")
+
+	// the cached plan is bound anew on every execution
+	result, err = service.Execute(ctx, `EXECUTE by_city('Osaka')`)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 1)
+	require.Equal(t, "Osaka", result.Records[0].Values["city"].MustString())
+	result, err = service.Execute(ctx, `EXECUTE by_city`, engine.NewStringValue("Sydney"))
+	require.NoError(t, err)
+	require.Len(t, result.Records, 1)
+	require.Equal(t, "Sydney", result.Records[0].Values["city"].MustString())
+	result, err = service.Execute(ctx, `EXECUTE by_city('Atlantis')`)
+	require.NoError(t, err)
+	require.Empty(t, result.Records)
+
+	_, err = service.Execute(ctx, `DEALLOCATE by_city`)
+	require.NoError(t, err)
+	_, err = service.Execute(ctx, `EXECUTE by_city('Paris')`)
+	require.ErrorContains(t, err, "does not exist")
+	_, err = service.Execute(ctx, `DEALLOCATE by_city`)
+	require.ErrorContains(t, err, "does not exist")
+}
+
+func TestServiceProvider_ConcurrentExecute(t *testing.T) {
+	teardown, service := setupSuite(t, data)
+	defer teardown(t)
+
+	// the operands beside the placeholders are shared with the cached plan until bound
+	prepared, err := service.Execute(context.Background(),
+		`PREPARE by_population AS SELECT city, population * 2 FROM cities WHERE population * 2 > $1 AND (population + 1) * 3 > $2 ORDER BY population + $2`)
+	require.NoError(t, err)
+	ctx := WithSession(context.Background(), prepared.Session)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := service.Execute(ctx, `EXECUTE by_population`, engine.NewIntValue(16000), engine.NewIntValue(int64(i)))
+			if err == nil && len(result.Records) != 2 {
+				err = fmt.Errorf("expected 2 records, received %d", len(result.Records))
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestServiceProvider_PreparedNow(t *testing.T) {
+	teardown, service := setupSuite(t, data)
+	defer teardown(t)
+
+	prepared, err := service.Execute(context.Background(), `PREPARE clock AS SELECT NOW() FROM cities WHERE city = $1`)
+	require.NoError(t, err)
+	ctx := WithSession(context.Background(), prepared.Session)
+
+	// NOW() is the time of each execution, not of the PREPARE
+	var last time.Time
+	for i := 0; i < 2; i++ {
+		time.Sleep(time.Millisecond)
+		before := time.Now()
+		result, err := service.Execute(ctx, `EXECUTE clock('Osaka')`)
+		require.NoError(t, err)
+		require.Len(t, result.Records, 1)
+		now := result.Records[0].Values["NOW()"].MustTime()
+		require.False(t, now.Before(before.Truncate(time.Millisecond)))
+		require.True(t, now.After(last))
+		last = now
+	}
+}
+
+func TestServiceProvider_InvalidPreparedStatements(t *testing.T) {
+	ctx := WithSession(context.Background(), "session-1")
+	teardown, service := setupSuite(t, data)
+	defer teardown(t)
+
+	tests := []struct {
+		query string
+	}{
+		{`PREPARE q AS SELECT x FROM cities WHERE city = $1`},
+		{`PREPARE q AS SELECT city FROM towns`},
+		{`PREPARE q AS SELECT city FROM cities WHERE city = $1 OR city = ?`},
+		{`PREPARE q AS CREATE TABLE t (c KEYWORD)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := service.Execute(ctx, tt.query)
+			require.Error(t, err)
 		})
 	}
 }
 
+func TestServiceProvider_ParameterCount(t *testing.T) {
+	ctx := context.Background()
+	teardown, service := setupSuite(t, data)
+	defer teardown(t)
+
+	_, err := service.Execute(ctx, `SELECT city FROM cities WHERE population > $1 AND city = $2`, engine.NewIntValue(1000))
+	require.ErrorContains(t, err, "expects 2 parameter(s), received 1")
+	_, err = service.Execute(ctx, `SELECT city FROM cities`, engine.NewIntValue(1000))
+	require.ErrorContains(t, err, "expects 0 parameter(s), received 1")
+}
+
+func TestServiceProvider_ExecuteScript(t *testing.T) {
+	ctx := context.Background()
+	script := `
+		CREATE TABLE s1 (c1 KEYWORD, c2 INTEGER);
+		CREATE TABLE s2 (c1 KEYWORD) PARTITION BY c1;
+		CREATE TABLE s1 (c1 KEYWORD); -- already exists
+		CREATE TABLE s3 (c1 TEXT);`
+
+	t.Run("stop", func(t *testing.T) {
+		teardown, service := setupSuite(t, data)
+		defer teardown(t)
+
+		results, err := service.ExecuteScript(ctx, script, false)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		require.NoError(t, results[0].Err)
+		require.Equal(t, "CREATE TABLE s1 (c1 KEYWORD, c2 INTEGER)", results[0].Statement)
+		require.NoError(t, results[1].Err)
+		require.Error(t, results[2].Err)
+		require.Nil(t, results[2].Result)
+
+		_, err = service.Execute(ctx, `SELECT c1 FROM s3`)
+		require.ErrorContains(t, err, "s3")
+	})
+
+	t.Run("continue", func(t *testing.T) {
+		teardown, service := setupSuite(t, data)
+		defer teardown(t)
+
+		results, err := service.ExecuteScript(ctx, script, true)
+		require.NoError(t, err)
+		require.Len(t, results, 4)
+		require.Error(t, results[2].Err)
+		require.NoError(t, results[3].Err)
+		require.Equal(t, "CREATE TABLE s3 (c1 TEXT)", results[3].Statement)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		teardown, service := setupSuite(t, data)
+		defer teardown(t)
+
+		results, err := service.ExecuteScript(ctx, `
+			PREPARE by_city AS SELECT city FROM cities WHERE city = $1;
+			EXECUTE by_city('Osaka');
+			DEALLOCATE by_city`, false)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		for _, result := range results {
+			require.NoError(t, result.Err)
+		}
+		require.NotEmpty(t, results[0].Result.Session)
+		require.Len(t, results[1].Result.Records, 1)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		teardown, service := setupSuite(t, data)
+		defer teardown(t)
+
+		results, err := service.ExecuteScript(ctx, script+` CREATE TABLE`, true)
+		require.Error(t, err)
+		require.Nil(t, results)
+
+		_, err = service.Execute(ctx, `CREATE TABLE s4 (c1 TEXT); CREATE TABLE s5 (c1 TEXT)`)
+		require.Error(t, err)
+	})
+}
+
+func TestServiceProvider_Statistics(t *testing.T) {
+	ctx := context.Background()
+	teardown, service := setupSuite(t, data)
+	defer teardown(t)
+
+	for _, stmt := range []string{
+		`SELECT fingerprint FROM stat_statements WHERE calls > 5`,
+		`select fingerprint from stat_statements where calls > 10`,
+		`SELECT population FROM citys WHERE city = 'Paris'`,
+		`SELEC city FROM cities`,
+		"SELEC  city\n\tFROM cities",
+	} {
+		_, _ = service.Execute(ctx, stmt)
+	}
+	_, err := service.ExecuteScript(ctx, `SELECT city FROM cities; SELEC city`, false)
+	require.Error(t, err)
+
+	byQuery := make(map[string]*StatementStatistics)
+	for _, stats := range service.Statistics() {
+		byQuery[stats.Query] = stats
+	}
+	require.Len(t, byQuery, 4)
+
+	selected := byQuery[`SELECT fingerprint FROM stat_statements WHERE calls > $1`]
+	require.NotNil(t, selected)
+	require.Equal(t, uint64(2), selected.Calls)
+	require.Equal(t, uint64(0), selected.Errors)
+	require.Equal(t, selected.TotalTime/2, selected.MeanTime)
+	require.GreaterOrEqual(t, selected.TotalTime, selected.MaxTime)
+
+	failed := byQuery[`SELECT population FROM citys WHERE city = $1`]
+	require.NotNil(t, failed)
+	require.Equal(t, uint64(1), failed.Errors)
+
+	// statements that fail to parse are counted under their text
+	unparsed := byQuery[`SELEC city FROM cities`]
+	require.NotNil(t, unparsed)
+	require.Equal(t, uint64(2), unparsed.Calls)
+	require.Equal(t, uint64(2), unparsed.Errors)
+	script := byQuery[`SELECT city FROM cities; SELEC city`]
+	require.NotNil(t, script)
+	require.Equal(t, uint64(1), script.Errors)
+
+	result, err := service.Execute(ctx, `SELECT query, calls, rows FROM stat_statements WHERE errors = 0 ORDER BY calls DESC`)
+	require.NoError(t, err)
+	require.Len(t, result.Records, 1)
+	require.Equal(t, selected.Query, result.Records[0].Values["query"].MustString())
+	require.Equal(t, int64(2), result.Records[0].Values["calls"].MustInt())
+
+	_, err = service.Execute(ctx, `CREATE TABLE stat_statements (c1 KEYWORD)`)
+	require.ErrorContains(t, err, "system table")
+	result, err = service.Execute(ctx, `SHOW TABLES`)
+	require.NoError(t, err)
+	tables := make([]string, len(result.Records))
+	for i, record := range result.Records {
+		tables[i] = record.Values["table"].MustString()
+	}
+	require.Contains(t, tables, StatStatementsTable)
+	require.Contains(t, tables, "cities")
+	_, err = service.Execute(ctx, `SELECT query FROM stat_statements WHERE MATCH(query, 'SELECT')`)
+	require.ErrorContains(t, err, "search predicates")
+
+	service.ResetStatistics()
+	require.Empty(t, service.Statistics())
+}
+
 func setupSuite(tb testing.TB, testdata string) (func(tb testing.TB), Service) {
 	dir, err := createTempMetastore(filepath.Join(testdata, "metastore.json"))
 	if err != nil {
@@ -43,10 +344,44 @@ func setupSuite(tb testing.TB, testdata string) (func(tb testing.TB), Service) {
 	if err := metaSvc.Open(); err != nil {
 		tb.Fatal(err)
 	}
+	// the fixture names the directories the tables were created in; index them in the temporary
+	// directory instead
+	for _, table := range metaSvc.GetTables() {
+		table.Directory = filepath.Join(dir, table.TableName)
+	}
 
-	querySvc := NewService(metaSvc, index.NewService(metaSvc))
+	indexSvc := index.NewService(metaSvc)
+	if err := indexFixture(indexSvc, "cities", filepath.Join(testdata, "..", "documents", "cities-small.ndjson")); err != nil {
+		tb.Fatal(err)
+	}
+
+	querySvc := NewService(metaSvc, indexSvc)
 
-	return func(tb testing.TB) { /* no-op teardown */ }, querySvc
+	return func(tb testing.TB) {
+		require.NoError(tb, indexSvc.Close())
+		require.NoError(tb, os.RemoveAll(dir))
+	}, querySvc
+}
+
+// indexFixture indexes the newline-delimited JSON documents of a file into a table.
+func indexFixture(indexSvc index.Service, table string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var documents []*index.Document
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		fields := make(map[string]interface{})
+		if err := decoder.Decode(&fields); err != nil {
+			return err
+		}
+		documents = append(documents, &index.Document{Fields: fields})
+	}
+	_, err = indexSvc.Index(context.Background(), table, documents)
+	return err
 }
 
 func createTempMetastore(srcFile string) (string, error) {
@@ -78,3 +413,26 @@ func createTempMetastore(srcFile string) (string, error) {
 
 	return tempDir, nil
 }
+
+func TestServiceProvider_Parallelism(t *testing.T) {
+	service := &ServiceProvider{options: []physical.Option{physical.WithParallelism(2)}}
+	limit := max(2, runtime.GOMAXPROCS(0))
+
+	tests := []struct {
+		workers  int
+		expected int
+	}{
+		{1, 1},
+		{2, 2},
+		{limit, limit},
+		{limit + 1, limit},
+		{1 << 20, limit},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.workers), func(t *testing.T) {
+			config := physical.NewConfig(service.planOptions(WithParallelism(context.Background(), tt.workers))...)
+			require.Equal(t, tt.expected, config.Parallelism)
+		})
+	}
+}
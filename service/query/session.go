@@ -0,0 +1,139 @@
+package query
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine/ast"
+    "github.com/aleph-zero/flutterdb/engine/logical"
+    "sync"
+    "time"
+)
+
+// sessionIdleTimeout is how long a session, and the statements prepared in it, survive without
+// being used.
+const sessionIdleTimeout = 30 * time.Minute
+
+type sessionKey struct{}
+
+// WithSession returns a context carrying the id of the client session a statement belongs to, as
+// handed out by the server when the session was opened.
+func WithSession(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, sessionKey{}, id)
+}
+
+func SessionFromContext(ctx context.Context) string {
+    if id, ok := ctx.Value(sessionKey{}).(string); ok {
+        return id
+    }
+    return ""
+}
+
+// PreparedStatement is a statement whose optimized plan is cached with its placeholders in place,
+// and bound anew on every EXECUTE.
+type PreparedStatement struct {
+    Name       string
+    Statement  ast.VisitableNode
+    Source     string // the text the positions in the statement refer to
+    Parameters int
+    Plan       *logical.QueryPlan
+    Tables     []string // the tables the plan reads
+}
+
+type session struct {
+    mu         sync.Mutex
+    statements map[string]*PreparedStatement
+    lastUsed   time.Time
+}
+
+func (s *session) put(stmt *PreparedStatement) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.statements[stmt.Name] = stmt
+}
+
+func (s *session) lookup(name string) (*PreparedStatement, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    stmt, ok := s.statements[name]
+    return stmt, ok
+}
+
+func (s *session) remove(name string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, ok := s.statements[name]
+    delete(s.statements, name)
+    return ok
+}
+
+type sessionStore struct {
+    mu       sync.Mutex
+    sessions map[string]*session
+}
+
+func newSessionStore() *sessionStore {
+    return &sessionStore{sessions: make(map[string]*session)}
+}
+
+// get returns the session with the given id. Sessions that have been idle for longer than
+// sessionIdleTimeout are discarded first.
+func (ss *sessionStore) get(id string) (*session, error) {
+    if id == "" {
+        return nil, errors.New("prepared statements require a session")
+    }
+
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+
+    now := ss.expire()
+    s, ok := ss.sessions[id]
+    if !ok {
+        return nil, errors.New("session has no prepared statements")
+    }
+    s.lastUsed = now
+    return s, nil
+}
+
+// open returns the session with the given id, or starts a new one when the id is missing or
+// unknown. Session ids are generated by the server and never chosen by clients, so a client only
+// reaches the prepared statements of a session whose id it was handed.
+func (ss *sessionStore) open(id string) (string, *session, error) {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+
+    now := ss.expire()
+    s, ok := ss.sessions[id]
+    if !ok {
+        var err error
+        if id, err = newSessionId(); err != nil {
+            return "", nil, err
+        }
+        s = &session{statements: make(map[string]*PreparedStatement)}
+        ss.sessions[id] = s
+    }
+    s.lastUsed = now
+    return id, s, nil
+}
+
+// expire discards the sessions that have been idle for longer than sessionIdleTimeout, and
+// returns the current time. The caller must hold the lock.
+func (ss *sessionStore) expire() time.Time {
+    now := time.Now()
+    for key, s := range ss.sessions {
+        if now.Sub(s.lastUsed) > sessionIdleTimeout {
+            delete(ss.sessions, key)
+        }
+    }
+    return now
+}
+
+func newSessionId() (string, error) {
+    id := make([]byte, 16)
+    if _, err := rand.Read(id); err != nil {
+        return "", fmt.Errorf("generating session id: %w", err)
+    }
+    return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,218 @@
+package query
+
+import (
+    "context"
+    "fmt"
+    "github.com/aleph-zero/flutterdb/engine"
+    "github.com/aleph-zero/flutterdb/engine/types"
+    "github.com/aleph-zero/flutterdb/service/metastore"
+    "sort"
+    "sync"
+    "time"
+)
+
+// maxStatements bounds the number of fingerprints tracked. When a new fingerprint arrives at the
+// limit, the least called one is discarded to make room.
+const maxStatements = 5000
+
+// StatementStatistics aggregates the executions of all statements sharing a fingerprint.
+type StatementStatistics struct {
+    Fingerprint string        `json:"fingerprint"`
+    Query       string        `json:"query"` // the normalized statement
+    Calls       uint64        `json:"calls"`
+    TotalTime   time.Duration `json:"total_time"`
+    MeanTime    time.Duration `json:"mean_time"`
+    MaxTime     time.Duration `json:"max_time"`
+    Rows        uint64        `json:"rows"`
+    Bytes       uint64        `json:"bytes_scanned"`
+    Errors      uint64        `json:"errors"`
+}
+
+type statementStats struct {
+    mu         sync.Mutex
+    statements map[string]*StatementStatistics
+}
+
+func newStatementStats() *statementStats {
+    return &statementStats{statements: make(map[string]*StatementStatistics)}
+}
+
+// execution is what is recorded of a single execution of a statement.
+type execution struct {
+    fingerprint string
+    query       string
+    elapsed     time.Duration
+    rows        uint64
+    bytes       uint64
+    failed      bool
+}
+
+func (ss *statementStats) record(e execution) {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+
+    stats, ok := ss.statements[e.fingerprint]
+    if !ok {
+        if len(ss.statements) >= maxStatements {
+            ss.evict()
+        }
+        stats = &StatementStatistics{Fingerprint: e.fingerprint, Query: e.query}
+        ss.statements[e.fingerprint] = stats
+    }
+
+    stats.Calls++
+    stats.TotalTime += e.elapsed
+    stats.MaxTime = max(stats.MaxTime, e.elapsed)
+    stats.Rows += e.rows
+    stats.Bytes += e.bytes
+    if e.failed {
+        stats.Errors++
+    }
+}
+
+func (ss *statementStats) evict() {
+    var victim *StatementStatistics
+    for _, stats := range ss.statements {
+        if victim == nil || stats.Calls < victim.Calls {
+            victim = stats
+        }
+    }
+    if victim != nil {
+        delete(ss.statements, victim.Fingerprint)
+    }
+}
+
+// snapshot returns a copy of the statistics, ordered by total time, the most expensive first.
+func (ss *statementStats) snapshot() []*StatementStatistics {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+
+    snapshot := make([]*StatementStatistics, 0, len(ss.statements))
+    for _, stats := range ss.statements {
+        s := *stats
+        s.MeanTime = s.TotalTime / time.Duration(s.Calls)
+        snapshot = append(snapshot, &s)
+    }
+    sort.Slice(snapshot, func(i, j int) bool {
+        if snapshot[i].TotalTime != snapshot[j].TotalTime {
+            return snapshot[i].TotalTime > snapshot[j].TotalTime
+        }
+        return snapshot[i].Fingerprint < snapshot[j].Fingerprint
+    })
+    return snapshot
+}
+
+func (ss *statementStats) reset() {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+    clear(ss.statements)
+}
+
+/* *** stat_statements system table *** */
+
+// StatStatementsTable is the name of the system table exposing the statement statistics.
+const StatStatementsTable = "stat_statements"
+
+type statStatementsTable struct {
+    stats    *statementStats
+    metadata *metastore.TableMetadata
+}
+
+func newStatStatementsTable(stats *statementStats) *statStatementsTable {
+    columns := map[string]types.Type{
+        "fingerprint":   types.KEYWORD,
+        "query":         types.KEYWORD,
+        "calls":         types.INTEGER,
+        "total_time_ms": types.FLOAT,
+        "mean_time_ms":  types.FLOAT,
+        "max_time_ms":   types.FLOAT,
+        "rows":          types.INTEGER,
+        "bytes_scanned": types.INTEGER,
+        "errors":        types.INTEGER,
+    }
+    metadata := metastore.NewTableMetadata(StatStatementsTable, nil, "")
+    for name, typ := range columns {
+        metadata.Columns[name] = metastore.ColumnMetadata{ColumnName: name, ColumnType: typ}
+    }
+    return &statStatementsTable{stats: stats, metadata: metadata}
+}
+
+func (t *statStatementsTable) Metadata() *metastore.TableMetadata {
+    return t.metadata
+}
+
+func (t *statStatementsTable) Records(context.Context) ([]*engine.Record, error) {
+    milliseconds := func(d time.Duration) engine.Value {
+        return engine.NewFloatValue(float64(d) / float64(time.Millisecond))
+    }
+
+    snapshot := t.stats.snapshot()
+    records := make([]*engine.Record, len(snapshot))
+    for i, stats := range snapshot {
+        record := engine.NewRecord()
+        record.AddValue("fingerprint", engine.NewStringValue(stats.Fingerprint))
+        record.AddValue("query", engine.NewStringValue(stats.Query))
+        record.AddValue("calls", engine.NewIntValue(int64(stats.Calls)))
+        record.AddValue("total_time_ms", milliseconds(stats.TotalTime))
+        record.AddValue("mean_time_ms", milliseconds(stats.MeanTime))
+        record.AddValue("max_time_ms", milliseconds(stats.MaxTime))
+        record.AddValue("rows", engine.NewIntValue(int64(stats.Rows)))
+        record.AddValue("bytes_scanned", engine.NewIntValue(int64(stats.Bytes)))
+        record.AddValue("errors", engine.NewIntValue(int64(stats.Errors)))
+        records[i] = record
+    }
+    return records, nil
+}
+
+/* *** catalog *** */
+
+// catalog is the metastore as seen by queries: the tables of the metastore along with the
+// system tables, which shadow any table of the same name and cannot be created.
+type catalog struct {
+    metastore.Service
+    system map[string]engine.SystemTable
+}
+
+func newCatalog(metaSvc metastore.Service, tables ...engine.SystemTable) *catalog {
+    c := &catalog{Service: metaSvc, system: make(map[string]engine.SystemTable)}
+    for _, table := range tables {
+        c.system[table.Metadata().TableName] = table
+    }
+    return c
+}
+
+func (c *catalog) SystemTable(name string) (engine.SystemTable, bool) {
+    table, ok := c.system[name]
+    return table, ok
+}
+
+func (c *catalog) GetTable(name string) (*metastore.TableMetadata, error) {
+    if table, ok := c.system[name]; ok {
+        return table.Metadata(), nil
+    }
+    return c.Service.GetTable(name)
+}
+
+// GetTables returns the tables of the metastore followed by the system tables.
+func (c *catalog) GetTables() []*metastore.TableMetadata {
+    tables := make([]*metastore.TableMetadata, 0)
+    for _, table := range c.Service.GetTables() {
+        if _, ok := c.system[table.TableName]; !ok {
+            tables = append(tables, table)
+        }
+    }
+    for _, table := range c.system {
+        tables = append(tables, table.Metadata())
+    }
+    return tables
+}
+
+func (c *catalog) CreateTable(ctx context.Context, table *metastore.TableMetadata) error {
+    if _, ok := c.system[table.TableName]; ok {
+        return metastore.Error{
+            ErrorCode: metastore.TableExists,
+            Message:   fmt.Sprintf("table %s is a system table", table.TableName),
+        }
+    }
+    return c.Service.CreateTable(ctx, table)
+}